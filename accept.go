@@ -0,0 +1,83 @@
+package gear
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AcceptSpec represents an item of the Accept, Accept-Encoding, Accept-Charset
+// or Accept-Language request header.
+type AcceptSpec struct {
+	Value  string            // media range, content coding, charset or language tag, in lower case.
+	Q      float64           // quality value, default to 1.
+	Params map[string]string // media type parameters except "q", nil if no parameter.
+}
+
+// ParseAccept parses the value of Accept* headers, returns the AcceptSpecs sorted
+// by quality value in descending order. For Accept header, the specs with same quality
+// value are sorted by specificity: "text/html;level=1" > "text/html" > "text/*" > "*/*".
+// Otherwise the original order is kept.
+//
+//  specs := gear.ParseAccept("text/*;q=0.3, text/html;q=0.7, text/html;level=1")
+//  // []AcceptSpec{
+//  // 	{Value: "text/html", Q: 1, Params: map[string]string{"level": "1"}},
+//  // 	{Value: "text/html", Q: 0.7},
+//  // 	{Value: "text/*", Q: 0.3},
+//  // }
+//
+func ParseAccept(header string) []AcceptSpec {
+	specs := make([]AcceptSpec, 0, 4)
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		spec := AcceptSpec{Value: strings.ToLower(strings.TrimSpace(parts[0])), Q: 1}
+		if spec.Value == "" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			if key == "" {
+				continue
+			}
+			val := ""
+			if len(kv) == 2 {
+				val = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+			if key == "q" {
+				if q, err := strconv.ParseFloat(val, 64); err == nil && q >= 0 && q <= 1 {
+					spec.Q = q
+				} else {
+					spec.Q = 0
+				}
+				continue
+			}
+			if spec.Params == nil {
+				spec.Params = make(map[string]string)
+			}
+			spec.Params[key] = val
+		}
+		specs = append(specs, spec)
+	}
+
+	sort.SliceStable(specs, func(i, j int) bool {
+		if specs[i].Q != specs[j].Q {
+			return specs[i].Q > specs[j].Q
+		}
+		return specs[i].specificity() > specs[j].specificity()
+	})
+	return specs
+}
+
+func (s AcceptSpec) specificity() int {
+	switch {
+	case s.Value == "*/*" || s.Value == "*":
+		return 0
+	case strings.HasSuffix(s.Value, "/*"):
+		return 1
+	case strings.Contains(s.Value, "/"):
+		return 2 + len(s.Params)
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,50 @@
+package gear
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearParseAccept(t *testing.T) {
+	t.Run("Accept", func(t *testing.T) {
+		assert := assert.New(t)
+
+		specs := ParseAccept("text/*;q=0.3, text/html;q=0.7, text/html;level=1, */*;q=0.5, Text/Plain, application/json;charset=UTF-8")
+		assert.Equal([]AcceptSpec{
+			{Value: "text/html", Q: 1, Params: map[string]string{"level": "1"}},
+			{Value: "application/json", Q: 1, Params: map[string]string{"charset": "UTF-8"}},
+			{Value: "text/plain", Q: 1},
+			{Value: "text/html", Q: 0.7},
+			{Value: "*/*", Q: 0.5},
+			{Value: "text/*", Q: 0.3},
+		}, specs)
+	})
+
+	t.Run("Accept-Encoding and Accept-Language", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal([]AcceptSpec{
+			{Value: "gzip", Q: 1},
+			{Value: "br", Q: 1},
+			{Value: "*", Q: 0.1},
+			{Value: "compress", Q: 0},
+		}, ParseAccept("*;q=0.1, gzip, compress;q=0, br"))
+
+		assert.Equal([]AcceptSpec{
+			{Value: "zh-cn", Q: 1},
+			{Value: "zh", Q: 0.8},
+			{Value: "en", Q: 0},
+		}, ParseAccept("zh;q=0.8, zh-CN, en;q=bad"))
+	})
+
+	t.Run("empty or malformed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal([]AcceptSpec{}, ParseAccept(""))
+		assert.Equal([]AcceptSpec{
+			{Value: "text/html", Q: 1, Params: map[string]string{"a": ""}},
+			{Value: "gzip", Q: 0},
+		}, ParseAccept(" , text/html; ;a, ;q=1, gzip;q=2"))
+	})
+}
@@ -2,18 +2,18 @@ package gear
 
 import (
 	"context"
-	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/http/fcgi"
 	"net/textproto"
 	"os"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -37,10 +37,13 @@ type Renderer interface {
 type BodyParser interface {
 	// Maximum allowed size for a request body
 	MaxBytes() int64
+	// Parse parses the request body buf into body, it should not retain buf after returned,
+	// the buf is reused by other requests.
 	Parse(buf []byte, body interface{}, mediaType, charset string) error
 }
 
-// DefaultBodyParser is default BodyParser type.
+// DefaultBodyParser is default BodyParser type, it parses JSON, XML
+// and the media types registered by gear.RegisterCodec.
 // SetBodyParser used 1MB as default:
 //
 //  app.Set(gear.SetBodyParser, DefaultBodyParser(1<<20))
@@ -57,11 +60,8 @@ func (d DefaultBodyParser) Parse(buf []byte, body interface{}, mediaType, charse
 	if len(buf) == 0 {
 		return &Error{Code: http.StatusBadRequest, Msg: "request entity empty"}
 	}
-	switch mediaType {
-	case MIMEApplicationJSON:
-		return json.Unmarshal(buf, body)
-	case MIMEApplicationXML:
-		return xml.Unmarshal(buf, body)
+	if codec, ok := lookupCodec(mediaType); ok {
+		return codec.Unmarshal(buf, body)
 	}
 	return &Error{Code: http.StatusUnsupportedMediaType, Msg: "unsupported media type"}
 }
@@ -178,16 +178,38 @@ func ErrorWithStack(val interface{}, skip ...int) *Error {
 type App struct {
 	Server *http.Server
 	mds    middlewares
-
-	keys        []string
-	renderer    Renderer
-	bodyParser  BodyParser
-	compress    Compressible  // Default to nil, do not compress response content.
-	timeout     time.Duration // Default to 0, no time out.
-	logger      *log.Logger
-	onerror     func(*Context, HTTPError)
-	withContext func(*http.Request) context.Context
-	settings    map[interface{}]interface{}
+	names  []string // names of the middlewares, "" for unnamed
+
+	keys         []string
+	renderer     Renderer
+	bodyParser   BodyParser
+	compress     Compressible  // Default to nil, do not compress response content.
+	timeout      time.Duration // Default to 0, no time out.
+	logger       *log.Logger
+	onerror      func(*Context, HTTPError)
+	withContext  func(*http.Request) context.Context
+	locales      Locales
+	jsonOptions  *JSONOptions // Default to nil, use json.Marshal, or indent in "development" env.
+	onExpect     func(*Context) error
+	rawHook      func(http.ResponseWriter, *http.Request) bool
+	taskPool     *taskPool
+	grpcServer   http.Handler
+	transport    http.RoundTripper
+	autoETag     bool
+	strict       *StrictOptions
+	limits       *RequestLimits
+	pacing       *ReadPacing
+	connLimiter  *ConnLimiter
+	certs        CertificateProvider
+	keyLog       io.Writer
+	cookiePolicy *CookiePolicy
+	bufPool      *BufferPool
+	assets       *Assets
+	renderCache  *RenderCache
+	transportMu  sync.Mutex
+	settingsMu   sync.RWMutex
+	settings     map[interface{}]interface{}
+	required     []interface{}
 }
 
 // New creates an instance of App.
@@ -204,17 +226,104 @@ func New() *App {
 	app.Set(SetEnv, env)
 	app.Set(SetBodyParser, DefaultBodyParser(1<<20))
 	app.Set(SetLogger, log.New(os.Stderr, "", log.LstdFlags))
+	app.Set(SetDeferWorkers, 16)
+	app.Set(SetBufferPool, NewBufferPool())
 	return app
 }
 
 // Use uses the given middleware `handle`.
 func (app *App) Use(handle Middleware) {
-	app.mds = append(app.mds, handle)
+	app.insert(len(app.mds), "", handle)
 }
 
 // UseHandler uses a instance that implemented Handler interface.
 func (app *App) UseHandler(h Handler) {
-	app.mds = append(app.mds, h.Serve)
+	app.insert(len(app.mds), "", h.Serve)
+}
+
+// UseWhen uses the given middleware `handle` only when the app env is one of the envs.
+// The app env is checked on every request, so it doesn't matter whether SetEnv is set
+// before or after UseWhen.
+//
+//  app.UseWhen([]string{"development", "test"}, bodydump.New(bodydump.Options{Enabled: true}).Serve)
+//
+func (app *App) UseWhen(envs []string, handle Middleware) {
+	app.insert(len(app.mds), "", func(ctx *Context) error {
+		env := app.Env()
+		for _, e := range envs {
+			if e == env {
+				return handle(ctx)
+			}
+		}
+		return nil
+	})
+}
+
+// UseNamed uses the given middleware `handle` with a name, so that other middlewares can be
+// inserted before or after it by UseBefore and UseAfter. The name should be unique.
+func (app *App) UseNamed(name string, handle Middleware) {
+	app.insert(len(app.mds), name, handle)
+}
+
+// UseAt inserts the given middleware `handle` at the index of the middlewares, an optional name
+// can be given. The index should be in [0, count of the middlewares].
+//
+//  app.UseAt(0, recovery) // run first
+//
+func (app *App) UseAt(index int, handle Middleware, name ...string) {
+	if index < 0 || index > len(app.mds) {
+		panic(NewAppError(fmt.Sprintf("middleware index %d out of range [0, %d]", index, len(app.mds))))
+	}
+	app.insert(index, optionalName(name), handle)
+}
+
+// UseBefore inserts the given middleware `handle` before the middleware named target,
+// an optional name can be given. It panics if target not found. It is useful for libraries
+// that register middlewares automatically and need to guarantee the order.
+//
+//  app.UseNamed("auth", auth)
+//  app.UseBefore("auth", tracing, "tracing")
+//
+func (app *App) UseBefore(target string, handle Middleware, name ...string) {
+	app.insert(app.indexOf(target), optionalName(name), handle)
+}
+
+// UseAfter inserts the given middleware `handle` after the middleware named target,
+// an optional name can be given. It panics if target not found.
+func (app *App) UseAfter(target string, handle Middleware, name ...string) {
+	app.insert(app.indexOf(target)+1, optionalName(name), handle)
+}
+
+func (app *App) indexOf(name string) int {
+	for i, n := range app.names {
+		if n != "" && n == name {
+			return i
+		}
+	}
+	panic(NewAppError("middleware not found: " + name))
+}
+
+func (app *App) insert(index int, name string, handle Middleware) {
+	if name != "" {
+		for _, n := range app.names {
+			if n == name {
+				panic(NewAppError("middleware name exists: " + name))
+			}
+		}
+	}
+	app.mds = append(app.mds, nil)
+	copy(app.mds[index+1:], app.mds[index:])
+	app.mds[index] = handle
+	app.names = append(app.names, "")
+	copy(app.names[index+1:], app.names[index:])
+	app.names[index] = name
+}
+
+func optionalName(name []string) string {
+	if len(name) > 0 {
+		return name[0]
+	}
+	return ""
 }
 
 type appSetting uint8
@@ -257,7 +366,8 @@ const (
 	SetRenderer
 
 	// Set a timeout to for the middleware process, value should be `time.Duration`. No default.
-	// Example:
+	// Every ctx carries the deadline, 504 Gateway Timeout will be responded when it exceeded.
+	// It can be overridden for the routes by `gear.Timeout` or `ctx.SetTimeout`. Example:
 	//
 	//  app.Set(gear.SetTimeout, 3*time.Second)
 	//
@@ -269,6 +379,192 @@ const (
 	// Set a app env string to app, it can be retrieved by `ctx.Setting(gear.SetEnv)`.
 	// Default to os process "APP_ENV" or "development".
 	SetEnv
+
+	// Set a message catalog to app, it will be used by `ctx.Lang` and `ctx.T`,
+	// value should implements `gear.Locales` interface, no default value. Example:
+	//
+	//  catalog, err := gear.LoadCatalog("./locales", "en")
+	//  app.Set(gear.SetLocales, catalog)
+	//
+	SetLocales
+
+	// Set options to encode the JSON responses, it will be used by `ctx.JSON`, `ctx.JSONP`
+	// and `ctx.Negotiate`, value should be `gear.JSONOptions`. Default to indent with 2 spaces
+	// in "development" env and compact in other envs. Example:
+	//
+	//  app.Set(gear.SetJSONOptions, gear.JSONOptions{DisableHTMLEscape: true})
+	//
+	SetJSONOptions
+
+	// Set a hook to check the request with "Expect: 100-continue" header before the middlewares run,
+	// value should be `func(ctx *Context) error`, no default value. If the hook returns an error,
+	// the error will be responded without reading the request body, the client will not upload it.
+	// Otherwise "100 Continue" will be sent when the request body first read. Example:
+	//
+	//  app.Set(gear.SetExpectContinue, func(ctx *gear.Context) error {
+	//  	if ctx.Req.ContentLength > 10<<20 {
+	//  		return &gear.Error{Code: http.StatusRequestEntityTooLarge, Msg: "request entity too large"}
+	//  	}
+	//  	if ctx.Get(gear.HeaderAuthorization) == "" {
+	//  		return &gear.Error{Code: http.StatusUnauthorized, Msg: "unauthorized"}
+	//  	}
+	//  	return nil
+	//  })
+	//
+	SetExpectContinue
+
+	// Set the number of workers to run the tasks added by `ctx.Defer`, value should be `int` and greater than 0.
+	// The queue of the workers holds 64 tasks per worker, the tasks are dropped and logged when it is full.
+	// It should be set before the app serving, default to:
+	//
+	//  app.Set(gear.SetDeferWorkers, 16)
+	//
+	SetDeferWorkers
+
+	// Set a gRPC server to serve the gRPC requests on the same port, value should implements
+	// `http.Handler` interface, such as `*grpc.Server`, no default value. The HTTP/2 requests with
+	// "application/grpc" content type (or "application/grpc+proto" etc.) will be served by it directly, without
+	// the middlewares. The gRPC-Web requests ("application/grpc-web") go through the middlewares. Example:
+	//
+	//  grpcServer := grpc.NewServer()
+	//  pb.RegisterGreeterServer(grpcServer, &greeter{})
+	//  app.Set(gear.SetGRPCServer, grpcServer)
+	//  app.Error(app.ListenTLS(":443", "cert.pem", "key.pem"))
+	//
+	SetGRPCServer
+
+	// Set a http.RoundTripper to send the outbound requests of `ctx.HTTPClient`, value should implements
+	// `http.RoundTripper` interface, such as `*http.Transport`. It is shared by all the requests of the app,
+	// so the connections are pooled. Default to a `*http.Transport` like `http.DefaultTransport`. Example:
+	//
+	//  app.Set(gear.SetHTTPTransport, &http.Transport{MaxIdleConnsPerHost: 32})
+	//
+	SetHTTPTransport
+
+	// Set to true to add a content-hash ETag to the responses sent by `ctx.End` with body, such as
+	// `ctx.JSON`, `ctx.HTML` and `ctx.Render`, value should be `bool`, default to false. The GET and HEAD
+	// requests with 200 status will be responded with 304 Not Modified if the If-None-Match header matched.
+	// The response with ETag header already set will not be changed. The ETag is weak (W/ prefixed)
+	// if app setting SetCompress exists, as the hash covers the uncompressed body. Example:
+	//
+	//  app.Set(gear.SetAutoETag, true)
+	//
+	SetAutoETag
+
+	// Set options to validate the requests strictly before the middlewares run, value should be
+	// `gear.StrictOptions`, no default value. The requests with conflicting Content-Length headers,
+	// invalid header names, control characters in header values or oversized header fields will be
+	// rejected with 400 Bad Request. Note that net/http already drops the Content-Length header when
+	// the Transfer-Encoding is chunked, and unfolds the obs-fold header lines before the app runs. Example:
+	//
+	//  app.Set(gear.SetStrictRequest, gear.StrictOptions{MaxHeaderFieldSize: 4096})
+	//
+	SetStrictRequest
+
+	// Set limits to the request target and headers to bound the memory used by hostile requests,
+	// value should be `gear.RequestLimits`, no default value. The limits are checked before the
+	// middlewares run, 414 URI Too Long or 431 Request Header Fields Too Large will be responded
+	// if exceeded. The zero limit means no limit. Example:
+	//
+	//  app.Set(gear.SetRequestLimits, gear.RequestLimits{MaxURILength: 2048, MaxHeaderCount: 64, MaxHeaderSize: 4096})
+	//
+	SetRequestLimits
+
+	// Set the minimum throughput to receive the requests, value should be `gear.ReadPacing`, no default value.
+	// The connections that send the request headers or the request body (HTTP/1.x) slower than the MinRate
+	// after the Grace duration will be aborted, it protects the server from the slow-client attacks (Slowloris)
+	// in addition to the plain timeouts of app.Server. 408 Request Timeout will be responded if the body is
+	// read by `ctx.ParseBody`. It should be set before `app.Listen`, `app.ListenTLS` or `app.Start`. Example:
+	//
+	//  app.Set(gear.SetReadPacing, gear.ReadPacing{MinRate: 1024, Grace: 5 * time.Second})
+	//
+	SetReadPacing
+
+	// Set a ConnLimiter to limit the concurrent connections in total and per source IP, value should be
+	// `*gear.ConnLimiter`, no default value. It should be set before `app.Listen`, `app.ListenTLS` or
+	// `app.Start`. Example:
+	//
+	//  limiter := gear.NewConnLimiter(gear.ConnLimits{MaxConns: 10000, MaxConnsPerIP: 100})
+	//  app.Set(gear.SetConnLimiter, limiter)
+	//
+	SetConnLimiter
+
+	// Set a certificate provider to select the TLS certificate by SNI for `app.ListenTLS`, value should
+	// implements `gear.CertificateProvider` interface, such as `*gear.CertificateStore`, no default value.
+	// The certFile and keyFile of `app.ListenTLS` can be empty if it is set. Example:
+	//
+	//  store := gear.NewCertificateStore()
+	//  store.AddFile("example.com", "example.com.crt", "example.com.key")
+	//  store.AddFile("*.example.org", "example.org.crt", "example.org.key")
+	//  app.Set(gear.SetCertificates, store)
+	//  app.Error(app.ListenTLS(":443", "", ""))
+	//
+	SetCertificates
+
+	// Set a writer to log the TLS master secrets of `app.ListenTLS` in NSS key log format, value should be
+	// `io.Writer`, no default value. It can be used by Wireshark to decrypt the TLS traffic captures when
+	// debugging, and it compromises the security, so do not use it in production. In "development" env,
+	// the file of "SSLKEYLOGFILE" environment variable will be used if the setting not set. Example:
+	//
+	//  f, _ := os.OpenFile("keys.log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	//  app.Set(gear.SetKeyLogWriter, f)
+	//
+	SetKeyLogWriter
+
+	// Set a cookie policy to enforce the Secure, HttpOnly and SameSite defaults and validate the
+	// "__Host-" and "__Secure-" prefix rules on all the cookies of the responses, value should be
+	// `gear.CookiePolicy`, no default value. Example:
+	//
+	//  app.Set(gear.SetCookiePolicy, gear.CookiePolicy{
+	//  	Secure:   app.Env() == "production",
+	//  	HTTPOnly: true,
+	//  	SameSite: http.SameSiteLaxMode,
+	//  	Strict:   true,
+	//  })
+	//
+	SetCookiePolicy
+
+	// Set a BufferPool to reuse the buffers of `ctx.JSON`, `ctx.JSONP`, `ctx.ParseBody` and the response
+	// compression, value should be `*gear.BufferPool`. Its statistics can be used to tune the size classes.
+	// Default to:
+	//
+	//  app.Set(gear.SetBufferPool, gear.NewBufferPool(gear.DefaultBufferSizes...))
+	//
+	SetBufferPool
+
+	// Set the fingerprinted Assets to resolve the asset paths by `ctx.Asset`, value should be
+	// `*gear.Assets`, no default value. Example:
+	//
+	//  assets, err := gear.LoadAssets("./public", "/assets/")
+	//  app.Set(gear.SetAssets, assets)
+	//  app.UseHandler(assets)
+	//
+	SetAssets
+
+	// Set a RenderCache to cache the rendered output of `ctx.RenderCached`, value should be `*gear.RenderCache`,
+	// no default value (the output is not cached). Example:
+	//
+	//  app.Set(gear.SetRenderCache, gear.NewRenderCache(gear.RenderCacheOptions{TTL: 10 * time.Minute}))
+	//
+	SetRenderCache
+
+	// Set a hook to run on the raw request before the Context created and the middlewares (including the
+	// gRPC server) run, value should be `func(w http.ResponseWriter, r *http.Request) bool`, no default value.
+	// It is used for the ultra-cheap rejections, such as the bad hosts, the blocklisted IPs or the protocol
+	// sniffing. If the hook returns true, the request is handled by the hook and will not be processed anymore,
+	// the hook should have written the response. The "after hooks", "end hooks" and OnError hook will not run
+	// for it. Example:
+	//
+	//  app.Set(gear.SetRawHook, func(w http.ResponseWriter, r *http.Request) bool {
+	//  	if blocklist.Has(r.RemoteAddr) {
+	//  		w.Header().Set("Connection", "close")
+	//  		w.WriteHeader(http.StatusForbidden)
+	//  		return true
+	//  	}
+	//  	return false
+	//  })
+	//
+	SetRawHook
 )
 
 // Set add key/value settings to app. The settings can be retrieved by `ctx.Setting(key)`.
@@ -327,39 +623,209 @@ func (app *App) Set(key, val interface{}) {
 			if _, ok := val.(string); !ok {
 				panic(NewAppError("SetEnv setting must be string"))
 			}
+		case SetLocales:
+			if locales, ok := val.(Locales); !ok || len(locales.Languages()) == 0 {
+				panic(NewAppError("SetLocales setting must implemented gear.Locales interface with some languages"))
+			} else {
+				app.locales = locales
+			}
+		case SetJSONOptions:
+			if options, ok := val.(JSONOptions); !ok {
+				panic(NewAppError("SetJSONOptions setting must be gear.JSONOptions"))
+			} else {
+				app.jsonOptions = &options
+			}
+		case SetExpectContinue:
+			if onExpect, ok := val.(func(ctx *Context) error); !ok {
+				panic(NewAppError("SetExpectContinue setting must be func(ctx *Context) error"))
+			} else {
+				app.onExpect = onExpect
+			}
+		case SetDeferWorkers:
+			if workers, ok := val.(int); !ok || workers <= 0 {
+				panic(NewAppError("SetDeferWorkers setting must be int greater than 0"))
+			} else {
+				if app.taskPool != nil {
+					app.taskPool.stop()
+				}
+				app.taskPool = newTaskPool(app, workers)
+			}
+		case SetGRPCServer:
+			if grpcServer, ok := val.(http.Handler); !ok {
+				panic(NewAppError("SetGRPCServer setting must implemented http.Handler interface"))
+			} else {
+				app.grpcServer = grpcServer
+			}
+		case SetAutoETag:
+			if autoETag, ok := val.(bool); !ok {
+				panic(NewAppError("SetAutoETag setting must be bool"))
+			} else {
+				app.autoETag = autoETag
+			}
+		case SetStrictRequest:
+			if options, ok := val.(StrictOptions); !ok {
+				panic(NewAppError("SetStrictRequest setting must be gear.StrictOptions"))
+			} else {
+				if options.MaxHeaderFieldSize <= 0 {
+					options.MaxHeaderFieldSize = 8 << 10
+				}
+				app.strict = &options
+			}
+		case SetRequestLimits:
+			if limits, ok := val.(RequestLimits); !ok {
+				panic(NewAppError("SetRequestLimits setting must be gear.RequestLimits"))
+			} else {
+				app.limits = &limits
+			}
+		case SetReadPacing:
+			if pacing, ok := val.(ReadPacing); !ok || pacing.MinRate <= 0 {
+				panic(NewAppError("SetReadPacing setting must be gear.ReadPacing with MinRate greater than 0"))
+			} else {
+				if pacing.Grace <= 0 {
+					pacing.Grace = 5 * time.Second
+				}
+				app.pacing = &pacing
+			}
+		case SetConnLimiter:
+			if limiter, ok := val.(*ConnLimiter); !ok || limiter == nil {
+				panic(NewAppError("SetConnLimiter setting must be *gear.ConnLimiter"))
+			} else {
+				app.connLimiter = limiter
+			}
+		case SetCertificates:
+			if certs, ok := val.(CertificateProvider); !ok {
+				panic(NewAppError("SetCertificates setting must implemented gear.CertificateProvider interface"))
+			} else {
+				app.certs = certs
+			}
+		case SetKeyLogWriter:
+			if w, ok := val.(io.Writer); !ok {
+				panic(NewAppError("SetKeyLogWriter setting must be io.Writer"))
+			} else {
+				app.keyLog = w
+			}
+		case SetCookiePolicy:
+			if policy, ok := val.(CookiePolicy); !ok {
+				panic(NewAppError("SetCookiePolicy setting must be gear.CookiePolicy"))
+			} else {
+				app.cookiePolicy = &policy
+			}
+		case SetBufferPool:
+			if pool, ok := val.(*BufferPool); !ok {
+				panic(NewAppError("SetBufferPool setting must be *gear.BufferPool"))
+			} else {
+				app.bufPool = pool
+			}
+		case SetAssets:
+			if assets, ok := val.(*Assets); !ok {
+				panic(NewAppError("SetAssets setting must be *gear.Assets"))
+			} else {
+				app.assets = assets
+			}
+		case SetRenderCache:
+			if cache, ok := val.(*RenderCache); !ok {
+				panic(NewAppError("SetRenderCache setting must be *gear.RenderCache"))
+			} else {
+				app.renderCache = cache
+			}
+		case SetRawHook:
+			if hook, ok := val.(func(http.ResponseWriter, *http.Request) bool); !ok {
+				panic(NewAppError("SetRawHook setting must be func(w http.ResponseWriter, r *http.Request) bool"))
+			} else {
+				app.rawHook = hook
+			}
+		case SetHTTPTransport:
+			if transport, ok := val.(http.RoundTripper); !ok {
+				panic(NewAppError("SetHTTPTransport setting must implemented http.RoundTripper interface"))
+			} else {
+				app.transportMu.Lock()
+				app.transport = transport
+				app.transportMu.Unlock()
+			}
 		}
-		app.settings[k] = val
+		app.storeSetting(k, val)
 		return
 	}
-	app.settings[key] = val
+	app.storeSetting(key, val)
+}
+
+// jsonOpts returns the options to encode the JSON responses.
+func (app *App) jsonOpts() *JSONOptions {
+	if app.jsonOptions == nil && app.Env() == "development" {
+		return developmentJSONOptions
+	}
+	return app.jsonOptions
 }
 
 // Env returns app' env. You can set app env with `app.Set(gear.SetEnv, "dome env")`
 // Default to os process "APP_ENV" or "development".
 func (app *App) Env() string {
-	return app.settings[SetEnv].(string)
+	return app.Setting(SetEnv).(string)
 }
 
 // Listen starts the HTTP server.
 func (app *App) Listen(addr string) error {
+	if err := app.checkRequired(); err != nil {
+		return err
+	}
 	app.Server.Addr = addr
 	app.Server.ErrorLog = app.logger
 	app.Server.Handler = app
-	return app.Server.ListenAndServe()
+	if addr == "" {
+		addr = ":http"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return app.Server.Serve(app.listen(l))
 }
 
 // ListenTLS starts the HTTPS server.
 func (app *App) ListenTLS(addr, certFile, keyFile string) error {
+	if err := app.checkRequired(); err != nil {
+		return err
+	}
 	app.Server.Addr = addr
 	app.Server.ErrorLog = app.logger
 	app.Server.Handler = app
-	return app.Server.ListenAndServeTLS(certFile, keyFile)
+	if err := app.setupTLS(); err != nil {
+		return err
+	}
+	if addr == "" {
+		addr = ":https"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return app.Server.ServeTLS(app.listen(l), certFile, keyFile)
+}
+
+// ServeFCGI serves the app as a FastCGI responder on the listener, so that it can be
+// deployed behind a web server that speaks FastCGI. If l is nil, it serves on os.Stdin
+// that the web server spawned the app as a FastCGI child process.
+//
+//  l, err := net.Listen("unix", "/var/run/app.sock")
+//  if err != nil {
+//  	panic(err)
+//  }
+//  app.Error(app.ServeFCGI(l))
+//
+func (app *App) ServeFCGI(l net.Listener) error {
+	if err := app.checkRequired(); err != nil {
+		return err
+	}
+	return fcgi.Serve(l, app)
 }
 
 // Start starts a non-blocking app instance. It is useful for testing.
 // If addr omit, the app will listen on a random addr, use ServerListener.Addr() to get it.
 // The non-blocking app instance must close by ServerListener.Close().
 func (app *App) Start(addr ...string) *ServerListener {
+	if err := app.checkRequired(); err != nil {
+		panic(err)
+	}
 	laddr := "127.0.0.1:0"
 	if len(addr) > 0 && addr[0] != "" {
 		laddr = addr[0]
@@ -374,7 +840,7 @@ func (app *App) Start(addr ...string) *ServerListener {
 
 	c := make(chan error)
 	go func() {
-		c <- app.Server.Serve(l)
+		c <- app.Server.Serve(app.listen(l))
 	}()
 	return &ServerListener{l, c}
 }
@@ -387,11 +853,30 @@ func (app *App) Error(err error) {
 }
 
 func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if app.rawHook != nil && app.rawHook(w, r) {
+		return
+	}
+
+	if app.grpcServer != nil && isGRPCRequest(r) {
+		app.grpcServer.ServeHTTP(w, r)
+		return
+	}
+
+	if disarm := pacedBody(r); disarm != nil {
+		defer disarm()
+	}
+
 	ctx := NewContext(app, w, r)
+	// run deferred tasks after the response written
+	defer ctx.runDeferred()
 
 	if compressWriter := ctx.handleCompress(); compressWriter != nil {
 		defer compressWriter.Close()
 	}
+	// transform body before compress
+	defer ctx.Res.closeTransforms()
+	// abort the connection after recovered if the body is truncated by Response.SetLimit
+	defer ctx.Res.abortTruncated()
 
 	// recover panic error
 	defer func() {
@@ -407,8 +892,23 @@ func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx.ended.setTrue()
 	}()
 
+	// reject the hostile or malformed request and close the connection, the OnError hook will not run
+	if err := app.checkRequest(r); err != nil {
+		ctx.Res.ResetHeader()
+		ctx.Res.setHeader("Connection", "close")
+		ctx.respondError(err)
+		return
+	}
+
+	// check "Expect: 100-continue" before the request body read
+	var err error
+	if app.onExpect != nil && ctx.ExpectContinue() {
+		err = app.onExpect(ctx)
+	}
 	// process app middleware
-	err := app.mds.run(ctx)
+	if IsNil(err) && !ctx.Res.wroteHeader.isTrue() {
+		err = app.mds.run(ctx)
+	}
 	if ctx.Res.wroteHeader.isTrue() {
 		if !IsNil(err) {
 			app.Error(err)
@@ -431,10 +931,11 @@ func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Close closes the underlying server.
+// Close closes the underlying server and stops the workers of `ctx.Defer` after the queued tasks finished.
 // If context omit, Server.Close will be used to close immediately.
 // Otherwise Server.Shutdown will be used to close gracefully.
 func (app *App) Close(ctx ...context.Context) error {
+	defer app.taskPool.stop()
 	if len(ctx) > 0 {
 		return app.Server.Shutdown(ctx[0])
 	}
@@ -465,7 +966,7 @@ func (s *ServerListener) Wait() error {
 // WrapHandler wrap a http.Handler to Gear Middleware
 func WrapHandler(handler http.Handler) Middleware {
 	return func(ctx *Context) error {
-		handler.ServeHTTP(ctx.Res, ctx.Req)
+		handler.ServeHTTP(ctx.Res, ctx.IntoRequest())
 		return nil
 	}
 }
@@ -473,11 +974,66 @@ func WrapHandler(handler http.Handler) Middleware {
 // WrapHandlerFunc wrap a http.HandlerFunc to Gear Middleware
 func WrapHandlerFunc(fn http.HandlerFunc) Middleware {
 	return func(ctx *Context) error {
-		fn(ctx.Res, ctx.Req)
+		fn(ctx.Res, ctx.IntoRequest())
+		return nil
+	}
+}
+
+// WrapStdMiddleware wrap a standard net/http middleware to Gear Middleware.
+// If the middleware calls the next handler, the ctx will adopt the request
+// passed to next (with its context values) and the middleware process continues.
+// Otherwise the middleware is treated as responded, and the process ended.
+//
+//  app.Use(gear.WrapStdMiddleware(func(next http.Handler) http.Handler {
+//  	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//  		if r.Header.Get("X-Token") == "" {
+//  			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+//  			return
+//  		}
+//  		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "user", "admin")))
+//  	})
+//  }))
+//
+// Notice: the next handler returns immediately, the rest of the middlewares run after
+// the wrapped middleware returned, so a middleware that wraps the http.ResponseWriter
+// for the next handler will not see the response. Use ctx.After for that instead.
+func WrapStdMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(ctx *Context) error {
+		var next *http.Request
+		req := ctx.IntoRequest()
+		mw(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			next = r
+		})).ServeHTTP(ctx.Res, req)
+
+		switch {
+		case next == nil:
+			if !ctx.Res.wroteHeader.isTrue() {
+				return ctx.End(http.StatusOK)
+			}
+		case next != req:
+			ctx.Req = next
+			if c := next.Context(); c != req.Context() {
+				ctx.WithContext(c)
+			}
+		}
 		return nil
 	}
 }
 
+// isGRPCRequest reports whether r is a gRPC request, such as "application/grpc" or
+// "application/grpc+proto", but not the gRPC-Web request "application/grpc-web".
+func isGRPCRequest(r *http.Request) bool {
+	if r.ProtoMajor != 2 {
+		return false
+	}
+	ct := r.Header.Get(HeaderContentType)
+	if !strings.HasPrefix(ct, MIMEApplicationGRPC) {
+		return false
+	}
+	rest := ct[len(MIMEApplicationGRPC):]
+	return rest == "" || rest[0] == '+' || rest[0] == ';'
+}
+
 // IsNil checks if a specified object is nil or not, without Failing.
 func IsNil(val interface{}) bool {
 	if val == nil {
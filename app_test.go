@@ -1,17 +1,23 @@
 package gear
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"compress/zlib"
 	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/textproto"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -24,6 +30,12 @@ import (
 
 // ----- Test Helpers -----
 
+// TestMain runs the tests in "test" env, so the JSON responses are compact.
+func TestMain(m *testing.M) {
+	os.Setenv("APP_ENV", "test")
+	os.Exit(m.Run())
+}
+
 func EqualPtr(t *testing.T, a, b interface{}) {
 	assert.Equal(t, reflect.ValueOf(a).Pointer(), reflect.ValueOf(b).Pointer())
 }
@@ -203,6 +215,7 @@ func TestGearAppHello(t *testing.T) {
 	t.Run("should work", func(t *testing.T) {
 		assert := assert.New(t)
 
+		t.Setenv("APP_ENV", "")
 		app := New()
 		assert.Equal("development", app.Env())
 		app.Use(func(ctx *Context) error {
@@ -664,6 +677,81 @@ func TestGearWrapHandlerFunc(t *testing.T) {
 	res.Body.Close()
 }
 
+func TestGearWrapStdMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	type ctxKey string
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Auth", "checked")
+			switch r.Header.Get("X-Token") {
+			case "":
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			case "skip":
+				// do nothing
+			case "same":
+				next.ServeHTTP(w, r)
+			default:
+				r = r.WithContext(context.WithValue(r.Context(), ctxKey("user"), r.Header.Get("X-Token")))
+				r.Header.Set("X-User", "yes")
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+
+	app := New()
+	app.Use(func(ctx *Context) error {
+		ctx.SetAny("key", "val")
+		ctx.After(func() {
+			ctx.Set("X-After", "ok")
+		})
+		return nil
+	})
+	app.Use(WrapStdMiddleware(auth))
+	app.Use(func(ctx *Context) error {
+		user, _ := ctx.Value(ctxKey("user")).(string)
+		return ctx.HTML(200, user+":"+ctx.Value("key").(string)+":"+ctx.Get("X-User"))
+	})
+
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	t.Run("should continue with request from next", func(t *testing.T) {
+		req, _ := NewRequst("GET", host)
+		req.Header.Set("X-Token", "admin")
+		res, err := DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("checked", res.Header.Get("X-Auth"))
+		assert.Equal("ok", res.Header.Get("X-After"))
+		assert.Equal("admin:val:yes", PickRes(res.Text()).(string))
+
+		req, _ = NewRequst("GET", host)
+		req.Header.Set("X-Token", "same")
+		res, err = DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(":val:", PickRes(res.Text()).(string))
+	})
+
+	t.Run("should end when middleware responded", func(t *testing.T) {
+		res, err := RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal(401, res.StatusCode)
+		assert.Equal("checked", res.Header.Get("X-Auth"))
+		assert.Equal("ok", res.Header.Get("X-After"))
+		assert.Equal("Unauthorized\n", PickRes(res.Text()).(string))
+
+		req, _ := NewRequst("GET", host)
+		req.Header.Set("X-Token", "skip")
+		res, err = DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("", PickRes(res.Text()).(string))
+	})
+}
+
 func TestGearCompose(t *testing.T) {
 	assert := assert.New(t)
 
@@ -801,3 +889,328 @@ func HTTP2Transport(cert, key string) (*http2.Transport, error) {
 	transport.TLSClientConfig = tlsCfg
 	return transport, nil
 }
+
+func TestGearAppExpectContinue(t *testing.T) {
+	assert := assert.New(t)
+
+	app := New()
+	assert.Panics(func() {
+		app.Set(SetExpectContinue, func(ctx *Context) {})
+	})
+	app.Set(SetExpectContinue, func(ctx *Context) error {
+		if ctx.Req.ContentLength > 10 {
+			return &Error{Code: http.StatusRequestEntityTooLarge, Msg: "too large"}
+		}
+		if ctx.Get(HeaderAuthorization) == "" {
+			return ctx.ErrorStatus(http.StatusUnauthorized)
+		}
+		return nil
+	})
+	app.Use(func(ctx *Context) error {
+		body, err := ioutil.ReadAll(ctx.Req.Body)
+		if err != nil {
+			return err
+		}
+		return ctx.End(http.StatusOK, body)
+	})
+	srv := app.Start()
+	defer srv.Close()
+
+	request := func(length int, auth bool, body string) string {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		assert.Nil(err)
+		defer conn.Close()
+
+		header := fmt.Sprintf("POST / HTTP/1.1\r\nHost: example.com\r\nExpect: 100-continue\r\nContent-Length: %d\r\n", length)
+		if auth {
+			header += "Authorization: Bearer token\r\n"
+		}
+		_, err = conn.Write([]byte(header + "\r\n"))
+		assert.Nil(err)
+
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		assert.Nil(err)
+		if !strings.HasPrefix(line, "HTTP/1.1 100") {
+			return line
+		}
+		reader.ReadString('\n') // read the empty line
+		conn.Write([]byte(body))
+		res, err := http.ReadResponse(reader, nil)
+		assert.Nil(err)
+		buf, _ := ioutil.ReadAll(res.Body)
+		return line + res.Status + " " + string(buf)
+	}
+
+	assert.Equal("HTTP/1.1 413 Request Entity Too Large\r\n", request(100, true, ""))
+	assert.Equal("HTTP/1.1 401 Unauthorized\r\n", request(5, false, ""))
+	assert.Equal("HTTP/1.1 100 Continue\r\n200 OK hello", request(5, true, "hello"))
+
+	// should not run hook without Expect header
+	res, err := RequestBy("POST", "http://"+srv.Addr().String())
+	assert.Nil(err)
+	assert.Equal(200, res.StatusCode)
+	res.Body.Close()
+
+	ctx := CtxTest(app, "POST", "http://example.com/foo", strings.NewReader("hello"))
+	assert.False(ctx.ExpectContinue())
+	ctx.Req.Header.Set(HeaderExpect, "100-Continue")
+	assert.True(ctx.ExpectContinue())
+	ctx.Req.ContentLength = 0
+	assert.False(ctx.ExpectContinue())
+}
+
+func TestGearAppRawHook(t *testing.T) {
+	assert := assert.New(t)
+
+	count := 0
+	app := New()
+	assert.Panics(func() {
+		app.Set(SetRawHook, func(w http.ResponseWriter, r *http.Request) {})
+	})
+	app.Set(SetRawHook, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Host == "evil.com" {
+			w.WriteHeader(http.StatusMisdirectedRequest)
+			return true
+		}
+		return false
+	})
+	app.Use(func(ctx *Context) error {
+		ctx.OnEnd(func() {
+			count++
+		})
+		return ctx.HTML(200, "OK")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	req, _ := NewRequst("GET", host)
+	req.Host = "evil.com"
+	res, err := DefaultClient.Do(req)
+	assert.Nil(err)
+	assert.Equal(http.StatusMisdirectedRequest, res.StatusCode)
+	res.Body.Close()
+	assert.Equal(0, count)
+
+	res2, err := RequestBy("GET", host)
+	assert.Nil(err)
+	assert.Equal(200, res2.StatusCode)
+	assert.Equal("OK", PickRes(res2.Text()).(string))
+	assert.Equal(1, count)
+}
+
+func TestGearAppServeFCGI(t *testing.T) {
+	assert := assert.New(t)
+
+	app := New()
+	app.Use(func(ctx *Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		ctx.Set("X-Path", ctx.Path)
+		return ctx.HTML(200, ctx.Method+" "+ctx.Query("q")+" "+string(body))
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	c := make(chan error, 1)
+	go func() {
+		c <- app.ServeFCGI(l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(err)
+	defer conn.Close()
+
+	// write FastCGI records: https://fast-cgi.github.io/spec
+	record := func(typ byte, content []byte) {
+		header := []byte{1, typ, 0, 1, 0, 0, 0, 0}
+		binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+		conn.Write(append(header, content...))
+	}
+	var params bytes.Buffer
+	for _, kv := range [][2]string{
+		{"REQUEST_METHOD", "POST"},
+		{"SERVER_PROTOCOL", "HTTP/1.1"},
+		{"REQUEST_URI", "/fcgi?q=1"},
+		{"HTTP_HOST", "example.com"},
+		{"CONTENT_LENGTH", "5"},
+	} {
+		params.Write([]byte{byte(len(kv[0])), byte(len(kv[1]))})
+		params.WriteString(kv[0] + kv[1])
+	}
+	record(1, []byte{0, 1, 0, 0, 0, 0, 0, 0}) // FCGI_BEGIN_REQUEST, role responder
+	record(4, params.Bytes())                // FCGI_PARAMS
+	record(4, nil)
+	record(5, []byte("hello")) // FCGI_STDIN
+	record(5, nil)
+
+	var stdout bytes.Buffer
+	reader := bufio.NewReader(conn)
+	for {
+		header := make([]byte, 8)
+		_, err := io.ReadFull(reader, header)
+		assert.Nil(err)
+		content := make([]byte, int(binary.BigEndian.Uint16(header[4:]))+int(header[6]))
+		_, err = io.ReadFull(reader, content)
+		assert.Nil(err)
+		if header[1] == 3 { // FCGI_END_REQUEST
+			break
+		}
+		if header[1] == 6 { // FCGI_STDOUT
+			stdout.Write(content[:binary.BigEndian.Uint16(header[4:])])
+		}
+	}
+
+	// CGI response: header lines with "Status", then body
+	tp := textproto.NewReader(bufio.NewReader(&stdout))
+	header, err := tp.ReadMIMEHeader()
+	assert.Nil(err)
+	assert.Equal("200 OK", header.Get("Status"))
+	assert.Equal("/fcgi", header.Get("X-Path"))
+	body, _ := ioutil.ReadAll(tp.R)
+	assert.Equal("POST 1 hello", string(body))
+
+	l.Close()
+	assert.NotNil(<-c)
+}
+
+func TestGearAppSetGRPCServer(t *testing.T) {
+	assert := assert.New(t)
+
+	app := New()
+	assert.Panics(func() {
+		app.Set(SetGRPCServer, "grpc")
+	})
+	app.Set(SetGRPCServer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, MIMEApplicationGRPC)
+		w.Header().Set("Grpc-Status", "0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	app.Use(func(ctx *Context) error {
+		return ctx.HTML(http.StatusOK, "gear")
+	})
+
+	request := func(protoMajor int, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://example.com/helloworld.Greeter/SayHello", nil)
+		req.ProtoMajor = protoMajor
+		req.Header.Set(HeaderContentType, contentType)
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+		return res
+	}
+
+	res := request(2, MIMEApplicationGRPC)
+	assert.Equal(200, res.Code)
+	assert.Equal("0", res.Header().Get("Grpc-Status"))
+	assert.Equal("", res.Body.String())
+
+	res = request(2, MIMEApplicationGRPC+"+proto")
+	assert.Equal("0", res.Header().Get("Grpc-Status"))
+
+	res = request(1, MIMEApplicationGRPC)
+	assert.Equal("", res.Header().Get("Grpc-Status"))
+	assert.Equal("gear", res.Body.String())
+
+	res = request(2, MIMEApplicationGRPC+"; charset=utf-8")
+	assert.Equal("0", res.Header().Get("Grpc-Status"))
+
+	res = request(2, MIMEApplicationJSON)
+	assert.Equal("", res.Header().Get("Grpc-Status"))
+	assert.Equal("gear", res.Body.String())
+
+	for _, ct := range []string{"application/grpc-web", "application/grpc-web-text", "application/grpc-web+proto"} {
+		res = request(2, ct)
+		assert.Equal("", res.Header().Get("Grpc-Status"))
+		assert.Equal("gear", res.Body.String())
+	}
+
+	srv := httptest.NewUnstartedServer(app)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL+"/helloworld.Greeter/SayHello", nil)
+	req.Header.Set(HeaderContentType, "application/grpc-web+proto")
+	r, err := srv.Client().Do(req)
+	assert.Nil(err)
+	assert.Equal("HTTP/2.0", r.Proto)
+	assert.Equal("", r.Header.Get("Grpc-Status"))
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	assert.Equal("gear", string(body))
+}
+
+func TestGearAppUseWhen(t *testing.T) {
+	assert := assert.New(t)
+
+	app := New()
+	app.UseWhen([]string{"development", "test"}, func(ctx *Context) error {
+		ctx.Set("X-Debug", ctx.Setting(SetEnv).(string))
+		return nil
+	})
+	app.Use(func(ctx *Context) error {
+		return ctx.HTML(http.StatusOK, "gear")
+	})
+
+	request := func(env string) *httptest.ResponseRecorder {
+		app.Set(SetEnv, env)
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, httptest.NewRequest("GET", "http://example.com/", nil))
+		return res
+	}
+
+	res := request("development")
+	assert.Equal("development", res.Header().Get("X-Debug"))
+	assert.Equal("gear", res.Body.String())
+	res = request("test")
+	assert.Equal("test", res.Header().Get("X-Debug"))
+	res = request("production")
+	assert.Equal("", res.Header().Get("X-Debug"))
+	assert.Equal("gear", res.Body.String())
+}
+
+func TestGearAppUseAt(t *testing.T) {
+	assert := assert.New(t)
+
+	mark := func(name string) Middleware {
+		return func(ctx *Context) error {
+			ctx.Res.Header().Add("X-Mark", name)
+			return nil
+		}
+	}
+
+	app := New()
+	app.Use(mark("a"))
+	app.UseNamed("auth", mark("auth"))
+	app.Use(mark("b"))
+	app.UseBefore("auth", mark("tracing"), "tracing")
+	app.UseAfter("auth", mark("session"))
+	app.UseAfter("tracing", mark("metrics"))
+	app.UseAt(0, mark("recovery"))
+	app.UseAt(7, mark("end"), "end")
+	app.Use(func(ctx *Context) error {
+		return ctx.End(204)
+	})
+
+	assert.Panics(func() {
+		app.UseNamed("auth", mark("auth"))
+	})
+	assert.Panics(func() {
+		app.UseBefore("none", mark("none"))
+	})
+	assert.Panics(func() {
+		app.UseAfter("", mark("none"))
+	})
+	assert.Panics(func() {
+		app.UseAt(-1, mark("none"))
+	})
+	assert.Panics(func() {
+		app.UseAt(100, mark("none"))
+	})
+
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, httptest.NewRequest("GET", "http://example.com/", nil))
+	assert.Equal(204, res.Code)
+	assert.Equal([]string{"recovery", "a", "tracing", "metrics", "auth", "session", "b", "end"},
+		res.Header()["X-Mark"])
+}
@@ -0,0 +1,173 @@
+package gear
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Assets is the fingerprinted static assets, the files are served under the content-hashed
+// URL paths (such as "/assets/js/app.3f2a9c1d0b.js") with immutable caching, so that a new
+// version of a file always has a new URL. The logical names (such as "js/app.js") are resolved
+// to the hashed paths by Assets.Path, ctx.Asset or the "asset" template function.
+//
+//  assets, err := gear.LoadAssets("./public", "/assets/")
+//  if err != nil {
+//  	panic(err)
+//  }
+//  app.Set(gear.SetAssets, assets)
+//  app.UseHandler(assets)
+//
+//  renderer, err := gear.LoadTemplates("./views", ".html", assets.FuncMap())
+//  // in the templates: <script src="{{asset "js/app.js"}}"></script>
+//
+type Assets struct {
+	prefix string
+	paths  map[string]string // logical name -> hashed name
+	files  map[string]string // hashed name -> file path
+}
+
+// LoadAssets hashes the files in the dir and its sub directories, the files are served under
+// the URL prefix (such as "/assets/") with the hashed names. The logical name is the file path
+// relative to the dir, separated by "/".
+func LoadAssets(dir, prefix string) (*Assets, error) {
+	a := newAssets(prefix)
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(dir, file)
+		name = filepath.ToSlash(name)
+		a.add(name, hashedName(name, sum), file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// LoadAssetManifest creates Assets from a build manifest, so that the files fingerprinted by
+// the frontend build tools are served without hashing at startup. The manifest is a JSON object
+// of the logical names to the hashed names, both are relative to the dir:
+//
+//  {"js/app.js": "js/app.3f2a9c1d.js", "css/app.css": "css/app.9b8e7f6a.css"}
+//
+func LoadAssetManifest(dir, prefix, manifest string) (*Assets, error) {
+	buf, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var names map[string]string
+	if err = json.Unmarshal(buf, &names); err != nil {
+		return nil, err
+	}
+	a := newAssets(prefix)
+	for name, hashed := range names {
+		file := filepath.Join(dir, filepath.FromSlash(hashed))
+		if _, err = os.Stat(file); err != nil {
+			return nil, err
+		}
+		a.add(name, hashed, file)
+	}
+	return a, nil
+}
+
+func newAssets(prefix string) *Assets {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Assets{prefix: prefix, paths: make(map[string]string), files: make(map[string]string)}
+}
+
+func (a *Assets) add(name, hashed, file string) {
+	a.paths[name] = hashed
+	a.files[hashed] = file
+}
+
+// Path returns the hashed URL path of the logical name, the unknown name is returned with
+// the prefix but not hashed.
+func (a *Assets) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashed, ok := a.paths[name]; ok {
+		return a.prefix + hashed
+	}
+	return a.prefix + name
+}
+
+// FuncMap returns the template functions of the Assets, includes "asset" to resolve the logical
+// name to the hashed URL path. It can be used with LoadTemplates.
+func (a *Assets) FuncMap() template.FuncMap {
+	return template.FuncMap{"asset": a.Path}
+}
+
+// Serve implemented gear.Handler interface, it serves the GET and HEAD requests of the hashed
+// URL paths with "Cache-Control: public, max-age=31536000, immutable" header.
+// The other requests will go through.
+func (a *Assets) Serve(ctx *Context) error {
+	if ctx.Method != http.MethodGet && ctx.Method != http.MethodHead {
+		return nil
+	}
+	if !strings.HasPrefix(ctx.Path, a.prefix) {
+		return nil
+	}
+	file, ok := a.files[ctx.Path[len(a.prefix):]]
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	ctx.Set(HeaderCacheControl, "public, max-age=31536000, immutable")
+	http.ServeContent(ctx.Res, ctx.Req, info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// Asset returns the hashed URL path of the asset by the logical name with the app setting
+// SetAssets, the name is returned as is if no SetAssets.
+func (ctx *Context) Asset(name string) string {
+	if ctx.app.assets == nil {
+		return name
+	}
+	return ctx.app.assets.Path(name)
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:10], nil
+}
+
+// hashedName inserts the hash before the extension: "js/app.js" -> "js/app.3f2a9c1d0b.js".
+func hashedName(name, sum string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + sum + ext
+}
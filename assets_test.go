@@ -0,0 +1,102 @@
+package gear
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearAssets(t *testing.T) {
+	t.Run("should hash and serve the files", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := LoadAssets("./testdata/none", "/assets/")
+		assert.NotNil(err)
+
+		assets, err := LoadAssets("./testdata", "assets")
+		assert.Nil(err)
+		css := assets.Path("hello.css")
+		assert.True(strings.HasPrefix(css, "/assets/hello."))
+		assert.True(strings.HasSuffix(css, ".css"))
+		assert.Equal(len("/assets/hello.0123456789.css"), len(css))
+		assert.Equal(css, assets.Path("/hello.css"))
+		assert.True(strings.HasPrefix(assets.Path("locales/en.json"), "/assets/locales/en."))
+		assert.Equal("/assets/none.js", assets.Path("none.js"))
+
+		app := New()
+		assert.Panics(func() {
+			app.Set(SetAssets, "assets")
+		})
+		app.Set(SetAssets, assets)
+		app.UseHandler(assets)
+		app.Use(func(ctx *Context) error {
+			return ctx.HTML(200, ctx.Asset("hello.css"))
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("GET", host+css)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("public, max-age=31536000, immutable", res.Header.Get(HeaderCacheControl))
+		assert.Equal("text/css; charset=utf-8", res.Header.Get(HeaderContentType))
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		file, _ := ioutil.ReadFile("./testdata/hello.css")
+		assert.Equal(file, body)
+
+		res, err = RequestBy("HEAD", host+css)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+
+		for _, path := range []string{"/assets/hello.css", "/hello.css", "/x"} {
+			res, err = RequestBy("GET", host+path)
+			assert.Nil(err)
+			assert.Equal(css, PickRes(res.Text()).(string))
+			res.Body.Close()
+		}
+
+		res, err = RequestBy("POST", host+css)
+		assert.Nil(err)
+		assert.Equal(css, PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		ctx := CtxTest(New(), "GET", "http://example.com", nil)
+		assert.Equal("hello.css", ctx.Asset("hello.css"))
+	})
+
+	t.Run("should work with the manifest and templates", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dir := t.TempDir()
+		manifest := filepath.Join(dir, "manifest.json")
+		ioutil.WriteFile(filepath.Join(dir, "app.abc123.js"), []byte("app"), 0644)
+		ioutil.WriteFile(manifest, []byte(`{"app.js": "app.abc123.js"}`), 0644)
+
+		assets, err := LoadAssetManifest(dir, "/static/", manifest)
+		assert.Nil(err)
+		assert.Equal("/static/app.abc123.js", assets.Path("app.js"))
+
+		tpl := template.Must(template.New("").Funcs(assets.FuncMap()).Parse(`<script src="{{asset "app.js"}}"></script>`))
+		buf := new(bytes.Buffer)
+		assert.Nil(tpl.Execute(buf, nil))
+		assert.Equal(`<script src="/static/app.abc123.js"></script>`, buf.String())
+
+		_, err = LoadAssetManifest(dir, "/static/", filepath.Join(dir, "none.json"))
+		assert.NotNil(err)
+		ioutil.WriteFile(manifest, []byte(`{"app.js": 1}`), 0644)
+		_, err = LoadAssetManifest(dir, "/static/", manifest)
+		assert.NotNil(err)
+		ioutil.WriteFile(manifest, []byte(`{"app.js": "app.js"}`), 0644)
+		_, err = LoadAssetManifest(dir, "/static/", manifest)
+		assert.True(os.IsNotExist(err))
+	})
+}
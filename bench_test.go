@@ -1,8 +1,15 @@
 package gear_test
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/teambition/gear"
 )
@@ -36,3 +43,86 @@ func BenchmarkGearAppHello(b *testing.B) {
 		res.Body.Close()
 	}
 }
+
+// go test -bench=BenchmarkGearAppFile -run none
+// BenchmarkGearAppFile/sendfile	     100	   2581860 ns/op	3249.06 MB/s	    7400 B/op	      94 allocs/op
+// BenchmarkGearAppFile/copy    	     100	   3641973 ns/op	2303.31 MB/s	    9729 B/op	     348 allocs/op
+//
+func BenchmarkGearAppFile(b *testing.B) {
+	file, err := ioutil.TempFile("", "gear-bench")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(file.Name())
+	size := int64(8 << 20)
+	if _, err = file.Write(bytes.Repeat([]byte("0123456789abcdef"), int(size/16))); err != nil {
+		panic(err)
+	}
+	file.Close()
+
+	app := gear.New()
+	app.Use(func(ctx *gear.Context) error {
+		f, err := os.Open(file.Name())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if ctx.Query("copy") != "" {
+			// hide the *os.File to send through userspace buffers
+			return ctx.Stream(200, gear.MIMEOctetStream, struct{ io.Reader }{f})
+		}
+		return ctx.Content(gear.MIMEOctetStream, time.Time{}, f, size)
+	})
+	srv := app.Start()
+	defer srv.Close()
+
+	bench := func(url string) func(b *testing.B) {
+		return func(b *testing.B) {
+			b.SetBytes(size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				res, err := http.Get(url)
+				if err != nil {
+					panic(err)
+				}
+				io.Copy(ioutil.Discard, res.Body)
+				res.Body.Close()
+			}
+		}
+	}
+	url := "http://" + srv.Addr().String()
+	b.Run("sendfile", bench(url))
+	b.Run("copy", bench(url+"?copy=1"))
+}
+
+// go test -bench=BenchmarkGearContextEnd -run none
+// BenchmarkGearContextEnd/html 	  200000	      7940 ns/op	    2425 B/op	      19 allocs/op
+// BenchmarkGearContextEnd/json 	  200000	      9256 ns/op	    2698 B/op	      23 allocs/op
+// BenchmarkGearContextEnd/error	  200000	      4091 ns/op	    2512 B/op	      20 allocs/op
+//
+func BenchmarkGearContextEnd(b *testing.B) {
+	app := gear.New()
+	app.Set(gear.SetLogger, log.New(ioutil.Discard, "", 0))
+	app.Use(func(ctx *gear.Context) error {
+		switch ctx.Path {
+		case "/json":
+			return ctx.JSON(200, map[string]int{"a": 1})
+		case "/error":
+			return &gear.Error{Code: 400, Msg: "bad request"}
+		}
+		return ctx.HTML(200, "<h1>Hello!</h1>")
+	})
+
+	bench := func(path string) func(b *testing.B) {
+		return func(b *testing.B) {
+			req := httptest.NewRequest("GET", path, nil)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				app.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		}
+	}
+	b.Run("html", bench("/html"))
+	b.Run("json", bench("/json"))
+	b.Run("error", bench("/error"))
+}
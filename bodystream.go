@@ -0,0 +1,95 @@
+package gear
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// ParseBodyStream decodes the JSON request body incrementally with the json.Decoder in fn,
+// so that a huge body can be processed without reading all of it into memory. The body is
+// limited by the BodyParser's MaxBytes as ctx.ParseBody. The malformed body is responded with
+// 400 and the body exceeding the limit with 413, other errors returned by fn are returned as is.
+//
+//  err := ctx.ParseBodyStream(func(dec *json.Decoder) error {
+//  	var body Body
+//  	dec.DisallowUnknownFields()
+//  	return dec.Decode(&body)
+//  })
+//
+func (ctx *Context) ParseBodyStream(fn func(dec *json.Decoder) error) error {
+	if ctx.app.bodyParser == nil {
+		return ErrBodyParserNotRegistered
+	}
+	if ctx.Req.Body == nil {
+		return ErrMissingRequestBody
+	}
+
+	mediaType := ctx.Get(HeaderContentType)
+	if mediaType != "" {
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+	}
+	if !isJSONMediaType(mediaType) {
+		return &Error{Code: http.StatusUnsupportedMediaType, Msg: "unsupported media type"}
+	}
+
+	reader := http.MaxBytesReader(ctx.Res, ctx.Req.Body, ctx.app.bodyParser.MaxBytes())
+	return parseStreamError(fn(json.NewDecoder(reader)))
+}
+
+// ParseBodyArray iterates the elements of a JSON array request body, fn is called for each
+// element and should decode it with dec.Decode, so that the elements are processed one by one.
+// It works as ctx.ParseBodyStream.
+//
+//  err := ctx.ParseBodyArray(func(dec *json.Decoder) error {
+//  	var user User
+//  	if err := dec.Decode(&user); err != nil {
+//  		return err
+//  	}
+//  	return db.Insert(&user)
+//  })
+//
+func (ctx *Context) ParseBodyArray(fn func(dec *json.Decoder) error) error {
+	return ctx.ParseBodyStream(func(dec *json.Decoder) error {
+		if t, err := dec.Token(); err != nil {
+			return err
+		} else if t != json.Delim('[') {
+			return &Error{Code: http.StatusBadRequest, Msg: "request entity should be a JSON array"}
+		}
+		for dec.More() {
+			offset := dec.InputOffset()
+			if err := fn(dec); err != nil {
+				return err
+			}
+			if dec.InputOffset() == offset {
+				return NewAppError("the array element is not decoded")
+			}
+		}
+		if _, err := dec.Token(); err != nil { // the closing ']'
+			return err
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return &Error{Code: http.StatusBadRequest, Msg: "invalid data after the JSON array"}
+		}
+		return nil
+	})
+}
+
+func parseStreamError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case err == io.EOF:
+		return &Error{Code: http.StatusBadRequest, Msg: "request entity empty"}
+	case errors.As(err, &maxBytesErr):
+		return &Error{Code: http.StatusRequestEntityTooLarge, Msg: err.Error()}
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), err == io.ErrUnexpectedEOF:
+		return &Error{Code: http.StatusBadRequest, Msg: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package gear
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextParseBodyStream(t *testing.T) {
+	type item struct {
+		ID int `json:"id"`
+	}
+
+	newApp := func(array bool) *ServerListener {
+		app := New()
+		app.Set(SetBodyParser, DefaultBodyParser(100))
+		app.Use(func(ctx *Context) error {
+			var ids []string
+			var err error
+			if array {
+				err = ctx.ParseBodyArray(func(dec *json.Decoder) error {
+					var v item
+					if err := dec.Decode(&v); err != nil {
+						return err
+					}
+					if v.ID < 0 {
+						return &Error{Code: http.StatusUnprocessableEntity, Msg: "invalid id"}
+					}
+					ids = append(ids, strconv.Itoa(v.ID))
+					return nil
+				})
+			} else {
+				err = ctx.ParseBodyStream(func(dec *json.Decoder) error {
+					var v item
+					dec.DisallowUnknownFields()
+					if err := dec.Decode(&v); err != nil {
+						return err
+					}
+					ids = append(ids, strconv.Itoa(v.ID))
+					return nil
+				})
+			}
+			if err != nil {
+				return err
+			}
+			return ctx.HTML(200, strings.Join(ids, ","))
+		})
+		return app.Start()
+	}
+
+	post := func(srv *ServerListener, contentType, body string) (int, string) {
+		req, _ := http.NewRequest("POST", "http://"+srv.Addr().String(), strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set(HeaderContentType, contentType)
+		}
+		r, err := DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		res := &GearResponse{r}
+		defer res.Body.Close()
+		return res.StatusCode, PickRes(res.Text()).(string)
+	}
+
+	t.Run("should decode the body stream", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(false)
+		defer srv.Close()
+
+		code, body := post(srv, MIMEApplicationJSON, `{"id":1}`)
+		assert.Equal(200, code)
+		assert.Equal("1", body)
+
+		code, _ = post(srv, MIMEApplicationJSON, `{"id":1,"x":1}`)
+		assert.Equal(500, code)
+		code, _ = post(srv, MIMEApplicationJSON, `{"id":"1"}`)
+		assert.Equal(400, code)
+		code, body = post(srv, MIMEApplicationJSON, ``)
+		assert.Equal(400, code)
+		assert.Equal("request entity empty", body)
+		code, _ = post(srv, MIMEApplicationXML, `<id>1</id>`)
+		assert.Equal(415, code)
+		code, _ = post(srv, "", `{"id":1}`)
+		assert.Equal(415, code)
+	})
+
+	t.Run("should iterate the array elements", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(true)
+		defer srv.Close()
+
+		code, body := post(srv, MIMEApplicationJSONCharsetUTF8, ` [{"id":1}, {"id":2},{"id":3}] `)
+		assert.Equal(200, code)
+		assert.Equal("1,2,3", body)
+
+		code, body = post(srv, "application/vnd.api+json", `[]`)
+		assert.Equal(200, code)
+		assert.Equal("", body)
+
+		code, body = post(srv, MIMEApplicationJSON, `[{"id":1},{"id":-1}]`)
+		assert.Equal(422, code)
+		assert.Equal("invalid id", body)
+
+		code, body = post(srv, MIMEApplicationJSON, `{"id":1}`)
+		assert.Equal(400, code)
+		assert.Equal("request entity should be a JSON array", body)
+
+		for _, s := range []string{`[{"id":1}`, `[{"id":1},]`, `[{"id":1}] x`, `[{"id":1}] []`} {
+			code, _ = post(srv, MIMEApplicationJSON, s)
+			assert.Equal(400, code, s)
+		}
+
+		code, _ = post(srv, MIMEApplicationJSON, "["+strings.Repeat(`{"id":1},`, 20)+`{"id":1}]`)
+		assert.Equal(413, code)
+	})
+
+	t.Run("should check the element decoded", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			return ctx.ParseBodyArray(func(dec *json.Decoder) error {
+				return nil
+			})
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		code, body := post(srv, MIMEApplicationJSON, `[1]`)
+		assert.Equal(500, code)
+		assert.Equal("Gear: the array element is not decoded", body)
+	})
+
+	t.Run("should return the errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		ctx := CtxTest(app, "POST", "http://example.com", nil)
+		ctx.Req.Body = nil
+		assert.Equal(ErrMissingRequestBody, ctx.ParseBodyStream(nil))
+
+		app.bodyParser = nil
+		assert.Equal(ErrBodyParserNotRegistered, ctx.ParseBodyArray(nil))
+
+		err := errors.New("some error")
+		assert.Equal(err, parseStreamError(err))
+	})
+}
@@ -0,0 +1,78 @@
+package gear
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Predicate reports whether a condition is satisfied for the request,
+// it is used by If, Unless and Branch.
+type Predicate func(ctx *Context) bool
+
+// If composes the middlewares to one middleware that runs only when pred returns true.
+//
+//  app.Use(gear.If(gear.PathPrefix("/api"), auth, rateLimit))
+//
+func If(pred Predicate, mds ...Middleware) Middleware {
+	return Branch(pred, Compose(mds...), noOp)
+}
+
+// Unless composes the middlewares to one middleware that runs only when pred returns false.
+//
+//  app.Use(gear.Unless(gear.PathPrefix("/health", "/metrics"), logger.Serve))
+//
+func Unless(pred Predicate, mds ...Middleware) Middleware {
+	return Branch(pred, noOp, Compose(mds...))
+}
+
+// Branch returns a middleware that runs then when pred returns true, otherwise runs otherwise.
+// Use Compose to run a middleware chain.
+//
+//  app.Use(gear.Branch(gear.HeaderEquals(gear.HeaderAccept, gear.MIMEApplicationJSON),
+//  	gear.Compose(apiAuth, apiErrors),
+//  	gear.Compose(sessionAuth, htmlErrors),
+//  ))
+//
+func Branch(pred Predicate, then, otherwise Middleware) Middleware {
+	return func(ctx *Context) error {
+		if pred(ctx) {
+			return then(ctx)
+		}
+		return otherwise(ctx)
+	}
+}
+
+// PathPrefix returns a Predicate that reports whether the request path has one of the prefixes.
+func PathPrefix(prefixes ...string) Predicate {
+	return func(ctx *Context) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ctx.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MethodIs returns a Predicate that reports whether the request method is one of the methods.
+func MethodIs(methods ...string) Predicate {
+	return func(ctx *Context) bool {
+		for _, method := range methods {
+			if ctx.Method == method {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HeaderEquals returns a Predicate that reports whether the request header value equals value,
+// if value is empty, it reports whether the header exists.
+func HeaderEquals(key, value string) Predicate {
+	return func(ctx *Context) bool {
+		if value == "" {
+			return len(ctx.Req.Header[http.CanonicalHeaderKey(key)]) > 0
+		}
+		return ctx.Get(key) == value
+	}
+}
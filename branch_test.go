@@ -0,0 +1,74 @@
+package gear
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearBranch(t *testing.T) {
+	mark := func(name string) Middleware {
+		return func(ctx *Context) error {
+			ctx.Res.Header().Add("X-Mark", name)
+			return nil
+		}
+	}
+
+	app := New()
+	app.Use(If(PathPrefix("/api", "/v2"), mark("api"), mark("auth")))
+	app.Use(Unless(MethodIs(http.MethodGet, http.MethodHead), mark("csrf")))
+	app.Use(Branch(HeaderEquals(HeaderAccept, MIMEApplicationJSON), mark("json"), mark("html")))
+	app.Use(If(HeaderEquals("X-Debug", ""), mark("debug")))
+	app.Use(func(ctx *Context) error {
+		return ctx.End(204)
+	})
+
+	request := func(method, path string, header map[string]string) []string {
+		req := httptest.NewRequest(method, "http://example.com"+path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+		return res.Header()["X-Mark"]
+	}
+
+	t.Run("If", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal([]string{"api", "auth", "html"}, request("GET", "/api/users", nil))
+		assert.Equal([]string{"api", "auth", "html"}, request("GET", "/v2", nil))
+		assert.Equal([]string{"html"}, request("GET", "/", nil))
+		assert.Equal([]string{"html", "debug"}, request("GET", "/", map[string]string{"X-Debug": "1"}))
+	})
+
+	t.Run("Unless", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal([]string{"csrf", "html"}, request("POST", "/", nil))
+		assert.Equal([]string{"html"}, request("HEAD", "/", nil))
+	})
+
+	t.Run("Branch", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal([]string{"json"}, request("GET", "/", map[string]string{HeaderAccept: MIMEApplicationJSON}))
+		assert.Equal([]string{"html"}, request("GET", "/", map[string]string{HeaderAccept: MIMETextHTML}))
+	})
+
+	t.Run("Should stop when ended", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(If(PathPrefix("/"), func(ctx *Context) error {
+			return ctx.End(401)
+		}, mark("next")))
+		app.Use(mark("after"))
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, httptest.NewRequest("GET", "http://example.com/", nil))
+		assert.Equal(401, res.Code)
+		assert.Nil(res.Header()["X-Mark"])
+	})
+}
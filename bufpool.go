@@ -0,0 +1,119 @@
+package gear
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// BufferPool is a size-classed pool of bytes.Buffer, it is used by ctx.JSON, ctx.JSONP,
+// ctx.ParseBody and the response compression to reuse the buffers between requests.
+// A buffer is taken from the smallest class that fits the size hint, and returned to the
+// largest class that its capacity fits. The buffers larger than the largest class are
+// dropped, so that a few huge bodies don't pin the memory. It is safe for concurrent use.
+//
+//  pool := ctx.Setting(gear.SetBufferPool).(*gear.BufferPool)
+//  for _, s := range pool.Stats() {
+//  	logger.Printf("class %d: gets %d, misses %d, drops %d", s.Size, s.Gets, s.Misses, s.Drops)
+//  }
+//
+type BufferPool struct {
+	classes []*bufferClass
+}
+
+type bufferClass struct {
+	size   int
+	pool   sync.Pool
+	gets   uint64
+	misses uint64
+	puts   uint64
+	drops  uint64
+}
+
+// BufferPoolStats is the statistics of a size class of BufferPool. The high Misses/Gets ratio
+// of a class means its buffers are held too long or returned to the larger classes, and the
+// high Drops of the largest class means a larger class should be added.
+type BufferPoolStats struct {
+	Size   int    // the capacity of the buffers of the class
+	Gets   uint64 // the number of buffers taken from the class
+	Misses uint64 // the number of buffers allocated because the class was empty
+	Puts   uint64 // the number of buffers returned to the class
+	Drops  uint64 // the number of buffers dropped, larger than the class (only the largest class)
+}
+
+// DefaultBufferSizes is the size classes of BufferPool if none given.
+var DefaultBufferSizes = []int{512, 4 << 10, 32 << 10, 256 << 10}
+
+// NewBufferPool creates a BufferPool with the size classes, DefaultBufferSizes is used if
+// none given.
+func NewBufferPool(sizes ...int) *BufferPool {
+	if len(sizes) == 0 {
+		sizes = DefaultBufferSizes
+	}
+	sizes = append([]int(nil), sizes...)
+	sort.Ints(sizes)
+	p := &BufferPool{}
+	for _, size := range sizes {
+		if size <= 0 {
+			panic(NewAppError("invalid buffer size"))
+		}
+		if n := len(p.classes); n > 0 && p.classes[n-1].size == size {
+			continue
+		}
+		p.classes = append(p.classes, &bufferClass{size: size})
+	}
+	return p
+}
+
+// Get returns an empty buffer with capacity of at least size (if not larger than the largest
+// class), the buffer should be returned with Put after used.
+func (p *BufferPool) Get(size int) *bytes.Buffer {
+	i := sort.Search(len(p.classes), func(i int) bool {
+		return p.classes[i].size >= size
+	})
+	if i == len(p.classes) {
+		i--
+	}
+	c := p.classes[i]
+	atomic.AddUint64(&c.gets, 1)
+	if v := c.pool.Get(); v != nil {
+		return v.(*bytes.Buffer)
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return bytes.NewBuffer(make([]byte, 0, c.size))
+}
+
+// Put returns the buffer to the pool, the buffer and its bytes should not be used after.
+func (p *BufferPool) Put(buf *bytes.Buffer) {
+	n := buf.Cap()
+	if last := p.classes[len(p.classes)-1]; n > last.size {
+		atomic.AddUint64(&last.drops, 1)
+		return
+	}
+	i := sort.Search(len(p.classes), func(i int) bool {
+		return p.classes[i].size > n
+	})
+	if i == 0 {
+		return // not from the pool
+	}
+	c := p.classes[i-1]
+	buf.Reset()
+	atomic.AddUint64(&c.puts, 1)
+	c.pool.Put(buf)
+}
+
+// Stats returns the statistics of the size classes, from small to large.
+func (p *BufferPool) Stats() []BufferPoolStats {
+	stats := make([]BufferPoolStats, len(p.classes))
+	for i, c := range p.classes {
+		stats[i] = BufferPoolStats{
+			Size:   c.size,
+			Gets:   atomic.LoadUint64(&c.gets),
+			Misses: atomic.LoadUint64(&c.misses),
+			Puts:   atomic.LoadUint64(&c.puts),
+			Drops:  atomic.LoadUint64(&c.drops),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,98 @@
+package gear
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearBufferPool(t *testing.T) {
+	t.Run("should create size classes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() {
+			NewBufferPool(0)
+		})
+		p := NewBufferPool(1024, 64, 1024)
+		assert.Equal([]BufferPoolStats{{Size: 64}, {Size: 1024}}, p.Stats())
+		assert.Equal(len(DefaultBufferSizes), len(NewBufferPool().Stats()))
+	})
+
+	t.Run("should get and put buffers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		p := NewBufferPool(64, 1024)
+		buf := p.Get(10)
+		assert.Equal(0, buf.Len())
+		assert.Equal(64, buf.Cap())
+		buf.WriteString("hello")
+		p.Put(buf)
+
+		buf = p.Get(100)
+		assert.Equal(1024, buf.Cap())
+		buf.WriteString(strings.Repeat("x", 2048))
+		p.Put(buf) // dropped
+		p.Put(bytes.NewBuffer(make([]byte, 0, 10)))
+
+		buf = p.Get(4096)
+		assert.True(buf.Cap() >= 1024)
+		p.Put(buf)
+
+		stats := p.Stats()
+		assert.Equal(uint64(1), stats[0].Gets)
+		assert.Equal(uint64(1), stats[0].Puts)
+		assert.Equal(uint64(2), stats[1].Gets)
+		assert.Equal(uint64(1), stats[1].Drops)
+
+		buf = p.Get(0)
+		assert.Equal(0, buf.Len())
+	})
+
+	t.Run("should be used by app", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		assert.Panics(func() {
+			app.Set(SetBufferPool, 1)
+		})
+		pool := NewBufferPool(64, 1024)
+		app.Set(SetBufferPool, pool)
+		app.Set(SetCompress, &DefaultCompress{})
+		app.Use(func(ctx *Context) error {
+			body := &poolBody{}
+			if err := ctx.ParseBody(body); err != nil {
+				return err
+			}
+			return ctx.JSON(200, body)
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest("POST", "http://"+srv.Addr().String(), strings.NewReader(`{"a":"`+strings.Repeat("x", 2000)+`"}`))
+			req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+			res, err := DefaultClient.Do(req)
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			assert.True(res.Uncompressed)
+			body, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.Equal(`{"a":"`+strings.Repeat("x", 2000)+`"}`, string(body))
+		}
+		stats := pool.Stats()
+		assert.True(stats[0].Gets+stats[1].Gets >= 6)
+		assert.True(stats[0].Puts+stats[1].Puts+stats[1].Drops >= 6)
+	})
+}
+
+type poolBody struct {
+	A string `json:"a"`
+}
+
+func (b *poolBody) Validate() error {
+	return nil
+}
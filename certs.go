@@ -0,0 +1,107 @@
+package gear
+
+import (
+	"crypto/tls"
+	"strings"
+	"sync"
+)
+
+// CertificateProvider provides the TLS certificate for the client hello, the method signature
+// is the same as tls.Config.GetCertificate, it is used by app setting SetCertificates.
+type CertificateProvider interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// CertificateProviderFunc is an adapter to use a function as CertificateProvider.
+type CertificateProviderFunc func(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+
+// GetCertificate implemented CertificateProvider interface.
+func (fn CertificateProviderFunc) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return fn(hello)
+}
+
+// CertificateStore is a CertificateProvider that selects the certificate by SNI (server name) from
+// the certificates added, the certificates can be added or removed while serving. The exact host
+// is matched first, then the wildcard host such as "*.example.com", then the Fallback provider,
+// and at last the Default certificate.
+//
+//  store := gear.NewCertificateStore()
+//  store.AddFile("example.com", "example.com.crt", "example.com.key")
+//  store.AddFile("*.example.org", "example.org.crt", "example.org.key")
+//  store.Fallback = autocertManager // such as *autocert.Manager
+//  app.Set(gear.SetCertificates, store)
+//  app.Error(app.ListenTLS(":443", "", ""))
+//
+type CertificateStore struct {
+	// Fallback provides the certificate if no one matched in the store, optional.
+	Fallback CertificateProvider
+	// Default is the certificate if no one matched and no Fallback, or the client
+	// does not support SNI. Optional.
+	Default *tls.Certificate
+	mu      sync.RWMutex
+	certs   map[string]*tls.Certificate
+}
+
+// NewCertificateStore creates a CertificateStore instance.
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{certs: make(map[string]*tls.Certificate)}
+}
+
+// Add adds the certificate for the host, the host can be a wildcard host such as "*.example.com".
+func (s *CertificateStore) Add(host string, cert *tls.Certificate) {
+	s.mu.Lock()
+	s.certs[strings.ToLower(host)] = cert
+	s.mu.Unlock()
+}
+
+// AddFile loads the certificate from a pair of PEM files and adds it for the host.
+func (s *CertificateStore) AddFile(host, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	s.Add(host, &cert)
+	return nil
+}
+
+// Remove removes the certificate of the host.
+func (s *CertificateStore) Remove(host string) {
+	s.mu.Lock()
+	delete(s.certs, strings.ToLower(host))
+	s.mu.Unlock()
+}
+
+// Hosts returns the hosts in the store.
+func (s *CertificateStore) Hosts() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hosts := make([]string, 0, len(s.certs))
+	for host := range s.certs {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// GetCertificate implemented CertificateProvider interface.
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if name := strings.TrimSuffix(strings.ToLower(hello.ServerName), "."); name != "" {
+		s.mu.RLock()
+		cert, ok := s.certs[name]
+		if !ok {
+			if i := strings.IndexByte(name, '.'); i > 0 {
+				cert, ok = s.certs["*"+name[i:]]
+			}
+		}
+		s.mu.RUnlock()
+		if ok {
+			return cert, nil
+		}
+		if s.Fallback != nil {
+			return s.Fallback.GetCertificate(hello)
+		}
+	}
+	if s.Default != nil {
+		return s.Default, nil
+	}
+	return nil, NewAppError("no certificate for server name " + hello.ServerName)
+}
@@ -0,0 +1,129 @@
+package gear
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCert(host string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestGearCertificateStore(t *testing.T) {
+	certA := newTestCert("a.com")
+	certB := newTestCert("*.b.com")
+	certC := newTestCert("c.com")
+
+	t.Run("GetCertificate", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewCertificateStore()
+		store.Add("A.com", certA)
+		store.Add("*.b.com", certB)
+		assert.Nil(store.AddFile("localhost", "./testdata/cert.pem", "./testdata/key.pem"))
+		assert.NotNil(store.AddFile("none", "./testdata/none.pem", "./testdata/key.pem"))
+		assert.ElementsMatch([]string{"a.com", "*.b.com", "localhost"}, store.Hosts())
+
+		get := func(name string) (*tls.Certificate, error) {
+			return store.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		}
+		cert, _ := get("a.com")
+		assert.Equal(certA, cert)
+		cert, _ = get("A.COM.")
+		assert.Equal(certA, cert)
+		cert, _ = get("x.b.com")
+		assert.Equal(certB, cert)
+		_, err := get("b.com")
+		assert.Equal("Gear: no certificate for server name b.com", err.Error())
+		_, err = get("x.y.b.com")
+		assert.NotNil(err)
+
+		store.Fallback = CertificateProviderFunc(func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName == "c.com" {
+				return certC, nil
+			}
+			return nil, nil
+		})
+		store.Default = certA
+		cert, _ = get("c.com")
+		assert.Equal(certC, cert)
+		cert, _ = get("")
+		assert.Equal(certA, cert)
+
+		store.Remove("*.B.com")
+		cert, err = get("x.b.com")
+		assert.Nil(err)
+		assert.Nil(cert)
+	})
+
+	t.Run("Should serve multiple certificates by SNI", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewCertificateStore()
+		store.Add("a.com", certA)
+
+		app := New()
+		assert.Panics(func() {
+			app.Set(SetCertificates, certA)
+		})
+		app.Set(SetCertificates, store)
+		app.Use(func(ctx *Context) error {
+			return ctx.HTML(200, ctx.Host)
+		})
+		go app.ListenTLS("127.0.0.1:3445", "", "")
+		defer app.Close()
+
+		serverName := func(name string) (string, error) {
+			var conn *tls.Conn
+			var err error
+			for i := 0; i < 50; i++ {
+				if conn, err = tls.Dial("tcp", "127.0.0.1:3445", &tls.Config{ServerName: name, InsecureSkipVerify: true}); err == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+			return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+		}
+
+		name, err := serverName("a.com")
+		assert.Nil(err)
+		assert.Equal("a.com", name)
+
+		// dynamically added
+		store.Add("*.b.com", certB)
+		name, err = serverName("x.b.com")
+		assert.Nil(err)
+		assert.Equal("*.b.com", name)
+
+		_, err = serverName("c.com")
+		assert.NotNil(err)
+	})
+}
@@ -0,0 +1,189 @@
+package gear
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PropagatedHeaders is the list of the request headers that `ctx.HTTPClient` copies from the
+// incoming request to the outbound requests as is, for the request ID and the distributed tracing.
+// The headers already set on the outbound request are kept.
+//
+// The span headers of the distributed tracing (W3C "Traceparent", B3 "X-B3-Spanid" and "B3", Jaeger
+// "Uber-Trace-Id") are not copied as is, the outbound request is a child span of the incoming one:
+// it carries the same trace ID, a new span ID, and the incoming span ID as the parent span ID.
+var PropagatedHeaders = []string{
+	HeaderXRequestID,
+	HeaderTracestate,
+	"X-B3-Traceid",
+	"X-B3-Sampled",
+	"X-B3-Flags",
+}
+
+// HTTPClient returns a http.Client bound to the ctx for the outbound requests. The requests sent
+// by it are canceled when the ctx is done, so they share the deadline of the ctx (app setting
+// SetTimeout) along with the request's own context, and they carry the PropagatedHeaders and the
+// child span headers of the incoming request. If the incoming request has no "X-Request-Id"
+// header but the response has one (set by a request ID middleware), the response one is propagated.
+// The client uses the app's transport (app setting SetHTTPTransport), so the connections
+// are pooled across the requests.
+//
+//  res, err := ctx.HTTPClient().Get("http://user-service/users/" + id)
+//
+func (ctx *Context) HTTPClient() *http.Client {
+	return &http.Client{Transport: &contextTransport{ctx: ctx, base: ctx.app.httpTransport()}}
+}
+
+func (app *App) httpTransport() http.RoundTripper {
+	app.transportMu.Lock()
+	defer app.transportMu.Unlock()
+	if app.transport == nil {
+		app.transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   16,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		}
+	}
+	return app.transport
+}
+
+type contextTransport struct {
+	ctx  *Context
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, cancel := t.merge(req.Context())
+	r := req.WithContext(c) // shallow copy, the RoundTripper should not modify the request
+	r.Header = make(http.Header, len(req.Header)+len(PropagatedHeaders))
+	for key, vals := range req.Header {
+		r.Header[key] = vals
+	}
+	for _, key := range PropagatedHeaders {
+		key = http.CanonicalHeaderKey(key)
+		if len(r.Header[key]) > 0 {
+			continue
+		}
+		if vals := t.ctx.Req.Header[key]; len(vals) > 0 {
+			r.Header[key] = vals
+		} else if key == HeaderXRequestID {
+			if id := t.ctx.Res.Get(HeaderXRequestID); id != "" {
+				r.Header.Set(key, id)
+			}
+		}
+	}
+	propagateSpan(t.ctx.Req.Header, r.Header)
+
+	res, err := t.base.RoundTrip(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// merge returns a context of c that is also done when the ctx is done, with the earlier deadline
+// of them. The cancel func should be called when the response body closed.
+func (t *contextTransport) merge(c context.Context) (context.Context, context.CancelFunc) {
+	if c == context.Context(t.ctx) {
+		return c, func() {}
+	}
+	c, cancel := context.WithCancel(c)
+	if deadline, ok := t.ctx.Deadline(); ok {
+		var cancelDeadline context.CancelFunc
+		c, cancelDeadline = context.WithDeadline(c, deadline)
+		cancelParent := cancel
+		cancel = func() {
+			cancelDeadline()
+			cancelParent()
+		}
+	}
+	stop := context.AfterFunc(t.ctx, cancel)
+	return c, func() {
+		stop()
+		cancel()
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// propagateSpan sets the span headers of the outbound request as a child span of the incoming
+// request, with a new span ID. The headers already set on the outbound request are kept.
+func propagateSpan(in, out http.Header) {
+	var span string
+	newSpan := func() string {
+		if span == "" {
+			span = newSpanID()
+		}
+		return span
+	}
+
+	// version-traceid-parentid-flags
+	if v := in.Get(HeaderTraceparent); v != "" && out.Get(HeaderTraceparent) == "" {
+		if parts := strings.Split(v, "-"); len(parts) >= 4 && len(parts[2]) == 16 {
+			if parts[2] = newSpan(); parts[2] != "" {
+				out.Set(HeaderTraceparent, strings.Join(parts, "-"))
+			}
+		}
+	}
+	if v := in.Get("X-B3-Spanid"); v != "" && out.Get("X-B3-Spanid") == "" {
+		if id := newSpan(); id != "" {
+			out.Set("X-B3-Spanid", id)
+			out.Set("X-B3-Parentspanid", v)
+		}
+	}
+	// traceid-spanid[-sampled[-parentspanid]], or the sampling state only
+	if v := in.Get("B3"); v != "" && out.Get("B3") == "" {
+		if parts := strings.Split(v, "-"); len(parts) < 2 {
+			out.Set("B3", v)
+		} else if id := newSpan(); id != "" {
+			b3 := parts[0] + "-" + id
+			if len(parts) > 2 {
+				b3 += "-" + parts[2] + "-" + parts[1]
+			}
+			out.Set("B3", b3)
+		}
+	}
+	// traceid:spanid:parentid:flags
+	if v := in.Get("Uber-Trace-Id"); v != "" && out.Get("Uber-Trace-Id") == "" {
+		if parts := strings.Split(v, ":"); len(parts) == 4 {
+			if id := newSpan(); id != "" {
+				parts[1], parts[2] = id, parts[1]
+				out.Set("Uber-Trace-Id", strings.Join(parts, ":"))
+			}
+		}
+	}
+}
+
+// newSpanID returns a random 64-bit span ID in hex, or "" if failed to read the random bytes.
+func newSpanID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,165 @@
+package gear
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextHTTPClient(t *testing.T) {
+	upstream := New()
+	upstream.Use(func(ctx *Context) error {
+		if ctx.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+		return ctx.HTML(200, strings.Join([]string{
+			ctx.Get(HeaderXRequestID), ctx.Get(HeaderTraceparent), ctx.Get("X-B3-Traceid"), ctx.Get(HeaderUserAgent),
+		}, ","))
+	})
+	us := upstream.Start()
+	defer us.Close()
+	upstreamURL := "http://" + us.Addr().String()
+
+	call := func(ctx *Context, path string, header map[string]string) (string, error) {
+		req, _ := http.NewRequest("GET", upstreamURL+path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := ctx.HTTPClient().Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return string(body), nil
+	}
+
+	t.Run("Should propagate the request ID and trace headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := CtxTest(New(), "GET", "http://example.com/foo", nil)
+		ctx.Req.Header.Set(HeaderXRequestID, "req-1")
+		ctx.Req.Header.Set(HeaderTraceparent, "00-trace-span-01")
+		ctx.Req.Header.Set("X-B3-TraceId", "b3")
+		ctx.Req.Header.Set(HeaderUserAgent, "browser")
+
+		// the malformed traceparent is not propagated
+		body, err := call(ctx, "/", nil)
+		assert.Nil(err)
+		assert.Equal("req-1,,b3,Go-http-client/1.1", body)
+
+		body, err = call(ctx, "/", map[string]string{HeaderXRequestID: "req-2", HeaderTraceparent: "00-trace-span-01"})
+		assert.Nil(err)
+		assert.Equal("req-2,00-trace-span-01,b3,Go-http-client/1.1", body)
+
+		ctx = CtxTest(New(), "GET", "http://example.com/foo", nil)
+		ctx.Res.Set(HeaderXRequestID, "res-1")
+		body, err = call(ctx, "/", nil)
+		assert.Nil(err)
+		assert.Equal("res-1,,,Go-http-client/1.1", body)
+	})
+
+	t.Run("Should propagate the child span headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var header http.Header
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+		}))
+		defer upstream.Close()
+
+		ctx := CtxTest(New(), "GET", "http://example.com/foo", nil)
+		ctx.Req.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		ctx.Req.Header.Set("X-B3-Traceid", "463ac35c9f6413ad")
+		ctx.Req.Header.Set("X-B3-Spanid", "a2fb4a1d1a96d312")
+		ctx.Req.Header.Set("X-B3-Parentspanid", "0020000000000001")
+		ctx.Req.Header.Set("B3", "80f198ee56343ba8-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90")
+		ctx.Req.Header.Set("Uber-Trace-Id", "7f1c:5a3b:0:1")
+
+		res, err := ctx.HTTPClient().Get(upstream.URL)
+		assert.Nil(err)
+		res.Body.Close()
+
+		span := header.Get("X-B3-Spanid")
+		assert.Equal(16, len(span))
+		assert.NotEqual("a2fb4a1d1a96d312", span)
+		assert.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-"+span+"-01", header.Get(HeaderTraceparent))
+		assert.Equal("463ac35c9f6413ad", header.Get("X-B3-Traceid"))
+		assert.Equal("a2fb4a1d1a96d312", header.Get("X-B3-Parentspanid"))
+		assert.Equal("80f198ee56343ba8-"+span+"-1-e457b5a2e4d86bd1", header.Get("B3"))
+		assert.Equal("7f1c:"+span+":5a3b:1", header.Get("Uber-Trace-Id"))
+
+		ctx.Req.Header.Set("B3", "0")
+		res, err = ctx.HTTPClient().Get(upstream.URL)
+		assert.Nil(err)
+		res.Body.Close()
+		assert.Equal("0", header.Get("B3"))
+		assert.NotEqual(span, header.Get("X-B3-Spanid"))
+	})
+
+	t.Run("Should share the deadline of the ctx", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetTimeout, 50*time.Millisecond)
+		ctx := CtxTest(app, "GET", "http://example.com/foo", nil)
+		start := time.Now()
+		_, err := call(ctx, "/slow", nil)
+		assert.NotNil(err)
+		assert.True(time.Since(start) < 500*time.Millisecond)
+
+		ctx = CtxTest(New(), "GET", "http://example.com/foo", nil)
+		ctx.Cancel()
+		_, err = call(ctx, "/", nil)
+		assert.NotNil(err)
+
+		// the request's own context is respected
+		c, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req, _ := http.NewRequest("GET", upstreamURL+"/", nil)
+		res, err := CtxTest(app, "GET", "http://example.com/foo", nil).HTTPClient().Do(req.WithContext(c))
+		assert.Nil(err)
+		res.Body.Close()
+
+		// the deadline and cancellation of the ctx apply to the request's own context too
+		req, _ = http.NewRequest("GET", upstreamURL+"/slow", nil)
+		start = time.Now()
+		_, err = CtxTest(app, "GET", "http://example.com/foo", nil).HTTPClient().Do(req.WithContext(context.TODO()))
+		assert.NotNil(err)
+		assert.True(time.Since(start) < 500*time.Millisecond)
+
+		ctx = CtxTest(New(), "GET", "http://example.com/foo", nil)
+		ctx.Cancel()
+		_, err = ctx.HTTPClient().Do(req.WithContext(c))
+		assert.NotNil(err)
+	})
+
+	t.Run("Should use the app transport", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		ctx := CtxTest(app, "GET", "http://example.com/foo", nil)
+		transport := app.httpTransport()
+		assert.Equal(transport, ctx.HTTPClient().Transport.(*contextTransport).base)
+		assert.Equal(transport, app.httpTransport())
+
+		assert.Panics(func() {
+			app.Set(SetHTTPTransport, "transport")
+		})
+		tr := &http.Transport{}
+		app.Set(SetHTTPTransport, tr)
+		assert.Equal(tr, ctx.HTTPClient().Transport.(*contextTransport).base)
+		body, err := call(ctx, "/", nil)
+		assert.Nil(err)
+		assert.Equal(",,,Go-http-client/1.1", body)
+	})
+}
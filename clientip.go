@@ -0,0 +1,85 @@
+package gear
+
+import (
+	"net"
+	"strings"
+)
+
+// TrustedProxies is a set of the IPs and CIDRs of the trusted reverse proxies, it is used by
+// ctx.ClientIP to decide whether to read the forwarding headers.
+type TrustedProxies []*net.IPNet
+
+// NewTrustedProxies parses the IPs and CIDRs (such as "10.0.0.0/8") of the trusted reverse
+// proxies, it panics on the invalid ones.
+func NewTrustedProxies(list ...string) TrustedProxies {
+	tp := make(TrustedProxies, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				panic(NewAppError("invalid trusted proxy: " + s))
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			tp = append(tp, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(NewAppError("invalid trusted proxy: " + s))
+		}
+		tp = append(tp, ipnet)
+	}
+	return tp
+}
+
+// Contains returns true if the ip is a trusted proxy.
+func (tp TrustedProxies) Contains(ip net.IP) bool {
+	for _, n := range tp {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client IP for the security decisions, such as allowlists and rate limits.
+// It is the peer IP of the connection (the host of Req.RemoteAddr), unless the peer is one of the
+// trusted proxies, then it is the rightmost IP in the `X-Forwarded-For` header that is not a
+// trusted proxy, or the `X-Real-IP` header. Unlike ctx.IP, the forwarding headers forged by the
+// clients are ignored. It returns nil if the IP can't be parsed.
+//
+//  proxies := gear.NewTrustedProxies("10.0.0.0/8")
+//  app.Use(func(ctx *gear.Context) error {
+//  	if ip := ctx.ClientIP(proxies); ip == nil || !allowlist.Has(ip.String()) {
+//  		return ctx.ErrorStatus(http.StatusForbidden)
+//  	}
+//  	return nil
+//  })
+//
+func (ctx *Context) ClientIP(trusted TrustedProxies) net.IP {
+	host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+	if err != nil {
+		host = ctx.Req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trusted.Contains(ip) {
+		return ip
+	}
+
+	if xff := ctx.Req.Header.Values(HeaderXForwardedFor); len(xff) > 0 {
+		ips := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			if ip = net.ParseIP(strings.TrimSpace(ips[i])); ip == nil || !trusted.Contains(ip) {
+				return ip
+			}
+		}
+		return ip
+	}
+	if xri := ctx.Req.Header.Get(HeaderXRealIP); xri != "" {
+		return net.ParseIP(strings.TrimSpace(xri))
+	}
+	return ip
+}
@@ -0,0 +1,69 @@
+package gear
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextClientIP(t *testing.T) {
+	newCtx := func(remoteAddr string, header map[string]string) *Context {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return NewContext(New(), httptest.NewRecorder(), req)
+	}
+
+	t.Run("should panic with invalid proxies", func(t *testing.T) {
+		assert.Panics(t, func() {
+			NewTrustedProxies("abc")
+		})
+		assert.Panics(t, func() {
+			NewTrustedProxies("10.0.0.0/abc")
+		})
+	})
+
+	t.Run("should ignore the forwarding headers from untrusted peers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := newCtx("192.0.2.1:1234", map[string]string{HeaderXForwardedFor: "10.0.0.1"})
+		assert.Equal("192.0.2.1", ctx.ClientIP(nil).String())
+		assert.Equal("10.0.0.1", ctx.IP().String())
+
+		ctx = newCtx("192.0.2.1:1234", map[string]string{HeaderXRealIP: "10.0.0.1"})
+		assert.Equal("192.0.2.1", ctx.ClientIP(NewTrustedProxies("10.0.0.0/8")).String())
+
+		ctx = newCtx("[::1]:1234", nil)
+		assert.Equal("::1", ctx.ClientIP(nil).String())
+
+		ctx = newCtx("bad", nil)
+		assert.Nil(ctx.ClientIP(nil))
+	})
+
+	t.Run("should read the forwarding headers from trusted proxies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		proxies := NewTrustedProxies("10.0.0.0/8", "192.0.2.1")
+		assert.True(proxies.Contains(net.ParseIP("10.1.2.3")))
+		assert.False(proxies.Contains(net.ParseIP("192.0.2.2")))
+
+		ctx := newCtx("192.0.2.1:1234", map[string]string{HeaderXForwardedFor: "1.1.1.1, 2.2.2.2, 10.0.0.2"})
+		assert.Equal("2.2.2.2", ctx.ClientIP(proxies).String())
+
+		ctx = newCtx("192.0.2.1:1234", map[string]string{HeaderXForwardedFor: "10.0.0.3, 10.0.0.2"})
+		assert.Equal("10.0.0.3", ctx.ClientIP(proxies).String())
+
+		ctx = newCtx("192.0.2.1:1234", map[string]string{HeaderXForwardedFor: "1.1.1.1, abc"})
+		assert.Nil(ctx.ClientIP(proxies))
+
+		ctx = newCtx("10.0.0.1:1234", map[string]string{HeaderXRealIP: " 3.3.3.3 "})
+		assert.Equal("3.3.3.3", ctx.ClientIP(proxies).String())
+
+		ctx = newCtx("10.0.0.1:1234", nil)
+		assert.Equal("10.0.0.1", ctx.ClientIP(proxies).String())
+	})
+}
@@ -0,0 +1,234 @@
+package gear
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"sync"
+)
+
+// Codec interface is used to marshal and unmarshal values of a media type,
+// it should be registered by gear.RegisterCodec. MsgPack, CBOR, Protobuf or YAML codec
+// can be implemented with a third-party library easily:
+//
+//  import "github.com/vmihailenco/msgpack"
+//
+//  type msgpackCodec struct{}
+//
+//  func (msgpackCodec) Marshal(val interface{}) ([]byte, error) {
+//  	return msgpack.Marshal(val)
+//  }
+//
+//  func (msgpackCodec) Unmarshal(buf []byte, val interface{}) error {
+//  	return msgpack.Unmarshal(buf, val)
+//  }
+//
+//  func init() {
+//  	gear.RegisterCodec(gear.MIMEApplicationMsgpack, msgpackCodec{})
+//  }
+//
+type Codec interface {
+	Marshal(val interface{}) ([]byte, error)
+	Unmarshal(buf []byte, val interface{}) error
+}
+
+// CodecFunc is an adapter to create a Codec from marshal and unmarshal functions.
+//
+//  gear.RegisterCodec(gear.MIMEApplicationCBOR, gear.CodecFunc{
+//  	MarshalFunc:   cbor.Marshal,
+//  	UnmarshalFunc: cbor.Unmarshal,
+//  })
+//
+type CodecFunc struct {
+	MarshalFunc   func(val interface{}) ([]byte, error)
+	UnmarshalFunc func(buf []byte, val interface{}) error
+}
+
+// Marshal implemented Codec interface.
+func (c CodecFunc) Marshal(val interface{}) ([]byte, error) {
+	return c.MarshalFunc(val)
+}
+
+// Unmarshal implemented Codec interface.
+func (c CodecFunc) Unmarshal(buf []byte, val interface{}) error {
+	return c.UnmarshalFunc(buf, val)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	types []string
+	m     map[string]Codec
+}{m: make(map[string]Codec)}
+
+// RegisterCodec registers a Codec for the media type, such as "application/msgpack".
+// The registered codecs will be used by gear.DefaultBodyParser to parse request body,
+// and by ctx.Encode, ctx.Negotiate to respond. It will override the codec registered before
+// with the same media type. JSON and XML are supported without registering,
+// but ctx.Negotiate always responds them with ctx.JSON and ctx.XML.
+// It should be called before the app serving, such as in init function.
+func RegisterCodec(mediaType string, codec Codec) {
+	mediaType = strings.ToLower(mediaType)
+	if mediaType == "" || strings.ContainsAny(mediaType, "*;") || !strings.Contains(mediaType, "/") {
+		panic(NewAppError("invalid codec media type: " + mediaType))
+	}
+	if codec == nil {
+		panic(NewAppError("codec required"))
+	}
+
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, ok := codecs.m[mediaType]; !ok {
+		codecs.types = append(codecs.types, mediaType)
+	}
+	codecs.m[mediaType] = codec
+}
+
+// mediaTypeAliases maps the unofficial media types to the registered ones.
+var mediaTypeAliases = map[string]string{
+	"application/x-yaml": MIMEApplicationYAML,
+	"text/yaml":          MIMEApplicationYAML,
+	"text/x-yaml":        MIMEApplicationYAML,
+}
+
+// lookupCodec returns the codec for the media type, JSON and XML have built-in codecs.
+func lookupCodec(mediaType string) (Codec, bool) {
+	mediaType = strings.ToLower(mediaType)
+	if alias, ok := mediaTypeAliases[mediaType]; ok {
+		mediaType = alias
+	}
+	codecs.RLock()
+	codec, ok := codecs.m[mediaType]
+	codecs.RUnlock()
+	if ok {
+		return codec, true
+	}
+
+	switch mediaType {
+	case MIMEApplicationJSON:
+		return CodecFunc{json.Marshal, json.Unmarshal}, true
+	case MIMEApplicationXML:
+		return CodecFunc{xml.Marshal, xml.Unmarshal}, true
+	}
+	return nil, false
+}
+
+// codecTypes returns the media types can be responded by ctx.Negotiate, JSON first.
+func codecTypes() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	types := make([]string, 0, len(codecs.types)+2)
+	types = append(types, MIMEApplicationJSON, MIMEApplicationXML)
+	for _, t := range codecs.types {
+		if t != MIMEApplicationJSON && t != MIMEApplicationXML {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// JSONOptions is used by app setting gear.SetJSONOptions to encode the values
+// responded by ctx.JSON, ctx.JSONP and ctx.Negotiate.
+type JSONOptions struct {
+	// Prefix and Indent are used to indent the output, in the manner of json.MarshalIndent.
+	Prefix string
+	Indent string
+	// DisableHTMLEscape disables escaping of "<", ">" and "&" in JSON strings.
+	DisableHTMLEscape bool
+	// OmitNull removes the null value fields from JSON objects, the null items of arrays are kept.
+	OmitNull bool
+}
+
+// developmentJSONOptions is the default JSONOptions in "development" env.
+var developmentJSONOptions = &JSONOptions{Indent: "  "}
+
+// marshal encodes the value to a buffer taken from the pool, the buffer should be returned
+// to the pool after the bytes used. The output is the same as json.Marshal if o is nil.
+func (o *JSONOptions) marshal(pool *BufferPool, val interface{}) (*bytes.Buffer, error) {
+	buf := pool.Get(0)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(o == nil || !o.DisableHTMLEscape)
+	if err := enc.Encode(val); err != nil {
+		pool.Put(buf)
+		return nil, err
+	}
+	buf.Truncate(buf.Len() - 1) // the trailing newline
+	if o == nil {
+		return buf, nil
+	}
+	if o.OmitNull {
+		out := pool.Get(buf.Len())
+		err := o.writeOmitNull(out, buf.Bytes())
+		pool.Put(buf)
+		if err != nil {
+			pool.Put(out)
+			return nil, err
+		}
+		buf = out
+	}
+	if o.Prefix != "" || o.Indent != "" {
+		out := pool.Get(buf.Len() * 2)
+		err := json.Indent(out, buf.Bytes(), o.Prefix, o.Indent)
+		pool.Put(buf)
+		if err != nil {
+			pool.Put(out)
+			return nil, err
+		}
+		buf = out
+	}
+	return buf, nil
+}
+
+// writeOmitNull writes the compact JSON value to w, without null value fields of objects.
+func (o *JSONOptions) writeOmitNull(w *bytes.Buffer, raw []byte) error {
+	if len(raw) == 0 || (raw[0] != '{' && raw[0] != '[') {
+		w.Write(raw)
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	isObject := raw[0] == '{'
+	w.WriteByte(raw[0])
+	first := true
+	for dec.More() {
+		var key json.Token
+		if isObject {
+			var err error
+			if key, err = dec.Token(); err != nil {
+				return err
+			}
+		}
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return err
+		}
+		if isObject && string(val) == "null" {
+			continue
+		}
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+		if isObject {
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(!o.DisableHTMLEscape)
+			if err := enc.Encode(key); err != nil {
+				return err
+			}
+			w.Truncate(w.Len() - 1) // remove the newline appended by Encode
+			w.WriteByte(':')
+		}
+		if err := o.writeOmitNull(w, val); err != nil {
+			return err
+		}
+	}
+	if isObject {
+		w.WriteByte('}')
+	} else {
+		w.WriteByte(']')
+	}
+	return nil
+}
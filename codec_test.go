@@ -0,0 +1,376 @@
+package gear
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const mimeApplicationGob = "application/x-gob"
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(val interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(val)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(buf []byte, val interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(buf)).Decode(val)
+}
+
+type codecBody struct {
+	ID   string `json:"id"`
+	Pass string `json:"pass"`
+}
+
+func (b *codecBody) Validate() error {
+	if b.ID == "" {
+		return &Error{Code: 400, Msg: "invalid id"}
+	}
+	return nil
+}
+
+func TestGearRegisterCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Panics(func() { RegisterCodec("", gobCodec{}) })
+	assert.Panics(func() { RegisterCodec("application", gobCodec{}) })
+	assert.Panics(func() { RegisterCodec("application/*", gobCodec{}) })
+	assert.Panics(func() { RegisterCodec("application/x-gob; v=1", gobCodec{}) })
+	assert.Panics(func() { RegisterCodec(mimeApplicationGob, nil) })
+
+	RegisterCodec("Application/X-Gob", gobCodec{})
+	RegisterCodec(mimeApplicationGob, gobCodec{})
+	assert.Equal([]string{MIMEApplicationJSON, MIMEApplicationXML, mimeApplicationGob}, codecTypes())
+
+	codec, ok := lookupCodec(MIMEApplicationJSON)
+	assert.True(ok)
+	buf, err := codec.Marshal([]int{1, 2})
+	assert.Nil(err)
+	assert.Equal("[1,2]", string(buf))
+	_, ok = lookupCodec(mimeApplicationGob)
+	assert.True(ok)
+	_, ok = lookupCodec(MIMEApplicationCBOR)
+	assert.False(ok)
+}
+
+func TestGearCodec(t *testing.T) {
+	RegisterCodec(mimeApplicationGob, gobCodec{})
+
+	t.Run("DefaultBodyParser", func(t *testing.T) {
+		assert := assert.New(t)
+
+		buf, _ := gobCodec{}.Marshal(codecBody{ID: "admin", Pass: "password"})
+		app := New()
+		ctx := CtxTest(app, "POST", "http://example.com/foo", bytes.NewReader(buf))
+		ctx.Req.Header.Set(HeaderContentType, mimeApplicationGob)
+		body := codecBody{}
+		assert.Nil(ctx.ParseBody(&body))
+		assert.Equal("admin", body.ID)
+		assert.Equal("password", body.Pass)
+
+		ctx = CtxTest(app, "POST", "http://example.com/foo", bytes.NewReader(buf))
+		ctx.Req.Header.Set(HeaderContentType, MIMEApplicationCBOR)
+		err := ctx.ParseBody(&codecBody{})
+		assert.Equal(415, err.(*Error).Code)
+	})
+
+	t.Run("ctx.Encode and ctx.Negotiate", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			val := codecBody{ID: "admin"}
+			switch ctx.Path {
+			case "/encode":
+				return ctx.Encode(http.StatusOK, ctx.Query("type"), val)
+			case "/error":
+				return ctx.Negotiate(http.StatusOK, make(chan int))
+			}
+			return ctx.Negotiate(http.StatusOK, val)
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		host := "http://" + srv.Addr().String()
+		request := func(path, accept string) *GearResponse {
+			req, _ := NewRequst("GET", host+path)
+			if accept != "" {
+				req.Header.Set(HeaderAccept, accept)
+			}
+			res, err := DefaultClientDo(req)
+			assert.Nil(err)
+			return res
+		}
+
+		res := request("/encode?type="+mimeApplicationGob, "")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(mimeApplicationGob, res.Header.Get(HeaderContentType))
+		buf, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		body := codecBody{}
+		assert.Nil(gobCodec{}.Unmarshal(buf, &body))
+		assert.Equal("admin", body.ID)
+
+		res = request("/encode?type="+MIMEApplicationCBOR, "")
+		assert.Equal(500, res.StatusCode)
+		assert.True(strings.Contains(PickRes(res.Text()).(string), "codec not registered"))
+
+		res = request("/", "")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(MIMEApplicationJSONCharsetUTF8, res.Header.Get(HeaderContentType))
+		assert.Equal(HeaderAccept, res.Header.Get(HeaderVary))
+		assert.Equal(`{"id":"admin","pass":""}`, PickRes(res.Text()).(string))
+
+		res = request("/", "application/xml, application/json;q=0.8")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(MIMEApplicationXMLCharsetUTF8, res.Header.Get(HeaderContentType))
+		res.Body.Close()
+
+		res = request("/", mimeApplicationGob+", application/json;q=0.8")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(mimeApplicationGob, res.Header.Get(HeaderContentType))
+		res.Body.Close()
+
+		res = request("/", "text/html")
+		assert.Equal(406, res.StatusCode)
+		res.Body.Close()
+
+		res = request("/error", "")
+		assert.Equal(500, res.StatusCode)
+		res.Body.Close()
+	})
+}
+
+func TestGearJSONOptions(t *testing.T) {
+	type item struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}
+	val := map[string]interface{}{
+		"html":  "<a>&</a>",
+		"null":  nil,
+		"items": []interface{}{item{"a", nil}, nil, item{"<b>", map[string]interface{}{"x": nil, "y": 1}}},
+	}
+
+	t.Run("marshal", func(t *testing.T) {
+		assert := assert.New(t)
+
+		pool := NewBufferPool()
+		var options *JSONOptions
+		buf, err := options.marshal(pool, val)
+		assert.Nil(err)
+		assert.Equal(`{"html":"\u003ca\u003e\u0026\u003c/a\u003e","items":[{"name":"a","value":null},null,{"name":"\u003cb\u003e","value":{"x":null,"y":1}}],"null":null}`, buf.String())
+
+		options = &JSONOptions{}
+		buf, err = options.marshal(pool, val)
+		assert.Nil(err)
+		assert.Equal(`{"html":"\u003ca\u003e\u0026\u003c/a\u003e","items":[{"name":"a","value":null},null,{"name":"\u003cb\u003e","value":{"x":null,"y":1}}],"null":null}`, buf.String())
+
+		options = &JSONOptions{DisableHTMLEscape: true, OmitNull: true}
+		buf, err = options.marshal(pool, val)
+		assert.Nil(err)
+		assert.Equal(`{"html":"<a>&</a>","items":[{"name":"a"},null,{"name":"<b>","value":{"y":1}}]}`, buf.String())
+
+		options = &JSONOptions{Indent: "  ", OmitNull: true}
+		buf, err = options.marshal(pool, map[string]interface{}{"a": nil, "b": []int{1}, "<": "ok"})
+		assert.Nil(err)
+		assert.Equal("{\n  \"\\u003c\": \"ok\",\n  \"b\": [\n    1\n  ]\n}", buf.String())
+
+		buf, err = options.marshal(pool, nil)
+		assert.Nil(err)
+		assert.Equal("null", buf.String())
+
+		_, err = options.marshal(pool, make(chan int))
+		assert.NotNil(err)
+	})
+
+	t.Run("indent JSON in development env", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetEnv, "development")
+		app.Use(func(ctx *Context) error {
+			return ctx.JSON(http.StatusOK, item{"<a>", nil})
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		host := "http://" + srv.Addr().String()
+		res, err := RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal("{\n  \"name\": \"\\u003ca\\u003e\",\n  \"value\": null\n}", PickRes(res.Text()).(string))
+
+		app.Set(SetEnv, "production")
+		res, err = RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal(`{"name":"\u003ca\u003e","value":null}`, PickRes(res.Text()).(string))
+
+		app.Set(SetEnv, "development")
+		app.Set(SetJSONOptions, JSONOptions{})
+		res, err = RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal(`{"name":"\u003ca\u003e","value":null}`, PickRes(res.Text()).(string))
+	})
+
+	t.Run("SetJSONOptions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		assert.Panics(func() {
+			app.Set(SetJSONOptions, &JSONOptions{})
+		})
+		app.Set(SetJSONOptions, JSONOptions{Indent: "\t", DisableHTMLEscape: true, OmitNull: true})
+		app.Use(func(ctx *Context) error {
+			if ctx.Path == "/jsonp" {
+				return ctx.JSONP(http.StatusOK, "cb", item{"<a>", nil})
+			}
+			return ctx.JSON(http.StatusOK, item{"<a>", nil})
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		host := "http://" + srv.Addr().String()
+		res, err := RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("{\n\t\"name\": \"<a>\"\n}", PickRes(res.Text()).(string))
+
+		res, err = RequestBy("GET", host+"/jsonp")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("/**/ typeof cb === \"function\" && cb({\n\t\"name\": \"<a>\"\n});", PickRes(res.Text()).(string))
+	})
+}
+
+// yamlCodec is a fake YAML codec for testing, it supports flat string maps only.
+type yamlCodec struct{}
+
+type yamlBody map[string]string
+
+func (b *yamlBody) Validate() error {
+	if (*b)["name"] == "" {
+		return &Error{Code: 400, Msg: "invalid name"}
+	}
+	return nil
+}
+
+func (yamlCodec) Marshal(val interface{}) ([]byte, error) {
+	m, ok := val.(map[string]string)
+	if !ok {
+		return nil, errors.New("yaml: unsupported value")
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := []byte{}
+	for _, k := range keys {
+		buf = append(buf, k+": "+m[k]+"\n"...)
+	}
+	return buf, nil
+}
+
+func (yamlCodec) Unmarshal(buf []byte, val interface{}) error {
+	m := val.(*yamlBody)
+	*m = make(yamlBody)
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) != 2 {
+			return errors.New("yaml: invalid line " + line)
+		}
+		(*m)[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+func TestGearContextYAML(t *testing.T) {
+	t.Run("without codec", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		ctx := CtxTest(app, "POST", "http://example.com/foo", strings.NewReader("name: gear"))
+		ctx.Req.Header.Set(HeaderContentType, MIMEApplicationYAML)
+		err := ctx.ParseBody(&yamlBody{})
+		assert.Equal(415, err.(*Error).Code)
+
+		app.Use(func(ctx *Context) error {
+			return ctx.YAML(http.StatusOK, map[string]string{"name": "gear"})
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		res, err := RequestBy("GET", "http://"+srv.Addr().String())
+		assert.Nil(err)
+		assert.Equal(500, res.StatusCode)
+		assert.True(strings.Contains(PickRes(res.Text()).(string), "codec not registered: application/yaml"))
+	})
+
+	t.Run("with codec", func(t *testing.T) {
+		assert := assert.New(t)
+
+		RegisterCodec(MIMEApplicationYAML, yamlCodec{})
+		defer func() {
+			codecs.Lock()
+			delete(codecs.m, MIMEApplicationYAML)
+			codecs.types = codecs.types[:len(codecs.types)-1]
+			codecs.Unlock()
+		}()
+
+		app := New()
+		for _, typ := range []string{"application/yaml", "application/x-yaml; charset=utf-8", "text/yaml", "text/x-yaml"} {
+			ctx := CtxTest(app, "POST", "http://example.com/foo", strings.NewReader("name: gear\nversion: 1"))
+			ctx.Req.Header.Set(HeaderContentType, typ)
+			body := yamlBody{}
+			assert.Nil(ctx.ParseBody(&body))
+			assert.Equal(yamlBody{"name": "gear", "version": "1"}, body)
+		}
+
+		ctx := CtxTest(app, "POST", "http://example.com/foo", strings.NewReader("version: 1"))
+		ctx.Req.Header.Set(HeaderContentType, MIMEApplicationYAML)
+		err := ctx.ParseBody(&yamlBody{})
+		assert.Equal(400, err.(*Error).Code)
+
+		app.Use(func(ctx *Context) error {
+			switch ctx.Path {
+			case "/error":
+				return ctx.YAML(http.StatusOK, []string{})
+			case "/negotiate":
+				return ctx.Negotiate(http.StatusOK, map[string]string{"name": "gear"})
+			}
+			return ctx.YAML(http.StatusOK, map[string]string{"name": "gear", "version": "1"})
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		host := "http://" + srv.Addr().String()
+		res, err := RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(MIMEApplicationYAMLCharsetUTF8, res.Header.Get(HeaderContentType))
+		assert.Equal("name: gear\nversion: 1\n", PickRes(res.Text()).(string))
+
+		res, err = RequestBy("GET", host+"/error")
+		assert.Nil(err)
+		assert.Equal(500, res.StatusCode)
+		assert.Equal("yaml: unsupported value", PickRes(res.Text()).(string))
+
+		req, _ := NewRequst("GET", host+"/negotiate")
+		req.Header.Set(HeaderAccept, "application/yaml, application/json;q=0.9")
+		res, err = DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(MIMEApplicationYAMLCharsetUTF8, res.Header.Get(HeaderContentType))
+		assert.Equal("name: gear\n", PickRes(res.Text()).(string))
+	})
+}
@@ -5,8 +5,12 @@ import (
 	"compress/gzip"
 	"io"
 	"net/http"
+	"sync"
 )
 
+// the gzip and flate writers are pooled, they allocate hundreds of KB each.
+var gzipWriters, flateWriters sync.Pool
+
 // Compressible interface is use to enable compress response context.
 type Compressible interface {
 	// Compressible checks the response Content-Type and Content-Length to
@@ -15,11 +19,27 @@ type Compressible interface {
 	Compressible(contentType string, contentLength int) bool
 }
 
+// CompressSkipper is an optional interface of the Compressible to skip the compression for
+// the requests, such as the Server-Sent Events that should be flushed as they are.
+type CompressSkipper interface {
+	// SkipCompress is called before the middlewares run, the response of the request
+	// will not be compressed if it returns true.
+	SkipCompress(ctx *Context) bool
+}
+
 // DefaultCompress is defalut Compress implemented. Use it to enable compress:
 //
 //  app.Set(gear.SetCompress, &gear.DefaultCompress{})
 //
-type DefaultCompress struct{}
+type DefaultCompress struct {
+	// Skipper defines a function to skip the compression for the request.
+	Skipper func(ctx *Context) bool
+}
+
+// SkipCompress implemented CompressSkipper interface.
+func (d *DefaultCompress) SkipCompress(ctx *Context) bool {
+	return d.Skipper != nil && d.Skipper(ctx)
+}
 
 // Compressible implemented Compress interface.
 // Recommend https://github.com/teambition/compressible-go.
@@ -70,15 +90,26 @@ func newCompress(res *Response, c Compressible, encoding string) *compressWriter
 func (cw *compressWriter) WriteHeader(code int) {
 	defer cw.rw.WriteHeader(code)
 
-	if !isEmptyStatus(code) &&
+	// the partial content is not compressed, as Content-Range refers to the identity content.
+	if !isEmptyStatus(code) && code != http.StatusPartialContent &&
 		cw.compress.Compressible(cw.res.Get(HeaderContentType), cw.res.bodyLength) {
 		var w io.WriteCloser
 
 		switch cw.encoding {
 		case "gzip":
-			w, _ = gzip.NewWriterLevel(cw.rw, gzip.DefaultCompression)
+			if gw, ok := gzipWriters.Get().(*gzip.Writer); ok {
+				gw.Reset(cw.rw)
+				w = gw
+			} else {
+				w, _ = gzip.NewWriterLevel(cw.rw, gzip.DefaultCompression)
+			}
 		case "deflate":
-			w, _ = flate.NewWriter(cw.rw, flate.DefaultCompression)
+			if fw, ok := flateWriters.Get().(*flate.Writer); ok {
+				fw.Reset(cw.rw)
+				w = fw
+			} else {
+				w, _ = flate.NewWriter(cw.rw, flate.DefaultCompression)
+			}
 		}
 
 		if w != nil {
@@ -101,9 +132,40 @@ func (cw *compressWriter) Write(b []byte) (int, error) {
 	return cw.rw.Write(b)
 }
 
-func (cw *compressWriter) Close() error {
+// ReadFrom passes through the io.ReaderFrom of the underlying writer if not compressed.
+func (cw *compressWriter) ReadFrom(src io.Reader) (int64, error) {
 	if cw.writer != nil {
-		return cw.writer.Close()
+		buf := cw.res.ctx.app.bufPool.Get(32 << 10)
+		defer cw.res.ctx.app.bufPool.Put(buf)
+		return io.CopyBuffer(cw.writer, src, buf.Bytes()[:buf.Cap()])
+	}
+	if rf, ok := cw.rw.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(writerOnly{cw.rw}, src)
+}
+
+func (cw *compressWriter) Flush() error {
+	if flusher, ok := cw.writer.(interface {
+		Flush() error
+	}); ok {
+		return flusher.Flush()
 	}
 	return nil
 }
+
+// Close closes the compression writer and returns it to the pool.
+func (cw *compressWriter) Close() error {
+	if cw.writer == nil {
+		return nil
+	}
+	err := cw.writer.Close()
+	switch w := cw.writer.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(w)
+	case *flate.Writer:
+		flateWriters.Put(w)
+	}
+	cw.writer = nil
+	return err
+}
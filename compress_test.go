@@ -221,4 +221,35 @@ func TestGearResponseCompress(t *testing.T) {
 			assert.Equal("", res.Header.Get(HeaderContentEncoding))
 		})
 	})
+	t.Run("DefaultCompress with Skipper", func(t *testing.T) {
+		assert := assert.New(t)
+
+		body := []byte(strings.Repeat("你好，Gear", 500))
+		app := New()
+		app.Set(SetCompress, &DefaultCompress{Skipper: func(ctx *Context) bool {
+			return ctx.Path == "/events"
+		}})
+		app.Use(func(ctx *Context) error {
+			ctx.Type(MIMETextPlainCharsetUTF8)
+			return ctx.End(http.StatusOK, body)
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		req, _ := NewRequst("GET", host+"/events")
+		req.Header.Set("Accept-Encoding", "gzip")
+		res, err := DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal("", res.Header.Get(HeaderContentEncoding))
+		assert.Equal(body, PickRes(ioutil.ReadAll(res.Body)).([]byte))
+		res.Body.Close()
+
+		req, _ = NewRequst("GET", host+"/full")
+		req.Header.Set("Accept-Encoding", "gzip")
+		res, err = DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal("gzip", res.Header.Get(HeaderContentEncoding))
+		res.Body.Close()
+	})
 }
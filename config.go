@@ -0,0 +1,181 @@
+package gear
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+)
+
+// ConfigProvider loads the config values, it is used by ConfigWatcher.
+type ConfigProvider interface {
+	Load() (map[string]interface{}, error)
+}
+
+// ConfigProviderFunc is an adapter to use a function as ConfigProvider.
+type ConfigProviderFunc func() (map[string]interface{}, error)
+
+// Load implemented ConfigProvider interface.
+func (fn ConfigProviderFunc) Load() (map[string]interface{}, error) {
+	return fn()
+}
+
+// JSONFileConfig returns a ConfigProvider that loads the config values from a JSON object file.
+// The JSON numbers are decoded as float64, they can be read by app.GetInt, the durations should
+// be strings such as "1.5s".
+func JSONFileConfig(file string) ConfigProvider {
+	return ConfigProviderFunc(func() (map[string]interface{}, error) {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]interface{})
+		if err = json.Unmarshal(buf, &values); err != nil {
+			return nil, NewAppError("invalid config file " + file + ": " + err.Error())
+		}
+		return values, nil
+	})
+}
+
+// ConfigWatcher loads the config values from a ConfigProvider as app settings, and reloads
+// them on signals or change notifications, so that the middlewares can pick up new values
+// without restart. The callbacks registered by OnChange run after the changed values set.
+//
+//  w, err := app.WatchConfig(gear.JSONFileConfig("./config.json"))
+//  if err != nil {
+//  	panic(err)
+//  }
+//  stop := w.Notify(syscall.SIGHUP) // reload with `kill -HUP pid`
+//  defer stop()
+//
+//  w.OnChange("RATE_LIMIT", func(val interface{}) {
+//  	limiter.SetLimit(app.GetInt("RATE_LIMIT"))
+//  })
+//
+type ConfigWatcher struct {
+	app       *App
+	provider  ConfigProvider
+	mu        sync.Mutex // serializes the reloading
+	values    map[string]interface{}
+	cbMu      sync.RWMutex
+	callbacks map[string][]func(val interface{})
+}
+
+// WatchConfig creates a ConfigWatcher with the provider, the config values are loaded as app
+// settings immediately, the keys are the string keys of the values.
+func (app *App) WatchConfig(provider ConfigProvider) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{
+		app:       app,
+		provider:  provider,
+		values:    make(map[string]interface{}),
+		callbacks: make(map[string][]func(val interface{})),
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// OnChange registers a callback that runs when the config value of the key is changed,
+// val is nil if the key is removed from the config.
+func (w *ConfigWatcher) OnChange(key string, fn func(val interface{})) {
+	w.cbMu.Lock()
+	w.callbacks[key] = append(w.callbacks[key], fn)
+	w.cbMu.Unlock()
+}
+
+// Reload loads the config values from the provider, sets the changed values as app settings,
+// deletes the removed keys from app settings, and runs the callbacks of the changed keys.
+// The app settings are not changed if the provider returns an error.
+func (w *ConfigWatcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	values, err := w.provider.Load()
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	for key, val := range values {
+		if old, ok := w.values[key]; !ok || !reflect.DeepEqual(old, val) {
+			w.app.Set(key, val)
+			changed = append(changed, key)
+		}
+	}
+	for key := range w.values {
+		if _, ok := values[key]; !ok {
+			w.app.deleteSetting(key)
+			changed = append(changed, key)
+		}
+	}
+	w.values = values
+
+	for _, key := range changed {
+		w.cbMu.RLock()
+		callbacks := w.callbacks[key]
+		w.cbMu.RUnlock()
+		for _, fn := range callbacks {
+			fn(values[key])
+		}
+	}
+	return nil
+}
+
+// Notify reloads the config when receives the given signals, such as syscall.SIGHUP.
+// The reloading errors are written to the app logger.
+// It returns a function to stop receiving the signals.
+func (w *ConfigWatcher) Notify(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		panic(NewAppError("config notify signals required"))
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				w.reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// Watch reloads the config when receives change notifications from the channel,
+// such as the events from a file watcher or a config center client.
+// The reloading errors are written to the app logger.
+// It returns a function to stop watching, the watching also stops when the channel closed.
+func (w *ConfigWatcher) Watch(changes <-chan struct{}) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case _, ok := <-changes:
+				if !ok {
+					return
+				}
+				w.reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func (w *ConfigWatcher) reload() {
+	if err := w.Reload(); err != nil {
+		w.app.Error(err)
+	}
+}
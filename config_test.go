@@ -0,0 +1,140 @@
+package gear
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearConfigWatcher(t *testing.T) {
+	t.Run("Should reload config with callbacks", func(t *testing.T) {
+		assert := assert.New(t)
+
+		values := map[string]interface{}{"RATE_LIMIT": "100", "FEATURE": true}
+		var loadErr error
+		app := New()
+		w, err := app.WatchConfig(ConfigProviderFunc(func() (map[string]interface{}, error) {
+			res := make(map[string]interface{})
+			for k, v := range values {
+				res[k] = v
+			}
+			return res, loadErr
+		}))
+		assert.Nil(err)
+		assert.Equal(100, app.GetInt("RATE_LIMIT"))
+		assert.True(app.GetBool("FEATURE"))
+
+		var changes []interface{}
+		w.OnChange("RATE_LIMIT", func(val interface{}) {
+			changes = append(changes, val)
+		})
+		w.OnChange("FEATURE", func(val interface{}) {
+			changes = append(changes, val)
+		})
+
+		assert.Nil(w.Reload())
+		assert.Equal(0, len(changes))
+
+		values = map[string]interface{}{"RATE_LIMIT": "200"}
+		assert.Nil(w.Reload())
+		assert.Equal(200, app.GetInt("RATE_LIMIT"))
+		assert.Nil(app.Setting("FEATURE"))
+		assert.Equal(2, len(changes))
+		assert.Contains(changes, "200")
+		assert.Contains(changes, nil)
+
+		loadErr = errors.New("load error")
+		values = map[string]interface{}{"RATE_LIMIT": "300"}
+		assert.Equal(loadErr, w.Reload())
+		assert.Equal(200, app.GetInt("RATE_LIMIT"))
+
+		_, err = app.WatchConfig(ConfigProviderFunc(func() (map[string]interface{}, error) {
+			return nil, loadErr
+		}))
+		assert.Equal(loadErr, err)
+	})
+
+	t.Run("JSONFileConfig", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "gear-config")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "config.json")
+		ioutil.WriteFile(file, []byte(`{"RATE_LIMIT": 100, "TIMEOUT": "1s"}`), 0644)
+
+		app := New()
+		w, err := app.WatchConfig(JSONFileConfig(file))
+		assert.Nil(err)
+		assert.Equal(100, app.GetInt("RATE_LIMIT"))
+		assert.Equal(time.Second, app.GetDuration("TIMEOUT"))
+
+		ioutil.WriteFile(file, []byte(`{"RATE_LIMIT": 100`), 0644)
+		assert.NotNil(w.Reload())
+		assert.Equal(100, app.GetInt("RATE_LIMIT"))
+
+		_, err = app.WatchConfig(JSONFileConfig(filepath.Join(dir, "none.json")))
+		assert.NotNil(err)
+	})
+
+	t.Run("Should reload on notifications", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var mu sync.Mutex
+		count := 0
+		var buf bytes.Buffer
+		app := New()
+		app.Set(SetLogger, log.New(&buf, "", 0))
+		w, err := app.WatchConfig(ConfigProviderFunc(func() (map[string]interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			count++
+			if count == 3 {
+				return nil, errors.New("load error")
+			}
+			return map[string]interface{}{"COUNT": count}, nil
+		}))
+		assert.Nil(err)
+
+		reloaded := make(chan interface{}, 1)
+		w.OnChange("COUNT", func(val interface{}) {
+			reloaded <- val
+		})
+
+		stop := w.Notify(syscall.SIGHUP)
+		syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+		assert.Equal(2, <-reloaded)
+		stop()
+
+		changes := make(chan struct{})
+		stop = w.Watch(changes)
+		changes <- struct{}{}
+		changes <- struct{}{}
+		assert.Equal(4, <-reloaded)
+		stop()
+		assert.Contains(buf.String(), "load error")
+
+		// stop watching when the channel closed
+		changes = make(chan struct{})
+		stop = w.Watch(changes)
+		close(changes)
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		assert.Equal(4, count)
+		mu.Unlock()
+		stop()
+
+		assert.Panics(func() {
+			w.Notify()
+		})
+	})
+}
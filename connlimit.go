@@ -0,0 +1,131 @@
+package gear
+
+import (
+	"net"
+	"sync"
+)
+
+// ConnLimits is the options of ConnLimiter.
+type ConnLimits struct {
+	// MaxConns defines the maximum number of the concurrent connections, 0 means no limit.
+	MaxConns int
+	// MaxConnsPerIP defines the maximum number of the concurrent connections from a source IP,
+	// 0 means no limit.
+	MaxConnsPerIP int
+	// OnReject is called with the rejected connection before it closed, reason is "max_conns"
+	// or "max_conns_per_ip". Optional.
+	OnReject func(conn net.Conn, reason string)
+}
+
+// ConnStats is the metrics of ConnLimiter.
+type ConnStats struct {
+	Active   int64  // the number of the active connections
+	Accepted uint64 // the total number of the accepted connections
+	Rejected uint64 // the total number of the rejected connections
+	IPs      int    // the number of the source IPs with active connections
+}
+
+// ConnLimiter limits the concurrent connections of the listeners, in total and per source IP.
+// The connections over the limits are closed once accepted, before any request read, so the
+// abuse is blocked without allocating a Context. It can be used by app setting SetConnLimiter,
+// or wrap a net.Listener directly.
+//
+//  limiter := gear.NewConnLimiter(gear.ConnLimits{MaxConns: 10000, MaxConnsPerIP: 100})
+//  app.Set(gear.SetConnLimiter, limiter)
+//  // limiter.Stats() for metrics
+//
+type ConnLimiter struct {
+	opts     ConnLimits
+	mu       sync.Mutex
+	active   int64
+	ips      map[string]int
+	accepted uint64
+	rejected uint64
+}
+
+// NewConnLimiter creates a ConnLimiter with the options.
+func NewConnLimiter(opts ConnLimits) *ConnLimiter {
+	return &ConnLimiter{opts: opts, ips: make(map[string]int)}
+}
+
+// Listener returns a net.Listener that limits the connections accepted by l.
+func (cl *ConnLimiter) Listener(l net.Listener) net.Listener {
+	return &limitedListener{l, cl}
+}
+
+// Stats returns the metrics of the ConnLimiter.
+func (cl *ConnLimiter) Stats() ConnStats {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return ConnStats{
+		Active:   cl.active,
+		Accepted: cl.accepted,
+		Rejected: cl.rejected,
+		IPs:      len(cl.ips),
+	}
+}
+
+// acquire returns the rejected reason, or "" if the connection is accepted.
+func (cl *ConnLimiter) acquire(ip string) string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.opts.MaxConns > 0 && cl.active >= int64(cl.opts.MaxConns) {
+		cl.rejected++
+		return "max_conns"
+	}
+	if cl.opts.MaxConnsPerIP > 0 && cl.ips[ip] >= cl.opts.MaxConnsPerIP {
+		cl.rejected++
+		return "max_conns_per_ip"
+	}
+	cl.accepted++
+	cl.active++
+	cl.ips[ip]++
+	return ""
+}
+
+func (cl *ConnLimiter) release(ip string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.active--
+	if cl.ips[ip]--; cl.ips[ip] <= 0 {
+		delete(cl.ips, ip)
+	}
+}
+
+type limitedListener struct {
+	net.Listener
+	cl *ConnLimiter
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := c.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		if reason := l.cl.acquire(ip); reason != "" {
+			if l.cl.opts.OnReject != nil {
+				l.cl.opts.OnReject(c, reason)
+			}
+			c.Close()
+			continue
+		}
+		return &limitedConn{Conn: c, ip: ip, cl: l.cl}, nil
+	}
+}
+
+type limitedConn struct {
+	net.Conn
+	ip   string
+	cl   *ConnLimiter
+	once sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(func() { c.cl.release(c.ip) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,116 @@
+package gear
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearConnLimiter(t *testing.T) {
+	var mu sync.Mutex
+	var reasons []string
+	limiter := NewConnLimiter(ConnLimits{
+		MaxConns:      3,
+		MaxConnsPerIP: 2,
+		OnReject: func(conn net.Conn, reason string) {
+			mu.Lock()
+			reasons = append(reasons, reason)
+			mu.Unlock()
+		},
+	})
+
+	app := New()
+	assert.Panics(t, func() {
+		app.Set(SetConnLimiter, ConnLimits{})
+	})
+	app.Set(SetConnLimiter, limiter)
+	app.Use(func(ctx *Context) error {
+		return ctx.HTML(200, "OK")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	addr := srv.Addr().String()
+
+	// get sends a request on the connection, returns error if the connection is rejected.
+	get := func(conn net.Conn) error {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")); err != nil {
+			return err
+		}
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+	dial := func(network, laddr string) net.Conn {
+		d := net.Dialer{}
+		if laddr != "" {
+			d.LocalAddr = &net.TCPAddr{IP: net.ParseIP(laddr)}
+		}
+		conn, err := d.Dial(network, addr)
+		if err != nil {
+			panic(err)
+		}
+		return conn
+	}
+	waitFor := func(fn func() bool) {
+		for i := 0; i < 100 && !fn(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("Should limit the connections per IP", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c1 := dial("tcp", "")
+		c2 := dial("tcp", "")
+		assert.Nil(get(c1))
+		assert.Nil(get(c2))
+
+		c3 := dial("tcp", "")
+		assert.NotNil(get(c3))
+		c3.Close()
+		assert.Equal(ConnStats{Active: 2, Accepted: 2, Rejected: 1, IPs: 1}, limiter.Stats())
+
+		c1.Close()
+		waitFor(func() bool { return limiter.Stats().Active == 1 })
+		c4 := dial("tcp", "")
+		assert.Nil(get(c4))
+		assert.Equal(ConnStats{Active: 2, Accepted: 3, Rejected: 1, IPs: 1}, limiter.Stats())
+
+		c2.Close()
+		c4.Close()
+		waitFor(func() bool { return limiter.Stats().Active == 0 })
+		assert.Equal(0, limiter.Stats().IPs)
+	})
+
+	t.Run("Should limit the total connections", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var conns []net.Conn
+		for _, ip := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"} {
+			conn := dial("tcp", ip)
+			assert.Nil(get(conn))
+			conns = append(conns, conn)
+		}
+		conn := dial("tcp", "127.0.0.4")
+		assert.NotNil(get(conn))
+		conn.Close()
+
+		stats := limiter.Stats()
+		assert.Equal(int64(3), stats.Active)
+		assert.Equal(3, stats.IPs)
+		for _, conn := range conns {
+			conn.Close()
+		}
+		mu.Lock()
+		assert.Equal([]string{"max_conns_per_ip", "max_conns"}, reasons)
+		mu.Unlock()
+	})
+}
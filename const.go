@@ -12,10 +12,16 @@ const (
 	MIMEApplicationForm                  = "application/x-www-form-urlencoded"
 	MIMEApplicationProtobuf              = "application/protobuf"
 	MIMEApplicationMsgpack               = "application/msgpack"
+	MIMEApplicationCBOR                  = "application/cbor"
+	MIMEApplicationYAML                  = "application/yaml"
+	MIMEApplicationYAMLCharsetUTF8       = "application/yaml; charset=utf-8"
+	MIMEApplicationGRPC                  = "application/grpc"
 	MIMETextHTML                         = "text/html"
 	MIMETextHTMLCharsetUTF8              = "text/html; charset=utf-8"
 	MIMETextPlain                        = "text/plain"
 	MIMETextPlainCharsetUTF8             = "text/plain; charset=utf-8"
+	MIMETextCSV                          = "text/csv"
+	MIMETextCSVCharsetUTF8               = "text/csv; charset=utf-8"
 	MIMEMultipartForm                    = "multipart/form-data"
 	MIMEOctetStream                      = "application/octet-stream"
 )
@@ -31,6 +37,7 @@ const (
 	HeaderContentLength      = "Content-Length"      // Requests, Responses
 	HeaderContentMD5         = "Content-MD5"         // Requests, Responses
 	HeaderContentType        = "Content-Type"        // Requests, Responses
+	HeaderExpect             = "Expect"              // Requests
 	HeaderIfMatch            = "If-Match"            // Requests
 	HeaderIfModifiedSince    = "If-Modified-Since"   // Requests
 	HeaderIfNoneMatch        = "If-None-Match"       // Requests
@@ -43,12 +50,16 @@ const (
 	HeaderReferer            = "Referer"             // Requests
 	HeaderUserAgent          = "User-Agent"          // Requests
 	HeaderTE                 = "TE"                  // Requests
+	HeaderTrailer            = "Trailer"             // Requests, Responses
 	HeaderVia                = "Via"                 // Requests
 	HeaderWarning            = "Warning"             // Requests, Responses
 	HeaderCookie             = "Cookie"              // Requests
 	HeaderOrigin             = "Origin"              // Requests
 	HeaderAcceptDatetime     = "Accept-Datetime"     // Requests
 	HeaderXRequestedWith     = "X-Requested-With"    // Requests
+	HeaderXRequestID         = "X-Request-Id"        // Requests, Responses
+	HeaderTraceparent        = "Traceparent"         // Requests
+	HeaderTracestate         = "Tracestate"          // Requests
 
 	HeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"      // Responses
 	HeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"     // Responses
@@ -75,7 +86,11 @@ const (
 	HeaderProxyAuthenticate             = "Proxy-Authenticate"               // Responses
 	HeaderRefresh                       = "Refresh"                          // Responses
 	HeaderRetryAfter                    = "Retry-After"                      // Responses
+	HeaderRateLimitLimit                = "RateLimit-Limit"                  // Responses
+	HeaderRateLimitRemaining            = "RateLimit-Remaining"              // Responses
+	HeaderRateLimitReset                = "RateLimit-Reset"                  // Responses
 	HeaderServer                        = "Server"                           // Responses
+	HeaderServerTiming                  = "Server-Timing"                    // Responses
 	HeaderSetCookie                     = "Set-Cookie"                       // Responses
 	HeaderStrictTransportSecurity       = "Strict-Transport-Security"        // Responses
 	HeaderTransferEncoding              = "Transfer-Encoding"                // Responses
@@ -103,4 +118,5 @@ const (
 	HeaderXCSRFToken                      = "X-CSRF-Token"                        // Responses
 	HeaderXDNSPrefetchControl             = "X-DNS-Prefetch-Control"              // Responses
 	HeaderXDownloadOptions                = "X-Download-Options"                  // Responses
+	HeaderXAccelBuffering                 = "X-Accel-Buffering"                   // Responses
 )
@@ -3,15 +3,18 @@ package gear
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-http-utils/cookie"
@@ -34,6 +37,13 @@ var ErrMissingRequestBody = NewAppError("missing request body")
 // ErrRendererNotRegistered is returned from Context.Render
 var ErrRendererNotRegistered = NewAppError("renderer not registered")
 
+// jsonpCallbackReg matches a JavaScript identifier or a dot-separated member expression,
+// such as "cb", "jQuery123_456", "app.handlers.cb".
+var jsonpCallbackReg = regexp.MustCompile(`^[a-zA-Z_$][\w$]*(\.[a-zA-Z_$][\w$]*)*$`)
+
+// maxJSONPCallbackLen is the maximum length of a JSONP callback name.
+const maxJSONPCallbackLen = 128
+
 // Any interface is used by ctx.Any.
 type Any interface {
 	New(ctx *Context) (interface{}, error)
@@ -58,8 +68,16 @@ type Context struct {
 
 	ended      atomicBool // indicate that app middlewares run out.
 	query      url.Values
+	accepts    map[string][]AcceptSpec
+	lang       string
+	mu         sync.Mutex
+	timings    []serverTiming
+	flash      *flashState
+	deferred   []func()
 	afterHooks []func()
 	endHooks   []func()
+	onerror    func(*Context, HTTPError)
+	base       *deadlineContext
 	ctx        context.Context
 	_ctx       context.Context
 	cancelCtx  context.CancelFunc
@@ -77,11 +95,8 @@ func NewContext(app *App, w http.ResponseWriter, r *http.Request) *Context {
 	ctx.Path = r.URL.Path
 	ctx.kv = make(map[interface{}]interface{})
 
-	if app.timeout <= 0 {
-		ctx.ctx, ctx.cancelCtx = context.WithCancel(r.Context())
-	} else {
-		ctx.ctx, ctx.cancelCtx = context.WithTimeout(r.Context(), app.timeout)
-	}
+	ctx.base = newDeadlineContext(r.Context(), app.timeout)
+	ctx.ctx, ctx.cancelCtx = context.WithCancel(ctx.base)
 
 	if app.withContext != nil {
 		ctx._ctx = app.withContext(r.WithContext(ctx.ctx))
@@ -113,8 +128,21 @@ func (ctx *Context) Err() error {
 // Value returns the value associated with this context for key, or nil
 // if no value is associated with key. Successive calls to Value with
 // the same key returns the same result.
+// The values saved by ctx.SetAny are also reachable if the underlying context
+// has no value for the key.
 func (ctx *Context) Value(key interface{}) (val interface{}) {
-	return ctx._ctx.Value(key)
+	if val = ctx._ctx.Value(key); val == nil {
+		val = ctx.value(key)
+	}
+	return
+}
+
+// value returns the value saved by ctx.SetAny, it can be called from the other goroutines
+// through the context.Context interface.
+func (ctx *Context) value(key interface{}) interface{} {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.kv[key]
 }
 
 // Cancel cancel the ctx and all it' children context.
@@ -164,6 +192,34 @@ func (ctx *Context) WithContext(c context.Context) {
 	ctx._ctx = c
 }
 
+// IntoRequest returns a shallow copy of ctx.Req with its context changed to ctx,
+// so the wrapped net/http code will see the ctx's deadline, cancellation and values
+// (saved by ctx.WithContext or ctx.SetAny) from req.Context().
+// WrapHandler and WrapHandlerFunc use it automatically.
+//
+//  ctx.SetAny("user", user)
+//  someHandler.ServeHTTP(ctx.Res, ctx.IntoRequest())
+//  // req.Context().Value("user") == user in someHandler
+//
+func (ctx *Context) IntoRequest() *http.Request {
+	return ctx.Req.WithContext(&requestContext{ctx._ctx, ctx})
+}
+
+// requestContext is the context of the request returned by ctx.IntoRequest.
+// It doesn't refer to ctx as parent, so that the request's context can be set back
+// by ctx.WithContext safely.
+type requestContext struct {
+	context.Context
+	ctx *Context
+}
+
+func (c *requestContext) Value(key interface{}) interface{} {
+	if val := c.Context.Value(key); val != nil {
+		return val
+	}
+	return c.ctx.value(key)
+}
+
 // Timing runs fn with the given time limit. If a call runs for longer than its time limit,
 // it will return context.DeadlineExceeded as error, otherwise return fn's result.
 func (ctx *Context) Timing(dt time.Duration, fn func(context.Context) interface{}) (res interface{}, err error) {
@@ -211,12 +267,15 @@ func (ctx *Context) Timing(dt time.Duration, fn func(context.Context) interface{
 //  }
 //
 func (ctx *Context) Any(any interface{}) (val interface{}, err error) {
-	var ok bool
-	if val, ok = ctx.kv[any]; !ok {
+	ctx.mu.Lock()
+	val, ok := ctx.kv[any]
+	ctx.mu.Unlock()
+	if !ok {
 		switch v := any.(type) {
 		case Any:
+			// New may call ctx.Any, so it runs without the lock
 			if val, err = v.New(ctx); err == nil {
-				ctx.kv[any] = val
+				ctx.SetAny(any, val)
 			}
 		default:
 			return nil, ErrAnyKeyNonExistent
@@ -228,7 +287,9 @@ func (ctx *Context) Any(any interface{}) (val interface{}, err error) {
 // SetAny save a key, value pair on the ctx.
 // Then we can use ctx.Any(key) to retrieve the value from ctx.
 func (ctx *Context) SetAny(key, val interface{}) {
+	ctx.mu.Lock()
 	ctx.kv[key] = val
+	ctx.mu.Unlock()
 }
 
 // Setting returns App's settings by key
@@ -238,10 +299,7 @@ func (ctx *Context) SetAny(key, val interface{}) {
 //  fmt.Println(ctx.Setting(gear.SetEnv).(string) == "production")
 //
 func (ctx *Context) Setting(key interface{}) interface{} {
-	if val, ok := ctx.app.settings[key]; ok {
-		return val
-	}
-	return nil
+	return ctx.app.Setting(key)
 }
 
 // IP returns the client's network address based on `X-Forwarded-For`
@@ -265,9 +323,14 @@ func (ctx *Context) AcceptType(preferred ...string) string {
 }
 
 // AcceptLanguage returns the most preferred language from the HTTP Accept-Language header.
+// If preferred languages given, the best matched one will be returned, "en" matches "en-US"
+// and "en-US" matches "en" too, the exact matching takes precedence.
 // If nothing accepted, then empty string is returned.
 func (ctx *Context) AcceptLanguage(preferred ...string) string {
-	return negotiator.New(ctx.Req.Header).Language(preferred...)
+	if len(preferred) == 0 {
+		return negotiator.New(ctx.Req.Header).Language()
+	}
+	return matchLanguage(ctx.Accepts(HeaderAcceptLanguage), preferred)
 }
 
 // AcceptEncoding returns the most preferred encoding from the HTTP Accept-Encoding header.
@@ -282,6 +345,69 @@ func (ctx *Context) AcceptCharset(preferred ...string) string {
 	return negotiator.New(ctx.Req.Header).Charset(preferred...)
 }
 
+// Accepts returns the parsed AcceptSpecs of the given Accept* request header,
+// sorted by quality value. The result is cached on the ctx, it should not be modified.
+//
+//  for _, spec := range ctx.Accepts(gear.HeaderAcceptEncoding) {
+//  	fmt.Println(spec.Value, spec.Q)
+//  }
+//
+func (ctx *Context) Accepts(header string) []AcceptSpec {
+	header = http.CanonicalHeaderKey(header)
+	if specs, ok := ctx.accepts[header]; ok {
+		return specs
+	}
+	if ctx.accepts == nil {
+		ctx.accepts = make(map[string][]AcceptSpec, 4)
+	}
+	specs := ParseAccept(ctx.Req.Header.Get(header))
+	ctx.accepts[header] = specs
+	return specs
+}
+
+// Lang returns the best matched language of the app's Locales for the request,
+// it will be the default language of the Locales if nothing matched.
+// Returns empty string if the app's Locales not set.
+func (ctx *Context) Lang() string {
+	if ctx.lang == "" && ctx.app.locales != nil {
+		langs := ctx.app.locales.Languages()
+		if ctx.lang = ctx.AcceptLanguage(langs...); ctx.lang == "" {
+			ctx.lang = langs[0]
+		}
+	}
+	return ctx.lang
+}
+
+// T returns the localized message by key for the request language (ctx.Lang),
+// the message of the default language will be used if not exists, and then the key.
+// If args given, the message will be formatted in the manner of fmt.Sprintf.
+//
+//  app.Set(gear.SetLocales, gear.NewCatalog().
+//  	Add("en", map[string]string{"hello": "Hello, %s!"}).
+//  	Add("zh-CN", map[string]string{"hello": "你好，%s！"}))
+//
+//  app.Use(func(ctx *gear.Context) error {
+//  	// "Accept-Language: zh-CN,zh;q=0.8,en;q=0.6"
+//  	return ctx.HTML(200, ctx.T("hello", "Gear")) // "你好，Gear！"
+//  })
+//
+func (ctx *Context) T(key string, args ...interface{}) string {
+	msg := key
+	if locales := ctx.app.locales; locales != nil {
+		m, ok := locales.Message(ctx.Lang(), key)
+		if !ok {
+			m, ok = locales.Message(locales.Languages()[0], key)
+		}
+		if ok {
+			msg = m
+		}
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
 // Param returns path parameter by name.
 func (ctx *Context) Param(key string) (val string) {
 	if res, _ := ctx.Any(paramsKey); res != nil {
@@ -306,8 +432,227 @@ func (ctx *Context) QueryAll(name string) []string {
 	return ctx.query[name]
 }
 
+// QueryInt returns the query param for the provided name as int.
+// It returns def if the param not exists, or 400 error if the param is not a valid integer.
+//
+//  page, err := ctx.QueryInt("page", 1)
+//  if err != nil {
+//  	return err
+//  }
+//
+func (ctx *Context) QueryInt(name string, def int) (int, error) {
+	return parseInt("query", name, ctx.Query(name), def)
+}
+
+// QueryBool returns the query param for the provided name as bool,
+// accepts 1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False.
+// It returns def if the param not exists, or 400 error if the param is not a valid bool.
+func (ctx *Context) QueryBool(name string, def bool) (bool, error) {
+	return parseBool("query", name, ctx.Query(name), def)
+}
+
+// QueryTime returns the query param for the provided name as time.Time with RFC3339 layout.
+// It returns def if the param not exists, or 400 error if the param is not a valid time.
+func (ctx *Context) QueryTime(name string, def time.Time) (time.Time, error) {
+	return parseTime("query", name, ctx.Query(name), def)
+}
+
+// QueryInts returns all query params for the provided name as []int.
+// It returns 400 error if some param is not a valid integer.
+func (ctx *Context) QueryInts(name string) (res []int, err error) {
+	vals := ctx.QueryAll(name)
+	res = make([]int, len(vals))
+	for i, val := range vals {
+		if res[i], err = parseInt("query", name, val, 0); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// QueryBools returns all query params for the provided name as []bool.
+// It returns 400 error if some param is not a valid bool.
+func (ctx *Context) QueryBools(name string) (res []bool, err error) {
+	vals := ctx.QueryAll(name)
+	res = make([]bool, len(vals))
+	for i, val := range vals {
+		if res[i], err = parseBool("query", name, val, false); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// QueryTimes returns all query params for the provided name as []time.Time with RFC3339 layout.
+// It returns 400 error if some param is not a valid time.
+func (ctx *Context) QueryTimes(name string) (res []time.Time, err error) {
+	vals := ctx.QueryAll(name)
+	res = make([]time.Time, len(vals))
+	for i, val := range vals {
+		if res[i], err = parseTime("query", name, val, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// ParamInt returns path parameter by name as int.
+// It returns def if the parameter not exists, or 400 error if the parameter is not a valid integer.
+func (ctx *Context) ParamInt(key string, def int) (int, error) {
+	return parseInt("param", key, ctx.Param(key), def)
+}
+
+// ParamBool returns path parameter by name as bool.
+// It returns def if the parameter not exists, or 400 error if the parameter is not a valid bool.
+func (ctx *Context) ParamBool(key string, def bool) (bool, error) {
+	return parseBool("param", key, ctx.Param(key), def)
+}
+
+// ParamTime returns path parameter by name as time.Time with RFC3339 layout.
+// It returns def if the parameter not exists, or 400 error if the parameter is not a valid time.
+func (ctx *Context) ParamTime(key string, def time.Time) (time.Time, error) {
+	return parseTime("param", key, ctx.Param(key), def)
+}
+
+func parseInt(kind, name, val string, def int) (int, error) {
+	if val == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return def, invalidValueError(kind, name, val)
+	}
+	return i, nil
+}
+
+func parseBool(kind, name, val string, def bool) (bool, error) {
+	if val == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return def, invalidValueError(kind, name, val)
+	}
+	return b, nil
+}
+
+func parseTime(kind, name, val string, def time.Time) (time.Time, error) {
+	if val == "" {
+		return def, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return def, invalidValueError(kind, name, val)
+	}
+	return t, nil
+}
+
+func invalidValueError(kind, name, val string) error {
+	return &Error{Code: http.StatusBadRequest, Msg: fmt.Sprintf(`invalid %s "%s": "%s"`, kind, name, val)}
+}
+
+// QueryNested returns the query params parsed with bracket keys (Rails/PHP style)
+// into nested maps and slices, for compatibility with common JS clients.
+//
+//  // ?filter[status]=open&filter[tag]=go&ids[]=1&ids[]=2&q=gear
+//  query, err := ctx.QueryNested()
+//  // query == map[string]interface{}{
+//  // 	"filter": map[string]interface{}{"status": "open", "tag": "go"},
+//  // 	"ids":    []string{"1", "2"},
+//  // 	"q":      "gear",
+//  // }
+//
+// A key that has more than one value will be parsed to []string.
+// It returns 400 error if the keys conflict (such as "a=1&a[b]=2"), or nest deeper than 5 levels.
+func (ctx *Context) QueryNested() (map[string]interface{}, error) {
+	if ctx.query == nil {
+		ctx.query = ctx.Req.URL.Query()
+	}
+	return parseNestedQuery(ctx.query)
+}
+
+const maxNestedQueryDepth = 5
+
+func parseNestedQuery(query url.Values) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	// parent keys are processed before its children, so the conflicts can be found.
+	sort.Strings(keys)
+
+	res := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		segs := splitNestedQueryKey(key)
+		if segs == nil {
+			return nil, &Error{Code: http.StatusBadRequest, Msg: fmt.Sprintf(`invalid query key "%s"`, key)}
+		}
+		if len(segs) > maxNestedQueryDepth+1 {
+			return nil, &Error{Code: http.StatusBadRequest, Msg: fmt.Sprintf(`query key "%s" is too deep`, key)}
+		}
+
+		var val interface{}
+		vals := query[key]
+		if last := len(segs) - 1; segs[last] == "" {
+			segs = segs[:last]
+			val = vals
+		} else if len(vals) == 1 {
+			val = vals[0]
+		} else {
+			val = vals
+		}
+
+		m := res
+		for i, seg := range segs {
+			child, ok := m[seg]
+			if i == len(segs)-1 {
+				if ok {
+					return nil, &Error{Code: http.StatusBadRequest, Msg: fmt.Sprintf(`query key "%s" conflicts`, key)}
+				}
+				m[seg] = val
+				break
+			}
+			if !ok {
+				child = make(map[string]interface{})
+				m[seg] = child
+			}
+			if m, ok = child.(map[string]interface{}); !ok {
+				return nil, &Error{Code: http.StatusBadRequest, Msg: fmt.Sprintf(`query key "%s" conflicts`, key)}
+			}
+		}
+	}
+	return res, nil
+}
+
+// splitNestedQueryKey splits "a[b][c][]" to ["a", "b", "c", ""].
+// A malformed bracket key is treated as a plain key, returns nil if it is invalid.
+func splitNestedQueryKey(key string) []string {
+	i := strings.IndexByte(key, '[')
+	if i <= 0 {
+		return []string{key}
+	}
+	segs := []string{key[:i]}
+	rest := key[i:]
+	for rest != "" {
+		j := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || j < 0 {
+			return []string{key}
+		}
+		segs = append(segs, rest[1:j])
+		rest = rest[j+1:]
+	}
+	for _, seg := range segs[1 : len(segs)-1] {
+		if seg == "" {
+			return nil // "[]" must be the last one
+		}
+	}
+	return segs
+}
+
 // ParseBody parses request content with BodyParser, DefaultBodyParser support JSON and XML.
 // stores the result in the value pointed to by BodyTemplate body, and validate it.
+// If the BodyTemplate implements SchemaBody, the JSON content will be validated with
+// the JSON Schema before parsed.
 //
 // Defaine a BodyTemplate type in some API:
 //  type jsonBodyTemplate struct {
@@ -338,7 +683,6 @@ func (ctx *Context) ParseBody(body BodyTemplate) error {
 	}
 
 	var err error
-	var buf []byte
 	var mediaType string
 	var params map[string]string
 	if mediaType = ctx.Get(HeaderContentType); mediaType == "" {
@@ -350,10 +694,21 @@ func (ctx *Context) ParseBody(body BodyTemplate) error {
 	}
 
 	reader := http.MaxBytesReader(ctx.Res, ctx.Req.Body, ctx.app.bodyParser.MaxBytes())
-	if buf, err = ioutil.ReadAll(reader); err != nil {
+	b := ctx.app.bufPool.Get(int(ctx.Req.ContentLength))
+	defer ctx.app.bufPool.Put(b)
+	if _, err = b.ReadFrom(reader); err != nil {
+		if e, ok := err.(HTTPError); ok {
+			return e
+		}
 		// err may not be 413 Request entity too large, just make it to 413
 		return &Error{Code: http.StatusRequestEntityTooLarge, Msg: err.Error()}
 	}
+	buf := b.Bytes()
+	if sb, ok := body.(SchemaBody); ok && isJSONMediaType(mediaType) {
+		if err = sb.JSONSchema().ValidateJSON(buf); err != nil {
+			return err
+		}
+	}
 	if err = ctx.app.bodyParser.Parse(buf, body, mediaType, params["charset"]); err != nil {
 		return err
 	}
@@ -370,6 +725,132 @@ func (ctx *Context) Set(key, value string) {
 	ctx.Res.Set(key, value)
 }
 
+// SetHeaders saves the key-value pairs to the response Header, the keys will be canonicalized.
+func (ctx *Context) SetHeaders(headers map[string]string) {
+	for key, value := range headers {
+		ctx.Res.Set(key, value)
+	}
+}
+
+// AppendHeader appends the values to the response Header with the key, the existing values will be kept.
+func (ctx *Context) AppendHeader(key string, values ...string) {
+	header := ctx.Res.Header()
+	for _, value := range values {
+		header.Add(key, value)
+	}
+}
+
+// Vary adds the fields to the response Vary header, the fields that already exist will be ignored.
+func (ctx *Context) Vary(fields ...string) {
+	ctx.Res.Vary(fields...)
+}
+
+// Fresh returns true if the response is still "fresh" in the client's cache, it checks the
+// request If-None-Match and If-Modified-Since headers against the response ETag and
+// Last-Modified headers, so it should be called after these headers set. Only GET and HEAD
+// requests with 2xx or 304 status (or status not set) can be fresh, and the request with
+// "Cache-Control: no-cache" is never fresh.
+//
+//  ctx.Set(gear.HeaderETag, etag)
+//  if ctx.Fresh() {
+//  	return ctx.End(http.StatusNotModified)
+//  }
+//  return ctx.JSON(http.StatusOK, data)
+//
+func (ctx *Context) Fresh() bool {
+	if ctx.Method != http.MethodGet && ctx.Method != http.MethodHead {
+		return false
+	}
+	if s := ctx.Res.status; s != 0 && s != http.StatusNotModified && (s < 200 || s >= 300) {
+		return false
+	}
+
+	noneMatch := ctx.Get(HeaderIfNoneMatch)
+	modifiedSince := ctx.Get(HeaderIfModifiedSince)
+	if noneMatch == "" && modifiedSince == "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(ctx.Get(HeaderCacheControl)), "no-cache") {
+		return false
+	}
+
+	if noneMatch != "" && noneMatch != "*" {
+		etag := ctx.Res.Get(HeaderETag)
+		if etag == "" || !matchETag(noneMatch, etag) {
+			return false
+		}
+	}
+	if modifiedSince != "" {
+		lastModified, err := http.ParseTime(ctx.Res.Get(HeaderLastModified))
+		if err != nil {
+			return false
+		}
+		if since, err := http.ParseTime(modifiedSince); err != nil || lastModified.After(since) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stale is the opposite of ctx.Fresh.
+func (ctx *Context) Stale() bool {
+	return !ctx.Fresh()
+}
+
+// matchETag checks the ETag against the comma-separated list with weak comparison.
+func matchETag(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectContinue returns true if the request has "Expect: 100-continue" header
+// and the client is waiting for "100 Continue" to send the request body. Go's
+// HTTP server sends "100 Continue" when the request body first read, so middlewares
+// can reject the request early by responding without reading the body.
+// See app setting SetExpectContinue.
+func (ctx *Context) ExpectContinue() bool {
+	return ctx.Req.ProtoAtLeast(1, 1) && ctx.Req.ContentLength != 0 &&
+		strings.Contains(strings.ToLower(ctx.Get(HeaderExpect)), "100-continue")
+}
+
+// GetTrailer retrieves data from the request trailers. The trailers are only
+// available after the request body has been read completely (such as by ctx.ParseBody).
+func (ctx *Context) GetTrailer(key string) string {
+	return ctx.Req.Trailer.Get(key)
+}
+
+// DeclareTrailer declares the response trailers by "Trailer" header, the response
+// will be sent with chunked encoding (without Content-Length) in HTTP/1.1, so that the
+// trailers can be set by ctx.SetTrailer after the body written.
+// It returns ErrHeaderWrote if the response header has been written.
+//
+//  ctx.DeclareTrailer("X-Checksum")
+//  h := sha256.New()
+//  io.Copy(io.MultiWriter(ctx.Res, h), file)
+//  ctx.SetTrailer("X-Checksum", hex.EncodeToString(h.Sum(nil)))
+//
+func (ctx *Context) DeclareTrailer(keys ...string) error {
+	if ctx.Res.wroteHeader.isTrue() {
+		return ErrHeaderWrote
+	}
+	for _, key := range keys {
+		ctx.Res.Header().Add(HeaderTrailer, http.CanonicalHeaderKey(key))
+	}
+	return nil
+}
+
+// SetTrailer sets the response trailer, it can be called before or after the body written,
+// the trailer will be sent after the body. The trailer should be declared by ctx.DeclareTrailer,
+// otherwise it may be dropped by HTTP/1.1 response with Content-Length header.
+func (ctx *Context) SetTrailer(key, value string) {
+	ctx.Res.Header().Set(http.TrailerPrefix+http.CanonicalHeaderKey(key), value)
+}
+
 // Status set a status code (optional) to the response, returns the new status code.
 func (ctx *Context) Status(code ...int) int {
 	if len(code) > 0 && IsStatusCode(code[0]) {
@@ -381,7 +862,7 @@ func (ctx *Context) Status(code ...int) int {
 // Type set a content type (optional) to the response, returns the new content type.
 func (ctx *Context) Type(str ...string) string {
 	if len(str) > 0 {
-		ctx.Res.Set(HeaderContentType, str[0])
+		ctx.Res.setHeader(HeaderContentType, str[0])
 	}
 	return ctx.Res.Get(HeaderContentType)
 }
@@ -396,15 +877,17 @@ func (ctx *Context) HTML(code int, str string) error {
 }
 
 // JSON set a JSON body with status code to response.
+// The value will be encoded with the app setting SetJSONOptions (indented in "development" env by default).
 // It will end the ctx. The middlewares after current middleware will not run.
 // "after hooks" (if no error) and "end hooks" will run normally.
 // Note that this will not stop the current handler.
 func (ctx *Context) JSON(code int, val interface{}) error {
-	buf, err := json.Marshal(val)
+	buf, err := ctx.app.jsonOpts().marshal(ctx.app.bufPool, val)
 	if err != nil {
 		return ctx.Error(err)
 	}
-	return ctx.JSONBlob(code, buf)
+	defer ctx.app.bufPool.Put(buf)
+	return ctx.JSONBlob(code, buf.Bytes())
 }
 
 // JSONBlob set a JSON blob body with status code to response.
@@ -421,21 +904,28 @@ func (ctx *Context) JSONBlob(code int, buf []byte) error {
 // "after hooks" (if no error) and "end hooks" will run normally.
 // Note that this will not stop the current handler.
 func (ctx *Context) JSONP(code int, callback string, val interface{}) error {
-	buf, err := json.Marshal(val)
+	buf, err := ctx.app.jsonOpts().marshal(ctx.app.bufPool, val)
 	if err != nil {
 		return ctx.Error(err)
 	}
-	return ctx.JSONPBlob(code, callback, buf)
+	defer ctx.app.bufPool.Put(buf)
+	return ctx.JSONPBlob(code, callback, buf.Bytes())
 }
 
 // JSONPBlob sends a JSONP blob response with status code. It uses `callback`
 // to construct the JSONP payload.
+// The callback should be a JavaScript identifier or a dot-separated member expression
+// (such as "cb", "app.handlers.cb") not longer than 128 bytes,
+// otherwise a 400 error will be responded.
 // It will end the ctx. The middlewares after current middleware will not run.
 // "after hooks" and "end hooks" will run normally.
 // Note that this will not stop the current handler.
 func (ctx *Context) JSONPBlob(code int, callback string, buf []byte) error {
+	if len(callback) > maxJSONPCallbackLen || !jsonpCallbackReg.MatchString(callback) {
+		return ctx.Error(&Error{Code: http.StatusBadRequest, Msg: fmt.Sprintf("invalid JSONP callback %q", callback)})
+	}
 	ctx.Type(MIMEApplicationJavaScriptCharsetUTF8)
-	ctx.Set(HeaderXContentTypeOptions, "nosniff")
+	ctx.Res.setHeader(HeaderXContentTypeOptions, "nosniff")
 	// the /**/ is a specific security mitigation for "Rosetta Flash JSONP abuse"
 	// @see http://miki.it/blog/2014/7/8/abusing-jsonp-with-rosetta-flash/
 	// the typeof check is just to reduce client error noise
@@ -444,6 +934,49 @@ func (ctx *Context) JSONPBlob(code int, callback string, buf []byte) error {
 	return ctx.End(code, append(b, ')', ';'))
 }
 
+// Encode marshals the value with the codec registered for the media type
+// (see gear.RegisterCodec), and sets it as the body with status code to response.
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+//
+//  return ctx.Encode(http.StatusOK, gear.MIMEApplicationMsgpack, data)
+//
+func (ctx *Context) Encode(code int, mediaType string, val interface{}) error {
+	codec, ok := lookupCodec(mediaType)
+	if !ok {
+		return ctx.Error(NewAppError("codec not registered: " + mediaType))
+	}
+	buf, err := codec.Marshal(val)
+	if err != nil {
+		return ctx.Error(err)
+	}
+	ctx.Type(mediaType)
+	return ctx.End(code, buf)
+}
+
+// Negotiate responds the value with the most preferred media type from the HTTP Accept header,
+// in JSON, XML and the media types registered by gear.RegisterCodec. JSON will be used
+// if no Accept header, and 406 error will be responded if nothing accepted.
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+func (ctx *Context) Negotiate(code int, val interface{}) error {
+	ctx.Res.Vary(HeaderAccept)
+	switch mediaType := ctx.AcceptType(codecTypes()...); mediaType {
+	case "":
+		return ctx.Error(&Error{Code: http.StatusNotAcceptable, Msg: "not acceptable media type"})
+	case MIMEApplicationJSON:
+		return ctx.JSON(code, val)
+	case MIMEApplicationXML:
+		return ctx.XML(code, val)
+	case MIMEApplicationYAML:
+		return ctx.YAML(code, val)
+	default:
+		return ctx.Encode(code, mediaType, val)
+	}
+}
+
 // XML set an XML body with status code to response.
 // It will end the ctx. The middlewares after current middleware will not run.
 // "after hooks" (if no error) and "end hooks" will run normally.
@@ -465,6 +998,65 @@ func (ctx *Context) XMLBlob(code int, buf []byte) error {
 	return ctx.End(code, buf)
 }
 
+// YAML set a YAML body with status code to response. A YAML codec should be registered
+// for "application/yaml" media type before, it will also be used to parse YAML request body
+// ("application/yaml", "application/x-yaml", "text/yaml" and "text/x-yaml").
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" (if no error) and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+//
+//  import "gopkg.in/yaml.v2"
+//
+//  gear.RegisterCodec(gear.MIMEApplicationYAML, gear.CodecFunc{
+//  	MarshalFunc:   yaml.Marshal,
+//  	UnmarshalFunc: yaml.Unmarshal,
+//  })
+//
+func (ctx *Context) YAML(code int, val interface{}) error {
+	codec, ok := lookupCodec(MIMEApplicationYAML)
+	if !ok {
+		return ctx.Error(NewAppError("codec not registered: " + MIMEApplicationYAML))
+	}
+	buf, err := codec.Marshal(val)
+	if err != nil {
+		return ctx.Error(err)
+	}
+	return ctx.YAMLBlob(code, buf)
+}
+
+// YAMLBlob set a YAML blob body with status code to response.
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+func (ctx *Context) YAMLBlob(code int, buf []byte) error {
+	ctx.Type(MIMEApplicationYAMLCharsetUTF8)
+	return ctx.End(code, buf)
+}
+
+// Flush sends the buffered response data to the client, it is useful for progress-style
+// responses. The header will be written and "after hooks" will run on the first flush,
+// so the middlewares after current middleware will not run. The compressed data will be
+// flushed too, and the body transformation (ctx.Transform) will be skipped.
+//
+//  for i := 0; i < 10; i++ {
+//  	fmt.Fprintf(ctx.Res, "progress: %d%%\n", i*10)
+//  	ctx.Flush()
+//  }
+//
+func (ctx *Context) Flush() {
+	ctx.Res.Flush()
+}
+
+// DisableBuffering makes the response be flushed after every write, and sets the
+// "X-Accel-Buffering: no" header to disable proxy buffering (such as nginx).
+// If app setting SetCompress exists, the response will still be compressed, but the
+// compressor will be flushed on every write too. The body transformation (ctx.Transform)
+// will be skipped. It should be called before writing the response.
+func (ctx *Context) DisableBuffering() {
+	ctx.Res.noBuffering = true
+	ctx.Res.setHeader(HeaderXAccelBuffering, "no")
+}
+
 // Render renders a template with data and sends a text/html response with status
 // code. Templates can be registered using `app.Renderer = Renderer`.
 // It will end the ctx. The middlewares after current middleware will not run.
@@ -513,21 +1105,90 @@ func (ctx *Context) Attachment(name string, modtime time.Time, content io.ReadSe
 	return
 }
 
-// Redirect redirects the request with status code 302.
-// You can use other status code with ctx.Status method, It is a wrap of http.Redirect.
+// Redirect redirects the request with status code 303 for POST request, 302 otherwise.
+// You can use other status code with ctx.Status method or ctx.RedirectStatus method.
+// The relative url (such as "edit", "../list", "?page=2") will be resolved against
+// the current request URL. It is a wrap of http.Redirect.
 // It will end the ctx. The middlewares after current middleware will not run.
 // "after hooks" and "end hooks" will run normally.
 // Note that this will not stop the current handler.
 func (ctx *Context) Redirect(url string) (err error) {
 	if ctx.ended.swapTrue() {
 		if !isRedirectStatus(ctx.Res.status) {
-			ctx.Res.status = http.StatusFound
+			if ctx.Method == http.MethodPost {
+				ctx.Res.status = http.StatusSeeOther
+			} else {
+				ctx.Res.status = http.StatusFound
+			}
 		}
-		http.Redirect(ctx.Res, ctx.Req, url, ctx.Res.status)
+		http.Redirect(ctx.Res, ctx.Req, ctx.resolveURL(url), ctx.Res.status)
 	}
 	return
 }
 
+// RedirectStatus redirects the request with the redirect status code, such as
+// 301 (http.StatusMovedPermanently), 307 (http.StatusTemporaryRedirect)
+// and 308 (http.StatusPermanentRedirect). It will panic if the code is not a redirect status.
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+func (ctx *Context) RedirectStatus(code int, url string) error {
+	if !isRedirectStatus(code) {
+		panic(NewAppError("invalid redirect status code: " + strconv.Itoa(code)))
+	}
+	ctx.Res.status = code
+	return ctx.Redirect(url)
+}
+
+// Back redirects the request to the Referer if it is the same host as the current request,
+// otherwise redirects to the fallback url, it is useful after a form submitted.
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+//
+//  return ctx.Back("/")
+//
+func (ctx *Context) Back(fallback string) error {
+	if referer := ctx.Get(HeaderReferer); referer != "" {
+		if u, err := url.Parse(referer); err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+			u.Host == ctx.Host && u.User == nil {
+			return ctx.Redirect(u.RequestURI())
+		}
+	}
+	return ctx.Redirect(fallback)
+}
+
+// resolveURL resolves the relative url reference against the request URL.
+func (ctx *Context) resolveURL(ref string) string {
+	if ref == "" || ref[0] == '/' {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return ref
+	}
+	res := ctx.Req.URL.ResolveReference(u)
+	if res.Fragment != "" {
+		return res.RequestURI() + "#" + res.EscapedFragment()
+	}
+	return res.RequestURI()
+}
+
+// LogError writes the error to the app's logger by app.Error. It is used to report the errors
+// that can't be responded, such as the errors in "end hooks" and the tasks of ctx.Defer.
+//
+//  ctx.OnEnd(func() {
+//  	if err := store.Unlock(key); err != nil {
+//  		ctx.LogError(err)
+//  	}
+//  })
+//
+func (ctx *Context) LogError(err error) {
+	if err != nil {
+		ctx.app.Error(err)
+	}
+}
+
 // Error send a error to response.
 // It will not reset response headers and not use app.OnError hook
 // It will end the ctx. The middlewares after current middleware and "after hooks" will not run.
@@ -536,11 +1197,18 @@ func (ctx *Context) Redirect(url string) (err error) {
 func (ctx *Context) Error(e error) error {
 	ctx.cleanAfterHooks() // clear afterHooks when any error
 	ctx.Res.ResetHeader()
+	ctx.Res.limit = 0 // the error responses are not limited
 	err := ParseError(e, ctx.Res.status)
 	if err == nil {
 		err = &Error{Code: http.StatusInternalServerError, Msg: NewAppError("nil error").Error()}
 	}
-	if ctx.app.onerror != nil {
+	if rl, ok := err.(*RateLimitError); ok {
+		ctx.SetRateLimit(rl.RateLimit)
+		ctx.Set(HeaderRetryAfter, rl.retryAfter())
+	}
+	if ctx.onerror != nil {
+		ctx.onerror(ctx, err)
+	} else if ctx.app.onerror != nil {
 		ctx.app.onerror(ctx, err)
 	}
 	//  try to respond error if `OnError` does't do it.
@@ -548,6 +1216,14 @@ func (ctx *Context) Error(e error) error {
 	return nil
 }
 
+// SetErrorHandler sets an error handler for the ctx, it overrides the app's OnError hook to render
+// the errors of the request, such as rendering the HTML error pages for the views while the API
+// responds JSON errors. It is set by Router.OnError for the routes of the router, and by
+// WithErrorHandler for a route.
+func (ctx *Context) SetErrorHandler(handle func(ctx *Context, err HTTPError)) {
+	ctx.onerror = handle
+}
+
 // ErrorStatus send a error by status code to response. The status should be 4xx or 5xx code.
 // It will not reset response headers and not use app.OnError hook
 // It will end the ctx. The middlewares after current middleware and "after hooks" will not run.
@@ -572,6 +1248,9 @@ func (ctx *Context) End(code int, buf ...[]byte) (err error) {
 		if len(buf) > 0 {
 			body = buf[0]
 		}
+		if ctx.app.autoETag && ctx.autoETag(code, body) {
+			code, body = http.StatusNotModified, nil
+		}
 		err = ctx.Res.respond(code, body)
 	}
 	return
@@ -605,16 +1284,21 @@ func (ctx *Context) respondError(err HTTPError) {
 		if code == 500 || code > 501 || code < 400 {
 			ctx.app.Error(err)
 		}
-		ctx.Set(HeaderContentType, MIMETextPlainCharsetUTF8)
-		ctx.Set(HeaderXContentTypeOptions, "nosniff")
+		ctx.Res.setHeader(HeaderContentType, MIMETextPlainCharsetUTF8)
+		ctx.Res.setHeader(HeaderXContentTypeOptions, "nosniff")
+		ctx.Res.limit = 0 // the error responses are not limited
 		ctx.Res.respond(code, []byte(err.Error()))
 	}
 }
 
 func (ctx *Context) handleCompress() (cw *compressWriter) {
 	if ctx.app.compress != nil && ctx.Method != http.MethodHead && ctx.Method != http.MethodOptions {
+		if s, ok := ctx.app.compress.(CompressSkipper); ok && s.SkipCompress(ctx) {
+			return
+		}
 		if cw = newCompress(ctx.Res, ctx.app.compress, ctx.AcceptEncoding("gzip", "deflate")); cw != nil {
 			ctx.Res.rw = cw // override with http.ResponseWriter wrapper.
+			ctx.Res.compress = cw
 		}
 	}
 	return
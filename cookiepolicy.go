@@ -0,0 +1,76 @@
+package gear
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CookiePolicy is the options of app setting SetCookiePolicy. It is applied to all the cookies
+// in the response Set-Cookie headers before the headers written, whether they are set by
+// ctx.Cookies, http.SetCookie or any other way.
+type CookiePolicy struct {
+	// Secure adds the Secure attribute to the cookies. It should be true if the app is served
+	// over HTTPS only.
+	Secure bool
+	// HTTPOnly adds the HttpOnly attribute to the cookies.
+	HTTPOnly bool
+	// SameSite defines the default SameSite attribute of the cookies without it, such as
+	// http.SameSiteLaxMode. The zero value means no default.
+	SameSite http.SameSite
+	// Strict drops the non-compliant cookies with an error logged, otherwise the non-compliant
+	// cookies are kept with a warning logged. The non-compliant cookies are:
+	// the "__Secure-" prefixed cookies without Secure attribute, the "__Host-" prefixed cookies
+	// without Secure attribute, with Domain attribute or with Path other than "/", and the
+	// cookies with "SameSite=None" but without Secure attribute.
+	Strict bool
+}
+
+// apply applies the policy to the response Set-Cookie headers.
+func (p *CookiePolicy) apply(ctx *Context) {
+	header := ctx.Res.Header()
+	values := header[HeaderSetCookie]
+	if len(values) == 0 {
+		return
+	}
+
+	res := make([]string, 0, len(values))
+	for _, value := range values {
+		cookie, err := http.ParseSetCookie(value)
+		if err != nil {
+			res = append(res, value)
+			continue
+		}
+		if p.Secure {
+			cookie.Secure = true
+		}
+		if p.HTTPOnly {
+			cookie.HttpOnly = true
+		}
+		if cookie.SameSite == 0 && p.SameSite != 0 {
+			cookie.SameSite = p.SameSite
+		}
+
+		if msg := checkCookie(cookie); msg != "" {
+			if p.Strict {
+				ctx.app.Error(fmt.Errorf("Gear: cookie %q dropped, %s", cookie.Name, msg))
+				continue
+			}
+			ctx.app.logger.Printf("Gear: cookie %q is not compliant, %s", cookie.Name, msg)
+		}
+		res = append(res, cookie.String())
+	}
+	header[HeaderSetCookie] = res
+}
+
+func checkCookie(cookie *http.Cookie) string {
+	switch {
+	case strings.HasPrefix(cookie.Name, "__Secure-") && !cookie.Secure:
+		return "__Secure- prefix requires Secure attribute"
+	case strings.HasPrefix(cookie.Name, "__Host-") && (!cookie.Secure || cookie.Domain != "" || cookie.Path != "/"):
+		return "__Host- prefix requires Secure attribute, Path=/ and no Domain attribute"
+	case cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure:
+		return "SameSite=None requires Secure attribute"
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package gear
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearCookiePolicy(t *testing.T) {
+	newApp := func(policy CookiePolicy, buf *bytes.Buffer) *App {
+		app := New()
+		app.Set(SetLogger, log.New(buf, "", 0))
+		app.Set(SetCookiePolicy, policy)
+		app.Use(func(ctx *Context) error {
+			ctx.Cookies.Set("session", "abc", &cookie.Options{Path: "/"})
+			http.SetCookie(ctx.Res, &http.Cookie{Name: "theme", Value: "dark", SameSite: http.SameSiteStrictMode})
+			http.SetCookie(ctx.Res, &http.Cookie{Name: "__Host-id", Value: "1", Path: "/app"})
+			http.SetCookie(ctx.Res, &http.Cookie{Name: "__Secure-id", Value: "2"})
+			http.SetCookie(ctx.Res, &http.Cookie{Name: "third", Value: "3", SameSite: http.SameSiteNoneMode})
+			return ctx.End(204)
+		})
+		return app
+	}
+	request := func(app *App) []string {
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, httptest.NewRequest("GET", "http://example.com/", nil))
+		return res.Header()[HeaderSetCookie]
+	}
+
+	assert.Panics(t, func() {
+		New().Set(SetCookiePolicy, true)
+	})
+
+	t.Run("Should apply the defaults and warn the non-compliant cookies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		buf := new(bytes.Buffer)
+		cookies := request(newApp(CookiePolicy{HTTPOnly: true, SameSite: http.SameSiteLaxMode}, buf))
+		assert.Equal([]string{
+			"session=abc; Path=/; HttpOnly; SameSite=Lax",
+			"theme=dark; HttpOnly; SameSite=Strict",
+			"__Host-id=1; Path=/app; HttpOnly; SameSite=Lax",
+			"__Secure-id=2; HttpOnly; SameSite=Lax",
+			"third=3; HttpOnly; SameSite=None",
+		}, cookies)
+		logs := buf.String()
+		assert.Contains(logs, `Gear: cookie "__Host-id" is not compliant, __Host- prefix requires Secure attribute, Path=/ and no Domain attribute`)
+		assert.Contains(logs, `Gear: cookie "__Secure-id" is not compliant, __Secure- prefix requires Secure attribute`)
+		assert.Contains(logs, `Gear: cookie "third" is not compliant, SameSite=None requires Secure attribute`)
+	})
+
+	t.Run("Should drop the non-compliant cookies in strict mode", func(t *testing.T) {
+		assert := assert.New(t)
+
+		buf := new(bytes.Buffer)
+		cookies := request(newApp(CookiePolicy{Strict: true}, buf))
+		assert.Equal([]string{"session=abc; Path=/", "theme=dark; SameSite=Strict"}, cookies)
+		assert.Equal(3, strings.Count(buf.String(), "dropped"))
+
+		buf.Reset()
+		cookies = request(newApp(CookiePolicy{Secure: true, Strict: true}, buf))
+		assert.Equal([]string{
+			"session=abc; Path=/; Secure",
+			"theme=dark; Secure; SameSite=Strict",
+			"__Secure-id=2; Secure",
+			"third=3; Secure; SameSite=None",
+		}, cookies)
+		assert.Contains(buf.String(), `Gear: cookie "__Host-id" dropped`)
+	})
+}
@@ -0,0 +1,102 @@
+package gear
+
+import (
+	"encoding/csv"
+	"mime"
+)
+
+// CSVOptions is the options of ctx.CSV.
+type CSVOptions struct {
+	// Filename sets the Content-Disposition header to prompt client to save the CSV as the file.
+	Filename string
+	// Comma is the field delimiter, default to ','.
+	Comma rune
+	// UseCRLF uses "\r\n" as the line terminator.
+	UseCRLF bool
+	// BOM writes the UTF-8 byte order mark before the CSV, so that Excel opens it as UTF-8.
+	BOM bool
+	// FlushRows flushes the response every FlushRows rows, default to 100.
+	FlushRows int
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// CSV sends a streaming CSV response with status code, the header (if not nil) and the rows
+// received from the channel are written as records until the channel closed. The response is
+// flushed periodically, so that a large export is sent while the rows are produced. The producer
+// should close the rows channel when done, and stop when ctx.Done() closed (the client gone),
+// in that case CSV returns the ctx.Err().
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+//
+//  rows := make(chan []string)
+//  go func() {
+//  	defer close(rows)
+//  	for _, u := range users {
+//  		select {
+//  		case rows <- []string{u.ID, u.Name}:
+//  		case <-ctx.Done():
+//  			return
+//  		}
+//  	}
+//  }()
+//  return ctx.CSV(200, []string{"id", "name"}, rows, gear.CSVOptions{Filename: "users.csv", BOM: true})
+//
+func (ctx *Context) CSV(code int, header []string, rows <-chan []string, options ...CSVOptions) (err error) {
+	if !ctx.ended.swapTrue() {
+		return
+	}
+	var opts CSVOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.FlushRows <= 0 {
+		opts.FlushRows = 100
+	}
+
+	ctx.Status(code)
+	ctx.Type(MIMETextCSVCharsetUTF8)
+	if opts.Filename != "" {
+		ctx.Set(HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": opts.Filename}))
+	}
+	if opts.BOM {
+		if _, err = ctx.Res.Write(utf8BOM); err != nil {
+			return
+		}
+	}
+
+	w := csv.NewWriter(ctx.Res)
+	if opts.Comma != 0 {
+		w.Comma = opts.Comma
+	}
+	w.UseCRLF = opts.UseCRLF
+	if header != nil {
+		if err = w.Write(header); err != nil {
+			return
+		}
+	}
+
+	n := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case row, ok := <-rows:
+			if !ok {
+				w.Flush()
+				return w.Error()
+			}
+			if err = w.Write(row); err != nil {
+				return
+			}
+			if n++; n%opts.FlushRows == 0 {
+				w.Flush()
+				if err = w.Error(); err != nil {
+					return
+				}
+				ctx.Res.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package gear
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextCSV(t *testing.T) {
+	produce := func(n int) <-chan []string {
+		rows := make(chan []string)
+		go func() {
+			defer close(rows)
+			for i := 0; i < n; i++ {
+				rows <- []string{strconv.Itoa(i), "name, " + strconv.Itoa(i)}
+			}
+		}()
+		return rows
+	}
+
+	t.Run("should send the rows", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			return ctx.CSV(200, []string{"id", "name"}, produce(3))
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		res, err := RequestBy("GET", "http://"+srv.Addr().String())
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(MIMETextCSVCharsetUTF8, res.Header.Get(HeaderContentType))
+		assert.Equal("", res.Header.Get(HeaderContentDisposition))
+		assert.Equal("id,name\n0,\"name, 0\"\n1,\"name, 1\"\n2,\"name, 2\"\n", PickRes(res.Text()).(string))
+		res.Body.Close()
+	})
+
+	t.Run("should work with options", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			return ctx.CSV(201, nil, produce(250), CSVOptions{
+				Filename:  "用户.csv",
+				Comma:     ';',
+				UseCRLF:   true,
+				BOM:       true,
+				FlushRows: 100,
+			})
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		res, err := RequestBy("GET", "http://"+srv.Addr().String())
+		assert.Nil(err)
+		assert.Equal(201, res.StatusCode)
+		assert.Equal("", res.Header.Get(HeaderContentLength))
+		assert.Equal("attachment; filename*=utf-8''%E7%94%A8%E6%88%B7.csv", res.Header.Get(HeaderContentDisposition))
+		body := PickRes(res.Text()).(string)
+		assert.Equal("\xEF\xBB\xBF0;name, 0\r\n1;name, 1\r\n", body[:25])
+		assert.Equal("249;name, 249\r\n", body[len(body)-15:])
+		res.Body.Close()
+	})
+
+	t.Run("should stop when ctx canceled", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest("GET", "http://example.com", nil).WithContext(c)
+		ctx := NewContext(New(), httptest.NewRecorder(), req)
+		cancel()
+		err := ctx.CSV(200, []string{"id"}, make(chan []string))
+		assert.NotNil(err)
+		assert.Equal(ctx.Err(), err)
+		assert.Nil(ctx.CSV(200, []string{"id"}, make(chan []string)))
+	})
+}
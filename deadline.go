@@ -0,0 +1,149 @@
+package gear
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// deadlineContext is the base context of the gear.Context, its deadline is set by the app setting
+// SetTimeout and can be reset by ctx.SetTimeout, so a route can override the app's timeout.
+// The children contexts see the current deadline and are done when it exceeded.
+type deadlineContext struct {
+	parent   context.Context
+	mu       sync.Mutex
+	done     chan struct{}
+	err      error
+	deadline time.Time
+	timer    *time.Timer
+	funcs    map[*func()]struct{}
+	stop     func() bool
+}
+
+func newDeadlineContext(parent context.Context, timeout time.Duration) *deadlineContext {
+	c := &deadlineContext{parent: parent, done: make(chan struct{})}
+	c.mu.Lock()
+	c.stop = context.AfterFunc(parent, func() {
+		c.cancel(parent.Err())
+	})
+	c.mu.Unlock()
+	if timeout > 0 {
+		c.setTimeout(timeout)
+	}
+	return c
+}
+
+// Deadline returns the earlier one of the deadline and the parent's deadline.
+func (c *deadlineContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	if d, ok := c.parent.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		return d, true
+	}
+	return deadline, !deadline.IsZero()
+}
+
+func (c *deadlineContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *deadlineContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *deadlineContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// AfterFunc is used by the context package to propagate the cancellation to the children
+// contexts without a goroutine for each of them.
+func (c *deadlineContext) AfterFunc(f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		go f()
+		return func() bool { return false }
+	}
+	if c.funcs == nil {
+		c.funcs = make(map[*func()]struct{})
+	}
+	key := &f
+	c.funcs[key] = struct{}{}
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		_, ok := c.funcs[key]
+		delete(c.funcs, key)
+		return ok
+	}
+}
+
+// setTimeout resets the deadline to now + timeout, a zero or negative timeout removes the deadline.
+func (c *deadlineContext) setTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.deadline = time.Time{}
+	if timeout > 0 {
+		c.deadline = time.Now().Add(timeout)
+		c.timer = time.AfterFunc(timeout, func() {
+			c.cancel(context.DeadlineExceeded)
+		})
+	}
+}
+
+func (c *deadlineContext) cancel(err error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.err = err
+	close(c.done)
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	funcs, stop := c.funcs, c.stop
+	c.funcs = nil
+	c.mu.Unlock()
+
+	stop()
+	for f := range funcs {
+		go (*f)()
+	}
+}
+
+// SetTimeout resets the deadline of the ctx to now + timeout, it overrides the app setting
+// SetTimeout for the request, such as a longer timeout for an upload route or a shorter one for
+// a search route. A zero or negative timeout removes the deadline.
+// When the deadline exceeded, the ctx and its children contexts are done, the middleware process
+// will end and 504 Gateway Timeout will be responded if the response has not been sent. So the
+// handlers should use the ctx for the blocking calls (such as the database queries) to return
+// early, a handler ignoring the ctx still holds the connection until it returns.
+func (ctx *Context) SetTimeout(timeout time.Duration) {
+	ctx.base.setTimeout(timeout)
+}
+
+// Timeout returns a middleware that resets the deadline of the request by ctx.SetTimeout,
+// it is used to override the app setting SetTimeout for the routes:
+//
+//  app.Set(gear.SetTimeout, 30*time.Second)
+//
+//  router.Post("/upload", gear.Timeout(10*time.Minute), uploadHandler)
+//  router.Get("/search", gear.Timeout(3*time.Second), searchHandler)
+//
+func Timeout(timeout time.Duration) Middleware {
+	return func(ctx *Context) error {
+		ctx.SetTimeout(timeout)
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package gear
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextSetTimeout(t *testing.T) {
+	t.Run("should override the app timeout by routes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetTimeout, 50*time.Millisecond)
+		router := NewRouter()
+		router.Get("/slow", Timeout(time.Second), func(ctx *Context) error {
+			time.Sleep(100 * time.Millisecond)
+			return ctx.HTML(200, "slow")
+		})
+		router.Get("/fast", Timeout(10*time.Millisecond), func(ctx *Context) error {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(40 * time.Millisecond):
+				return ctx.HTML(200, "fast")
+			}
+		})
+		router.Get("/", func(ctx *Context) error {
+			time.Sleep(100 * time.Millisecond)
+			return ctx.HTML(200, "OK")
+		})
+		app.UseHandler(router)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("GET", host+"/slow")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("slow", PickRes(res.Text()).(string))
+
+		res, err = RequestBy("GET", host+"/fast")
+		assert.Nil(err)
+		assert.Equal(504, res.StatusCode)
+		assert.Equal("context deadline exceeded", PickRes(res.Text()).(string))
+
+		res, err = RequestBy("GET", host+"/")
+		assert.Nil(err)
+		assert.Equal(504, res.StatusCode)
+		res.Body.Close()
+	})
+
+	t.Run("should reset the deadline of the children contexts", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetTimeout, time.Second)
+		ctx := NewContext(app, httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+		child, cancel := ctx.WithCancel()
+		defer cancel()
+
+		d1, ok := child.Deadline()
+		assert.True(ok)
+		assert.True(time.Until(d1) > 500*time.Millisecond)
+
+		ctx.SetTimeout(0)
+		_, ok = ctx.Deadline()
+		assert.False(ok)
+
+		ctx.SetTimeout(20 * time.Millisecond)
+		d2, ok := child.Deadline()
+		assert.True(ok)
+		assert.True(d2.Before(d1))
+
+		select {
+		case <-child.Done():
+		case <-time.After(time.Second):
+		}
+		assert.Equal(context.DeadlineExceeded, child.Err())
+		assert.Equal(context.DeadlineExceeded, ctx.Err())
+		ctx.SetTimeout(time.Second)
+		assert.Equal(context.DeadlineExceeded, ctx.Err())
+
+		grandchild, cancel2 := context.WithCancel(child)
+		defer cancel2()
+		assert.Equal(context.DeadlineExceeded, grandchild.Err())
+	})
+
+	t.Run("should be canceled with the request", func(t *testing.T) {
+		assert := assert.New(t)
+
+		deadline := time.Now().Add(10 * time.Millisecond)
+		c, cancel := context.WithDeadline(context.Background(), deadline)
+		ctx := NewContext(New(), httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil).WithContext(c))
+		ctx.SetTimeout(time.Second)
+		d, ok := ctx.Deadline()
+		assert.True(ok)
+		assert.Equal(deadline, d)
+
+		cancel()
+		<-ctx.Done()
+		assert.Equal(context.Canceled, ctx.Err())
+	})
+}
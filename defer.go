@@ -0,0 +1,114 @@
+package gear
+
+import "sync"
+
+// ErrDeferQueueFull is reported by app.Error when the tasks of a request are dropped since the
+// queue of the defer workers is full.
+var ErrDeferQueueFull = NewAppError("defer queue is full, the tasks are dropped")
+
+// ErrDeferStopped is reported by app.Error when the tasks of a request are dropped since the
+// defer workers have been stopped by app.Close.
+var ErrDeferStopped = NewAppError("defer workers stopped, the tasks are dropped")
+
+// taskPool is a fixed size worker pool to run the tasks added by ctx.Defer.
+type taskPool struct {
+	mu      sync.Mutex
+	app     *App
+	workers int
+	tasks   chan func()
+	stopped bool
+}
+
+func newTaskPool(app *App, workers int) *taskPool {
+	return &taskPool{app: app, workers: workers}
+}
+
+// submit adds the task to the queue, the workers are started on the first task. It never blocks
+// the caller (the request goroutine), the task is dropped and reported by app.Error if the queue
+// is full or the workers have been stopped.
+func (p *taskPool) submit(task func()) {
+	var err error
+	p.mu.Lock()
+	switch {
+	case p.stopped:
+		err = ErrDeferStopped
+	default:
+		if p.tasks == nil {
+			p.tasks = make(chan func(), p.workers*64)
+			for i := 0; i < p.workers; i++ {
+				go p.work()
+			}
+		}
+		select {
+		case p.tasks <- task:
+		default:
+			err = ErrDeferQueueFull
+		}
+	}
+	p.mu.Unlock()
+	if err != nil {
+		p.app.Error(err)
+	}
+}
+
+// stop stops the workers after the queued tasks finished, the later tasks are dropped.
+func (p *taskPool) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped {
+		p.stopped = true
+		if p.tasks != nil {
+			close(p.tasks)
+		}
+	}
+}
+
+func (p *taskPool) work() {
+	for task := range p.tasks {
+		p.run(task)
+	}
+}
+
+func (p *taskPool) run(task func()) {
+	// recover the task panic, keep the worker alive
+	defer func() {
+		if err := recover(); err != nil {
+			p.app.Error(ErrorWithStack(err))
+		}
+	}()
+	task()
+}
+
+// Defer adds a task to run after the app has served the request, that is after the handlers
+// returned and the response has been written to the net/http ResponseWriter. Note that net/http
+// may still be flushing the buffered response to the client when the tasks start. The tasks
+// run on the app's worker pool (app setting SetDeferWorkers) in order, and the panic in a task
+// will be recovered and logged by app.Error. The tasks are dropped and ErrDeferQueueFull is
+// logged when the pool is overloaded, or ErrDeferStopped after app.Close. It is useful for
+// audit logs, emails and cache warms that should not delay the response. The ctx is finished when the tasks run,
+// so the tasks should not use ctx.Res or the ctx as a context.Context, and should not read
+// the request body. The tasks will not run if the ctx is not served by the app.
+//
+//  ctx.Defer(func() {
+//  	mailer.Send(user.Email, "Welcome!")
+//  })
+//
+func (ctx *Context) Defer(task func()) {
+	ctx.mu.Lock()
+	ctx.deferred = append(ctx.deferred, task)
+	ctx.mu.Unlock()
+}
+
+func (ctx *Context) runDeferred() {
+	ctx.mu.Lock()
+	tasks := ctx.deferred
+	ctx.deferred = nil
+	ctx.mu.Unlock()
+	if len(tasks) > 0 {
+		ctx.app.taskPool.submit(func() {
+			for _, task := range tasks {
+				ctx.app.taskPool.run(task)
+			}
+		})
+	}
+}
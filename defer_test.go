@@ -0,0 +1,186 @@
+package gear
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextDefer(t *testing.T) {
+	t.Run("should run after response sent", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var mu sync.Mutex
+		events := []string{}
+		record := func(event string) {
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+		}
+		done := make(chan struct{})
+
+		var buf bytes.Buffer
+		app := New()
+		app.logger.SetOutput(&buf)
+		app.Use(func(ctx *Context) error {
+			ctx.Defer(func() {
+				record("task1")
+			})
+			ctx.Defer(func() {
+				panic("task panic")
+			})
+			ctx.Defer(func() {
+				record("task3")
+				close(done)
+			})
+			ctx.OnEnd(func() {
+				record("end")
+			})
+			return ctx.End(http.StatusOK, []byte("OK"))
+		})
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/foo", nil))
+		assert.Equal(200, rec.Code)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			assert.Fail("deferred tasks timeout")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal("end", events[0])
+		assert.Equal([]string{"task1", "task3"}, filterEvents(events, "task"))
+		assert.True(strings.Contains(buf.String(), "task panic"))
+	})
+
+	t.Run("should run when error or panic", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		app := New()
+		app.logger.SetOutput(&buf)
+		app.Set(SetDeferWorkers, 1)
+		ch := make(chan string, 2)
+		app.Use(func(ctx *Context) error {
+			ctx.Defer(func() {
+				ch <- ctx.Path
+			})
+			if ctx.Path == "/panic" {
+				panic("some panic")
+			}
+			return &Error{Code: 400, Msg: "some error"}
+		})
+
+		for _, path := range []string{"/error", "/panic"} {
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com"+path, nil))
+			select {
+			case p := <-ch:
+				assert.Equal(path, p)
+			case <-time.After(time.Second):
+				assert.Fail("deferred tasks timeout")
+			}
+		}
+	})
+
+	t.Run("should drop the tasks when the queue is full", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		app := New()
+		app.logger.SetOutput(&buf)
+		app.Set(SetDeferWorkers, 1)
+		release := make(chan struct{})
+		var ran int32
+		app.Use(func(ctx *Context) error {
+			ctx.Defer(func() {
+				<-release
+				atomic.AddInt32(&ran, 1)
+			})
+			return ctx.End(http.StatusNoContent)
+		})
+
+		served := make(chan struct{})
+		go func() {
+			for i := 0; i < 100; i++ {
+				app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+			}
+			close(served)
+		}()
+		select {
+		case <-served:
+		case <-time.After(time.Second):
+			assert.Fail("serving blocked by the deferred tasks")
+		}
+
+		close(release)
+		dropped := int32(strings.Count(buf.String(), "defer queue is full"))
+		assert.True(dropped >= 35)
+		for i := 0; i < 100 && atomic.LoadInt32(&ran)+dropped < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(int32(100), atomic.LoadInt32(&ran)+dropped)
+	})
+
+	t.Run("should stop the workers when app closed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		app := New()
+		app.logger.SetOutput(&buf)
+		app.Set(SetDeferWorkers, 1)
+		ch := make(chan struct{}, 1)
+		app.Use(func(ctx *Context) error {
+			ctx.Defer(func() {
+				ch <- struct{}{}
+			})
+			return ctx.End(http.StatusNoContent)
+		})
+
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+		app.Close()
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			assert.Fail("queued tasks should run after closed")
+		}
+
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+		assert.True(strings.Contains(buf.String(), "defer workers stopped"))
+		app.taskPool.stop()
+	})
+
+	t.Run("SetDeferWorkers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		assert.Panics(func() {
+			app.Set(SetDeferWorkers, 0)
+		})
+		assert.Panics(func() {
+			app.Set(SetDeferWorkers, "1")
+		})
+		assert.Equal(16, app.taskPool.workers)
+		app.Set(SetDeferWorkers, 4)
+		assert.Equal(4, app.taskPool.workers)
+	})
+}
+
+func filterEvents(events []string, prefix string) []string {
+	res := []string{}
+	for _, e := range events {
+		if strings.HasPrefix(e, prefix) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
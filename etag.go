@@ -0,0 +1,35 @@
+package gear
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+)
+
+// autoETag sets a content-hash ETag for the response body if app setting SetAutoETag is true,
+// it is a weak ETag if app setting SetCompress exists. It returns true if the response is fresh in the client's cache and 304 should be responded.
+func (ctx *Context) autoETag(code int, body []byte) bool {
+	if len(body) == 0 || (ctx.Method != http.MethodGet && ctx.Method != http.MethodHead) {
+		return false
+	}
+	if code == 0 {
+		code = ctx.Res.status
+	}
+	if (code != 0 && code != http.StatusOK) || ctx.Res.Get(HeaderETag) != "" {
+		return false
+	}
+	etag := contentETag(body)
+	if ctx.app.compress != nil {
+		// the hash covers the uncompressed body, it is not a strong validator of the compressed one.
+		etag = "W/" + etag
+	}
+	ctx.Set(HeaderETag, etag)
+	return ctx.Fresh()
+}
+
+// contentETag returns a strong ETag with the length and the SHA-1 hash of the content.
+func contentETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + strconv.FormatInt(int64(len(body)), 16) + "-" + base64.RawURLEncoding.EncodeToString(sum[:]) + `"`
+}
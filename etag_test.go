@@ -0,0 +1,123 @@
+package gear
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearAutoETag(t *testing.T) {
+	app := New()
+	assert.Panics(t, func() {
+		app.Set(SetAutoETag, "true")
+	})
+	app.Set(SetAutoETag, true)
+	app.Use(func(ctx *Context) error {
+		switch ctx.Path {
+		case "/json":
+			return ctx.JSON(200, map[string]string{"name": "gear"})
+		case "/etag":
+			ctx.Set(HeaderETag, `"v1"`)
+			return ctx.HTML(200, "Hello")
+		case "/created":
+			return ctx.JSON(201, map[string]string{"name": "gear"})
+		case "/empty":
+			return ctx.End(200)
+		}
+		return ctx.HTML(200, "Hello")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	request := func(method, path, etag string) *http.Response {
+		req, _ := http.NewRequest(method, host+path, nil)
+		if etag != "" {
+			req.Header.Set(HeaderIfNoneMatch, etag)
+		}
+		res, err := DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("Should add ETag and respond 304 when matched", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("GET", "/json", "")
+		assert.Equal(200, res.StatusCode)
+		etag := res.Header.Get(HeaderETag)
+		assert.Equal(contentETag([]byte(`{"name":"gear"}`)), etag)
+
+		res = request("GET", "/json", etag)
+		assert.Equal(http.StatusNotModified, res.StatusCode)
+		assert.Equal(etag, res.Header.Get(HeaderETag))
+		res = request("GET", "/json", `"other", W/`+etag)
+		assert.Equal(http.StatusNotModified, res.StatusCode)
+		res = request("HEAD", "/json", etag)
+		assert.Equal(http.StatusNotModified, res.StatusCode)
+
+		res = request("GET", "/json", `"other"`)
+		assert.Equal(200, res.StatusCode)
+		res = request("GET", "/html", etag)
+		assert.Equal(200, res.StatusCode)
+		assert.NotEqual(etag, res.Header.Get(HeaderETag))
+	})
+
+	t.Run("Should not change other responses", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("GET", "/etag", `"v1"`)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(`"v1"`, res.Header.Get(HeaderETag))
+
+		res = request("GET", "/created", "")
+		assert.Equal(201, res.StatusCode)
+		assert.Equal("", res.Header.Get(HeaderETag))
+
+		res = request("GET", "/empty", "")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("", res.Header.Get(HeaderETag))
+
+		res = request("POST", "/html", "")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("", res.Header.Get(HeaderETag))
+
+		app.Set(SetAutoETag, false)
+		res = request("GET", "/html", "")
+		assert.Equal("", res.Header.Get(HeaderETag))
+	})
+
+	t.Run("Should add weak ETag when compress", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetAutoETag, true)
+		app.Set(SetCompress, &DefaultCompress{})
+		app.Use(func(ctx *Context) error {
+			return ctx.HTML(200, strings.Repeat("Hello", 1000))
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		etag := "W/" + contentETag([]byte(strings.Repeat("Hello", 1000)))
+		req, _ := http.NewRequest("GET", "http://"+srv.Addr().String(), nil)
+		req.Header.Set(HeaderAcceptEncoding, "gzip")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		res.Body.Close()
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("gzip", res.Header.Get(HeaderContentEncoding))
+		assert.Equal(etag, res.Header.Get(HeaderETag))
+
+		req.Header.Set(HeaderIfNoneMatch, etag)
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		res.Body.Close()
+		assert.Equal(http.StatusNotModified, res.StatusCode)
+	})
+}
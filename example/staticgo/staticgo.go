@@ -22,7 +22,7 @@ func main() {
 
 	app.UseHandler(logging.Default())
 	app.Use(cors.New())
-	app.Use(static.New(static.Options{Root: *path}))
+	app.Use(static.New(static.Options{Root: *path, Browse: true}))
 
 	logging.Println("staticgo v1.1.0, created by https://github.com/teambition/gear")
 	logging.Printf("listen: %s, serve: %s\n", *address, *path)
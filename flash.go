@@ -0,0 +1,87 @@
+package gear
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// flashCookieName is the cookie name to carry flash messages.
+const flashCookieName = "_flash"
+
+type flashState struct {
+	hooked   bool
+	incoming map[string][]string // read from the request
+	outgoing map[string][]string // will be sent to the next request
+	read     bool
+	present  bool // the request carries the flash cookie
+}
+
+// Flash adds a flash message by kind (such as "error", "info"), the messages will be
+// stored in cookie and can be read once by ctx.Flashes in the next request, it is useful
+// for the "POST/Redirect/GET" form workflow. The cookie will be signed if app setting
+// SetKeys exists. Note that the cookie size is limited by browsers (about 4KB).
+// The messages added after the ctx ended are discarded.
+//
+//  if err := ctx.ParseBody(form); err != nil {
+//  	ctx.Flash("error", err.Error())
+//  	return ctx.Back("/form")
+//  }
+//
+func (ctx *Context) Flash(kind, msg string) {
+	fs := ctx.flashState()
+	if fs.outgoing == nil {
+		fs.outgoing = make(map[string][]string)
+	}
+	fs.outgoing[kind] = append(fs.outgoing[kind], msg)
+}
+
+// Flashes returns the flash messages added by the previous request, the messages will be
+// cleared in the response, so they can be read only once. It returns nil if no messages.
+// A Renderer can read it from ctx in Render method to expose them to templates:
+//
+//  func (t *Template) Render(ctx *gear.Context, w io.Writer, name string, data interface{}) error {
+//  	return t.templates.ExecuteTemplate(w, name, map[string]interface{}{
+//  		"Data":    data,
+//  		"Flashes": ctx.Flashes(),
+//  	})
+//  }
+//
+func (ctx *Context) Flashes() map[string][]string {
+	fs := ctx.flashState()
+	if !fs.read {
+		fs.read = true
+		if val, err := ctx.Cookies.Get(flashCookieName, len(ctx.app.keys) > 0); err == nil && val != "" {
+			fs.present = true
+			if buf, err := base64.RawURLEncoding.DecodeString(val); err == nil {
+				json.Unmarshal(buf, &fs.incoming)
+			}
+		}
+	}
+	return fs.incoming
+}
+
+func (ctx *Context) flashState() *flashState {
+	if ctx.flash == nil {
+		ctx.flash = &flashState{}
+	}
+	// "after hook" can't be added after the ctx ended, the flash messages will not be saved then.
+	if !ctx.flash.hooked && !ctx.ended.isTrue() {
+		ctx.flash.hooked = true
+		ctx.After(ctx.saveFlash)
+	}
+	return ctx.flash
+}
+
+func (ctx *Context) saveFlash() {
+	fs := ctx.flash
+	opts := &cookie.Options{Path: "/", HTTPOnly: true, Signed: len(ctx.app.keys) > 0}
+	if len(fs.outgoing) > 0 {
+		buf, _ := json.Marshal(fs.outgoing)
+		ctx.Cookies.Set(flashCookieName, base64.RawURLEncoding.EncodeToString(buf), opts)
+	} else if fs.present {
+		opts.MaxAge = -1
+		ctx.Cookies.Set(flashCookieName, "", opts)
+	}
+}
@@ -0,0 +1,111 @@
+package gear
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type flashTemplate struct {
+	tpl *template.Template
+}
+
+func (t *flashTemplate) Render(ctx *Context, w io.Writer, name string, data interface{}) error {
+	return t.tpl.ExecuteTemplate(w, name, map[string]interface{}{"Data": data, "Flashes": ctx.Flashes()})
+}
+
+func TestGearContextFlash(t *testing.T) {
+	newApp := func(keys ...string) *App {
+		app := New()
+		if len(keys) > 0 {
+			app.Set(SetKeys, keys)
+		}
+		app.Set(SetRenderer, &flashTemplate{template.Must(template.New("form").Parse(
+			`{{.Data}}{{range .Flashes.error}}<p class="error">{{.}}</p>{{end}}`))})
+		app.Use(func(ctx *Context) error {
+			switch ctx.Path {
+			case "/submit":
+				ctx.Flash("error", "name required")
+				ctx.Flash("error", "<b>age</b> invalid")
+				ctx.Flash("info", "try again")
+				return ctx.Redirect("/form")
+			case "/form":
+				return ctx.Render(http.StatusOK, "form", "form:")
+			}
+			return ctx.JSON(http.StatusOK, ctx.Flashes())
+		})
+		return app
+	}
+	serve := func(app *App, method, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://example.com"+path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+	flashCookies := func(rec *httptest.ResponseRecorder) []*http.Cookie {
+		res := http.Response{Header: rec.Header()}
+		return res.Cookies()
+	}
+
+	for _, keys := range [][]string{nil, {"some key"}} {
+		t.Run("flash messages across redirect with keys "+strings.Join(keys, ","), func(t *testing.T) {
+			assert := assert.New(t)
+
+			app := newApp(keys...)
+			rec := serve(app, "POST", "/submit")
+			assert.Equal(http.StatusSeeOther, rec.Code)
+			cookies := flashCookies(rec)
+			assert.Equal(flashCookieName, cookies[0].Name)
+			if len(keys) > 0 {
+				assert.Equal(2, len(cookies))
+				assert.Equal(flashCookieName+".sig", cookies[1].Name)
+			}
+
+			rec = serve(app, "GET", "/form", cookies...)
+			assert.Equal(http.StatusOK, rec.Code)
+			assert.Equal(`form:<p class="error">name required</p><p class="error">&lt;b&gt;age&lt;/b&gt; invalid</p>`,
+				rec.Body.String())
+			deleted := flashCookies(rec)
+			assert.Equal(flashCookieName, deleted[0].Name)
+			assert.Equal("", deleted[0].Value)
+			assert.True(deleted[0].MaxAge < 0)
+
+			rec = serve(app, "GET", "/", cookies...)
+			assert.Equal(`{"error":["name required","\u003cb\u003eage\u003c/b\u003e invalid"],"info":["try again"]}`,
+				rec.Body.String())
+		})
+	}
+
+	t.Run("without flash cookie", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := newApp()
+		rec := serve(app, "GET", "/")
+		assert.Equal("null", rec.Body.String())
+		assert.Equal(0, len(flashCookies(rec)))
+
+		rec = serve(app, "GET", "/", &http.Cookie{Name: flashCookieName, Value: "invalid!"})
+		assert.Equal("null", rec.Body.String())
+		assert.True(flashCookies(rec)[0].MaxAge < 0)
+	})
+
+	t.Run("after ctx ended", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := CtxTest(newApp(), "GET", "http://example.com/", nil)
+		ctx.Cancel()
+		assert.NotPanics(func() {
+			ctx.Flash("info", "ignored")
+			assert.Nil(ctx.Flashes())
+		})
+		assert.False(ctx.flash.hooked)
+	})
+}
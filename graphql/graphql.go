@@ -0,0 +1,465 @@
+// Package graphql serves GraphQL over HTTP with any GraphQL execution library.
+//
+// It decodes GET, POST (JSON and "application/graphql") and multipart upload requests
+// per the GraphQL-over-HTTP spec and the GraphQL multipart request spec, runs them with
+// an Executor and responds the result as JSON. The resolvers run with a context derived
+// from the gear.Context, so they see its deadline, cancellation and values:
+//
+//  package main
+//
+//  import (
+//  	"context"
+//
+//  	gql "github.com/graphql-go/graphql"
+//  	"github.com/teambition/gear"
+//  	"github.com/teambition/gear/graphql"
+//  )
+//
+//  func main() {
+//  	schema, _ := gql.NewSchema(gql.SchemaConfig{Query: queryType})
+//  	h := graphql.New(func(ctx context.Context, req *graphql.Request) interface{} {
+//  		return gql.Do(gql.Params{
+//  			Schema:         schema,
+//  			RequestString:  req.Query,
+//  			OperationName:  req.OperationName,
+//  			VariableValues: req.Variables,
+//  			Context:        ctx,
+//  		})
+//  	}, graphql.Options{Playground: true})
+//
+//  	router := gear.NewRouter()
+//  	router.Get("/graphql", h.Serve)
+//  	router.Post("/graphql", h.Serve)
+//
+//  	app := gear.New()
+//  	app.UseHandler(router)
+//  	app.Error(app.Listen(":3000"))
+//  }
+//
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+// MIMEApplicationGraphQL is the media type of the request body that contains a GraphQL query only.
+const MIMEApplicationGraphQL = "application/graphql"
+
+// Request is a GraphQL request decoded from HTTP request.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Validate implemented gear.BodyTemplate interface.
+func (r *Request) Validate() error {
+	if strings.TrimSpace(r.Query) == "" {
+		return &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: query required"}
+	}
+	return nil
+}
+
+// Upload is a file uploaded with the GraphQL multipart request, it is placed in the
+// Request.Variables by the "map" field of the request.
+type Upload struct {
+	File     multipart.File
+	Filename string
+	Size     int64
+	Header   *multipart.FileHeader
+}
+
+// Executor executes the GraphQL request and returns the result, the result will be responded as JSON.
+type Executor func(ctx context.Context, req *Request) interface{}
+
+// Options is the GraphQL handler options.
+type Options struct {
+	// Context maps the gear.Context into the resolver context, such as the authenticated
+	// principal or the request ID. Default to use the gear.Context as it is.
+	Context func(ctx *gear.Context) context.Context
+	// Playground serves a GraphiQL page for the GET requests that accept HTML and have no query.
+	Playground bool
+	// MaxMemory defines the maximum bytes of the uploaded files stored in memory,
+	// the rest are stored on disk in temporary files. Default to 32MB.
+	MaxMemory int64
+}
+
+type ctxKey struct{}
+
+// FromContext returns the gear.Context from the resolver context.
+//
+//  ctx := graphql.FromContext(c)
+//  user, _ := ctx.Any("user")
+//
+func FromContext(c context.Context) *gear.Context {
+	ctx, _ := c.Value(ctxKey{}).(*gear.Context)
+	return ctx
+}
+
+// Handler serves GraphQL requests, it implemented gear.Handler interface.
+type Handler struct {
+	exec Executor
+	opts Options
+}
+
+// New creates a GraphQL Handler with the executor.
+func New(exec Executor, options ...Options) *Handler {
+	h := &Handler{exec: exec}
+	if len(options) > 0 {
+		h.opts = options[0]
+	}
+	if h.opts.MaxMemory <= 0 {
+		h.opts.MaxMemory = 32 << 20
+	}
+	return h
+}
+
+// Serve implemented gear.Handler interface.
+func (h *Handler) Serve(ctx *gear.Context) error {
+	if h.opts.Playground && ctx.Method == http.MethodGet && ctx.Query("query") == "" &&
+		ctx.AcceptType(gear.MIMETextHTML, gear.MIMEApplicationJSON) == gear.MIMETextHTML {
+		return h.playground(ctx)
+	}
+
+	req, err := h.parse(ctx)
+	if err != nil {
+		return err
+	}
+
+	var c context.Context = ctx
+	if h.opts.Context != nil {
+		c = h.opts.Context(ctx)
+	}
+	res := h.exec(context.WithValue(c, ctxKey{}, ctx), req)
+	return ctx.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) parse(ctx *gear.Context) (*Request, error) {
+	req := &Request{}
+	switch ctx.Method {
+	case http.MethodGet:
+		req.Query = ctx.Query("query")
+		req.OperationName = ctx.Query("operationName")
+		if err := unmarshalQuery(ctx, "variables", &req.Variables); err != nil {
+			return nil, err
+		}
+		if err := unmarshalQuery(ctx, "extensions", &req.Extensions); err != nil {
+			return nil, err
+		}
+		if err := req.Validate(); err != nil {
+			return nil, err
+		}
+		// mutations are not allowed over GET
+		op, ok := selectOperation(req.Query, req.OperationName)
+		if !ok {
+			return nil, &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: operation not found or ambiguous"}
+		}
+		if op.kind == "mutation" {
+			ctx.Set(gear.HeaderAllow, http.MethodPost)
+			return nil, &gear.Error{Code: http.StatusMethodNotAllowed, Msg: "graphql: mutation requires POST"}
+		}
+		return req, nil
+
+	case http.MethodPost:
+		mediaType, _, _ := mime.ParseMediaType(ctx.Get(gear.HeaderContentType))
+		switch mediaType {
+		case MIMEApplicationGraphQL:
+			buf, err := readBody(ctx)
+			if err != nil {
+				return nil, err
+			}
+			req.Query = string(buf)
+			return req, req.Validate()
+		case gear.MIMEMultipartForm:
+			return h.parseMultipart(ctx)
+		default:
+			if err := ctx.ParseBody(req); err != nil {
+				return nil, err
+			}
+			return req, nil
+		}
+
+	default:
+		ctx.Set(gear.HeaderAllow, "GET, POST")
+		return nil, &gear.Error{Code: http.StatusMethodNotAllowed, Msg: "graphql: method not allowed"}
+	}
+}
+
+// parseMultipart parses the request per https://github.com/jaydenseric/graphql-multipart-request-spec
+func (h *Handler) parseMultipart(ctx *gear.Context) (*Request, error) {
+	if err := ctx.Req.ParseMultipartForm(h.opts.MaxMemory); err != nil {
+		return nil, &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: " + err.Error()}
+	}
+	form := ctx.Req.MultipartForm
+
+	req := &Request{}
+	if err := json.Unmarshal([]byte(formValue(form, "operations")), req); err != nil {
+		return nil, &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: invalid operations: " + err.Error()}
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var fileMap map[string][]string
+	if val := formValue(form, "map"); val != "" {
+		if err := json.Unmarshal([]byte(val), &fileMap); err != nil {
+			return nil, &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: invalid map: " + err.Error()}
+		}
+	}
+	for key, paths := range fileMap {
+		files := form.File[key]
+		if len(files) == 0 {
+			return nil, &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: missing file " + strconv.Quote(key)}
+		}
+		file, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		ctx.OnEnd(func() { file.Close() })
+		upload := &Upload{File: file, Filename: files[0].Filename, Size: files[0].Size, Header: files[0]}
+		for _, path := range paths {
+			if !strings.HasPrefix(path, "variables.") {
+				return nil, &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: invalid map path " + strconv.Quote(path)}
+			}
+			if req.Variables == nil {
+				req.Variables = make(map[string]interface{})
+			}
+			if !setPath(req.Variables, strings.Split(path, ".")[1:], upload) {
+				return nil, &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: invalid map path " + strconv.Quote(path)}
+			}
+		}
+	}
+	return req, nil
+}
+
+// setPath sets the val to the object path, such as ["files", "0"].
+func setPath(obj interface{}, path []string, val interface{}) bool {
+	for i, key := range path {
+		last := i == len(path)-1
+		switch v := obj.(type) {
+		case map[string]interface{}:
+			if last {
+				v[key] = val
+				return true
+			}
+			obj = v[key]
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return false
+			}
+			if last {
+				v[idx] = val
+				return true
+			}
+			obj = v[idx]
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func formValue(form *multipart.Form, key string) string {
+	if vals := form.Value[key]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func unmarshalQuery(ctx *gear.Context, name string, v interface{}) error {
+	if val := ctx.Query(name); val != "" {
+		if err := json.Unmarshal([]byte(val), v); err != nil {
+			return &gear.Error{Code: http.StatusBadRequest, Msg: "graphql: invalid " + name + ": " + err.Error()}
+		}
+	}
+	return nil
+}
+
+func readBody(ctx *gear.Context) ([]byte, error) {
+	var maxBytes int64 = 1 << 20
+	if parser, ok := ctx.Setting(gear.SetBodyParser).(gear.BodyParser); ok {
+		maxBytes = parser.MaxBytes()
+	}
+	buf, err := ioutil.ReadAll(http.MaxBytesReader(ctx.Res, ctx.Req.Body, maxBytes))
+	if err != nil {
+		return nil, &gear.Error{Code: http.StatusRequestEntityTooLarge, Msg: err.Error()}
+	}
+	return buf, nil
+}
+
+type operation struct {
+	kind string // "query", "mutation" or "subscription"
+	name string
+}
+
+// selectOperation returns the operation to execute in the query, that is the one named by
+// the operationName, or the only one if the operationName is empty. It returns false if the
+// operation can't be chosen, or the query is malformed.
+func selectOperation(query, operationName string) (operation, bool) {
+	ops, ok := operations(query)
+	if !ok {
+		return operation{}, false
+	}
+	if operationName == "" {
+		if len(ops) != 1 {
+			return operation{}, false
+		}
+		return ops[0], true
+	}
+	var res operation
+	found := false
+	for _, op := range ops {
+		if op.name == operationName {
+			if found {
+				return operation{}, false
+			}
+			res, found = op, true
+		}
+	}
+	return res, found
+}
+
+// operations scans the top level definitions of the query and returns the operations, the
+// fragments are skipped. The comments and the strings are skipped, it returns false if the
+// query is malformed.
+func operations(query string) ([]operation, bool) {
+	var ops []operation
+	var cur *operation // the definition being scanned at the top level
+	named := false     // the name of cur has been scanned, or can't follow
+	braces, parens := 0, 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ',':
+		case c == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+			continue
+		case c == '"':
+			end := skipString(query, i)
+			if end < 0 {
+				return nil, false
+			}
+			i, named = end, true
+			continue
+		case isNameStart(c):
+			j := i + 1
+			for j < len(query) && (isNameStart(query[j]) || query[j] >= '0' && query[j] <= '9') {
+				j++
+			}
+			if braces == 0 && parens == 0 {
+				if cur == nil {
+					cur, named = &operation{kind: query[i:j]}, false
+				} else if !named {
+					cur.name, named = query[i:j], true
+				}
+			}
+			i = j
+			continue
+		case c == '{':
+			if braces == 0 && parens == 0 {
+				if cur == nil {
+					cur = &operation{kind: "query"}
+				}
+				switch cur.kind {
+				case "query", "mutation", "subscription":
+					ops = append(ops, *cur)
+				case "fragment":
+				default:
+					return nil, false
+				}
+				cur = nil
+			}
+			braces++
+		case c == '}':
+			if braces--; braces < 0 {
+				return nil, false
+			}
+		case c == '(':
+			parens++
+			named = true
+		case c == ')':
+			if parens--; parens < 0 {
+				return nil, false
+			}
+		default:
+			named = true
+		}
+		i++
+	}
+	return ops, braces == 0 && parens == 0 && cur == nil
+}
+
+// skipString returns the index after the string or block string starting at i, or -1 if it
+// is not terminated.
+func skipString(query string, i int) int {
+	if strings.HasPrefix(query[i:], `"""`) {
+		for j := i + 3; j < len(query); j++ {
+			if query[j] == '\\' && strings.HasPrefix(query[j+1:], `"""`) {
+				j += 3
+			} else if strings.HasPrefix(query[j:], `"""`) {
+				return j + 3
+			}
+		}
+		return -1
+	}
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		case '\n', '\r':
+			return -1
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+var playgroundTemplate = template.Must(template.New("graphiql").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>GraphiQL</title>
+    <link rel="stylesheet" href="https://unpkg.com/graphiql/graphiql.min.css" />
+  </head>
+  <body style="margin: 0;">
+    <div id="graphiql" style="height: 100vh;"></div>
+    <script src="https://unpkg.com/react/umd/react.production.min.js"></script>
+    <script src="https://unpkg.com/react-dom/umd/react-dom.production.min.js"></script>
+    <script src="https://unpkg.com/graphiql/graphiql.min.js"></script>
+    <script>
+      ReactDOM.render(
+        React.createElement(GraphiQL, {
+          fetcher: GraphiQL.createFetcher({url: {{.}}}),
+        }),
+        document.getElementById('graphiql'),
+      );
+    </script>
+  </body>
+</html>`))
+
+func (h *Handler) playground(ctx *gear.Context) error {
+	var buf bytes.Buffer
+	if err := playgroundTemplate.Execute(&buf, ctx.Req.URL.Path); err != nil {
+		return err
+	}
+	return ctx.HTML(http.StatusOK, buf.String())
+}
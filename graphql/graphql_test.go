@@ -0,0 +1,257 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+type userKey struct{}
+
+func newApp(options Options) *gear.App {
+	h := New(func(c context.Context, req *Request) interface{} {
+		res := map[string]interface{}{
+			"query":         req.Query,
+			"operationName": req.OperationName,
+			"variables":     req.Variables,
+		}
+		if ctx := FromContext(c); ctx != nil {
+			res["path"] = ctx.Path
+		}
+		if user, ok := c.Value(userKey{}).(string); ok {
+			res["user"] = user
+		}
+		if upload, ok := req.Variables["file"].(*Upload); ok {
+			buf, _ := ioutil.ReadAll(upload.File)
+			res["file"] = upload.Filename + ":" + string(buf)
+			delete(req.Variables, "file")
+		}
+		return map[string]interface{}{"data": res}
+	}, options)
+
+	router := gear.NewRouter()
+	router.Get("/graphql", h.Serve)
+	router.Post("/graphql", h.Serve)
+	router.Put("/graphql", h.Serve)
+	app := gear.New()
+	app.UseHandler(router)
+	return app
+}
+
+func do(t *testing.T, app *gear.App, req *http.Request) (*http.Response, map[string]interface{}) {
+	srv := app.Start()
+	defer srv.Close()
+
+	u, _ := url.Parse("http://" + srv.Addr().String())
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	body := map[string]interface{}{}
+	buf, _ := ioutil.ReadAll(res.Body)
+	if err := json.Unmarshal(buf, &body); err != nil {
+		body["raw"] = string(buf)
+	}
+	data, _ := body["data"].(map[string]interface{})
+	if data == nil {
+		data = body
+	}
+	return res, data
+}
+
+func TestGraphQLGet(t *testing.T) {
+	assert := assert.New(t)
+	app := newApp(Options{})
+
+	query := url.Values{
+		"query":         []string{"query Hello($id: ID) { hello(id: $id) }"},
+		"operationName": []string{"Hello"},
+		"variables":     []string{`{"id":"1"}`},
+	}
+	req, _ := http.NewRequest("GET", "/graphql?"+query.Encode(), nil)
+	res, data := do(t, app, req)
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("query Hello($id: ID) { hello(id: $id) }", data["query"])
+	assert.Equal("Hello", data["operationName"])
+	assert.Equal(map[string]interface{}{"id": "1"}, data["variables"])
+	assert.Equal("/graphql", data["path"])
+
+	req, _ = http.NewRequest("GET", "/graphql?query="+url.QueryEscape("# comment\n mutation { hello }"), nil)
+	res, _ = do(t, app, req)
+	assert.Equal(405, res.StatusCode)
+	assert.Equal("POST", res.Header.Get(gear.HeaderAllow))
+
+	query = url.Values{}
+	query.Set("query", "query A { x } mutation B { y }")
+	query.Set("operationName", "B")
+	req, _ = http.NewRequest("GET", "/graphql?"+query.Encode(), nil)
+	res, _ = do(t, app, req)
+	assert.Equal(405, res.StatusCode)
+
+	query.Del("operationName")
+	req, _ = http.NewRequest("GET", "/graphql?"+query.Encode(), nil)
+	res, _ = do(t, app, req)
+	assert.Equal(400, res.StatusCode)
+
+	req, _ = http.NewRequest("GET", "/graphql?query={hello}&variables=x", nil)
+	res, _ = do(t, app, req)
+	assert.Equal(400, res.StatusCode)
+
+	req, _ = http.NewRequest("GET", "/graphql", nil)
+	res, _ = do(t, app, req)
+	assert.Equal(400, res.StatusCode)
+}
+
+func TestGraphQLPost(t *testing.T) {
+	assert := assert.New(t)
+	app := newApp(Options{
+		Context: func(ctx *gear.Context) context.Context {
+			return ctx.WithValue(userKey{}, ctx.Get("X-User"))
+		},
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"mutation { hello }","variables":{"a":1}}`))
+		req.Header.Set(gear.HeaderContentType, gear.MIMEApplicationJSON)
+		req.Header.Set("X-User", "admin")
+		res, data := do(t, app, req)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(gear.MIMEApplicationJSONCharsetUTF8, res.Header.Get(gear.HeaderContentType))
+		assert.Equal("mutation { hello }", data["query"])
+		assert.Equal(map[string]interface{}{"a": float64(1)}, data["variables"])
+		assert.Equal("admin", data["user"])
+		assert.Equal("/graphql", data["path"])
+	})
+
+	t.Run("application/graphql", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/graphql", strings.NewReader(`{ hello }`))
+		req.Header.Set(gear.HeaderContentType, MIMEApplicationGraphQL)
+		res, data := do(t, app, req)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("{ hello }", data["query"])
+	})
+
+	t.Run("empty query", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query":""}`))
+		req.Header.Set(gear.HeaderContentType, gear.MIMEApplicationJSON)
+		res, _ := do(t, app, req)
+		assert.Equal(400, res.StatusCode)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		req, _ := http.NewRequest("PUT", "/graphql", strings.NewReader(`{"query":"{ hello }"}`))
+		res, _ := do(t, app, req)
+		assert.Equal(405, res.StatusCode)
+		assert.Equal("GET, POST", res.Header.Get(gear.HeaderAllow))
+	})
+}
+
+func TestGraphQLMultipart(t *testing.T) {
+	assert := assert.New(t)
+	app := newApp(Options{})
+
+	request := func(operations, fileMap string) (*http.Response, map[string]interface{}) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("operations", operations)
+		w.WriteField("map", fileMap)
+		fw, _ := w.CreateFormFile("0", "a.txt")
+		fw.Write([]byte("hello"))
+		w.Close()
+		req, _ := http.NewRequest("POST", "/graphql", &buf)
+		req.Header.Set(gear.HeaderContentType, w.FormDataContentType())
+		return do(t, app, req)
+	}
+
+	res, data := request(`{"query":"mutation ($file: Upload!) { upload(file: $file) }","variables":{"file":null}}`,
+		`{"0":["variables.file"]}`)
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("a.txt:hello", data["file"])
+
+	res, _ = request(`{"query":"mutation { upload }"}`, `{"1":["variables.file"]}`)
+	assert.Equal(400, res.StatusCode)
+
+	res, _ = request(`{"query":"mutation { upload }"}`, `{"0":["query"]}`)
+	assert.Equal(400, res.StatusCode)
+
+	res, _ = request(`{"query":"mutation { upload }","variables":{"files":[null]}}`, `{"0":["variables.files.1"]}`)
+	assert.Equal(400, res.StatusCode)
+
+	res, _ = request(`invalid`, `{}`)
+	assert.Equal(400, res.StatusCode)
+}
+
+func TestGraphQLPlayground(t *testing.T) {
+	assert := assert.New(t)
+
+	req, _ := http.NewRequest("GET", "/graphql", nil)
+	req.Header.Set(gear.HeaderAccept, "text/html")
+	res, data := do(t, newApp(Options{Playground: true}), req)
+	assert.Equal(200, res.StatusCode)
+	assert.Equal(gear.MIMETextHTMLCharsetUTF8, res.Header.Get(gear.HeaderContentType))
+	assert.True(strings.Contains(data["raw"].(string), "GraphiQL"))
+	assert.True(strings.Contains(data["raw"].(string), `"/graphql"`))
+
+	req, _ = http.NewRequest("GET", "/graphql", nil)
+	req.Header.Set(gear.HeaderAccept, "text/html")
+	res, _ = do(t, newApp(Options{}), req)
+	assert.Equal(400, res.StatusCode)
+}
+
+func TestSetPath(t *testing.T) {
+	assert := assert.New(t)
+
+	vars := map[string]interface{}{
+		"input": map[string]interface{}{"files": []interface{}{nil, nil}},
+	}
+	assert.True(setPath(vars, []string{"input", "files", "1"}, "x"))
+	assert.Equal([]interface{}{nil, "x"}, vars["input"].(map[string]interface{})["files"])
+	assert.False(setPath(vars, []string{"input", "files", "2"}, "x"))
+	assert.False(setPath(vars, []string{"input", "files", "a"}, "x"))
+	assert.False(setPath(vars, []string{"none", "file"}, "x"))
+	assert.False(setPath(vars, nil, "x"))
+
+	op, ok := selectOperation("mutation { a }", "")
+	assert.True(ok)
+	assert.Equal(operation{kind: "mutation"}, op)
+	op, ok = selectOperation("  # comment\n\tmutation M { a }", "")
+	assert.True(ok)
+	assert.Equal(operation{kind: "mutation", name: "M"}, op)
+	op, ok = selectOperation("{ a }", "")
+	assert.True(ok)
+	assert.Equal(operation{kind: "query"}, op)
+	op, ok = selectOperation("query { mutation }", "")
+	assert.Equal(operation{kind: "query"}, op)
+
+	query := `query A($s: String = "}{ mutation") { x(a: """ { \""" """) } fragment F on T { y }
+	# mutation C { z }
+	mutation B @log(level: 1) { y(input: {a: 1}) }`
+	op, ok = selectOperation(query, "B")
+	assert.True(ok)
+	assert.Equal(operation{kind: "mutation", name: "B"}, op)
+	op, ok = selectOperation(query, "A")
+	assert.True(ok)
+	assert.Equal(operation{kind: "query", name: "A"}, op)
+	_, ok = selectOperation(query, "")
+	assert.False(ok)
+	_, ok = selectOperation(query, "C")
+	assert.False(ok)
+	_, ok = selectOperation("query A { x } mutation A { y }", "A")
+	assert.False(ok)
+	_, ok = selectOperation("{ a ", "")
+	assert.False(ok)
+	_, ok = selectOperation(`{ a(s: "x) }`, "")
+	assert.False(ok)
+	_, ok = selectOperation("foo { a }", "")
+	assert.False(ok)
+}
@@ -0,0 +1,97 @@
+package gear
+
+import (
+	"net"
+	"strings"
+)
+
+// hostPattern matches the request host by labels, it is used by RouterOptions.Host.
+// The label can be a literal ("example"), a named parameter (":tenant") that matches one label,
+// or a named wildcard parameter (":sub*") that matches one or more labels.
+type hostPattern struct {
+	labels []hostLabel
+}
+
+type hostLabel struct {
+	literal  string
+	name     string
+	wildcard bool
+}
+
+func parseHostPattern(pattern string) *hostPattern {
+	pattern = strings.ToLower(strings.Trim(pattern, "."))
+	if pattern == "" {
+		panic(NewAppError("invalid host pattern"))
+	}
+	p := &hostPattern{}
+	for _, label := range strings.Split(pattern, ".") {
+		switch {
+		case label == "":
+			panic(NewAppError("invalid host pattern: " + pattern))
+		case label[0] == ':':
+			l := hostLabel{name: label[1:]}
+			if strings.HasSuffix(l.name, "*") {
+				l.name, l.wildcard = l.name[:len(l.name)-1], true
+			}
+			if l.name == "" {
+				panic(NewAppError("invalid host pattern: " + pattern))
+			}
+			p.labels = append(p.labels, l)
+		default:
+			p.labels = append(p.labels, hostLabel{literal: label})
+		}
+	}
+	return p
+}
+
+// match matches the host (the port is ignored) and returns the parameters.
+// The parameters is nil if the pattern has no parameter.
+func (p *hostPattern) match(host string) (map[string]string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return nil, false
+	}
+	var params map[string]string
+	if !matchLabels(p.labels, strings.Split(host, "."), &params) {
+		return nil, false
+	}
+	return params, true
+}
+
+func matchLabels(labels []hostLabel, parts []string, params *map[string]string) bool {
+	if len(labels) == 0 {
+		return len(parts) == 0
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	l := labels[0]
+	switch {
+	case l.name == "":
+		return l.literal == parts[0] && matchLabels(labels[1:], parts[1:], params)
+	case !l.wildcard:
+		if matchLabels(labels[1:], parts[1:], params) {
+			setHostParam(params, l.name, parts[0])
+			return true
+		}
+	default:
+		// the wildcard matches as many labels as possible
+		for n := len(parts) - len(labels) + 1; n >= 1; n-- {
+			if matchLabels(labels[1:], parts[n:], params) {
+				setHostParam(params, l.name, strings.Join(parts[:n], "."))
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func setHostParam(params *map[string]string, name, val string) {
+	if *params == nil {
+		*params = make(map[string]string)
+	}
+	(*params)[name] = val
+}
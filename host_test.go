@@ -0,0 +1,97 @@
+package gear
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearHostPattern(t *testing.T) {
+	t.Run("should panic with invalid pattern", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, pattern := range []string{".", "a..com", ":.example.com", ":*.example.com"} {
+			assert.Panics(func() {
+				parseHostPattern(pattern)
+			}, pattern)
+		}
+	})
+
+	t.Run("should match the host", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cases := []struct {
+			pattern string
+			host    string
+			ok      bool
+			params  map[string]string
+		}{
+			{"example.com", "Example.com:8080", true, nil},
+			{"example.com", "www.example.com", false, nil},
+			{":tenant.example.com", "acme.example.com", true, map[string]string{"tenant": "acme"}},
+			{":tenant.example.com", "ACME.example.com.", true, map[string]string{"tenant": "acme"}},
+			{":tenant.example.com", "example.com", false, nil},
+			{":tenant.example.com", "a.b.example.com", false, nil},
+			{":sub*.example.com", "a.b.example.com", true, map[string]string{"sub": "a.b"}},
+			{":sub*.example.com", "a.example.com", true, map[string]string{"sub": "a"}},
+			{":sub*.example.com", "example.com", false, nil},
+			{":sub*.:region.example.com", "a.b.us.example.com", true, map[string]string{"sub": "a.b", "region": "us"}},
+			{"api.:region.example.com", "api.eu.example.com", true, map[string]string{"region": "eu"}},
+			{"api.:region.example.com", "www.eu.example.com", false, nil},
+			{":tenant.example.com", "", false, nil},
+		}
+		for _, c := range cases {
+			params, ok := parseHostPattern(c.pattern).match(c.host)
+			assert.Equal(c.ok, ok, c.pattern+" "+c.host)
+			assert.Equal(c.params, params, c.pattern+" "+c.host)
+		}
+	})
+
+	t.Run("should route by host", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tenants := NewRouter(RouterOptions{Host: ":tenant.example.com"})
+		tenants.Get("/users/:id", func(ctx *Context) error {
+			return ctx.HTML(200, ctx.Param("tenant")+":"+ctx.Param("id"))
+		})
+		tenants.Get("/", func(ctx *Context) error {
+			return ctx.HTML(200, "tenant "+ctx.Param("tenant"))
+		})
+
+		site := NewRouter()
+		site.Get("/", func(ctx *Context) error {
+			return ctx.HTML(200, "main"+ctx.Param("tenant"))
+		})
+
+		app := New()
+		app.UseHandler(tenants)
+		app.UseHandler(site)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		request := func(hostname, path string) (int, string) {
+			req, _ := http.NewRequest("GET", host+path, nil)
+			req.Host = hostname
+			res, err := DefaultClientDo(req)
+			assert.Nil(err)
+			return res.StatusCode, PickRes(res.Text()).(string)
+		}
+
+		code, body := request("acme.example.com", "/users/123")
+		assert.Equal(200, code)
+		assert.Equal("acme:123", body)
+
+		code, body = request("acme.example.com", "/")
+		assert.Equal(200, code)
+		assert.Equal("tenant acme", body)
+
+		code, body = request("example.com", "/")
+		assert.Equal(200, code)
+		assert.Equal("main", body)
+
+		code, _ = request("example.com", "/users/123")
+		assert.Equal(501, code)
+	})
+}
@@ -0,0 +1,147 @@
+package gear
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Locales interface is used by ctx.Lang and ctx.T.
+//
+//  app.Set(gear.SetLocales, gear.NewCatalog().
+//  	Add("en", map[string]string{"hello": "Hello, %s!"}).
+//  	Add("zh-CN", map[string]string{"hello": "你好，%s！"}))
+//
+type Locales interface {
+	// Languages returns the supported language tags, the first one is the default language.
+	Languages() []string
+	// Message returns the message by language tag and key.
+	Message(lang, key string) (msg string, ok bool)
+}
+
+// Catalog is a lightweight in-memory message catalog, it implements Locales interface.
+// It should be built before the app serving.
+type Catalog struct {
+	langs    []string
+	messages map[string]map[string]string
+}
+
+// NewCatalog creates an empty Catalog instance.
+func NewCatalog() *Catalog {
+	return &Catalog{messages: make(map[string]map[string]string)}
+}
+
+// LoadCatalog creates a Catalog instance with the JSON message files in the dir,
+// the file name is the language tag, such as "en.json", "zh-CN.json".
+// The file content should be a JSON object of key-message pairs.
+// defaultLang is used as the default language, it should be one of the files.
+//
+//  catalog, err := gear.LoadCatalog("./locales", "en")
+//  if err != nil {
+//  	panic(err)
+//  }
+//  app.Set(gear.SetLocales, catalog)
+//
+func LoadCatalog(dir, defaultLang string) (*Catalog, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCatalog()
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		messages := make(map[string]string)
+		if err = json.Unmarshal(buf, &messages); err != nil {
+			return nil, NewAppError("invalid locale file " + file + ": " + err.Error())
+		}
+		c.Add(strings.TrimSuffix(filepath.Base(file), ".json"), messages)
+	}
+	// move the default language to the first one
+	for i, lang := range c.langs {
+		if strings.EqualFold(lang, defaultLang) {
+			copy(c.langs[1:i+1], c.langs[:i])
+			c.langs[0] = lang
+			return c, nil
+		}
+	}
+	return nil, NewAppError("default language not found: " + defaultLang)
+}
+
+// Add adds messages for the language tag, the first added language is the default language.
+func (c *Catalog) Add(lang string, messages map[string]string) *Catalog {
+	m, ok := c.messages[lang]
+	if !ok {
+		m = make(map[string]string, len(messages))
+		c.messages[lang] = m
+		c.langs = append(c.langs, lang)
+	}
+	for key, msg := range messages {
+		m[key] = msg
+	}
+	return c
+}
+
+// Languages implemented Locales interface.
+func (c *Catalog) Languages() []string {
+	return c.langs
+}
+
+// Message implemented Locales interface.
+func (c *Catalog) Message(lang, key string) (msg string, ok bool) {
+	if m, has := c.messages[lang]; has {
+		msg, ok = m[key]
+	}
+	return
+}
+
+// matchLanguage returns the best matched language of the offers by the AcceptSpecs.
+// An offer matches a language range if they are equal, or one is the prefix of another,
+// such as "en" and "en-US".
+func matchLanguage(specs []AcceptSpec, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if len(specs) == 0 {
+		return offers[0]
+	}
+
+	for _, spec := range specs {
+		if spec.Q == 0 {
+			continue
+		}
+		if spec.Value == "*" {
+			for _, offer := range offers {
+				if !excludedLanguage(specs, offer) {
+					return offer
+				}
+			}
+			continue
+		}
+		for _, offer := range offers {
+			if strings.EqualFold(offer, spec.Value) {
+				return offer
+			}
+		}
+		for _, offer := range offers {
+			lang := strings.ToLower(offer)
+			if strings.HasPrefix(spec.Value, lang+"-") || strings.HasPrefix(lang, spec.Value+"-") {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+func excludedLanguage(specs []AcceptSpec, lang string) bool {
+	for _, spec := range specs {
+		if spec.Q == 0 && strings.EqualFold(spec.Value, lang) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package gear
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearCatalog(t *testing.T) {
+	t.Run("NewCatalog", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := NewCatalog().
+			Add("en", map[string]string{"hello": "Hello", "bye": "Bye"}).
+			Add("zh-CN", map[string]string{"hello": "你好"}).
+			Add("en", map[string]string{"hi": "Hi"})
+		assert.Equal([]string{"en", "zh-CN"}, c.Languages())
+
+		msg, ok := c.Message("en", "hi")
+		assert.True(ok)
+		assert.Equal("Hi", msg)
+		msg, ok = c.Message("zh-CN", "hello")
+		assert.True(ok)
+		assert.Equal("你好", msg)
+		_, ok = c.Message("zh-CN", "bye")
+		assert.False(ok)
+		_, ok = c.Message("fr", "hello")
+		assert.False(ok)
+	})
+
+	t.Run("LoadCatalog", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c, err := LoadCatalog("testdata/locales", "zh-cn")
+		assert.Nil(err)
+		assert.Equal([]string{"zh-CN", "en"}, c.Languages())
+		msg, _ := c.Message("en", "bye")
+		assert.Equal("Bye", msg)
+
+		c, err = LoadCatalog("testdata/locales", "en")
+		assert.Nil(err)
+		assert.Equal([]string{"en", "zh-CN"}, c.Languages())
+
+		_, err = LoadCatalog("testdata/locales", "fr")
+		assert.NotNil(err)
+		_, err = LoadCatalog("testdata", "en")
+		assert.NotNil(err)
+	})
+}
+
+func TestGearMatchLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", matchLanguage(ParseAccept("en"), nil))
+	assert.Equal("en", matchLanguage(ParseAccept(""), []string{"en", "zh"}))
+	assert.Equal("en-GB", matchLanguage(ParseAccept("en-US, en;q=0.8"), []string{"zh", "en-GB"}))
+	assert.Equal("en", matchLanguage(ParseAccept("en-US"), []string{"zh", "en"}))
+	assert.Equal("en-US", matchLanguage(ParseAccept("en"), []string{"en-US"}))
+	assert.Equal("zh-CN", matchLanguage(ParseAccept("zh-cn, en;q=0.5"), []string{"en", "zh-CN"}))
+	assert.Equal("zh", matchLanguage(ParseAccept("fr, *;q=0.5, en;q=0"), []string{"en", "zh"}))
+	assert.Equal("", matchLanguage(ParseAccept("fr, de"), []string{"en", "zh"}))
+}
@@ -0,0 +1,276 @@
+// Package jsonrpc serves JSON-RPC 2.0 (https://www.jsonrpc.org/specification) on a gear route.
+//
+// The methods are registered with typed params and results, the batch requests and
+// the notifications are supported:
+//
+//  type AddParams struct {
+//  	A int `json:"a"`
+//  	B int `json:"b"`
+//  }
+//
+//  rpc := jsonrpc.New()
+//  rpc.Register("add", func(ctx *gear.Context, p *AddParams) (int, error) {
+//  	return p.A + p.B, nil
+//  })
+//
+//  router := gear.NewRouter()
+//  router.Post("/rpc", rpc.Serve)
+//
+// The request body is limited by the app's body parser (gear.SetBodyParser). The HTTP level
+// errors (such as 405 or 413) are returned as gear errors, so that the app's error hooks handle them.
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/teambition/gear"
+)
+
+// Version is the JSON-RPC protocol version.
+const Version = "2.0"
+
+// Standard error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeServerError is used for the non-JSON-RPC errors (except 5xx HTTPError) returned by methods.
+	// -32000 to -32099 are reserved for implementation-defined server-errors.
+	CodeServerError = -32000
+)
+
+// Error is a JSON-RPC error object, methods can return it to respond a specified error code.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Error implemented error interface.
+func (err *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (%d)", err.Message, err.Code)
+}
+
+// Request is a JSON-RPC request object.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// IsNotification reports whether the request is a notification, that has no "id" member.
+func (req *Request) IsNotification() bool {
+	return req.ID == nil
+}
+
+// Response is a JSON-RPC response object.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+var null = json.RawMessage("null")
+
+var (
+	ctxType   = reflect.TypeOf((*gear.Context)(nil))
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type method struct {
+	fn     reflect.Value
+	params reflect.Type // nil if the method has no params
+}
+
+// Server is a JSON-RPC 2.0 server, it implemented gear.Handler interface.
+type Server struct {
+	mu      sync.RWMutex
+	methods map[string]*method
+}
+
+// New creates a JSON-RPC Server.
+func New() *Server {
+	return &Server{methods: make(map[string]*method)}
+}
+
+// Register registers a method with the name. The fn should be one of:
+//
+//  func(ctx *gear.Context) (Result, error)
+//  func(ctx *gear.Context, params Params) (Result, error)
+//
+// The request params are decoded to Params with encoding/json, the Params can be
+// a struct (by-name params), a slice (by-position params), a map or a pointer of them.
+// If Params implemented gear.BodyTemplate interface, it will be validated,
+// a validation error is responded with CodeInvalidParams.
+// Register panics if the fn is invalid or the name is registered.
+func (s *Server) Register(name string, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() < 1 || t.NumIn() > 2 || t.In(0) != ctxType ||
+		t.NumOut() != 2 || t.Out(1) != errorType {
+		panic(fmt.Errorf("jsonrpc: invalid method %q: %s", name, t))
+	}
+
+	m := &method{fn: v}
+	if t.NumIn() == 2 {
+		m.params = t.In(1)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.methods[name]; ok {
+		panic(fmt.Errorf("jsonrpc: method %q registered", name))
+	}
+	s.methods[name] = m
+}
+
+// Serve implemented gear.Handler interface.
+func (s *Server) Serve(ctx *gear.Context) error {
+	if ctx.Method != http.MethodPost {
+		ctx.Set(gear.HeaderAllow, http.MethodPost)
+		return &gear.Error{Code: http.StatusMethodNotAllowed, Msg: "jsonrpc: method not allowed"}
+	}
+
+	var maxBytes int64 = 1 << 20
+	if parser, ok := ctx.Setting(gear.SetBodyParser).(gear.BodyParser); ok {
+		maxBytes = parser.MaxBytes()
+	}
+	buf, err := ioutil.ReadAll(http.MaxBytesReader(ctx.Res, ctx.Req.Body, maxBytes))
+	if err != nil {
+		return &gear.Error{Code: http.StatusRequestEntityTooLarge, Msg: err.Error()}
+	}
+
+	buf = bytes.TrimSpace(buf)
+	if len(buf) > 0 && buf[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(buf, &batch); err != nil {
+			return ctx.JSON(http.StatusOK, newErrorResponse(null, CodeParseError, err.Error()))
+		}
+		if len(batch) == 0 {
+			return ctx.JSON(http.StatusOK, newErrorResponse(null, CodeInvalidRequest, "empty batch"))
+		}
+		responses := make([]*Response, 0, len(batch))
+		for _, raw := range batch {
+			if res := s.call(ctx, raw); res != nil {
+				responses = append(responses, res)
+			}
+		}
+		if len(responses) == 0 {
+			return ctx.End(http.StatusNoContent)
+		}
+		return ctx.JSON(http.StatusOK, responses)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return ctx.JSON(http.StatusOK, newErrorResponse(null, CodeParseError, err.Error()))
+	}
+	if res := s.call(ctx, buf); res != nil {
+		return ctx.JSON(http.StatusOK, res)
+	}
+	return ctx.End(http.StatusNoContent)
+}
+
+// call calls the method of the request, it returns nil for notifications.
+func (s *Server) call(ctx *gear.Context, raw json.RawMessage) *Response {
+	req := &Request{}
+	if err := json.Unmarshal(raw, req); err != nil || req.JSONRPC != Version || req.Method == "" {
+		return newErrorResponse(null, CodeInvalidRequest, "invalid request")
+	}
+
+	result, rpcErr := s.invoke(ctx, req)
+	if req.IsNotification() {
+		return nil
+	}
+	if rpcErr != nil {
+		return &Response{JSONRPC: Version, Error: rpcErr, ID: req.ID}
+	}
+	return &Response{JSONRPC: Version, Result: result, ID: req.ID}
+}
+
+func (s *Server) invoke(ctx *gear.Context, req *Request) (result interface{}, rpcErr *Error) {
+	s.mu.RLock()
+	m, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, &Error{Code: CodeMethodNotFound, Message: "method not found"}
+	}
+
+	args := []reflect.Value{reflect.ValueOf(ctx)}
+	if m.params != nil {
+		params, err := decodeParams(m.params, req.Params)
+		if err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		args = append(args, params)
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			rpcErr = toError(ctx, gear.ErrorWithStack(err))
+		}
+	}()
+	out := m.fn.Call(args)
+	if err, _ := out[1].Interface().(error); !gear.IsNil(err) {
+		return nil, toError(ctx, err)
+	}
+	result = out[0].Interface()
+	if result == nil {
+		result = null // result member is required on success
+	}
+	return result, nil
+}
+
+func decodeParams(t reflect.Type, raw json.RawMessage) (reflect.Value, error) {
+	ptr := reflect.New(t)
+	if t.Kind() == reflect.Ptr {
+		ptr.Elem().Set(reflect.New(t.Elem()))
+	}
+	if len(raw) > 0 && !bytes.Equal(raw, null) {
+		if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+			return ptr, err
+		}
+	}
+	params := ptr.Elem()
+	if v, ok := params.Interface().(gear.BodyTemplate); ok {
+		if err := v.Validate(); err != nil {
+			return params, err
+		}
+	} else if v, ok := ptr.Interface().(gear.BodyTemplate); ok {
+		if err := v.Validate(); err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
+
+// toError converts the error returned by method to a JSON-RPC error,
+// the 5xx errors are logged to the app logger.
+func toError(ctx *gear.Context, err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	e := gear.ParseError(err)
+	if e.Status() < 500 {
+		return &Error{Code: CodeServerError, Message: e.Error(), Data: map[string]int{"status": e.Status()}}
+	}
+	if logger, ok := ctx.Setting(gear.SetLogger).(*log.Logger); ok {
+		logger.Println(gear.ErrorWithStack(err, 3).String())
+	}
+	return &Error{Code: CodeInternalError, Message: http.StatusText(e.Status())}
+}
+
+func newErrorResponse(id json.RawMessage, code int, msg string) *Response {
+	return &Response{JSONRPC: Version, Error: &Error{Code: code, Message: msg}, ID: id}
+}
@@ -0,0 +1,227 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+// TestMain runs the tests in "test" env, so the JSON responses of gear are compact.
+func TestMain(m *testing.M) {
+	os.Setenv("APP_ENV", "test")
+	os.Exit(m.Run())
+}
+
+type addParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func (p *addParams) Validate() error {
+	if p.A < 0 || p.B < 0 {
+		return errors.New("negative number")
+	}
+	return nil
+}
+
+var notified = make(chan string, 10)
+
+func newServer() *Server {
+	rpc := New()
+	rpc.Register("add", func(ctx *gear.Context, p *addParams) (int, error) {
+		return p.A + p.B, nil
+	})
+	rpc.Register("sum", func(ctx *gear.Context, nums []int) (int, error) {
+		sum := 0
+		for _, n := range nums {
+			sum += n
+		}
+		return sum, nil
+	})
+	rpc.Register("path", func(ctx *gear.Context) (string, error) {
+		return ctx.Path, nil
+	})
+	rpc.Register("notify", func(ctx *gear.Context, msg string) (interface{}, error) {
+		notified <- msg
+		return nil, nil
+	})
+	rpc.Register("fail", func(ctx *gear.Context, code int) (interface{}, error) {
+		switch code {
+		case 0:
+			return nil, &Error{Code: 1, Message: "custom", Data: "x"}
+		case 1:
+			panic("some panic")
+		default:
+			return nil, &gear.Error{Code: code, Msg: "gear error"}
+		}
+	})
+	return rpc
+}
+
+func post(t *testing.T, app *gear.App, body string) (*http.Response, string) {
+	srv := app.Start()
+	defer srv.Close()
+
+	res, err := http.Post("http://"+srv.Addr().String()+"/rpc", gear.MIMEApplicationJSON, strings.NewReader(body))
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	buf, _ := ioutil.ReadAll(res.Body)
+	return res, string(buf)
+}
+
+func newApp(logger *log.Logger) *gear.App {
+	router := gear.NewRouter()
+	rpc := newServer()
+	router.Post("/rpc", rpc.Serve)
+	router.Get("/rpc", rpc.Serve)
+
+	app := gear.New()
+	app.Set(gear.SetLogger, logger)
+	app.Set(gear.SetBodyParser, gear.DefaultBodyParser(200))
+	app.UseHandler(router)
+	return app
+}
+
+func TestJSONRPC(t *testing.T) {
+	var logs bytes.Buffer
+	app := newApp(log.New(&logs, "", 0))
+
+	t.Run("call", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, body := post(t, app, `{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2},"id":1}`)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(gear.MIMEApplicationJSONCharsetUTF8, res.Header.Get(gear.HeaderContentType))
+		assert.Equal(`{"jsonrpc":"2.0","result":3,"id":1}`, body)
+
+		_, body = post(t, app, `{"jsonrpc":"2.0","method":"sum","params":[1,2,3],"id":"a"}`)
+		assert.Equal(`{"jsonrpc":"2.0","result":6,"id":"a"}`, body)
+
+		_, body = post(t, app, `{"jsonrpc":"2.0","method":"path","id":null}`)
+		assert.Equal(`{"jsonrpc":"2.0","result":"/rpc","id":null}`, body)
+
+		_, body = post(t, app, `{"jsonrpc":"2.0","method":"notify","params":"x","id":2}`)
+		assert.Equal(`{"jsonrpc":"2.0","result":null,"id":2}`, body)
+		assert.Equal("x", <-notified)
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, body := post(t, app, `{"jsonrpc":"2.0","method":"notify","params":"hello"}`)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("", body)
+		assert.Equal("hello", <-notified)
+
+		// no response for the notification even if error
+		res, _ = post(t, app, `{"jsonrpc":"2.0","method":"none"}`)
+		assert.Equal(204, res.StatusCode)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, body := post(t, app, `[
+			{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2},"id":1},
+			{"jsonrpc":"2.0","method":"notify","params":"batch"},
+			{"jsonrpc":"2.0","method":"none","id":2},
+			1
+		]`)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(`[{"jsonrpc":"2.0","result":3,"id":1},`+
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found"},"id":2},`+
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}]`, body)
+		assert.Equal("batch", <-notified)
+
+		res, _ = post(t, app, `[{"jsonrpc":"2.0","method":"notify","params":"batch"}]`)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("batch", <-notified)
+
+		_, body = post(t, app, `[]`)
+		assert.Equal(`{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`, body)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		errorCode := func(body string) float64 {
+			_, res := post(t, app, body)
+			r := &Response{}
+			assert.Nil(json.Unmarshal([]byte(res), r))
+			assert.NotNil(r.Error)
+			return float64(r.Error.Code)
+		}
+		assert.Equal(float64(CodeParseError), errorCode(`{"jsonrpc":"2.0",`))
+		assert.Equal(float64(CodeParseError), errorCode(`[{"jsonrpc":"2.0"}`))
+		assert.Equal(float64(CodeInvalidRequest), errorCode(`{"jsonrpc":"1.0","method":"add","id":1}`))
+		assert.Equal(float64(CodeInvalidRequest), errorCode(`{"jsonrpc":"2.0","id":1}`))
+		assert.Equal(float64(CodeInvalidRequest), errorCode(`"x"`))
+		assert.Equal(float64(CodeMethodNotFound), errorCode(`{"jsonrpc":"2.0","method":"none","id":1}`))
+		assert.Equal(float64(CodeInvalidParams), errorCode(`{"jsonrpc":"2.0","method":"add","params":[1],"id":1}`))
+		assert.Equal(float64(CodeInvalidParams), errorCode(`{"jsonrpc":"2.0","method":"add","params":{"a":-1},"id":1}`))
+
+		_, body := post(t, app, `{"jsonrpc":"2.0","method":"fail","params":0,"id":1}`)
+		assert.Equal(`{"jsonrpc":"2.0","error":{"code":1,"message":"custom","data":"x"},"id":1}`, body)
+
+		_, body = post(t, app, `{"jsonrpc":"2.0","method":"fail","params":403,"id":1}`)
+		assert.Equal(`{"jsonrpc":"2.0","error":{"code":-32000,"message":"gear error","data":{"status":403}},"id":1}`, body)
+		assert.Equal("", logs.String())
+
+		_, body = post(t, app, `{"jsonrpc":"2.0","method":"fail","params":502,"id":1}`)
+		assert.Equal(`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Bad Gateway"},"id":1}`, body)
+		assert.True(strings.Contains(logs.String(), `Msg:"gear error"`))
+
+		_, body = post(t, app, `{"jsonrpc":"2.0","method":"fail","params":1,"id":1}`)
+		assert.Equal(`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal Server Error"},"id":1}`, body)
+		assert.True(strings.Contains(logs.String(), `Msg:"some panic"`))
+	})
+
+	t.Run("HTTP errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, _ := post(t, app, `{"jsonrpc":"2.0","method":"notify","params":"`+strings.Repeat("x", 200)+`"}`)
+		assert.Equal(413, res.StatusCode)
+
+		srv := app.Start()
+		defer srv.Close()
+		res, err := http.Get("http://" + srv.Addr().String() + "/rpc")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.Equal("POST", res.Header.Get(gear.HeaderAllow))
+		res.Body.Close()
+	})
+}
+
+func TestJSONRPCRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := New()
+	assert.Panics(func() {
+		rpc.Register("a", "x")
+	})
+	assert.Panics(func() {
+		rpc.Register("a", func(ctx *gear.Context) error { return nil })
+	})
+	assert.Panics(func() {
+		rpc.Register("a", func(p int) (int, error) { return 0, nil })
+	})
+	assert.Panics(func() {
+		rpc.Register("a", func(ctx *gear.Context, a, b int) (int, error) { return 0, nil })
+	})
+	rpc.Register("a", func(ctx *gear.Context) (int, error) { return 0, nil })
+	assert.Panics(func() {
+		rpc.Register("a", func(ctx *gear.Context) (int, error) { return 0, nil })
+	})
+
+	err := &Error{Code: CodeMethodNotFound, Message: "method not found"}
+	assert.Equal("jsonrpc: method not found (-32601)", err.Error())
+}
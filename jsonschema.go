@@ -0,0 +1,676 @@
+package gear
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONSchema is a compiled JSON Schema to validate the JSON request bodies. It supports the
+// commonly used keywords of draft 2020-12 (and draft 7):
+// type, enum, const, properties, required, additionalProperties, minProperties, maxProperties,
+// items, minItems, maxItems, uniqueItems, minLength, maxLength, pattern, format, minimum,
+// maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not, and
+// $ref to the local definitions ("#/$defs/..." or "#/definitions/..."). The formats
+// "date-time", "date", "email", "uri", "uuid", "ipv4" and "ipv6" are checked, the others
+// are ignored.
+type JSONSchema struct {
+	boolean    *bool // true or false schema
+	types      []string
+	enum       []interface{}
+	constant   interface{}
+	hasConst   bool
+	properties map[string]*JSONSchema
+	propNames  []string // sorted for the stable violations
+	required   []string
+	additional *JSONSchema
+	minProps   int
+	maxProps   int
+	items      *JSONSchema
+	minItems   int
+	maxItems   int
+	unique     bool
+	minLength  int
+	maxLength  int
+	pattern    *regexp.Regexp
+	format     string
+	minimum    *float64
+	maximum    *float64
+	exclMin    *float64
+	exclMax    *float64
+	multipleOf float64
+	allOf      []*JSONSchema
+	anyOf      []*JSONSchema
+	oneOf      []*JSONSchema
+	not        *JSONSchema
+	ref        string
+	refSchema  *JSONSchema
+}
+
+// SchemaViolation is a violation of the JSON Schema, Pointer is the JSON pointer (RFC 6901)
+// of the invalid value, such as "/items/0/name".
+type SchemaViolation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// SchemaError is a 400 Bad Request error with the violations of the JSON Schema,
+// the violations are enumerated in the error message:
+//
+//  invalid request body: /name: is required; /age: must be >= 0
+//
+type SchemaError struct {
+	Violations []SchemaViolation `json:"violations"`
+}
+
+// Status implemented HTTPError interface.
+func (err *SchemaError) Status() int {
+	return http.StatusBadRequest
+}
+
+// Error implemented HTTPError interface.
+func (err *SchemaError) Error() string {
+	msgs := make([]string, len(err.Violations))
+	for i, v := range err.Violations {
+		pointer := v.Pointer
+		if pointer == "" {
+			pointer = "/"
+		}
+		msgs[i] = pointer + ": " + v.Message
+	}
+	return "invalid request body: " + strings.Join(msgs, "; ")
+}
+
+// SchemaBody is an optional interface of BodyTemplate, the JSON request body will be validated
+// with the JSON Schema by ctx.ParseBody before it parsed into the BodyTemplate.
+//
+//  var userSchema = gear.MustCompileJSONSchema(`{
+//  	"type": "object",
+//  	"properties": {"name": {"type": "string", "minLength": 1}},
+//  	"required": ["name"]
+//  }`)
+//
+//  func (b *userBody) JSONSchema() *gear.JSONSchema { return userSchema }
+//
+type SchemaBody interface {
+	JSONSchema() *JSONSchema
+}
+
+type schemaCompiler struct {
+	root  interface{}
+	cache map[string]*JSONSchema
+}
+
+// CompileJSONSchema compiles the JSON Schema document.
+func CompileJSONSchema(doc []byte) (*JSONSchema, error) {
+	return CompileJSONSchemaAt(doc, "")
+}
+
+// CompileJSONSchemaAt compiles the subschema at the JSON pointer of the document, the local
+// $ref are resolved from the document root, such as the schemas in an OpenAPI document:
+//
+//  s, err := gear.CompileJSONSchemaAt(doc, "/components/schemas/User")
+//
+func CompileJSONSchemaAt(doc []byte, pointer string) (*JSONSchema, error) {
+	var root interface{}
+	d := json.NewDecoder(bytes.NewReader(doc))
+	d.UseNumber()
+	if err := d.Decode(&root); err != nil {
+		return nil, err
+	}
+	c := &schemaCompiler{root: root, cache: make(map[string]*JSONSchema)}
+	s, err := c.resolve("#" + pointer)
+	if err != nil {
+		return nil, err
+	}
+	// resolve the references, the referenced schemas may have references too
+	for resolved := true; resolved; {
+		resolved = false
+		pending := make(map[string]*JSONSchema)
+		for ptr, s := range c.cache {
+			if s.ref != "" && s.refSchema == nil {
+				pending[ptr] = s
+			}
+		}
+		for ptr, s := range pending {
+			if s.refSchema, err = c.resolve(s.ref); err != nil {
+				return nil, fmt.Errorf("invalid $ref at %s: %v", ptr, err)
+			}
+			resolved = true
+		}
+	}
+	return s, nil
+}
+
+// MustCompileJSONSchema is like CompileJSONSchema but panics if the document is invalid.
+func MustCompileJSONSchema(doc string) *JSONSchema {
+	s, err := CompileJSONSchema([]byte(doc))
+	if err != nil {
+		panic(NewAppError("invalid JSON Schema: " + err.Error()))
+	}
+	return s
+}
+
+func (c *schemaCompiler) compile(v interface{}, ptr string) (*JSONSchema, error) {
+	if s, ok := c.cache[ptr]; ok {
+		return s, nil
+	}
+	s := &JSONSchema{minProps: -1, maxProps: -1, minItems: -1, maxItems: -1,
+		minLength: -1, maxLength: -1}
+	c.cache[ptr] = s
+
+	if b, ok := v.(bool); ok {
+		s.boolean = &b
+		return s, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema at %s must be an object or a boolean", ptr)
+	}
+
+	var err error
+	// sub compiles the subschema at the path (escaped) relative to the schema
+	sub := func(path string, v interface{}) *JSONSchema {
+		if err != nil {
+			return nil
+		}
+		var res *JSONSchema
+		res, err = c.compile(v, ptr+"/"+path)
+		return res
+	}
+	subs := func(key string) []*JSONSchema {
+		list, ok := m[key].([]interface{})
+		if !ok {
+			if m[key] != nil && err == nil {
+				err = fmt.Errorf("%s at %s must be an array", key, ptr)
+			}
+			return nil
+		}
+		res := make([]*JSONSchema, len(list))
+		for i, item := range list {
+			res[i] = sub(key+"/"+strconv.Itoa(i), item)
+		}
+		return res
+	}
+	num := func(key string) *float64 {
+		if n, ok := m[key].(json.Number); ok {
+			f, e := n.Float64()
+			if e != nil && err == nil {
+				err = e
+			}
+			return &f
+		}
+		return nil
+	}
+	count := func(key string) int {
+		if f := num(key); f != nil {
+			return int(*f)
+		}
+		return -1
+	}
+
+	if ref, ok := m["$ref"].(string); ok {
+		s.ref = ref
+	}
+	switch t := m["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			if str, ok := item.(string); ok {
+				s.types = append(s.types, str)
+			}
+		}
+	}
+	if enum, ok := m["enum"].([]interface{}); ok {
+		s.enum = enum
+	}
+	if constant, ok := m["const"]; ok {
+		s.constant, s.hasConst = constant, true
+	}
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		s.properties = make(map[string]*JSONSchema, len(props))
+		for name, v := range props {
+			s.properties[name] = sub("properties/"+escapePointer(name), v)
+			s.propNames = append(s.propNames, name)
+		}
+		sort.Strings(s.propNames)
+	}
+	if required, ok := m["required"].([]interface{}); ok {
+		for _, item := range required {
+			if str, ok := item.(string); ok {
+				s.required = append(s.required, str)
+			}
+		}
+	}
+	if v, ok := m["additionalProperties"]; ok {
+		s.additional = sub("additionalProperties", v)
+	}
+	if v, ok := m["items"]; ok {
+		s.items = sub("items", v)
+	}
+	s.minProps, s.maxProps = count("minProperties"), count("maxProperties")
+	s.minItems, s.maxItems = count("minItems"), count("maxItems")
+	s.minLength, s.maxLength = count("minLength"), count("maxLength")
+	s.unique, _ = m["uniqueItems"].(bool)
+	if pattern, ok := m["pattern"].(string); ok {
+		var e error
+		if s.pattern, e = regexp.Compile(pattern); e != nil {
+			return nil, fmt.Errorf("invalid pattern at %s: %v", ptr, e)
+		}
+	}
+	s.format, _ = m["format"].(string)
+	s.minimum, s.maximum = num("minimum"), num("maximum")
+	s.exclMin, s.exclMax = num("exclusiveMinimum"), num("exclusiveMaximum")
+	if f := num("multipleOf"); f != nil {
+		s.multipleOf = *f
+	}
+	s.allOf, s.anyOf, s.oneOf = subs("allOf"), subs("anyOf"), subs("oneOf")
+	if v, ok := m["not"]; ok {
+		s.not = sub("not", v)
+	}
+	// compile the definitions to check them
+	for _, key := range []string{"$defs", "definitions"} {
+		if defs, ok := m[key].(map[string]interface{}); ok {
+			for name, v := range defs {
+				sub(key+"/"+escapePointer(name), v)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *schemaCompiler) resolve(ref string) (*JSONSchema, error) {
+	if s, ok := c.cache[ref]; ok {
+		return s, nil
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local $ref is supported: %s", ref)
+	}
+	v := c.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		ok := false
+		switch val := v.(type) {
+		case map[string]interface{}:
+			v, ok = val[token]
+		case []interface{}:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(val) {
+				v, ok = val[i], true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("$ref not found: %s", ref)
+		}
+	}
+	return c.compile(v, ref)
+}
+
+// ValidateJSON validates the JSON document, it returns a *SchemaError with the violations if
+// the document is invalid.
+func (s *JSONSchema) ValidateJSON(doc []byte) error {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(doc))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return &SchemaError{Violations: []SchemaViolation{{Message: "invalid JSON: " + err.Error()}}}
+	}
+	if d.More() {
+		return &SchemaError{Violations: []SchemaViolation{{Message: "invalid JSON: extra data after the value"}}}
+	}
+	return s.Validate(v)
+}
+
+// Validate validates the value decoded from JSON (by json.Unmarshal into an interface{},
+// with or without json.Decoder.UseNumber), it returns a *SchemaError with the violations if
+// the value is invalid.
+func (s *JSONSchema) Validate(v interface{}) error {
+	var violations []SchemaViolation
+	s.validate(v, "", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validate(v interface{}, ptr string, vs *[]SchemaViolation) {
+	add := func(format string, args ...interface{}) {
+		*vs = append(*vs, SchemaViolation{Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.boolean != nil {
+		if !*s.boolean {
+			add("is not allowed")
+		}
+		return
+	}
+	if s.refSchema != nil {
+		s.refSchema.validate(v, ptr, vs)
+	}
+
+	if len(s.types) > 0 {
+		ok := false
+		for _, t := range s.types {
+			if isJSONType(v, t) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			add("must be %s", strings.Join(s.types, " or "))
+			return
+		}
+	}
+	if s.enum != nil {
+		ok := false
+		for _, e := range s.enum {
+			if jsonEqual(v, e) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			add("must be one of %s", jsonString(s.enum))
+		}
+	}
+	if s.hasConst && !jsonEqual(v, s.constant) {
+		add("must be %s", jsonString(s.constant))
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(val, ptr, vs, add)
+	case []interface{}:
+		s.validateArray(val, ptr, vs, add)
+	case string:
+		s.validateString(val, add)
+	case json.Number, float64:
+		f, _ := toFloat(val)
+		s.validateNumber(f, add)
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, ptr, vs)
+	}
+	if len(s.anyOf) > 0 {
+		ok := false
+		for _, sub := range s.anyOf {
+			if sub.Validate(v) == nil {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			add("must match any of the schemas")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		n := 0
+		for _, sub := range s.oneOf {
+			if sub.Validate(v) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			add("must match exactly one of the schemas, but matched %d", n)
+		}
+	}
+	if s.not != nil && s.not.Validate(v) == nil {
+		add("must not match the schema")
+	}
+}
+
+func (s *JSONSchema) validateObject(obj map[string]interface{}, ptr string, vs *[]SchemaViolation,
+	add func(string, ...interface{})) {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			*vs = append(*vs, SchemaViolation{Pointer: ptr + "/" + escapePointer(name), Message: "is required"})
+		}
+	}
+	if s.minProps >= 0 && len(obj) < s.minProps {
+		add("must have at least %d properties", s.minProps)
+	}
+	if s.maxProps >= 0 && len(obj) > s.maxProps {
+		add("must have at most %d properties", s.maxProps)
+	}
+	for _, name := range s.propNames {
+		if val, ok := obj[name]; ok {
+			s.properties[name].validate(val, ptr+"/"+escapePointer(name), vs)
+		}
+	}
+	if s.additional != nil {
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			if _, ok := s.properties[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := ptr + "/" + escapePointer(name)
+			if b := s.additional.boolean; b != nil && !*b {
+				*vs = append(*vs, SchemaViolation{Pointer: p, Message: "is not allowed"})
+			} else {
+				s.additional.validate(obj[name], p, vs)
+			}
+		}
+	}
+}
+
+func (s *JSONSchema) validateArray(arr []interface{}, ptr string, vs *[]SchemaViolation,
+	add func(string, ...interface{})) {
+	if s.minItems >= 0 && len(arr) < s.minItems {
+		add("must have at least %d items", s.minItems)
+	}
+	if s.maxItems >= 0 && len(arr) > s.maxItems {
+		add("must have at most %d items", s.maxItems)
+	}
+	if s.unique {
+	loop:
+		for i := 1; i < len(arr); i++ {
+			for j := 0; j < i; j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					add("must have unique items, but items %d and %d are equal", j, i)
+					break loop
+				}
+			}
+		}
+	}
+	if s.items != nil {
+		for i, item := range arr {
+			s.items.validate(item, ptr+"/"+strconv.Itoa(i), vs)
+		}
+	}
+}
+
+func (s *JSONSchema) validateString(str string, add func(string, ...interface{})) {
+	n := utf8.RuneCountInString(str)
+	if s.minLength >= 0 && n < s.minLength {
+		add("must be at least %d characters", s.minLength)
+	}
+	if s.maxLength >= 0 && n > s.maxLength {
+		add("must be at most %d characters", s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		add("must match pattern %q", s.pattern.String())
+	}
+	if s.format != "" && !checkFormat(s.format, str) {
+		add("must be a valid %s", s.format)
+	}
+}
+
+func (s *JSONSchema) validateNumber(f float64, add func(string, ...interface{})) {
+	if s.minimum != nil && f < *s.minimum {
+		add("must be >= %v", *s.minimum)
+	}
+	if s.maximum != nil && f > *s.maximum {
+		add("must be <= %v", *s.maximum)
+	}
+	if s.exclMin != nil && f <= *s.exclMin {
+		add("must be > %v", *s.exclMin)
+	}
+	if s.exclMax != nil && f >= *s.exclMax {
+		add("must be < %v", *s.exclMax)
+	}
+	if s.multipleOf > 0 {
+		if q := f / s.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			add("must be a multiple of %v", s.multipleOf)
+		}
+	}
+}
+
+// ValidateBody creates a middleware that validates the JSON request body with the JSON Schema
+// before the handlers run, the request without JSON body is responded with 415 Unsupported
+// Media Type, and the invalid body with 400 Bad Request enumerating the violations. The body
+// can be read again by the handlers, such as ctx.ParseBody.
+//
+//  router.Post("/users", gear.ValidateBody(userSchema), createUser)
+//
+func ValidateBody(s *JSONSchema) Middleware {
+	return func(ctx *Context) error {
+		if ctx.Req.Body == nil || ctx.Req.Body == http.NoBody {
+			return s.Validate(nil)
+		}
+		mediaType, _, _ := mime.ParseMediaType(ctx.Get(HeaderContentType))
+		if !isJSONMediaType(mediaType) {
+			return &Error{Code: http.StatusUnsupportedMediaType, Msg: "JSON request body required"}
+		}
+		maxBytes := int64(1 << 20)
+		if ctx.app.bodyParser != nil {
+			maxBytes = ctx.app.bodyParser.MaxBytes()
+		}
+		buf, err := ioutil.ReadAll(http.MaxBytesReader(ctx.Res, ctx.Req.Body, maxBytes))
+		if err != nil {
+			return &Error{Code: http.StatusRequestEntityTooLarge, Msg: err.Error()}
+		}
+		ctx.Req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		return s.ValidateJSON(buf)
+	}
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+func isJSONType(v interface{}, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := toFloat(v)
+		return ok
+	case "integer":
+		f, ok := toFloat(v)
+		return ok && f == math.Trunc(f)
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func jsonEqual(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, v := range va {
+			if w, ok := vb[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !jsonEqual(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonString(v interface{}) string {
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
+
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+var (
+	emailReg = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	uuidReg  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+func checkFormat(format, str string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, str)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", str)
+		return err == nil
+	case "email":
+		return emailReg.MatchString(str)
+	case "uri":
+		u, err := url.Parse(str)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		return uuidReg.MatchString(str)
+	case "ipv4":
+		ip := net.ParseIP(str)
+		return ip != nil && ip.To4() != nil && !strings.Contains(str, ":")
+	case "ipv6":
+		ip := net.ParseIP(str)
+		return ip != nil && strings.Contains(str, ":")
+	}
+	return true
+}
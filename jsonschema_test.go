@@ -0,0 +1,183 @@
+package gear
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testUserSchema = MustCompileJSONSchema(`{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 8},
+		"age": {"type": "integer", "minimum": 0},
+		"email": {"type": "string", "format": "email"},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "uniqueItems": true}
+	},
+	"required": ["name"],
+	"additionalProperties": false,
+	"$defs": {
+		"tag": {"type": "string", "enum": ["a", "b", "c"]}
+	}
+}`)
+
+type schemaBodyTemplate struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func (b *schemaBodyTemplate) Validate() error {
+	return nil
+}
+
+func (b *schemaBodyTemplate) JSONSchema() *JSONSchema {
+	return testUserSchema
+}
+
+func TestJSONSchema(t *testing.T) {
+	t.Run("should compile JSON Schema", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := CompileJSONSchema([]byte(`{"type":`))
+		assert.NotNil(err)
+		_, err = CompileJSONSchema([]byte(`"string"`))
+		assert.NotNil(err)
+		_, err = CompileJSONSchema([]byte(`{"pattern": "["}`))
+		assert.NotNil(err)
+		_, err = CompileJSONSchema([]byte(`{"$ref": "#/$defs/none"}`))
+		assert.NotNil(err)
+		_, err = CompileJSONSchema([]byte(`{"$ref": "http://example.com/schema"}`))
+		assert.NotNil(err)
+		assert.Panics(func() {
+			MustCompileJSONSchema(`[]`)
+		})
+
+		s, err := CompileJSONSchema([]byte(`true`))
+		assert.Nil(err)
+		assert.Nil(s.ValidateJSON([]byte(`{"any": 1}`)))
+	})
+
+	t.Run("should validate JSON document", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Nil(testUserSchema.ValidateJSON([]byte(`{"name":"gear","age":1,"tags":["a","b"]}`)))
+
+		err := testUserSchema.ValidateJSON([]byte(`{"age":-1.5,"email":"x","tags":["a","a","d"],"foo":1}`))
+		assert.NotNil(err)
+		e := err.(*SchemaError)
+		assert.Equal(400, e.Status())
+		assert.Equal([]SchemaViolation{
+			{Pointer: "/name", Message: "is required"},
+			{Pointer: "/age", Message: "must be integer"},
+			{Pointer: "/email", Message: "must be a valid email"},
+			{Pointer: "/tags", Message: "must have unique items, but items 0 and 1 are equal"},
+			{Pointer: "/tags/2", Message: `must be one of ["a","b","c"]`},
+			{Pointer: "/foo", Message: "is not allowed"},
+		}, e.Violations)
+		assert.True(strings.HasPrefix(e.Error(), "invalid request body: /name: is required; /age: must be integer"))
+
+		err = testUserSchema.ValidateJSON([]byte(`[]`))
+		assert.Equal("invalid request body: /: must be object", err.Error())
+		err = testUserSchema.ValidateJSON([]byte(`{"name":"gear"} {}`))
+		assert.Equal(400, err.(*SchemaError).Status())
+		err = testUserSchema.ValidateJSON([]byte(`{"name":`))
+		assert.Equal(400, err.(*SchemaError).Status())
+	})
+
+	t.Run("should compile subschema with CompileJSONSchemaAt", func(t *testing.T) {
+		assert := assert.New(t)
+
+		doc := []byte(`{
+			"paths": {"/users": {"schema": {"$ref": "#/components/schemas/User"}}},
+			"components": {"schemas": {"User": {"type": "object", "required": ["name"]}}}
+		}`)
+		s, err := CompileJSONSchemaAt(doc, "/paths/~1users/schema")
+		assert.Nil(err)
+		assert.Nil(s.ValidateJSON([]byte(`{"name":"gear"}`)))
+		assert.NotNil(s.ValidateJSON([]byte(`{}`)))
+
+		_, err = CompileJSONSchemaAt(doc, "/paths/~1none")
+		assert.NotNil(err)
+	})
+
+	t.Run("should validate combinators", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s := MustCompileJSONSchema(`{
+			"oneOf": [{"type": "integer"}, {"type": "number", "multipleOf": 0.5}],
+			"not": {"const": 3}
+		}`)
+		assert.Nil(s.ValidateJSON([]byte(`1.5`)))
+		assert.NotNil(s.ValidateJSON([]byte(`2`)))
+		assert.NotNil(s.ValidateJSON([]byte(`3`)))
+		assert.NotNil(s.ValidateJSON([]byte(`1.2`)))
+
+		s = MustCompileJSONSchema(`{"anyOf": [{"type": "string", "format": "uuid"}, {"type": "null"}]}`)
+		assert.Nil(s.ValidateJSON([]byte(`null`)))
+		assert.Nil(s.ValidateJSON([]byte(`"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`)))
+		assert.NotNil(s.ValidateJSON([]byte(`"abc"`)))
+	})
+
+	t.Run("should validate body with ctx.ParseBody", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		ctx := CtxTest(app, "POST", "http://example.com/foo",
+			bytes.NewBuffer([]byte(`{"name":"gear","age":1}`)))
+		ctx.Req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+		body := &schemaBodyTemplate{}
+		assert.Nil(ctx.ParseBody(body))
+		assert.Equal("gear", body.Name)
+		assert.Equal(1, body.Age)
+
+		ctx = CtxTest(app, "POST", "http://example.com/foo",
+			bytes.NewBuffer([]byte(`{"name":""}`)))
+		ctx.Req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+		err := ctx.ParseBody(&schemaBodyTemplate{})
+		assert.Equal(400, err.(*SchemaError).Status())
+		assert.Equal("/name", err.(*SchemaError).Violations[0].Pointer)
+	})
+
+	t.Run("ValidateBody middleware", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		router := NewRouter()
+		router.Post("/users", ValidateBody(testUserSchema), func(ctx *Context) error {
+			body := &schemaBodyTemplate{}
+			if err := ctx.ParseBody(body); err != nil {
+				return err
+			}
+			return ctx.JSON(200, body)
+		})
+		app.UseHandler(router)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		post := func(contentType, body string) (*http.Response, string) {
+			res, err := DefaultClient.Post(host+"/users", contentType, strings.NewReader(body))
+			if err != nil {
+				panic(err)
+			}
+			buf := new(bytes.Buffer)
+			buf.ReadFrom(res.Body)
+			res.Body.Close()
+			return res, buf.String()
+		}
+
+		res, body := post(MIMEApplicationJSON, `{"name":"gear","age":1}`)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(`{"name":"gear","age":1}`, body)
+
+		res, body = post(MIMEApplicationJSON, `{"age":1}`)
+		assert.Equal(400, res.StatusCode)
+		assert.Contains(body, "/name: is required")
+
+		res, _ = post(MIMETextPlain, `{"name":"gear"}`)
+		assert.Equal(415, res.StatusCode)
+	})
+}
@@ -0,0 +1,374 @@
+// Package lambda serves a Gear app (or any http.Handler) on AWS Lambda.
+//
+// It converts API Gateway REST API (payload v1), HTTP API (payload v2) and
+// Application Load Balancer events into http.Request, runs them through the
+// handler and converts the responses back. So the same app code runs on Lambda
+// and on a normal listener:
+//
+//  package main
+//
+//  import (
+//  	awslambda "github.com/aws/aws-lambda-go/lambda"
+//  	"github.com/teambition/gear"
+//  	"github.com/teambition/gear/lambda"
+//  )
+//
+//  func main() {
+//  	app := gear.New()
+//  	app.Use(func(ctx *gear.Context) error {
+//  		return ctx.HTML(200, "<h1>Hello, Gear!</h1>")
+//  	})
+//  	awslambda.StartHandler(lambda.New(app))
+//  }
+//
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+// ErrMultipleCookies is returned when the response has more than one Set-Cookie header for an ALB
+// event without the multi-value headers. Enable the multi-value headers of the ALB target group
+// to respond them.
+var ErrMultipleCookies = errors.New("lambda: multiple Set-Cookie headers require the multi-value headers of ALB")
+
+// EventKind represents the kind of the Lambda event.
+type EventKind int
+
+// The event kinds supported.
+const (
+	EventAPIGatewayV1 EventKind = iota
+	EventAPIGatewayV2
+	EventALB
+)
+
+// Event is the union of API Gateway v1, v2 and ALB request events,
+// only the fields used to build the http.Request are decoded.
+type Event struct {
+	Version                         string              `json:"version"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	RawPath                         string              `json:"rawPath"`
+	RawQueryString                  string              `json:"rawQueryString"`
+	Cookies                         []string            `json:"cookies"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	Body                            string              `json:"body"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+	RequestContext                  struct {
+		HTTP *struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+		Identity *struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+		ELB *struct {
+			TargetGroupArn string `json:"targetGroupArn"`
+		} `json:"elb"`
+	} `json:"requestContext"`
+
+	// Raw is the original event payload.
+	Raw json.RawMessage `json:"-"`
+}
+
+// Kind returns the kind of the event.
+func (e *Event) Kind() EventKind {
+	switch {
+	case e.RequestContext.ELB != nil:
+		return EventALB
+	case e.Version == "2.0" || e.RequestContext.HTTP != nil:
+		return EventAPIGatewayV2
+	default:
+		return EventAPIGatewayV1
+	}
+}
+
+// Response is the union of API Gateway v1, v2 and ALB response payloads.
+type Response struct {
+	StatusCode        int                 `json:"statusCode"`
+	StatusDescription string              `json:"statusDescription,omitempty"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+type eventKey struct{}
+
+// EventFrom returns the Lambda event from the request's context,
+// it can be used to access the fields (such as requestContext.authorizer) in Event.Raw.
+//
+//  event := lambda.EventFrom(ctx)
+//
+func EventFrom(ctx context.Context) *Event {
+	e, _ := ctx.Value(eventKey{}).(*Event)
+	return e
+}
+
+// Handler serves the Lambda events with a http.Handler.
+// It implements the Handler interface of github.com/aws/aws-lambda-go/lambda.
+type Handler struct {
+	handler http.Handler
+}
+
+// New creates a Handler with the handler, usually a *gear.App.
+func New(handler http.Handler) *Handler {
+	return &Handler{handler: handler}
+}
+
+// Invoke decodes the payload to an Event, serves it and returns the encoded Response.
+func (h *Handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	event := &Event{Raw: json.RawMessage(payload)}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	res, err := h.Serve(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
+
+// Serve serves the event with the handler and returns the Response.
+func (h *Handler) Serve(ctx context.Context, event *Event) (*Response, error) {
+	req, err := NewRequest(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	w := newResponseWriter()
+	h.handler.ServeHTTP(w, req)
+	return w.response(event)
+}
+
+// NewRequest creates a http.Request from the event, the event can be retrieved
+// by EventFrom(req.Context()).
+func NewRequest(ctx context.Context, event *Event) (*http.Request, error) {
+	kind := event.Kind()
+	method := event.HTTPMethod
+	path := event.Path
+	var rawQuery, remoteIP string
+
+	switch kind {
+	case EventAPIGatewayV2:
+		if event.RequestContext.HTTP != nil {
+			method = event.RequestContext.HTTP.Method
+			remoteIP = event.RequestContext.HTTP.SourceIP
+		}
+		path = event.RawPath
+		rawQuery = event.RawQueryString
+	case EventALB:
+		// ALB doesn't decode the query string parameters.
+		rawQuery = joinQuery(event.MultiValueQueryStringParameters, event.QueryStringParameters, false)
+	default:
+		if event.RequestContext.Identity != nil {
+			remoteIP = event.RequestContext.Identity.SourceIP
+		}
+		rawQuery = joinQuery(event.MultiValueQueryStringParameters, event.QueryStringParameters, true)
+	}
+
+	if method == "" {
+		return nil, errors.New("lambda: no HTTP method in event")
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	var body []byte
+	if event.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	} else {
+		body = []byte(event.Body)
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = rawQuery
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = u.RequestURI()
+
+	if len(event.MultiValueHeaders) > 0 {
+		for key, vals := range event.MultiValueHeaders {
+			for _, val := range vals {
+				req.Header.Add(key, val)
+			}
+		}
+	} else {
+		for key, val := range event.Headers {
+			req.Header.Set(key, val)
+		}
+	}
+	if len(event.Cookies) > 0 {
+		req.Header.Set(gear.HeaderCookie, strings.Join(event.Cookies, "; "))
+	}
+	if req.Header.Get(gear.HeaderContentLength) == "" && len(body) > 0 {
+		req.Header.Set(gear.HeaderContentLength, strconv.Itoa(len(body)))
+	}
+
+	req.Host = req.Header.Get("Host")
+	if remoteIP == "" {
+		remoteIP = lastForwardedFor(req.Header.Values(gear.HeaderXForwardedFor))
+	}
+	if remoteIP != "" {
+		req.RemoteAddr = remoteIP + ":0"
+	}
+	return req.WithContext(context.WithValue(ctx, eventKey{}, event)), nil
+}
+
+func joinQuery(multi map[string][]string, single map[string]string, escape bool) string {
+	var buf bytes.Buffer
+	add := func(key, val string) {
+		if buf.Len() > 0 {
+			buf.WriteByte('&')
+		}
+		if escape {
+			key = url.QueryEscape(key)
+			val = url.QueryEscape(val)
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(val)
+	}
+	if len(multi) > 0 {
+		for key, vals := range multi {
+			for _, val := range vals {
+				add(key, val)
+			}
+		}
+	} else {
+		for key, val := range single {
+			add(key, val)
+		}
+	}
+	return buf.String()
+}
+
+// lastForwardedFor returns the rightmost entry of the X-Forwarded-For headers, that is the
+// one appended by the load balancer. The entries before it are sent by the client.
+func lastForwardedFor(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	val := vals[len(vals)-1]
+	if i := strings.LastIndexByte(val, ','); i >= 0 {
+		val = val[i+1:]
+	}
+	return strings.TrimSpace(val)
+}
+
+// responseWriter records the response for Lambda.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseWriter() *responseWriter {
+	return &responseWriter{header: make(http.Header)}
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *responseWriter) response(event *Event) (*Response, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	res := &Response{StatusCode: w.status}
+	if isTextual(w.header) {
+		res.Body = w.body.String()
+	} else {
+		res.Body = base64.StdEncoding.EncodeToString(w.body.Bytes())
+		res.IsBase64Encoded = true
+	}
+
+	kind := event.Kind()
+	switch {
+	case kind == EventAPIGatewayV2:
+		res.Headers = make(map[string]string, len(w.header))
+		for key, vals := range w.header {
+			if key == gear.HeaderSetCookie {
+				res.Cookies = vals
+				continue
+			}
+			res.Headers[key] = strings.Join(vals, ",")
+		}
+	case kind == EventALB && len(event.MultiValueHeaders) == 0:
+		// ALB requires the response headers in the same mode as the request.
+		if len(w.header[gear.HeaderSetCookie]) > 1 {
+			return nil, ErrMultipleCookies
+		}
+		res.Headers = make(map[string]string, len(w.header))
+		for key := range w.header {
+			res.Headers[key] = w.header.Get(key)
+		}
+	default:
+		res.MultiValueHeaders = map[string][]string(w.header)
+	}
+	if kind == EventALB {
+		res.StatusDescription = strconv.Itoa(w.status) + " " + http.StatusText(w.status)
+	}
+	return res, nil
+}
+
+func isTextual(header http.Header) bool {
+	if header.Get(gear.HeaderContentEncoding) != "" {
+		return false
+	}
+	typ := header.Get(gear.HeaderContentType)
+	if typ == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case gear.MIMEApplicationJSON, gear.MIMEApplicationXML, gear.MIMEApplicationJavaScript,
+		gear.MIMEApplicationForm, gear.MIMEApplicationYAML:
+		return true
+	}
+	return false
+}
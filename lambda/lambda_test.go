@@ -0,0 +1,173 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+func newApp() *gear.App {
+	app := gear.New()
+	app.Use(func(ctx *gear.Context) error {
+		event := EventFrom(ctx)
+		if event == nil {
+			return &gear.Error{Code: 500, Msg: "no event"}
+		}
+		if ctx.Path == "/binary" {
+			ctx.Type(gear.MIMEOctetStream)
+			return ctx.End(200, []byte{0, 1, 2})
+		}
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		ctx.Res.Header().Add(gear.HeaderSetCookie, "a=1")
+		if ctx.Get("X-Cookies") != "1" {
+			ctx.Res.Header().Add(gear.HeaderSetCookie, "b=2")
+		}
+		return ctx.JSON(200, map[string]interface{}{
+			"kind":   event.Kind(),
+			"method": ctx.Method,
+			"path":   ctx.Path,
+			"query":  ctx.Req.URL.Query(),
+			"host":   ctx.Host,
+			"remote": ctx.Req.RemoteAddr,
+			"cookie": ctx.Get(gear.HeaderCookie),
+			"body":   string(body),
+		})
+	})
+	return app
+}
+
+func invoke(t *testing.T, payload string) (*Response, map[string]interface{}) {
+	res, err := New(newApp()).Invoke(context.Background(), []byte(payload))
+	assert.Nil(t, err)
+	r := &Response{}
+	assert.Nil(t, json.Unmarshal(res, r))
+	body := map[string]interface{}{}
+	if !r.IsBase64Encoded {
+		json.Unmarshal([]byte(r.Body), &body)
+	}
+	return r, body
+}
+
+func TestLambdaAPIGatewayV1(t *testing.T) {
+	assert := assert.New(t)
+
+	res, body := invoke(t, `{
+		"httpMethod": "POST",
+		"path": "/users",
+		"multiValueHeaders": {"Host": ["example.com"], "Cookie": ["x=1"]},
+		"multiValueQueryStringParameters": {"q": ["a b", "c"]},
+		"requestContext": {"identity": {"sourceIp": "1.2.3.4"}},
+		"body": "aGVsbG8=",
+		"isBase64Encoded": true
+	}`)
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("", res.StatusDescription)
+	assert.Equal([]string{"a=1", "b=2"}, res.MultiValueHeaders[gear.HeaderSetCookie])
+	assert.Equal(float64(EventAPIGatewayV1), body["kind"])
+	assert.Equal("POST", body["method"])
+	assert.Equal("/users", body["path"])
+	assert.Equal(map[string]interface{}{"q": []interface{}{"a b", "c"}}, body["query"])
+	assert.Equal("example.com", body["host"])
+	assert.Equal("1.2.3.4:0", body["remote"])
+	assert.Equal("x=1", body["cookie"])
+	assert.Equal("hello", body["body"])
+}
+
+func TestLambdaAPIGatewayV2(t *testing.T) {
+	assert := assert.New(t)
+
+	res, body := invoke(t, `{
+		"version": "2.0",
+		"rawPath": "/users/123",
+		"rawQueryString": "q=a%20b",
+		"cookies": ["x=1", "y=2"],
+		"headers": {"host": "example.com", "content-type": "text/plain"},
+		"requestContext": {"http": {"method": "PUT", "sourceIp": "1.2.3.4"}},
+		"body": "hello"
+	}`)
+	assert.Equal(200, res.StatusCode)
+	assert.False(res.IsBase64Encoded)
+	assert.Equal([]string{"a=1", "b=2"}, res.Cookies)
+	assert.Equal(gear.MIMEApplicationJSONCharsetUTF8, res.Headers[gear.HeaderContentType])
+	assert.Equal("", res.Headers[gear.HeaderSetCookie])
+	assert.Equal(float64(EventAPIGatewayV2), body["kind"])
+	assert.Equal("PUT", body["method"])
+	assert.Equal("/users/123", body["path"])
+	assert.Equal(map[string]interface{}{"q": []interface{}{"a b"}}, body["query"])
+	assert.Equal("1.2.3.4:0", body["remote"])
+	assert.Equal("x=1; y=2", body["cookie"])
+	assert.Equal("hello", body["body"])
+
+	res, _ = invoke(t, `{
+		"version": "2.0",
+		"rawPath": "/binary",
+		"requestContext": {"http": {"method": "GET"}}
+	}`)
+	assert.Equal(200, res.StatusCode)
+	assert.True(res.IsBase64Encoded)
+	assert.Equal(base64.StdEncoding.EncodeToString([]byte{0, 1, 2}), res.Body)
+}
+
+func TestLambdaALB(t *testing.T) {
+	assert := assert.New(t)
+
+	res, body := invoke(t, `{
+		"httpMethod": "GET",
+		"path": "/",
+		"headers": {"host": "example.com", "x-forwarded-for": "5.6.7.8, 10.0.0.1", "x-cookies": "1"},
+		"queryStringParameters": {"q": "a%20b"},
+		"requestContext": {"elb": {"targetGroupArn": "arn"}}
+	}`)
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("200 OK", res.StatusDescription)
+	assert.Equal("a=1", res.Headers[gear.HeaderSetCookie])
+	assert.Nil(res.MultiValueHeaders)
+	assert.Equal(float64(EventALB), body["kind"])
+	assert.Equal(map[string]interface{}{"q": []interface{}{"a b"}}, body["query"])
+	assert.Equal("10.0.0.1:0", body["remote"])
+
+	_, err := New(newApp()).Invoke(context.Background(), []byte(`{
+		"httpMethod": "GET",
+		"path": "/",
+		"headers": {"host": "example.com"},
+		"requestContext": {"elb": {"targetGroupArn": "arn"}}
+	}`))
+	assert.Equal(ErrMultipleCookies, err)
+
+	res, _ = invoke(t, `{
+		"httpMethod": "GET",
+		"path": "/",
+		"multiValueHeaders": {"host": ["example.com"]},
+		"requestContext": {"elb": {"targetGroupArn": "arn"}}
+	}`)
+	assert.Equal([]string{"a=1", "b=2"}, res.MultiValueHeaders[gear.HeaderSetCookie])
+
+	_, body = invoke(t, `{
+		"httpMethod": "GET",
+		"path": "/",
+		"multiValueHeaders": {"host": ["example.com"], "x-forwarded-for": ["5.6.7.8", "1.2.3.4, 10.0.0.2"]},
+		"requestContext": {"elb": {"targetGroupArn": "arn"}}
+	}`)
+	assert.Equal("10.0.0.2:0", body["remote"])
+}
+
+func TestLambdaErrors(t *testing.T) {
+	assert := assert.New(t)
+	h := New(newApp())
+
+	_, err := h.Invoke(context.Background(), []byte(`{`))
+	assert.NotNil(err)
+	_, err = h.Invoke(context.Background(), []byte(`{"path": "/"}`))
+	assert.Equal("lambda: no HTTP method in event", err.Error())
+	_, err = h.Invoke(context.Background(), []byte(`{"httpMethod": "GET", "body": "!", "isBase64Encoded": true}`))
+	assert.NotNil(err)
+
+	res, err := h.Serve(context.Background(), &Event{HTTPMethod: "GET"})
+	assert.Nil(err)
+	assert.Equal(200, res.StatusCode)
+}
@@ -0,0 +1,58 @@
+package gear
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RequestLimits is the options of app setting SetRequestLimits.
+type RequestLimits struct {
+	// MaxURILength defines the maximum bytes of the request target (path and query),
+	// 414 URI Too Long will be responded if exceeded.
+	MaxURILength int
+	// MaxHeaderCount defines the maximum number of the request header fields,
+	// 431 Request Header Fields Too Large will be responded if exceeded.
+	MaxHeaderCount int
+	// MaxHeaderSize defines the maximum bytes of a request header field (name and value),
+	// 431 Request Header Fields Too Large will be responded if exceeded.
+	MaxHeaderSize int
+}
+
+func (l *RequestLimits) check(r *http.Request) *Error {
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+	if l.MaxURILength > 0 && len(uri) > l.MaxURILength {
+		return &Error{Code: http.StatusRequestURITooLong, Msg: "request URI too long"}
+	}
+
+	count := 0
+	for key, vals := range r.Header {
+		count += len(vals)
+		if l.MaxHeaderSize > 0 {
+			for _, val := range vals {
+				if len(key)+len(val) > l.MaxHeaderSize {
+					return &Error{Code: http.StatusRequestHeaderFieldsTooLarge, Msg: fmt.Sprintf("header field %s too large", key)}
+				}
+			}
+		}
+	}
+	if l.MaxHeaderCount > 0 && count > l.MaxHeaderCount {
+		return &Error{Code: http.StatusRequestHeaderFieldsTooLarge, Msg: "too many header fields"}
+	}
+	return nil
+}
+
+// checkRequest checks the request with app settings SetRequestLimits and SetStrictRequest.
+func (app *App) checkRequest(r *http.Request) *Error {
+	if app.limits != nil {
+		if err := app.limits.check(r); err != nil {
+			return err
+		}
+	}
+	if app.strict != nil {
+		return app.strict.check(r)
+	}
+	return nil
+}
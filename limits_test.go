@@ -0,0 +1,76 @@
+package gear
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearRequestLimits(t *testing.T) {
+	app := New()
+	assert.Panics(t, func() {
+		app.Set(SetRequestLimits, 1024)
+	})
+	app.Set(SetRequestLimits, RequestLimits{MaxURILength: 32, MaxHeaderCount: 4, MaxHeaderSize: 64})
+	app.Use(func(ctx *Context) error {
+		return ctx.HTML(200, "OK")
+	})
+
+	request := func(url string, header map[string][]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Run("Should accept the request within the limits", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("/"+strings.Repeat("a", 31), map[string][]string{
+			"X-A": {"1", "2"},
+			"X-B": {strings.Repeat("b", 61)},
+		})
+		assert.Equal(200, res.Code)
+	})
+
+	t.Run("Should respond 414 for the long URI", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("/"+strings.Repeat("a", 20)+"?q="+strings.Repeat("a", 10), nil)
+		assert.Equal(http.StatusRequestURITooLong, res.Code)
+		assert.Equal("request URI too long", res.Body.String())
+		assert.Equal("close", res.Header().Get("Connection"))
+	})
+
+	t.Run("Should respond 431 for the large headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("/", map[string][]string{
+			"X-A": {"1", "2", "3"},
+			"X-B": {"1", "2"},
+		})
+		assert.Equal(http.StatusRequestHeaderFieldsTooLarge, res.Code)
+		assert.Equal("too many header fields", res.Body.String())
+
+		res = request("/", map[string][]string{"X-B": {strings.Repeat("b", 62)}})
+		assert.Equal(http.StatusRequestHeaderFieldsTooLarge, res.Code)
+		assert.Equal("header field X-B too large", res.Body.String())
+	})
+
+	t.Run("Should check the limits before SetStrictRequest", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app.Set(SetStrictRequest, StrictOptions{})
+		defer func() { app.strict = nil }()
+		res := request("/", map[string][]string{"X-B": {strings.Repeat("b", 61) + "\n"}})
+		assert.Equal(http.StatusRequestHeaderFieldsTooLarge, res.Code)
+		res = request("/", map[string][]string{"X-B": {"b\n"}})
+		assert.Equal(http.StatusBadRequest, res.Code)
+	})
+}
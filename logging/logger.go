@@ -161,6 +161,7 @@ type Logger struct {
 	mu      sync.Mutex               // ensures atomic writes; protects the following fields
 	init    func(Log, *gear.Context) // hook to initialize log with gear.Context
 	consume func(Log, *gear.Context) // hook to consume log
+	skipper func(*gear.Context) bool // skip logging for the request
 }
 
 // Check log output level statisfy output level or not, used internal, for performance
@@ -326,6 +327,19 @@ func (l *Logger) SetLogConsume(fn func(Log, *gear.Context)) {
 	l.consume = fn
 }
 
+// SetSkipper set a function to skip logging for the request, such as health checks.
+// The skipped requests' logs will not be consumed.
+//
+//  logger.SetSkipper(func(ctx *gear.Context) bool {
+//  	return ctx.Path == "/health"
+//  })
+//
+func (l *Logger) SetSkipper(fn func(*gear.Context) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.skipper = fn
+}
+
 // New implements gear.Any interface,then we can use ctx.Any to retrieve a Log instance from ctx.
 // Here also some initialization work after created.
 func (l *Logger) New(ctx *gear.Context) (interface{}, error) {
@@ -352,6 +366,12 @@ func (l *Logger) FromCtx(ctx *gear.Context) Log {
 //  })
 //
 func (l *Logger) Serve(ctx *gear.Context) error {
+	l.mu.Lock()
+	skipper := l.skipper
+	l.mu.Unlock()
+	if skipper != nil && skipper(ctx) {
+		return nil
+	}
 	// Add a "end hook" to flush logs.
 	ctx.OnEnd(func() {
 		log := l.FromCtx(ctx)
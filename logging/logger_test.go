@@ -297,6 +297,49 @@ func TestGearLoggerMiddleware(t *testing.T) {
 		res.Body.Close()
 	})
 
+	t.Run("skip log", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		app := gear.New()
+		logger := New(&buf)
+		logger.SetSkipper(func(ctx *gear.Context) bool {
+			return ctx.Path == "/health"
+		})
+		app.UseHandler(logger)
+		app.Use(func(ctx *gear.Context) error {
+			logger.FromCtx(ctx)["Data"] = 1
+			return ctx.HTML(200, "OK")
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		res, err := RequestBy("GET", "http://"+srv.Addr().String()+"/health")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+		res, err = RequestBy("GET", "http://"+srv.Addr().String()+"/user")
+		assert.Nil(err)
+		res.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+		logger.mu.Lock()
+		log := buf.String()
+		logger.mu.Unlock()
+		assert.NotContains(log, "/health")
+		assert.Contains(log, "GET /user ")
+
+		// set the skipper while serving
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			logger.SetSkipper(nil)
+		}()
+		res, err = RequestBy("GET", "http://"+srv.Addr().String()+"/health")
+		assert.Nil(err)
+		res.Body.Close()
+		<-done
+	})
+
 	t.Run("custom log", func(t *testing.T) {
 		assert := assert.New(t)
 
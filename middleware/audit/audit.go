@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Outcomes of the audit events.
+const (
+	OutcomeSuccess = "success" // 1xx, 2xx and 3xx status
+	OutcomeDenied  = "denied"  // 401 and 403 status
+	OutcomeFailure = "failure" // the other status
+)
+
+// Event is the audit record of a request: who did what on which resource, and the outcome.
+type Event struct {
+	Time      time.Time         `json:"time"`
+	Action    string            `json:"action"`
+	Principal string            `json:"principal,omitempty"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Params    map[string]string `json:"params,omitempty"`
+	Status    int               `json:"status"`
+	Outcome   string            `json:"outcome"`
+	Diff      *Diff             `json:"diff,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+	IP        string            `json:"ip"`
+	Duration  time.Duration     `json:"duration"`
+}
+
+// Diff is the change of the resource attached by SetDiff.
+type Diff struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Sink is the destination of the audit events, such as a file, a database or a message queue.
+// It should be safe for concurrent use.
+type Sink interface {
+	Write(e *Event) error
+}
+
+// SinkFunc is an adapter to use a function as Sink.
+type SinkFunc func(e *Event) error
+
+// Write implemented Sink interface.
+func (fn SinkFunc) Write(e *Event) error {
+	return fn(e)
+}
+
+// JSONSink returns a Sink that writes the events to w as JSON lines.
+func JSONSink(w io.Writer) Sink {
+	var mu sync.Mutex
+	return SinkFunc(func(e *Event) error {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(buf, '\n'))
+		return err
+	})
+}
+
+// Options is audit middleware options.
+type Options struct {
+	// Sink defines the destination of the events, required.
+	Sink Sink
+	// Principal returns who makes the request, such as the user ID verified from the auth token.
+	// It should not read the client supplied values, such as a header, since they can be forged.
+	// Optional.
+	Principal func(ctx *gear.Context) string
+	// TrustedProxies defines the IPs or CIDRs of the reverse proxies in front of the app, the
+	// event IP is read from the X-Forwarded-For or X-Real-IP header only when the request comes
+	// from them, see gear.Context.ClientIP. Default to none, the event IP is the peer IP of the
+	// connection, since the forwarding headers can be forged by any client.
+	TrustedProxies []string
+	// MaxBodySize defines the maximum bytes of the response body that can be replaced when the
+	// event of a Require route failed to write, the larger response keeps its body with the
+	// status changed to 500. Default to 1MB.
+	MaxBodySize int
+	// OnError is called when failed to write the event, default to log the error with the
+	// app logger.
+	OnError func(e *Event, err error)
+}
+
+// Auditor creates the audit middlewares for the routes.
+//
+//  auditor := audit.New(audit.Options{
+//  	Sink: audit.JSONSink(auditFile),
+//  	Principal: func(ctx *gear.Context) string {
+//  		// the user ID set by the auth middleware after the token verified
+//  		if uid, err := ctx.Any(authUserKey); err == nil {
+//  			return uid.(string)
+//  		}
+//  		return ""
+//  	},
+//  	TrustedProxies: []string{"10.0.0.0/8"},
+//  })
+//
+//  router.Post("/users/:id/roles", auditor.Require("user.grant", "id"), func(ctx *gear.Context) error {
+//  	before, after, err := grantRole(ctx.Param("id"), ctx)
+//  	if err != nil {
+//  		return err
+//  	}
+//  	audit.SetDiff(ctx, before, after)
+//  	return ctx.JSON(200, after)
+//  })
+//  router.Get("/users/:id", auditor.Record("user.read", "id"), getUser)
+//
+type Auditor struct {
+	opts    Options
+	proxies gear.TrustedProxies
+}
+
+type ctxKey struct{}
+
+// New creates an Auditor with the options.
+func New(opts Options) *Auditor {
+	if opts.Sink == nil {
+		panic(gear.NewAppError("audit sink required"))
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	return &Auditor{opts: opts, proxies: gear.NewTrustedProxies(opts.TrustedProxies...)}
+}
+
+// Record creates a middleware that records the event of the action with the route params,
+// the event is written after the response sent, so the sink does not delay the response,
+// and the response is not affected if the writing failed.
+func (a *Auditor) Record(action string, params ...string) gear.Middleware {
+	return func(ctx *gear.Context) error {
+		e := a.begin(ctx, action, params)
+		ctx.OnEnd(func() {
+			a.end(ctx, e)
+			ctx.Defer(func() {
+				if err := a.opts.Sink.Write(e); err != nil {
+					a.onError(ctx, e, err)
+				}
+			})
+		})
+		return nil
+	}
+}
+
+// Require creates a middleware that records the event of the action with the route params,
+// the event is written before the response sent. If the writing failed, the response is
+// replaced with a 500 error, so the client never gets the result of an unaudited action.
+// The error responses (by ctx.Error) skip the after hooks, their events are written once
+// the header written.
+func (a *Auditor) Require(action string, params ...string) gear.Middleware {
+	return func(ctx *gear.Context) error {
+		e := a.begin(ctx, action, params)
+		var failed error
+		if err := ctx.Transform(a.opts.MaxBodySize, func(body []byte) ([]byte, error) {
+			if failed != nil {
+				return json.Marshal(&gear.Error{Code: http.StatusInternalServerError, Msg: "audit failed"})
+			}
+			return body, nil
+		}); err != nil {
+			return err
+		}
+		written := false
+		ctx.After(func() {
+			written = true
+			a.end(ctx, e)
+			if failed = a.opts.Sink.Write(e); failed != nil {
+				ctx.Res.ResetHeader()
+				ctx.Type(gear.MIMEApplicationJSONCharsetUTF8)
+				ctx.Status(http.StatusInternalServerError)
+				a.onError(ctx, e, failed)
+			}
+		})
+		ctx.OnEnd(func() {
+			// the error responses skip the after hooks
+			if !written {
+				a.end(ctx, e)
+				if err := a.opts.Sink.Write(e); err != nil {
+					a.onError(ctx, e, err)
+				}
+			}
+		})
+		return nil
+	}
+}
+
+// SetDiff attaches the change of the resource to the audit event of the request.
+func SetDiff(ctx *gear.Context, before, after interface{}) {
+	if val, err := ctx.Any(ctxKey{}); err == nil {
+		val.(*Event).Diff = &Diff{Before: before, After: after}
+	}
+}
+
+func (a *Auditor) begin(ctx *gear.Context, action string, params []string) *Event {
+	e := &Event{
+		Time:   time.Now(),
+		Action: action,
+		Method: ctx.Method,
+		Path:   ctx.Path,
+	}
+	if ip := ctx.ClientIP(a.proxies); ip != nil {
+		e.IP = ip.String()
+	} else {
+		e.IP = ctx.Req.RemoteAddr
+	}
+	if len(params) > 0 {
+		e.Params = make(map[string]string, len(params))
+		for _, name := range params {
+			e.Params[name] = ctx.Param(name)
+		}
+	}
+	ctx.SetAny(ctxKey{}, e)
+	return e
+}
+
+func (a *Auditor) end(ctx *gear.Context, e *Event) {
+	if a.opts.Principal != nil {
+		e.Principal = a.opts.Principal(ctx)
+	}
+	e.RequestID = ctx.Get(gear.HeaderXRequestID)
+	if e.RequestID == "" {
+		e.RequestID = ctx.Res.Get(gear.HeaderXRequestID)
+	}
+	e.Status = ctx.Res.Status()
+	switch {
+	case e.Status < 400:
+		e.Outcome = OutcomeSuccess
+	case e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden:
+		e.Outcome = OutcomeDenied
+	default:
+		e.Outcome = OutcomeFailure
+	}
+	e.Duration = time.Since(e.Time)
+}
+
+func (a *Auditor) onError(ctx *gear.Context, e *Event, err error) {
+	if a.opts.OnError != nil {
+		a.opts.OnError(e, err)
+		return
+	}
+	ctx.Setting(gear.SetLogger).(*log.Logger).Printf("audit: failed to write %s event: %v", e.Action, err)
+}
+
@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+// TestMain runs the tests in "test" env, so the JSON responses of gear are compact.
+func TestMain(m *testing.M) {
+	os.Setenv("APP_ENV", "test")
+	os.Exit(m.Run())
+}
+
+var DefaultClient = &http.Client{}
+
+type memorySink struct {
+	mu     sync.Mutex
+	events []*Event
+	err    error
+}
+
+func (s *memorySink) Write(e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memorySink) get() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Event(nil), s.events...)
+}
+
+func request(method, url string) (string, *http.Response) {
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header.Set("X-User-Id", "u1")
+	req.Header.Set(gear.HeaderXRequestID, "req-1")
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res
+}
+
+func newApp(auditor *Auditor) *gear.ServerListener {
+	app := gear.New()
+	app.Set(gear.SetLogger, log.New(ioutil.Discard, "", 0))
+	router := gear.NewRouter()
+	router.Post("/users/:id/roles", auditor.Require("user.grant", "id"), func(ctx *gear.Context) error {
+		if ctx.Param("id") == "root" {
+			return ctx.ErrorStatus(403)
+		}
+		SetDiff(ctx, []string{"user"}, []string{"user", "admin"})
+		return ctx.JSON(200, []string{"user", "admin"})
+	})
+	router.Get("/users/:id", auditor.Record("user.read", "id"), func(ctx *gear.Context) error {
+		if ctx.Param("id") == "none" {
+			return ctx.ErrorStatus(404)
+		}
+		return ctx.HTML(200, ctx.Param("id"))
+	})
+	app.UseHandler(router)
+	return app.Start()
+}
+
+func waitEvents(sink *memorySink, n int) []*Event {
+	for i := 0; i < 100; i++ {
+		if events := sink.get(); len(events) >= n {
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return sink.get()
+}
+
+func TestGearMiddlewareAudit(t *testing.T) {
+	principal := func(ctx *gear.Context) string {
+		return ctx.Get("X-User-Id")
+	}
+
+	t.Run("Should panic without sink", func(t *testing.T) {
+		assert.Panics(t, func() {
+			New(Options{})
+		})
+	})
+
+	t.Run("Should record the events", func(t *testing.T) {
+		assert := assert.New(t)
+
+		sink := &memorySink{}
+		srv := newApp(New(Options{Sink: sink, Principal: principal}))
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, res := request("POST", host+"/users/123/roles")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(`["user","admin"]`, body)
+		// written before the response
+		events := sink.get()
+		assert.Equal(1, len(events))
+		e := events[0]
+		assert.Equal("user.grant", e.Action)
+		assert.Equal("u1", e.Principal)
+		assert.Equal("POST", e.Method)
+		assert.Equal("/users/123/roles", e.Path)
+		assert.Equal(map[string]string{"id": "123"}, e.Params)
+		assert.Equal(200, e.Status)
+		assert.Equal(OutcomeSuccess, e.Outcome)
+		assert.Equal(&Diff{Before: []string{"user"}, After: []string{"user", "admin"}}, e.Diff)
+		assert.Equal("req-1", e.RequestID)
+		assert.Equal("127.0.0.1", e.IP)
+		assert.True(e.Duration > 0)
+
+		_, res = request("POST", host+"/users/root/roles")
+		assert.Equal(403, res.StatusCode)
+		events = sink.get()
+		assert.Equal(2, len(events))
+		assert.Equal(OutcomeDenied, events[1].Outcome)
+		assert.Nil(events[1].Diff)
+
+		body, _ = request("GET", host+"/users/123")
+		assert.Equal("123", body)
+		_, res = request("GET", host+"/users/none")
+		assert.Equal(404, res.StatusCode)
+		events = waitEvents(sink, 4)
+		assert.Equal(4, len(events))
+		assert.Equal("user.read", events[2].Action)
+		assert.Equal(OutcomeSuccess, events[2].Outcome)
+		assert.Equal(map[string]string{"id": "none"}, events[3].Params)
+		assert.Equal(404, events[3].Status)
+		assert.Equal(OutcomeFailure, events[3].Outcome)
+	})
+
+	t.Run("Should respond 500 when failed to write the required event", func(t *testing.T) {
+		assert := assert.New(t)
+
+		sink := &memorySink{err: errors.New("sink down")}
+		var mu sync.Mutex
+		var errs []string
+		srv := newApp(New(Options{Sink: sink, OnError: func(e *Event, err error) {
+			mu.Lock()
+			errs = append(errs, e.Action+": "+err.Error())
+			mu.Unlock()
+		}}))
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, res := request("POST", host+"/users/123/roles")
+		assert.Equal(500, res.StatusCode)
+		assert.Equal(gear.MIMEApplicationJSONCharsetUTF8, res.Header.Get(gear.HeaderContentType))
+		assert.False(strings.Contains(body, "admin"))
+
+		// the response of Record route is not affected
+		body, res = request("GET", host+"/users/123")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("123", body)
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		assert.Equal([]string{"user.grant: sink down", "user.read: sink down"}, errs)
+		mu.Unlock()
+	})
+
+	t.Run("Should record the peer IP unless from trusted proxies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		send := func(host string) {
+			req, _ := http.NewRequest("GET", host+"/users/123", nil)
+			req.Header.Set(gear.HeaderXForwardedFor, "1.1.1.1, 2.2.2.2")
+			res, err := DefaultClient.Do(req)
+			assert.Nil(err)
+			res.Body.Close()
+		}
+
+		sink := &memorySink{}
+		srv := newApp(New(Options{Sink: sink}))
+		defer srv.Close()
+		send("http://" + srv.Addr().String())
+		events := waitEvents(sink, 1)
+		assert.Equal(1, len(events))
+		assert.Equal("127.0.0.1", events[0].IP)
+
+		sink = &memorySink{}
+		srv2 := newApp(New(Options{Sink: sink, TrustedProxies: []string{"127.0.0.1"}}))
+		defer srv2.Close()
+		send("http://" + srv2.Addr().String())
+		events = waitEvents(sink, 1)
+		assert.Equal(1, len(events))
+		assert.Equal("2.2.2.2", events[0].IP)
+
+		assert.Panics(func() {
+			New(Options{Sink: sink, TrustedProxies: []string{"abc"}})
+		})
+	})
+
+	t.Run("JSONSink", func(t *testing.T) {
+		assert := assert.New(t)
+
+		buf := new(bytes.Buffer)
+		sink := JSONSink(buf)
+		assert.Nil(sink.Write(&Event{Action: "a", Status: 200, Outcome: OutcomeSuccess}))
+		assert.Nil(sink.Write(&Event{Action: "b", Status: 500, Outcome: OutcomeFailure}))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Equal(2, len(lines))
+		var e Event
+		assert.Nil(json.Unmarshal([]byte(lines[1]), &e))
+		assert.Equal("b", e.Action)
+		assert.Equal(OutcomeFailure, e.Outcome)
+		assert.NotContains(lines[0], "diff")
+	})
+}
@@ -0,0 +1,306 @@
+package bodydump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Redacted replaces the redacted values in the dumped bodies.
+const Redacted = "[REDACTED]"
+
+// Options is bodydump middleware options.
+type Options struct {
+	// Enabled defines the initial state of the dumper, default to false.
+	Enabled bool
+	// MaxBodySize defines the maximum bytes of the request and response body to dump,
+	// the larger body is dumped as truncated. Default to 4KB.
+	MaxBodySize int
+	// ContentTypes defines the media type prefixes of the bodies to dump, the other bodies are
+	// dumped with the size only. Default to "application/json", "application/xml",
+	// "application/x-www-form-urlencoded" and "text/".
+	ContentTypes []string
+	// Patterns defines the regular expressions to redact, the whole match is redacted, or the
+	// first submatch if the expression has one, such as `password=([^&]*)`.
+	Patterns []string
+	// JSONPaths defines the paths of the JSON body values to redact, the path is separated by
+	// ".", "*" matches any key or array index, such as "password", "users.*.token".
+	// The JSON body that can't be parsed (such as a truncated body) will not be dumped if
+	// JSONPaths is not empty.
+	JSONPaths []string
+	// Logger defines the logger to write the dumps, default to the app logger.
+	Logger *log.Logger
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+var defaultContentTypes = []string{
+	gear.MIMEApplicationJSON,
+	gear.MIMEApplicationXML,
+	gear.MIMEApplicationForm,
+	"text/",
+}
+
+// Dumper is a runtime-toggleable middleware that logs the request and response bodies for
+// debugging, the secrets in the bodies can be redacted by Patterns and JSONPaths.
+// It should be used in development, or be enabled temporarily in production.
+//
+//  d := bodydump.New(bodydump.Options{
+//  	Patterns:  []string{`password=([^&]*)`},
+//  	JSONPaths: []string{"password", "user.token"},
+//  })
+//
+//  app := gear.New()
+//  app.UseHandler(d)
+//
+//  router.Post("/admin/bodydump", func(ctx *gear.Context) error {
+//  	d.Toggle()
+//  	return ctx.End(204)
+//  })
+//
+// Output:
+//
+//  POST /login 200 1.204ms
+//  > {"name":"gear","password":"[REDACTED]"}
+//  < {"token":"[REDACTED]"}
+//
+type Dumper struct {
+	enabled      int32
+	maxBodySize  int
+	contentTypes []string
+	patterns     []*regexp.Regexp
+	jsonPaths    [][]string
+	logger       *log.Logger
+	skipper      func(ctx *gear.Context) bool
+}
+
+// New creates a Dumper instance with options.
+func New(options ...Options) *Dumper {
+	opts := Options{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 4 << 10
+	}
+	if opts.ContentTypes == nil {
+		opts.ContentTypes = defaultContentTypes
+	}
+
+	d := &Dumper{
+		maxBodySize:  opts.MaxBodySize,
+		contentTypes: opts.ContentTypes,
+		logger:       opts.Logger,
+		skipper:      opts.Skipper,
+	}
+	for _, s := range opts.Patterns {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			panic(gear.NewAppError(err.Error()))
+		}
+		d.patterns = append(d.patterns, re)
+	}
+	for _, s := range opts.JSONPaths {
+		if s == "" {
+			panic(gear.NewAppError("invalid bodydump JSON path: " + s))
+		}
+		d.jsonPaths = append(d.jsonPaths, strings.Split(s, "."))
+	}
+	if opts.Enabled {
+		d.Enable()
+	}
+	return d
+}
+
+// Enable turns on the dumper.
+func (d *Dumper) Enable() {
+	atomic.StoreInt32(&d.enabled, 1)
+}
+
+// Disable turns off the dumper.
+func (d *Dumper) Disable() {
+	atomic.StoreInt32(&d.enabled, 0)
+}
+
+// Toggle switches the dumper, returns the new state.
+func (d *Dumper) Toggle() bool {
+	for {
+		old := atomic.LoadInt32(&d.enabled)
+		if atomic.CompareAndSwapInt32(&d.enabled, old, 1-old) {
+			return old == 0
+		}
+	}
+}
+
+// Enabled returns whether the dumper is on.
+func (d *Dumper) Enabled() bool {
+	return atomic.LoadInt32(&d.enabled) == 1
+}
+
+// Serve implements gear.Handler interface.
+func (d *Dumper) Serve(ctx *gear.Context) error {
+	if !d.Enabled() || (d.skipper != nil && d.skipper(ctx)) {
+		return nil
+	}
+
+	start := time.Now()
+	var reqBody []byte
+	reqLength := 0
+	if ctx.Req.Body != nil && ctx.Req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, int64(d.maxBodySize)+1))
+		if err != nil {
+			return err
+		}
+		reqBody, reqLength = body, len(body)
+		ctx.Req.Body = readCloser{io.MultiReader(bytes.NewReader(body), ctx.Req.Body), ctx.Req.Body}
+	}
+
+	var resBody []byte
+	captured := false
+	if err := ctx.Transform(d.maxBodySize, func(body []byte) ([]byte, error) {
+		captured = true
+		resBody = append([]byte(nil), body...)
+		return body, nil
+	}); err != nil {
+		return err
+	}
+
+	logger := d.logger
+	if logger == nil {
+		logger, _ = ctx.Setting(gear.SetLogger).(*log.Logger)
+	}
+	reqType := ctx.Get(gear.HeaderContentType)
+	ctx.Defer(func() {
+		if logger == nil {
+			return
+		}
+		buf := new(bytes.Buffer)
+		fmt.Fprintf(buf, "%s %s %d %s", ctx.Method, ctx.Req.URL.RequestURI(),
+			ctx.Res.Status(), time.Since(start))
+		if reqLength > 0 {
+			d.dump(buf, "> ", reqType, reqBody, reqLength > d.maxBodySize)
+		}
+		if n := ctx.Res.BytesWritten(); n > 0 {
+			if !captured {
+				resBody = nil
+			}
+			d.dump(buf, "< ", ctx.Res.Get(gear.HeaderContentType), resBody, !captured)
+		}
+		logger.Println(buf.String())
+	})
+	return nil
+}
+
+func (d *Dumper) dump(buf *bytes.Buffer, prefix, contentType string, body []byte, truncated bool) {
+	buf.WriteString("\n")
+	buf.WriteString(prefix)
+	if truncated && len(body) > d.maxBodySize {
+		body = body[:d.maxBodySize]
+	}
+	if !d.matchType(contentType) {
+		fmt.Fprintf(buf, "(%s body)", typeName(contentType))
+		return
+	}
+	if len(body) == 0 {
+		buf.WriteString("(truncated)")
+		return
+	}
+
+	if len(d.jsonPaths) > 0 && strings.HasPrefix(contentType, gear.MIMEApplicationJSON) {
+		var err error
+		if body, err = d.redactJSON(body); err != nil {
+			buf.WriteString("(invalid JSON body)")
+			return
+		}
+	}
+	for _, re := range d.patterns {
+		body = redactRegexp(body, re)
+	}
+	buf.Write(body)
+	if truncated {
+		buf.WriteString("...(truncated)")
+	}
+}
+
+func (d *Dumper) matchType(contentType string) bool {
+	for _, t := range d.contentTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dumper) redactJSON(body []byte) ([]byte, error) {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	for _, path := range d.jsonPaths {
+		data = redactPath(data, path)
+	}
+	return json.Marshal(data)
+}
+
+func redactPath(data interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return Redacted
+	}
+	key := path[0]
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if key == "*" || key == k {
+				v[k] = redactPath(val, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			if key == "*" || key == strconv.Itoa(i) {
+				v[i] = redactPath(val, path[1:])
+			}
+		}
+	}
+	return data
+}
+
+func redactRegexp(body []byte, re *regexp.Regexp) []byte {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteral(body, []byte(Redacted))
+	}
+	buf := new(bytes.Buffer)
+	last := 0
+	for _, m := range re.FindAllSubmatchIndex(body, -1) {
+		if m[2] < 0 {
+			continue
+		}
+		buf.Write(body[last:m[2]])
+		buf.WriteString(Redacted)
+		last = m[3]
+	}
+	buf.Write(body[last:])
+	return buf.Bytes()
+}
+
+func typeName(contentType string) string {
+	if contentType == "" {
+		return "unknown"
+	}
+	return contentType
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
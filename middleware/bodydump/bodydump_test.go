@@ -0,0 +1,160 @@
+package bodydump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+// chanWriter sends every log line to the channel.
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func newApp(d *Dumper) *gear.ServerListener {
+	app := gear.New()
+	app.UseHandler(d)
+	app.Use(func(ctx *gear.Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		switch ctx.Path {
+		case "/large":
+			ctx.Type(gear.MIMETextPlainCharsetUTF8)
+			return ctx.End(200, bytes.Repeat([]byte("x"), 200))
+		case "/image":
+			ctx.Type("image/png")
+			return ctx.End(200, []byte("png"))
+		}
+		ctx.Type(ctx.Get(gear.HeaderContentType))
+		return ctx.End(200, body)
+	})
+	return app.Start()
+}
+
+func TestGearMiddlewareBodyDump(t *testing.T) {
+	logs := make(chanWriter, 10)
+	d := New(Options{
+		MaxBodySize: 100,
+		Patterns:    []string{`password=([^&]*)`, `secret-\d+`},
+		JSONPaths:   []string{"password", "users.*.token"},
+		Logger:      log.New(logs, "", 0),
+	})
+	srv := newApp(d)
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	request := func(path, contentType, body string) string {
+		res, err := DefaultClient.Post(host+path, contentType, strings.NewReader(body))
+		assert.Nil(t, err)
+		buf, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return string(buf)
+	}
+	nextLog := func() string {
+		select {
+		case s := <-logs:
+			return s
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	t.Run("Should toggle at runtime", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.False(d.Enabled())
+		assert.Equal("a=1", request("/", gear.MIMEApplicationForm, "a=1"))
+		assert.True(d.Toggle())
+		assert.Equal("a=1", request("/", gear.MIMEApplicationForm, "a=1"))
+		lines := strings.Split(nextLog(), "\n")
+		assert.True(strings.HasPrefix(lines[0], "POST / 200 "))
+		assert.Equal("> a=1", lines[1])
+		assert.Equal("< a=1", lines[2])
+		assert.False(d.Toggle())
+		d.Enable()
+		assert.True(d.Enabled())
+	})
+
+	t.Run("Should redact by patterns", func(t *testing.T) {
+		assert := assert.New(t)
+
+		body := "name=gear&password=123&key=secret-42"
+		assert.Equal(body, request("/form", gear.MIMEApplicationForm, body))
+		lines := strings.Split(nextLog(), "\n")
+		assert.Equal("> name=gear&password=[REDACTED]&key=[REDACTED]", lines[1])
+	})
+
+	t.Run("Should redact by JSON paths", func(t *testing.T) {
+		assert := assert.New(t)
+
+		body := `{"name":"gear","password":"123","users":[{"id":1,"token":"a"},{"id":2}]}`
+		assert.Equal(body, request("/json", gear.MIMEApplicationJSON, body))
+		lines := strings.Split(nextLog(), "\n")
+		assert.Equal(`> {"name":"gear","password":"[REDACTED]","users":[{"id":1,"token":"[REDACTED]"},{"id":2}]}`, lines[1])
+		assert.Equal(lines[1][1:], lines[2][1:])
+
+		request("/json", gear.MIMEApplicationJSON, `{"password":`)
+		lines = strings.Split(nextLog(), "\n")
+		assert.Equal("> (invalid JSON body)", lines[1])
+	})
+
+	t.Run("Should filter content types and truncate", func(t *testing.T) {
+		assert := assert.New(t)
+
+		request("/image", "application/octet-stream", "binary")
+		lines := strings.Split(nextLog(), "\n")
+		assert.Equal("> (application/octet-stream body)", lines[1])
+		assert.Equal("< (image/png body)", lines[2])
+
+		body := strings.Repeat("a", 120)
+		request("/large", gear.MIMETextPlain, body)
+		lines = strings.Split(nextLog(), "\n")
+		assert.Equal("> "+strings.Repeat("a", 100)+"...(truncated)", lines[1])
+		assert.Equal("< (truncated)", lines[2])
+	})
+
+	t.Run("Should skip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		d := New(Options{
+			Enabled: true,
+			Logger:  log.New(logs, "", 0),
+			Skipper: func(ctx *gear.Context) bool {
+				return ctx.Path == "/skip"
+			},
+		})
+		srv := newApp(d)
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := DefaultClient.Post(host+"/skip", gear.MIMETextPlain, strings.NewReader("a"))
+		assert.Nil(err)
+		res.Body.Close()
+		res, err = DefaultClient.Post(host+"/next", gear.MIMETextPlain, strings.NewReader("b"))
+		assert.Nil(err)
+		res.Body.Close()
+		assert.True(strings.HasPrefix(nextLog(), "POST /next 200 "))
+	})
+
+	t.Run("Should panic with invalid options", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() {
+			New(Options{Patterns: []string{"("}})
+		})
+		assert.Panics(func() {
+			New(Options{JSONPaths: []string{""}})
+		})
+	})
+}
@@ -0,0 +1,120 @@
+package canary
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Options is canary middleware options.
+type Options struct {
+	// Handler defines the alternate handler to serve the canary requests, it should respond.
+	// One of Handler or Upstream is required.
+	Handler gear.Middleware
+	// Upstream defines the alternate upstream URL to proxy the canary requests to,
+	// such as "http://canary.internal:8080".
+	Upstream string
+	// Percent defines the percentage of the traffic to send to the canary, in [0, 100].
+	Percent float64
+	// Header defines the request header to force the routing, the value "always" (or "true", "1")
+	// sends the request to the canary, "never" (or "false", "0") sends it to the stable.
+	// Default to "X-Canary".
+	Header string
+	// Cookie defines the cookie name to keep the sticky assignment per client, the assignment
+	// is stored in the cookie for CookieMaxAge. Default to "canary".
+	Cookie string
+	// CookieMaxAge defines the max age of the assignment cookie, default to 24 hours.
+	CookieMaxAge time.Duration
+	// Key defines a function to return a stable key of the client, such as the user ID.
+	// If it is set, the assignment is computed from the hash of the key instead of the cookie,
+	// so that the same key always goes to the same side while Percent unchanged.
+	Key func(ctx *gear.Context) string
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// New creates a middleware that sends a percentage of the traffic, or the requests forced by
+// the Header, to an alternate handler or upstream. The other requests go through the next
+// middlewares as usual. The assignment is sticky per client by the Cookie or the Key.
+//
+//  app.Use(canary.New(canary.Options{
+//  	Upstream: "http://canary.internal:8080",
+//  	Percent:  5,
+//  }))
+//  app.UseHandler(router) // stable
+//
+func New(opts Options) gear.Middleware {
+	canary := opts.Handler
+	if canary == nil {
+		u, err := url.Parse(opts.Upstream)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			panic(gear.NewAppError("canary handler or upstream required"))
+		}
+		canary = gear.WrapHandler(httputil.NewSingleHostReverseProxy(u))
+	}
+	if opts.Percent < 0 || opts.Percent > 100 {
+		panic(gear.NewAppError("canary percent must be in [0, 100]"))
+	}
+	if opts.Header == "" {
+		opts.Header = "X-Canary"
+	}
+	if opts.Cookie == "" {
+		opts.Cookie = "canary"
+	}
+	if opts.CookieMaxAge <= 0 {
+		opts.CookieMaxAge = 24 * time.Hour
+	}
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+		if assign(ctx, &opts) {
+			return canary(ctx)
+		}
+		return nil
+	}
+}
+
+func assign(ctx *gear.Context, opts *Options) bool {
+	switch strings.ToLower(ctx.Get(opts.Header)) {
+	case "always", "true", "1":
+		return true
+	case "never", "false", "0":
+		return false
+	}
+
+	if opts.Key != nil {
+		h := fnv.New32a()
+		h.Write([]byte(opts.Key(ctx)))
+		return float64(h.Sum32()%10000) < opts.Percent*100
+	}
+
+	if c, err := ctx.Req.Cookie(opts.Cookie); err == nil {
+		switch c.Value {
+		case "1":
+			return true
+		case "0":
+			return false
+		}
+	}
+	ok := rand.Float64()*100 < opts.Percent
+	value := "0"
+	if ok {
+		value = "1"
+	}
+	http.SetCookie(ctx.Res, &http.Cookie{
+		Name:     opts.Cookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(opts.CookieMaxAge.Seconds()),
+		HttpOnly: true,
+	})
+	return ok
+}
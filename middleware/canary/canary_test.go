@@ -0,0 +1,151 @@
+package canary
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func newApp(opts Options) *gear.ServerListener {
+	app := gear.New()
+	app.Use(New(opts))
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, "stable")
+	})
+	return app.Start()
+}
+
+func canaryHandler(ctx *gear.Context) error {
+	return ctx.HTML(200, "canary")
+}
+
+func request(url string, header map[string]string, cookies ...*http.Cookie) (string, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res
+}
+
+func TestGearMiddlewareCanary(t *testing.T) {
+	t.Run("Should route by percentage with sticky cookie", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(Options{Handler: canaryHandler, Percent: 50})
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		counts := map[string]int{}
+		for i := 0; i < 100; i++ {
+			body, res := request(url, nil)
+			counts[body]++
+			cookies := res.Cookies()
+			assert.Equal(1, len(cookies))
+			assert.Equal("canary", cookies[0].Name)
+			assert.Equal(86400, cookies[0].MaxAge)
+			if body == "canary" {
+				assert.Equal("1", cookies[0].Value)
+			} else {
+				assert.Equal("0", cookies[0].Value)
+			}
+
+			// sticky
+			again, res := request(url, nil, cookies[0])
+			assert.Equal(body, again)
+			assert.Equal(0, len(res.Cookies()))
+		}
+		assert.True(counts["canary"] > 10)
+		assert.True(counts["stable"] > 10)
+	})
+
+	t.Run("Should route by header", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(Options{Handler: canaryHandler, Percent: 100, Header: "X-Version"})
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		body, res := request(url, map[string]string{"X-Version": "never"})
+		assert.Equal("stable", body)
+		assert.Equal(0, len(res.Cookies()))
+		body, _ = request(url, map[string]string{"X-Version": "0"}, &http.Cookie{Name: "canary", Value: "1"})
+		assert.Equal("stable", body)
+		body, _ = request(url, nil)
+		assert.Equal("canary", body)
+
+		srv2 := newApp(Options{Handler: canaryHandler})
+		defer srv2.Close()
+		body, _ = request("http://"+srv2.Addr().String(), map[string]string{"X-Canary": "always"})
+		assert.Equal("canary", body)
+	})
+
+	t.Run("Should route by key", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(Options{
+			Handler: canaryHandler,
+			Percent: 30,
+			Key: func(ctx *gear.Context) string {
+				return ctx.Get("X-User")
+			},
+			Skipper: func(ctx *gear.Context) bool {
+				return ctx.Path == "/skip"
+			},
+		})
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		counts := map[string]int{}
+		for i := 0; i < 200; i++ {
+			header := map[string]string{"X-User": strconv.Itoa(i)}
+			body, res := request(url, header)
+			assert.Equal(0, len(res.Cookies()))
+			again, _ := request(url, header)
+			assert.Equal(body, again)
+			counts[body]++
+		}
+		assert.True(counts["canary"] > 20 && counts["canary"] < 100)
+
+		body, _ := request(url+"/skip", map[string]string{"X-Canary": "1"})
+		assert.Equal("stable", body)
+	})
+
+	t.Run("Should proxy to upstream", func(t *testing.T) {
+		assert := assert.New(t)
+
+		upstream := gear.New()
+		upstream.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, "upstream "+ctx.Path)
+		})
+		up := upstream.Start()
+		defer up.Close()
+
+		srv := newApp(Options{Upstream: "http://" + up.Addr().String(), Percent: 100})
+		defer srv.Close()
+
+		body, _ := request("http://"+srv.Addr().String()+"/users", nil)
+		assert.Equal("upstream /users", body)
+
+		assert.Panics(func() {
+			New(Options{})
+		})
+		assert.Panics(func() {
+			New(Options{Handler: canaryHandler, Percent: 101})
+		})
+	})
+}
@@ -35,6 +35,8 @@ type Options struct {
 	// Credentials defines whether or not the response to the request
 	// can be exposed.
 	Credentials bool
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
 }
 
 var (
@@ -74,6 +76,9 @@ func New(options ...Options) gear.Middleware {
 	}
 
 	return func(ctx *gear.Context) (err error) {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return
+		}
 		// Always set Vary, see https://github.com/rs/cors/issues/10
 		ctx.Res.Vary(gear.HeaderOrigin)
 
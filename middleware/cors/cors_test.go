@@ -188,3 +188,34 @@ func TestGearMiddlewareCORS(t *testing.T) {
 		})
 	})
 }
+
+func TestGearMiddlewareCORSSkipper(t *testing.T) {
+	assert := assert.New(t)
+
+	app := gear.New()
+	app.Use(New(Options{
+		AllowOrigins: []string{"test.org"},
+		Skipper: func(ctx *gear.Context) bool {
+			return ctx.Path == "/public"
+		},
+	}))
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, "OK")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	url := "http://" + srv.Addr().String()
+
+	req, _ := http.NewRequest(http.MethodGet, url+"/public", nil)
+	req.Header.Set(gear.HeaderOrigin, "not-allowed.org")
+	res, err := DefaultClient.Do(req)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("", res.Header.Get(gear.HeaderVary))
+
+	req, _ = http.NewRequest(http.MethodGet, url+"/private", nil)
+	req.Header.Set(gear.HeaderOrigin, "not-allowed.org")
+	res, err = DefaultClient.Do(req)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, res.StatusCode)
+}
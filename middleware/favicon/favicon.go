@@ -13,6 +13,7 @@ import (
 )
 
 // New creates a favicon middleware to serve favicon from the provided directory.
+// Use NewFiles to serve more files or to skip some requests with the Skipper option.
 //
 //  package main
 //
@@ -0,0 +1,125 @@
+package favicon
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Options is the options of NewFiles.
+type Options struct {
+	// Files maps the URL paths to the file paths, the files are read once when the middleware
+	// created, such as {"/favicon.ico": "./public/favicon.ico", "/robots.txt": "./public/robots.txt"}.
+	Files map[string]string
+	// Contents maps the URL paths to the contents, such as {"/robots.txt": []byte("User-agent: *\n")}.
+	Contents map[string][]byte
+	// Suppress defines the URL paths of the absent files that are requested by the browsers
+	// or the crawlers, such as "/apple-touch-icon.png". They are responded with cached
+	// 204 No Content, rather than going through the app as 404 errors.
+	Suppress []string
+	// MaxAge defines the max-age of the Cache-Control header, default to 1 year.
+	MaxAge time.Duration
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+type memFile struct {
+	name    string
+	content []byte
+	ctype   string
+	etag    string
+	modTime time.Time
+}
+
+// NewFiles creates a middleware to serve the tiny single-file responses (such as favicon.ico,
+// robots.txt and site.webmanifest) from memory with far-future caching. The requests of them
+// don't touch the filesystem and don't go through the next middlewares, so put it before the
+// logging middleware to keep them out of the logs.
+//
+//  app.Use(favicon.NewFiles(favicon.Options{
+//  	Files: map[string]string{
+//  		"/favicon.ico": "./public/favicon.ico",
+//  		"/robots.txt":  "./public/robots.txt",
+//  	},
+//  	Suppress: []string{"/apple-touch-icon.png", "/apple-touch-icon-precomposed.png"},
+//  }))
+//  app.UseHandler(logger)
+//
+func NewFiles(opts Options) gear.Middleware {
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 365 * 24 * time.Hour
+	}
+	cacheControl := "public, max-age=" + strconv.FormatInt(int64(opts.MaxAge/time.Second), 10)
+
+	files := make(map[string]*memFile, len(opts.Files)+len(opts.Contents))
+	for urlPath, filePath := range opts.Files {
+		info, err := os.Stat(filePath)
+		if err != nil || info.IsDir() {
+			panic(gear.NewAppError(fmt.Sprintf(`invalid file path: "%s"`, filePath)))
+		}
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			panic(gear.NewAppError(err.Error()))
+		}
+		files[urlPath] = newMemFile(urlPath, content, info.ModTime())
+	}
+	now := time.Now()
+	for urlPath, content := range opts.Contents {
+		files[urlPath] = newMemFile(urlPath, content, now)
+	}
+	suppress := make(map[string]bool, len(opts.Suppress))
+	for _, urlPath := range opts.Suppress {
+		suppress[urlPath] = true
+	}
+
+	return func(ctx *gear.Context) error {
+		file := files[ctx.Path]
+		if (file == nil && !suppress[ctx.Path]) || (opts.Skipper != nil && opts.Skipper(ctx)) {
+			return nil
+		}
+		if ctx.Method != http.MethodGet && ctx.Method != http.MethodHead {
+			status := 200
+			if ctx.Method != http.MethodOptions {
+				status = 405
+			}
+			ctx.Set(gear.HeaderAllow, "GET, HEAD, OPTIONS")
+			return ctx.End(status)
+		}
+		ctx.Set(gear.HeaderCacheControl, cacheControl)
+		if file == nil {
+			return ctx.End(http.StatusNoContent)
+		}
+		ctx.Type(file.ctype)
+		ctx.Set(gear.HeaderETag, file.etag)
+		http.ServeContent(ctx.Res, ctx.Req, file.name, file.modTime, bytes.NewReader(file.content))
+		return nil
+	}
+}
+
+func newMemFile(urlPath string, content []byte, modTime time.Time) *memFile {
+	name := path.Base(urlPath)
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if path.Ext(name) == ".ico" {
+		ctype = "image/x-icon"
+	} else if ctype == "" {
+		ctype = http.DetectContentType(content)
+	}
+	sum := sha1.Sum(content)
+	return &memFile{
+		name:    name,
+		content: content,
+		ctype:   ctype,
+		etag:    `"` + hex.EncodeToString(sum[:8]) + `"`,
+		modTime: modTime,
+	}
+}
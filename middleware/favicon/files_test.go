@@ -0,0 +1,114 @@
+package favicon
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+func TestGearMiddlewareFaviconFiles(t *testing.T) {
+	assert.Panics(t, func() {
+		NewFiles(Options{Files: map[string]string{"/favicon.ico": "../../testdata/favicon1.ico"}})
+	})
+	assert.Panics(t, func() {
+		NewFiles(Options{Files: map[string]string{"/favicon.ico": "../../testdata"}})
+	})
+
+	count := 0
+	app := gear.New()
+	app.Use(NewFiles(Options{
+		Files:    map[string]string{"/favicon.ico": "../../testdata/favicon.ico"},
+		Contents: map[string][]byte{"/robots.txt": []byte("User-agent: *\nDisallow:\n")},
+		Suppress: []string{"/apple-touch-icon.png"},
+		MaxAge:   time.Hour,
+		Skipper: func(ctx *gear.Context) bool {
+			return ctx.Query("skip") != ""
+		},
+	}))
+	app.Use(func(ctx *gear.Context) error {
+		count++
+		return ctx.HTML(200, "OK")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	t.Run("should serve the files from memory", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := RequestBy("GET", host+"/favicon.ico")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("image/x-icon", res.Header.Get(gear.HeaderContentType))
+		assert.Equal("public, max-age=3600", res.Header.Get(gear.HeaderCacheControl))
+		etag := res.Header.Get(gear.HeaderETag)
+		assert.Equal(18, len(etag))
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		file, _ := ioutil.ReadFile("../../testdata/favicon.ico")
+		assert.Equal(file, body)
+
+		req, _ := NewRequst("GET", host+"/favicon.ico")
+		req.Header.Set(gear.HeaderIfNoneMatch, etag)
+		res, err = DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal(304, res.StatusCode)
+		res.Body.Close()
+
+		res, err = RequestBy("GET", host+"/robots.txt")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("text/plain; charset=utf-8", res.Header.Get(gear.HeaderContentType))
+		body, _ = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal("User-agent: *\nDisallow:\n", string(body))
+
+		res, err = RequestBy("HEAD", host+"/robots.txt")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+		assert.Equal(0, count)
+	})
+
+	t.Run("should suppress the absent files", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := RequestBy("GET", host+"/apple-touch-icon.png")
+		assert.Nil(err)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("public, max-age=3600", res.Header.Get(gear.HeaderCacheControl))
+		res.Body.Close()
+		assert.Equal(0, count)
+	})
+
+	t.Run("should handle the other methods and paths", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := RequestBy("OPTIONS", host+"/robots.txt")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("GET, HEAD, OPTIONS", res.Header.Get(gear.HeaderAllow))
+		res.Body.Close()
+
+		res, err = RequestBy("POST", host+"/apple-touch-icon.png")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		res.Body.Close()
+		assert.Equal(0, count)
+
+		res, err = RequestBy("GET", host+"/abc")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+		assert.Equal(1, count)
+
+		res, err = RequestBy("GET", host+"/robots.txt?skip=1")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+		assert.Equal(2, count)
+	})
+}
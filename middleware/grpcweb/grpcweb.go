@@ -0,0 +1,199 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+// gRPC-Web content types, https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+const (
+	MIMEApplicationGRPCWeb     = "application/grpc-web"
+	MIMEApplicationGRPCWebText = "application/grpc-web-text"
+)
+
+// New creates a middleware to translate the gRPC-Web (and gRPC-Web-Text) requests from browsers
+// into gRPC calls to the server, and translate the responses back with the trailers encoded in
+// the body, so that browser clients can talk to gRPC services without a proxy such as Envoy.
+// The other requests are passed to the next middlewares.
+//
+// The server can be an in-process `*grpc.Server`, or a reverse proxy to a gRPC backend
+// that supports HTTP/2 and trailers:
+//
+//  grpcServer := grpc.NewServer()
+//  pb.RegisterGreeterServer(grpcServer, &greeter{})
+//
+//  app := gear.New()
+//  app.Use(cors.New(cors.Options{
+//  	AllowHeaders:  []string{"Content-Type", "X-Grpc-Web", "X-User-Agent"},
+//  	ExposeHeaders: []string{"Grpc-Status", "Grpc-Message"},
+//  }))
+//  app.Use(grpcweb.New(grpcServer))
+//
+// The server should run the handler synchronously, the streaming response is
+// flushed to the client on every http.Flusher.Flush call.
+func New(server http.Handler) gear.Middleware {
+	return NewWithOptions(server, Options{})
+}
+
+// Options is grpcweb middleware options.
+type Options struct {
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// NewWithOptions creates a gRPC-Web middleware with options, see New.
+func NewWithOptions(server http.Handler, opts Options) gear.Middleware {
+	return func(ctx *gear.Context) error {
+		if ctx.Method != http.MethodPost || (opts.Skipper != nil && opts.Skipper(ctx)) {
+			return nil
+		}
+		contentType := ctx.Get(gear.HeaderContentType)
+		text := strings.HasPrefix(contentType, MIMEApplicationGRPCWebText)
+		if !text && !strings.HasPrefix(contentType, MIMEApplicationGRPCWeb) {
+			return nil
+		}
+
+		req := ctx.IntoRequest()
+		req.ProtoMajor = 2
+		req.ProtoMinor = 0
+		req.Proto = "HTTP/2"
+		req.Header = cloneHeader(req.Header)
+		req.Header.Del(gear.HeaderContentLength)
+		req.ContentLength = -1
+		if text {
+			req.Header.Set(gear.HeaderContentType, gear.MIMEApplicationGRPC+strings.TrimPrefix(contentType, MIMEApplicationGRPCWebText))
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{base64.NewDecoder(base64.StdEncoding, req.Body), req.Body}
+		} else {
+			req.Header.Set(gear.HeaderContentType, gear.MIMEApplicationGRPC+strings.TrimPrefix(contentType, MIMEApplicationGRPCWeb))
+		}
+		req.Header.Set("Te", "trailers")
+
+		w := &responseWriter{res: ctx.Res, header: make(http.Header), text: text, contentType: contentType}
+		server.ServeHTTP(w, req)
+		return w.finish()
+	}
+}
+
+// responseWriter is the http.ResponseWriter for the gRPC server, it writes
+// the gRPC response to the gear response in gRPC-Web format.
+type responseWriter struct {
+	res         *gear.Response
+	header      http.Header
+	text        bool
+	contentType string
+	wroteHeader bool
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.res.Header()
+	for key, vals := range w.header {
+		switch {
+		case key == gear.HeaderTrailer, key == gear.HeaderContentLength,
+			strings.HasPrefix(key, http.TrailerPrefix):
+			continue
+		}
+		header[key] = vals
+	}
+	contentType := strings.SplitN(w.contentType, ";", 2)[0]
+	header.Set(gear.HeaderContentType, contentType)
+	w.res.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(buf []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.text {
+		if _, err := w.res.Write([]byte(base64.StdEncoding.EncodeToString(buf))); err != nil {
+			return 0, err
+		}
+		return len(buf), nil
+	}
+	return w.res.Write(buf)
+}
+
+func (w *responseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+	w.res.Flush()
+}
+
+// finish writes the trailers as the last frame of the body.
+func (w *responseWriter) finish() error {
+	keys := trailerKeys(w.header)
+	trailer := make(http.Header, len(keys))
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, http.TrailerPrefix)
+		trailer[strings.ToLower(name)] = w.header[key]
+	}
+	w.WriteHeader(http.StatusOK)
+
+	var buf bytes.Buffer
+	names := make([]string, 0, len(trailer))
+	for name := range trailer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, val := range trailer[name] {
+			buf.WriteString(name + ": " + val + "\r\n")
+		}
+	}
+	frame := make([]byte, 5, 5+buf.Len())
+	frame[0] = 1 << 7 // the MSB of the flag indicates the trailer frame
+	binary.BigEndian.PutUint32(frame[1:], uint32(buf.Len()))
+	_, err := w.Write(append(frame, buf.Bytes()...))
+	return err
+}
+
+// trailerKeys returns the keys of the trailers declared by "Trailer" header or
+// with http.TrailerPrefix, or the status headers of the trailers-only response.
+func trailerKeys(header http.Header) []string {
+	var keys []string
+	for _, val := range header[gear.HeaderTrailer] {
+		for _, key := range strings.Split(val, ",") {
+			if key = http.CanonicalHeaderKey(strings.TrimSpace(key)); key != "" && len(header[key]) > 0 {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for key := range header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 && len(header["Grpc-Status"]) > 0 {
+		for _, key := range []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"} {
+			if len(header[key]) > 0 {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, vv := range h {
+		vv2 := make([]string, len(vv))
+		copy(vv2, vv)
+		h2[k] = vv2
+	}
+	return h2
+}
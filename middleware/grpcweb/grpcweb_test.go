@@ -0,0 +1,139 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func frame(flag byte, data []byte) []byte {
+	buf := make([]byte, 5, 5+len(data))
+	buf[0] = flag
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(data)))
+	return append(buf, data...)
+}
+
+// grpcServer echoes the message with "Hello, " prefix like a gRPC server.
+var grpcServer = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Header.Get("Te") != "trailers" {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusBadRequest)
+		return
+	}
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r.Body, header); err != nil {
+		w.Header().Set("Grpc-Status", "13")
+		w.Header().Set("Grpc-Message", "invalid message")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	io.ReadFull(r.Body, msg)
+
+	w.Header().Set(gear.HeaderContentType, r.Header.Get(gear.HeaderContentType))
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	w.Write(frame(0, append([]byte("Hello, "), msg...)))
+	w.(http.Flusher).Flush()
+	w.Header().Set("Grpc-Status", "0")
+	w.Header().Set("Grpc-Message", "")
+	w.Header().Set(http.TrailerPrefix+"X-Custom", "custom")
+})
+
+func TestGearMiddlewareGRPCWeb(t *testing.T) {
+	app := gear.New()
+	app.Use(New(grpcServer))
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, "gear")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	request := func(contentType string, body []byte) (*http.Response, []byte) {
+		req, _ := http.NewRequest(http.MethodPost, host+"/helloworld.Greeter/SayHello", bytes.NewReader(body))
+		req.Header.Set(gear.HeaderContentType, contentType)
+		res, err := DefaultClient.Do(req)
+		assert.Nil(t, err)
+		buf, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res, buf
+	}
+
+	trailer := frame(1<<7, []byte("grpc-message: \r\ngrpc-status: 0\r\nx-custom: custom\r\n"))
+
+	t.Run("gRPC-Web", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, body := request("application/grpc-web+proto", frame(0, []byte("gear")))
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("application/grpc-web+proto", res.Header.Get(gear.HeaderContentType))
+		assert.Equal("", res.Header.Get("Trailer"))
+		assert.Equal(append(frame(0, []byte("Hello, gear")), trailer...), body)
+	})
+
+	t.Run("gRPC-Web-Text", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, body := request(MIMEApplicationGRPCWebText,
+			[]byte(base64.StdEncoding.EncodeToString(frame(0, []byte("gear")))))
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(MIMEApplicationGRPCWebText, res.Header.Get(gear.HeaderContentType))
+		assert.Equal(base64.StdEncoding.EncodeToString(frame(0, []byte("Hello, gear")))+
+			base64.StdEncoding.EncodeToString(trailer), string(body))
+	})
+
+	t.Run("trailers-only response", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, body := request(MIMEApplicationGRPCWeb, nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("13", res.Header.Get("Grpc-Status"))
+		assert.Equal(frame(1<<7, []byte("grpc-message: invalid message\r\ngrpc-status: 13\r\n")), body)
+	})
+
+	t.Run("Should pass other requests", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, body := request(gear.MIMEApplicationJSON, []byte("{}"))
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("gear", string(body))
+
+		res, err := DefaultClient.Get(host)
+		assert.Nil(err)
+		body, _ = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal("gear", string(body))
+	})
+}
+
+func TestGearMiddlewareGRPCWebSkipper(t *testing.T) {
+	assert := assert.New(t)
+
+	app := gear.New()
+	app.Use(NewWithOptions(grpcServer, Options{
+		Skipper: func(ctx *gear.Context) bool {
+			return ctx.Path == "/skip"
+		},
+	}))
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, "gear")
+	})
+	srv := app.Start()
+	defer srv.Close()
+
+	res, err := DefaultClient.Post("http://"+srv.Addr().String()+"/skip", MIMEApplicationGRPCWeb,
+		bytes.NewReader(frame(0, []byte("gear"))))
+	assert.Nil(err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal("gear", string(body))
+}
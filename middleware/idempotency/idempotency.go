@@ -0,0 +1,315 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// ErrNoScope is responded when the Scope of the request is empty, such as an anonymous request.
+var ErrNoScope = &gear.Error{Code: http.StatusUnauthorized, Msg: "idempotency scope required"}
+
+// Response is the stored response of an idempotent request.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Fingerprint is the hash of the request method, URI and body, the retries with the same
+	// key must have the same fingerprint.
+	Fingerprint string
+}
+
+// Store is the storage of the idempotency keys and the responses, it should be safe for
+// concurrent use, and be shared by the app instances for the distributed deployment.
+type Store interface {
+	// Get returns the stored response of the key, or nil if not exists.
+	Get(key string) (*Response, error)
+	// Lock reserves the key for the in-flight request for ttl, it returns false if the key is
+	// locked or has a stored response.
+	Lock(key string, ttl time.Duration) (bool, error)
+	// Save stores the response of the key for ttl and releases the lock.
+	Save(key string, res *Response, ttl time.Duration) error
+	// Unlock releases the lock of the key without response, so the request can be retried.
+	Unlock(key string) error
+}
+
+// Options is idempotency middleware options.
+type Options struct {
+	// Store defines the storage of the keys and responses, default to a MemoryStore.
+	Store Store
+	// Header defines the request header carrying the key, default to "Idempotency-Key".
+	Header string
+	// Methods defines the methods to apply, default to POST and PATCH.
+	Methods []string
+	// TTL defines how long the responses are stored for retries, default to 24 hours.
+	TTL time.Duration
+	// LockTimeout defines the maximum time to hold the key for an in-flight request, the key is
+	// released after it if the app crashed. Default to 1 minute.
+	LockTimeout time.Duration
+	// MaxBodySize defines the maximum bytes of the response body to store, the larger responses
+	// are not stored, and the key is released. Only the first MaxBodySize bytes of the request
+	// body are fingerprinted. Default to 1MB.
+	MaxBodySize int
+	// Scope returns the scope of the key, such as the authenticated user ID, so the keys of the
+	// different users will not conflict, and a user can't replay the response of another user.
+	// It should not read the client supplied values, such as a header, since they can be forged.
+	// The requests with an idempotency key but an empty scope are responded with ErrNoScope.
+	// Required.
+	Scope func(ctx *gear.Context) string
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// HeaderIdempotentReplayed is the response header to indicate the response is replayed.
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+// New creates a middleware that makes the requests with an Idempotency-Key header safe to
+// retry. The first response of the key (except 5xx) is stored and replayed for the retries
+// within TTL, with the Idempotent-Replayed header. The Set-Cookie headers are never stored or
+// replayed. The errors of the Store after the request handled are logged by app.Error. A retry
+// arriving while the first request is in flight is responded with 409 Conflict, and a retry with
+// a different method, URI or body is responded with 422 Unprocessable Entity.
+//
+//  app.Use(idempotency.New(idempotency.Options{
+//  	Scope: func(ctx *gear.Context) string {
+//  		// the user ID verified by the auth middleware in front
+//  		if uid, err := ctx.Any(authUserKey); err == nil {
+//  			return uid.(string)
+//  		}
+//  		return ""
+//  	},
+//  }))
+//
+func New(opts Options) gear.Middleware {
+	if opts.Scope == nil {
+		panic(gear.NewAppError("idempotency scope required"))
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.Header == "" {
+		opts.Header = "Idempotency-Key"
+	}
+	if opts.Methods == nil {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = time.Minute
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	methods := make(map[string]bool, len(opts.Methods))
+	for _, m := range opts.Methods {
+		methods[m] = true
+	}
+
+	return func(ctx *gear.Context) error {
+		if !methods[ctx.Method] || (opts.Skipper != nil && opts.Skipper(ctx)) {
+			return nil
+		}
+		key := ctx.Get(opts.Header)
+		if key == "" {
+			return nil
+		}
+		if len(key) > 255 {
+			return &gear.Error{Code: http.StatusBadRequest, Msg: opts.Header + " too long"}
+		}
+		scope := opts.Scope(ctx)
+		if scope == "" {
+			return ErrNoScope
+		}
+		key = scope + ":" + key
+
+		fingerprint, err := fingerprint(ctx, opts.MaxBodySize)
+		if err != nil {
+			return err
+		}
+		if res, err := opts.Store.Get(key); err != nil || res != nil {
+			return replay(ctx, res, fingerprint, err)
+		}
+		ok, err := opts.Store.Lock(key, opts.LockTimeout)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// the first request may have finished just now
+			res, err := opts.Store.Get(key)
+			if err == nil && res == nil {
+				return &gear.Error{Code: http.StatusConflict,
+					Msg: "a request with the same " + opts.Header + " is in progress"}
+			}
+			return replay(ctx, res, fingerprint, err)
+		}
+
+		var done int32
+		finish := func(status int, body []byte) {
+			if !atomic.CompareAndSwapInt32(&done, 0, 1) {
+				return
+			}
+			if status >= 500 {
+				ctx.LogError(opts.Store.Unlock(key))
+				return
+			}
+			header := ctx.Res.Header().Clone()
+			header.Del(gear.HeaderContentLength)
+			header.Del(gear.HeaderSetCookie)
+			ctx.LogError(opts.Store.Save(key, &Response{
+				Status:      status,
+				Header:      header,
+				Body:        append([]byte(nil), body...),
+				Fingerprint: fingerprint,
+			}, opts.TTL))
+		}
+		if err := ctx.Transform(opts.MaxBodySize, func(body []byte) ([]byte, error) {
+			finish(ctx.Res.Status(), body)
+			return body, nil
+		}); err != nil {
+			ctx.LogError(opts.Store.Unlock(key))
+			return err
+		}
+		ctx.OnEnd(func() {
+			// the empty responses are not transformed
+			if status := ctx.Res.Status(); status == http.StatusNoContent || status == http.StatusResetContent {
+				finish(status, nil)
+			}
+		})
+		ctx.Defer(func() {
+			// the response is too large to store
+			if atomic.CompareAndSwapInt32(&done, 0, 1) {
+				ctx.LogError(opts.Store.Unlock(key))
+			}
+		})
+		return nil
+	}
+}
+
+func fingerprint(ctx *gear.Context, maxBytes int) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, ctx.Method+" "+ctx.Req.URL.RequestURI()+"\n")
+	if ctx.Req.Body != nil && ctx.Req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, int64(maxBytes)))
+		if err != nil {
+			return "", err
+		}
+		h.Write(body)
+		ctx.Req.Body = readCloser{io.MultiReader(bytes.NewReader(body), ctx.Req.Body), ctx.Req.Body}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func replay(ctx *gear.Context, res *Response, fingerprint string, err error) error {
+	if err != nil {
+		return err
+	}
+	if res.Fingerprint != fingerprint {
+		return &gear.Error{Code: http.StatusUnprocessableEntity,
+			Msg: "the request does not match the previous one with the same key"}
+	}
+	header := ctx.Res.Header()
+	for k, v := range res.Header {
+		if k != gear.HeaderSetCookie {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	header.Set(HeaderIdempotentReplayed, "true")
+	return ctx.End(res.Status, res.Body)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// MemoryStore is a Store that keeps the keys and responses in memory, it is not shared
+// between processes.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	sweepAt time.Time
+}
+
+type memoryEntry struct {
+	res     *Response // nil if locked
+	expires time.Time
+}
+
+// NewMemoryStore creates a MemoryStore instance.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+// Get implemented Store interface.
+func (s *MemoryStore) Get(key string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.entry(key, time.Now()); e != nil {
+		return e.res, nil
+	}
+	return nil, nil
+}
+
+// Lock implemented Store interface.
+func (s *MemoryStore) Lock(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if s.entry(key, now) != nil {
+		return false, nil
+	}
+	s.entries[key] = &memoryEntry{expires: now.Add(ttl)}
+	return true, nil
+}
+
+// Save implemented Store interface.
+func (s *MemoryStore) Save(key string, res *Response, ttl time.Duration) error {
+	s.mu.Lock()
+	s.entries[key] = &memoryEntry{res: res, expires: time.Now().Add(ttl)}
+	s.mu.Unlock()
+	return nil
+}
+
+// Unlock implemented Store interface.
+func (s *MemoryStore) Unlock(key string) error {
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok && e.res == nil {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// entry returns the unexpired entry, it should be called with the lock held.
+func (s *MemoryStore) entry(key string, now time.Time) *memoryEntry {
+	e, ok := s.entries[key]
+	if ok && !now.Before(e.expires) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+// sweep removes the expired entries every minute, it should be called with the lock held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.sweepAt) {
+		return
+	}
+	s.sweepAt = now.Add(time.Minute)
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
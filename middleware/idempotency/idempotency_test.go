@@ -0,0 +1,280 @@
+package idempotency
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+// TestMain runs the tests in "test" env, so the JSON responses of gear are compact.
+func TestMain(m *testing.M) {
+	os.Setenv("APP_ENV", "test")
+	os.Exit(m.Run())
+}
+
+var DefaultClient = &http.Client{}
+
+func request(method, url, key, body string) (string, *http.Response) {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	buf, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(buf), res
+}
+
+// userScope stands for the authenticated user
+func userScope(ctx *gear.Context) string {
+	return "u1"
+}
+
+type failingStore struct {
+	*MemoryStore
+}
+
+func (s failingStore) Save(key string, res *Response, ttl time.Duration) error {
+	return errors.New("save failed")
+}
+
+func (s failingStore) Unlock(key string) error {
+	return errors.New("unlock failed")
+}
+
+func TestGearMiddlewareIdempotency(t *testing.T) {
+	t.Run("Should panic without scope", func(t *testing.T) {
+		assert.Panics(t, func() {
+			New(Options{})
+		})
+	})
+
+	t.Run("Should replay the stored response", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var count int32
+		app := gear.New()
+		app.Use(New(Options{Scope: userScope}))
+		app.Use(func(ctx *gear.Context) error {
+			n := atomic.AddInt32(&count, 1)
+			body, _ := ioutil.ReadAll(ctx.Req.Body)
+			ctx.Set("X-Charge", string(body))
+			http.SetCookie(ctx.Res, &http.Cookie{Name: "session", Value: "secret"})
+			if ctx.Path == "/empty" {
+				return ctx.End(204)
+			}
+			return ctx.JSON(201, map[string]int32{"id": n})
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, res := request("POST", host+"/charges", "k1", "amount=100")
+		assert.Equal(201, res.StatusCode)
+		assert.Equal(`{"id":1}`, body)
+		assert.Equal("", res.Header.Get(HeaderIdempotentReplayed))
+
+		body, res = request("POST", host+"/charges", "k1", "amount=100")
+		assert.Equal(201, res.StatusCode)
+		assert.Equal(`{"id":1}`, body)
+		assert.Equal("true", res.Header.Get(HeaderIdempotentReplayed))
+		assert.Equal("amount=100", res.Header.Get("X-Charge"))
+		assert.Equal("", res.Header.Get(gear.HeaderSetCookie))
+		assert.Equal(gear.MIMEApplicationJSONCharsetUTF8, res.Header.Get(gear.HeaderContentType))
+		assert.Equal(int32(1), atomic.LoadInt32(&count))
+
+		// reused with a different request
+		_, res = request("POST", host+"/charges", "k1", "amount=200")
+		assert.Equal(422, res.StatusCode)
+		_, res = request("POST", host+"/refunds", "k1", "amount=100")
+		assert.Equal(422, res.StatusCode)
+
+		// the other keys, methods and the requests without key are not affected
+		body, _ = request("POST", host+"/charges", "k2", "amount=100")
+		assert.Equal(`{"id":2}`, body)
+		body, _ = request("POST", host+"/charges", "", "amount=100")
+		assert.Equal(`{"id":3}`, body)
+		body, _ = request("PUT", host+"/charges", "k2", "amount=100")
+		assert.Equal(`{"id":4}`, body)
+
+		_, res = request("POST", host+"/empty", "k3", "")
+		assert.Equal(204, res.StatusCode)
+		_, res = request("POST", host+"/empty", "k3", "")
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("true", res.Header.Get(HeaderIdempotentReplayed))
+		assert.Equal(int32(5), atomic.LoadInt32(&count))
+
+		_, res = request("POST", host+"/charges", strings.Repeat("k", 256), "")
+		assert.Equal(400, res.StatusCode)
+	})
+
+	t.Run("Should respond 409 for the concurrent duplicates", func(t *testing.T) {
+		assert := assert.New(t)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		app := gear.New()
+		app.Use(New(Options{Scope: userScope}))
+		app.Use(func(ctx *gear.Context) error {
+			close(started)
+			<-release
+			return ctx.HTML(200, "paid")
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, res := request("POST", host, "k1", "")
+			assert.Equal(200, res.StatusCode)
+			assert.Equal("paid", body)
+		}()
+
+		<-started
+		_, res := request("POST", host, "k1", "")
+		assert.Equal(409, res.StatusCode)
+		close(release)
+		wg.Wait()
+
+		body, res := request("POST", host, "k1", "")
+		assert.Equal("paid", body)
+		assert.Equal("true", res.Header.Get(HeaderIdempotentReplayed))
+	})
+
+	t.Run("Should release the key for 5xx and large responses", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var count int32
+		app := gear.New()
+		app.Use(New(Options{Scope: userScope, MaxBodySize: 16}))
+		app.Use(func(ctx *gear.Context) error {
+			n := atomic.AddInt32(&count, 1)
+			switch {
+			case ctx.Path == "/large":
+				return ctx.HTML(200, strings.Repeat("x", 32))
+			case n == 1:
+				return ctx.ErrorStatus(503)
+			}
+			return ctx.HTML(200, "ok")
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		_, res := request("POST", host, "k1", "")
+		assert.Equal(503, res.StatusCode)
+		body, res := request("POST", host, "k1", "")
+		assert.Equal("ok", body)
+		assert.Equal("", res.Header.Get(HeaderIdempotentReplayed))
+
+		body, _ = request("POST", host+"/large", "k2", "")
+		assert.Equal(32, len(body))
+		time.Sleep(50 * time.Millisecond) // the key is released after the response sent
+		_, res = request("POST", host+"/large", "k2", "")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("", res.Header.Get(HeaderIdempotentReplayed))
+		assert.Equal(int32(4), atomic.LoadInt32(&count))
+	})
+
+	t.Run("Should scope the keys", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Scope: func(ctx *gear.Context) string {
+			return ctx.Query("user")
+		}}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, ctx.Query("user"))
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, _ := request("POST", host+"?user=a", "k1", "")
+		assert.Equal("a", body)
+		body, res := request("POST", host+"?user=b", "k1", "")
+		assert.Equal("b", body)
+		assert.Equal("", res.Header.Get(HeaderIdempotentReplayed))
+
+		body, res = request("POST", host, "k1", "")
+		assert.Equal(401, res.StatusCode)
+		assert.Equal(ErrNoScope.Msg, body)
+		body, res = request("POST", host, "", "")
+		assert.Equal(200, res.StatusCode)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	assert := assert.New(t)
+
+	store := NewMemoryStore()
+	ok, _ := store.Lock("a", 50*time.Millisecond)
+	assert.True(ok)
+	ok, _ = store.Lock("a", time.Minute)
+	assert.False(ok)
+	res, _ := store.Get("a")
+	assert.Nil(res)
+
+	// the lock expires
+	time.Sleep(60 * time.Millisecond)
+	ok, _ = store.Lock("a", time.Minute)
+	assert.True(ok)
+	store.Unlock("a")
+	ok, _ = store.Lock("a", time.Minute)
+	assert.True(ok)
+
+	store.Save("a", &Response{Status: 200}, 50*time.Millisecond)
+	store.Unlock("a")
+	res, _ = store.Get("a")
+	assert.Equal(200, res.Status)
+	ok, _ = store.Lock("a", time.Minute)
+	assert.False(ok)
+
+	time.Sleep(60 * time.Millisecond)
+	res, _ = store.Get("a")
+	assert.Nil(res)
+	assert.Equal(0, len(store.entries))
+}
+
+func TestGearMiddlewareIdempotencyStoreErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	app := gear.New()
+	app.Set(gear.SetLogger, log.New(&buf, "", 0))
+	app.Use(New(Options{Scope: userScope, Store: failingStore{NewMemoryStore()}}))
+	app.Use(func(ctx *gear.Context) error {
+		if ctx.Path == "/fail" {
+			return ctx.ErrorStatus(503)
+		}
+		return ctx.HTML(200, "ok")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	body, res := request("POST", host, "k1", "")
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("ok", body)
+	_, res = request("POST", host+"/fail", "k2", "")
+	assert.Equal(503, res.StatusCode)
+	assert.Contains(buf.String(), "save failed")
+	assert.Contains(buf.String(), "unlock failed")
+}
@@ -0,0 +1,233 @@
+package maintenance
+
+import (
+	"bytes"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Options is maintenance middleware options.
+type Options struct {
+	// Enabled defines the initial state of the maintenance mode, default to false.
+	Enabled bool
+	// RetryAfter defines the Retry-After header value of the 503 response,
+	// default to 5 minutes.
+	RetryAfter time.Duration
+	// Message defines the message rendered by the Template.
+	// Default to "Service is under maintenance, please try again later."
+	Message string
+	// Template renders the 503 response body with Data. Default to a simple HTML page.
+	Template *template.Template
+	// AllowPaths defines the paths which will be served normally in maintenance mode,
+	// such as "/health". A path matches itself and its sub paths ("/health/check"),
+	// but not the other paths with the same prefix ("/healthx").
+	AllowPaths []string
+	// AllowIPs defines the client IPs or CIDRs (such as "10.0.0.0/8") which
+	// will be served normally in maintenance mode. The client IP is the peer IP
+	// of the connection, see TrustedProxies.
+	AllowIPs []string
+	// TrustedProxies defines the IPs or CIDRs of the reverse proxies in front of the app,
+	// the client IP is read from the X-Forwarded-For or X-Real-IP header only when the
+	// request comes from them, see gear.Context.ClientIP. Default to none, the forwarding
+	// headers are ignored since they can be forged by any client.
+	TrustedProxies []string
+	// Skipper defines a function to skip the middleware for the request,
+	// the skipped requests will be served normally in maintenance mode.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// Data is used to render the Template.
+type Data struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+var defaultTemplate = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html>
+  <head><title>Service Unavailable</title></head>
+  <body><h1>Service Unavailable</h1><p>{{.Message}}</p></body>
+</html>`))
+
+// Maintenance is a runtime-toggleable maintenance mode middleware.
+// When enabled, it responds 503 with Retry-After header for all requests,
+// except the requests matching AllowPaths or AllowIPs.
+//
+//  m := maintenance.New(maintenance.Options{
+//  	AllowPaths: []string{"/health"},
+//  	AllowIPs:   []string{"127.0.0.1"},
+//  })
+//  stop := m.Notify(syscall.SIGUSR2) // toggle maintenance mode with `kill -USR2 pid`
+//  defer stop()
+//
+//  app := gear.New()
+//  app.UseHandler(m)
+//
+//  // or toggle it by API
+//  router.Post("/admin/maintenance", func(ctx *gear.Context) error {
+//  	m.Enable()
+//  	return ctx.End(204)
+//  })
+//
+type Maintenance struct {
+	enabled    int32
+	retryAfter string
+	paths      []string
+	ips        []net.IP
+	nets       []*net.IPNet
+	proxies    gear.TrustedProxies
+	body       []byte
+	skipper    func(ctx *gear.Context) bool
+}
+
+// New creates a Maintenance instance with options.
+func New(options ...Options) *Maintenance {
+	opts := Options{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = 5 * time.Minute
+	}
+	if opts.Message == "" {
+		opts.Message = "Service is under maintenance, please try again later."
+	}
+	if opts.Template == nil {
+		opts.Template = defaultTemplate
+	}
+
+	m := &Maintenance{
+		retryAfter: strconv.Itoa(int(opts.RetryAfter.Seconds())),
+		paths:      opts.AllowPaths,
+		skipper:    opts.Skipper,
+		proxies:    gear.NewTrustedProxies(opts.TrustedProxies...),
+	}
+	for _, s := range opts.AllowIPs {
+		if strings.Contains(s, "/") {
+			_, ipnet, err := net.ParseCIDR(s)
+			if err != nil {
+				panic(gear.NewAppError(err.Error()))
+			}
+			m.nets = append(m.nets, ipnet)
+		} else if ip := net.ParseIP(s); ip != nil {
+			m.ips = append(m.ips, ip)
+		} else {
+			panic(gear.NewAppError("invalid maintenance allowed IP: " + s))
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := opts.Template.Execute(buf, &Data{opts.Message, opts.RetryAfter}); err != nil {
+		panic(gear.NewAppError(err.Error()))
+	}
+	m.body = buf.Bytes()
+	if opts.Enabled {
+		m.Enable()
+	}
+	return m
+}
+
+// Enable turns on the maintenance mode.
+func (m *Maintenance) Enable() {
+	atomic.StoreInt32(&m.enabled, 1)
+}
+
+// Disable turns off the maintenance mode.
+func (m *Maintenance) Disable() {
+	atomic.StoreInt32(&m.enabled, 0)
+}
+
+// Toggle switches the maintenance mode, returns the new state.
+func (m *Maintenance) Toggle() bool {
+	for {
+		old := atomic.LoadInt32(&m.enabled)
+		if atomic.CompareAndSwapInt32(&m.enabled, old, 1-old) {
+			return old == 0
+		}
+	}
+}
+
+// Enabled returns whether the maintenance mode is on.
+func (m *Maintenance) Enabled() bool {
+	return atomic.LoadInt32(&m.enabled) == 1
+}
+
+// Notify toggles the maintenance mode when receives the given signals.
+// It returns a function to stop receiving the signals.
+func (m *Maintenance) Notify(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		panic(gear.NewAppError("maintenance notify signals required"))
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				m.Toggle()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// Serve implements gear.Handler interface.
+func (m *Maintenance) Serve(ctx *gear.Context) error {
+	if !m.Enabled() || m.allowed(ctx) {
+		return nil
+	}
+	ctx.Set(gear.HeaderRetryAfter, m.retryAfter)
+	ctx.Type(gear.MIMETextHTMLCharsetUTF8)
+	return ctx.End(http.StatusServiceUnavailable, m.body)
+}
+
+func (m *Maintenance) allowed(ctx *gear.Context) bool {
+	if m.skipper != nil && m.skipper(ctx) {
+		return true
+	}
+	for _, path := range m.paths {
+		if matchPath(ctx.Path, path) {
+			return true
+		}
+	}
+	if len(m.ips) == 0 && len(m.nets) == 0 {
+		return false
+	}
+	ip := ctx.ClientIP(m.proxies)
+	if ip == nil {
+		return false
+	}
+	for _, i := range m.ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	for _, n := range m.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath checks the path is the prefix or under it by "/" segment boundary.
+func matchPath(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
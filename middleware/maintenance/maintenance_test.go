@@ -0,0 +1,210 @@
+package maintenance
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func newApp(m *Maintenance) *gear.ServerListener {
+	app := gear.New()
+	app.UseHandler(m)
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, "OK")
+	})
+	return app.Start()
+}
+
+func TestGearMiddlewareMaintenance(t *testing.T) {
+	t.Run("Should toggle maintenance mode", func(t *testing.T) {
+		assert := assert.New(t)
+
+		m := New()
+		srv := newApp(m)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		assert.False(m.Enabled())
+		res, err := DefaultClient.Get(url)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+
+		m.Enable()
+		assert.True(m.Enabled())
+		res, err = DefaultClient.Get(url)
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal("300", res.Header.Get(gear.HeaderRetryAfter))
+		assert.Equal(gear.MIMETextHTMLCharsetUTF8, res.Header.Get(gear.HeaderContentType))
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Contains(string(body), "Service is under maintenance")
+
+		assert.False(m.Toggle())
+		res, err = DefaultClient.Get(url)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+		assert.True(m.Toggle())
+		m.Disable()
+		assert.False(m.Enabled())
+	})
+
+	t.Run("Should render with custom template", func(t *testing.T) {
+		assert := assert.New(t)
+
+		m := New(Options{
+			Enabled:    true,
+			RetryAfter: time.Minute,
+			Message:    "Upgrading",
+			Template:   template.Must(template.New("").Parse("<p>{{.Message}} {{.RetryAfter}}</p>")),
+		})
+		srv := newApp(m)
+		defer srv.Close()
+
+		res, err := DefaultClient.Get("http://" + srv.Addr().String())
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal("60", res.Header.Get(gear.HeaderRetryAfter))
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("<p>Upgrading 1m0s</p>", string(body))
+	})
+
+	t.Run("Should serve allowed paths and IPs", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() {
+			New(Options{AllowIPs: []string{"abc"}})
+		})
+		assert.Panics(func() {
+			New(Options{AllowIPs: []string{"10.0.0.0/abc"}})
+		})
+
+		m := New(Options{
+			Enabled:    true,
+			AllowPaths: []string{"/health"},
+			AllowIPs:   []string{"10.0.0.1", "192.168.0.0/16"},
+			// the test client connects from loopback
+			TrustedProxies: []string{"127.0.0.1", "::1"},
+		})
+		srv := newApp(m)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		res, err := DefaultClient.Get(url + "/health/check")
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+		res, err = DefaultClient.Get(url + "/health")
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+		res, err = DefaultClient.Get(url + "/healthx")
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set(gear.HeaderXRealIP, "10.0.0.1")
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+
+		req, _ = http.NewRequest("GET", url, nil)
+		req.Header.Set(gear.HeaderXRealIP, "192.168.1.10")
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+
+		req, _ = http.NewRequest("GET", url, nil)
+		req.Header.Set(gear.HeaderXRealIP, "10.0.0.2")
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+	})
+
+	t.Run("Should reject the spoofed forwarding headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() {
+			New(Options{TrustedProxies: []string{"abc"}})
+		})
+
+		m := New(Options{
+			Enabled:  true,
+			AllowIPs: []string{"10.0.0.1"},
+		})
+		srv := newApp(m)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set(gear.HeaderXForwardedFor, "10.0.0.1")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+
+		req, _ = http.NewRequest("GET", url, nil)
+		req.Header.Set(gear.HeaderXRealIP, "10.0.0.1")
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+
+		m = New(Options{
+			Enabled:  true,
+			AllowIPs: []string{"127.0.0.1", "::1"},
+		})
+		srv2 := newApp(m)
+		defer srv2.Close()
+		res, err = DefaultClient.Get("http://" + srv2.Addr().String())
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("Should skip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		m := New(Options{
+			Enabled: true,
+			Skipper: func(ctx *gear.Context) bool {
+				return ctx.Get("X-Admin") == "true"
+			},
+		})
+		srv := newApp(m)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("X-Admin", "true")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+
+		res, err = DefaultClient.Get(url)
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+	})
+
+	t.Run("Should toggle by signal", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() {
+			New().Notify()
+		})
+
+		m := New()
+		stop := m.Notify(syscall.SIGUSR2)
+		defer stop()
+
+		p, _ := os.FindProcess(os.Getpid())
+		assert.Nil(p.Signal(syscall.SIGUSR2))
+		for i := 0; i < 100 && !m.Enabled(); i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+		assert.True(m.Enabled())
+	})
+}
@@ -0,0 +1,90 @@
+package methodoverride
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+// Options is method override middleware options.
+type Options struct {
+	// AllowedMethods defines the methods which can be used to override the POST
+	// request. Default value is []string{"PUT", "PATCH", "DELETE"}.
+	AllowedMethods []string
+	// Header defines the request header to read the override method from.
+	// Default value is "X-HTTP-Method-Override".
+	Header string
+	// Key defines the query or form field to read the override method from.
+	// Default value is "_method".
+	Key string
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+var defaultAllowedMethods = []string{
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// New creates a middleware to override the POST request method with
+// `X-HTTP-Method-Override` header, or `_method` query or form field,
+// so HTML forms and limited clients can request PUT, PATCH and DELETE routes.
+// It should be used before router.
+//
+//  app := gear.New()
+//  app.Use(methodoverride.New())
+//
+//  router := gear.NewRouter()
+//  router.Delete("/user/:id", deleteUser)
+//  app.UseHandler(router)
+//
+//  // <form method="POST" action="/user/123?_method=DELETE">
+//
+// The form body is parsed only if the request Content-Type is
+// "application/x-www-form-urlencoded", the values can be retrieved from ctx.Req.PostForm.
+func New(options ...Options) gear.Middleware {
+	opts := Options{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.AllowedMethods == nil {
+		opts.AllowedMethods = defaultAllowedMethods
+	}
+	if opts.Header == "" {
+		opts.Header = gear.HeaderXHTTPMethodOverride
+	}
+	if opts.Key == "" {
+		opts.Key = "_method"
+	}
+	allowed := make(map[string]bool, len(opts.AllowedMethods))
+	for _, method := range opts.AllowedMethods {
+		allowed[strings.ToUpper(method)] = true
+	}
+
+	return func(ctx *gear.Context) error {
+		if ctx.Method != http.MethodPost || (opts.Skipper != nil && opts.Skipper(ctx)) {
+			return nil
+		}
+
+		method := ctx.Get(opts.Header)
+		if method == "" {
+			method = ctx.Query(opts.Key)
+		}
+		if method == "" && isForm(ctx.Get(gear.HeaderContentType)) {
+			method = ctx.Req.PostFormValue(opts.Key)
+		}
+		if method = strings.ToUpper(method); allowed[method] {
+			ctx.Method = method
+			ctx.Req.Method = method
+		}
+		return nil
+	}
+}
+
+func isForm(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == gear.MIMEApplicationForm
+}
@@ -0,0 +1,137 @@
+package methodoverride
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func TestGearMiddlewareMethodOverride(t *testing.T) {
+	app := gear.New()
+	app.Use(New())
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, ctx.Method+" "+ctx.Req.Method)
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	getMethod := func(res *http.Response) string {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return string(body)
+	}
+
+	t.Run("Should override with header", func(t *testing.T) {
+		assert := assert.New(t)
+
+		req, _ := http.NewRequest(http.MethodPost, host, nil)
+		req.Header.Set(gear.HeaderXHTTPMethodOverride, "put")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal("PUT PUT", getMethod(res))
+	})
+
+	t.Run("Should override with query", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := DefaultClient.Post(host+"?_method=DELETE", gear.MIMETextPlain, nil)
+		assert.Nil(err)
+		assert.Equal("DELETE DELETE", getMethod(res))
+	})
+
+	t.Run("Should override with form", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := DefaultClient.PostForm(host, url.Values{"_method": {"PATCH"}})
+		assert.Nil(err)
+		assert.Equal("PATCH PATCH", getMethod(res))
+
+		res, err = DefaultClient.Post(host, gear.MIMETextPlain, strings.NewReader("_method=PATCH"))
+		assert.Nil(err)
+		assert.Equal("POST POST", getMethod(res))
+	})
+
+	t.Run("Should not override with not allowed method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		req, _ := http.NewRequest(http.MethodPost, host, nil)
+		req.Header.Set(gear.HeaderXHTTPMethodOverride, "CONNECT")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal("POST POST", getMethod(res))
+	})
+
+	t.Run("Should not override non-POST request", func(t *testing.T) {
+		assert := assert.New(t)
+
+		req, _ := http.NewRequest(http.MethodGet, host+"?_method=DELETE", nil)
+		req.Header.Set(gear.HeaderXHTTPMethodOverride, "PUT")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal("GET GET", getMethod(res))
+	})
+
+	t.Run("Should work with options", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{
+			AllowedMethods: []string{"propfind"},
+			Header:         "X-Method",
+			Key:            "method",
+		}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, ctx.Method)
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		req, _ := http.NewRequest(http.MethodPost, host, nil)
+		req.Header.Set("X-Method", "PROPFIND")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal("PROPFIND", getMethod(res))
+
+		res, err = DefaultClient.Post(host+"?method=DELETE", gear.MIMETextPlain, nil)
+		assert.Nil(err)
+		assert.Equal("POST", getMethod(res))
+	})
+}
+
+func TestGearMiddlewareMethodOverrideSkipper(t *testing.T) {
+	assert := assert.New(t)
+
+	app := gear.New()
+	app.Use(New(Options{
+		Skipper: func(ctx *gear.Context) bool {
+			return strings.HasPrefix(ctx.Path, "/webhook")
+		},
+	}))
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, ctx.Method)
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	res, err := DefaultClient.Post(host+"/webhook?_method=DELETE", gear.MIMETextPlain, nil)
+	assert.Nil(err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal("POST", string(body))
+
+	res, err = DefaultClient.Post(host+"/user?_method=DELETE", gear.MIMETextPlain, nil)
+	assert.Nil(err)
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal("DELETE", string(body))
+}
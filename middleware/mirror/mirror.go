@@ -0,0 +1,144 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Options is mirror middleware options.
+type Options struct {
+	// Upstream defines the shadow upstream URL, such as "http://10.0.0.2:8080", it is required.
+	// The request path and query are appended to it.
+	Upstream string
+	// SampleRate defines the ratio of requests to mirror, in (0, 1]. Default to 1, mirror all.
+	SampleRate float64
+	// MaxBodySize defines the maximum bytes of the request body to mirror,
+	// the requests with larger body are not mirrored. Default to 1MB.
+	MaxBodySize int
+	// MaxConcurrent defines the maximum number of the in-flight mirrored requests,
+	// the requests over the limit are not mirrored. Default to 100.
+	MaxConcurrent int
+	// Client defines the http.Client to send the mirrored requests.
+	// Default to a client with 5 seconds timeout.
+	Client *http.Client
+	// OnError is called when the mirrored request failed, optional.
+	OnError func(req *http.Request, err error)
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// hop-by-hop headers should not be forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	gear.HeaderProxyAuthenticate,
+	gear.HeaderProxyAuthorization,
+	"Te",
+	gear.HeaderTrailer,
+	gear.HeaderTransferEncoding,
+	gear.HeaderUpgrade,
+}
+
+// New creates a middleware that duplicates a sample of the requests to a shadow upstream
+// asynchronously, for testing a new service version against the production traffic. The
+// request body is buffered and remains readable by the next middlewares. The mirrored
+// requests are fire-and-forget, their responses are discarded, and they never delay or
+// affect the origin responses.
+//
+//  app.Use(mirror.New(mirror.Options{
+//  	Upstream:   "http://canary.internal:8080",
+//  	SampleRate: 0.1,
+//  	Skipper: func(ctx *gear.Context) bool {
+//  		return ctx.Method != http.MethodGet
+//  	},
+//  }))
+//
+func New(opts Options) gear.Middleware {
+	upstream, err := url.Parse(opts.Upstream)
+	if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+		panic(gear.NewAppError("invalid mirror upstream: " + opts.Upstream))
+	}
+	if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 100
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	sem := make(chan struct{}, opts.MaxConcurrent)
+	base := strings.TrimSuffix(upstream.String(), "/")
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+		if opts.SampleRate < 1 && rand.Float64() >= opts.SampleRate {
+			return nil
+		}
+
+		var body []byte
+		if ctx.Req.Body != nil && ctx.Req.Body != http.NoBody {
+			buf, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, int64(opts.MaxBodySize)+1))
+			if err != nil {
+				return err
+			}
+			ctx.Req.Body = readCloser{io.MultiReader(bytes.NewReader(buf), ctx.Req.Body), ctx.Req.Body}
+			if len(buf) > opts.MaxBodySize {
+				return nil
+			}
+			body = buf
+		}
+
+		req, err := http.NewRequest(ctx.Method, base+ctx.Req.URL.RequestURI(), bytes.NewReader(body))
+		if err != nil {
+			return nil
+		}
+		for key, vals := range ctx.Req.Header {
+			req.Header[key] = append([]string(nil), vals...)
+		}
+		for _, key := range hopHeaders {
+			req.Header.Del(key)
+		}
+		req.Host = ctx.Host
+		if ip := ctx.IP(); ip != nil {
+			req.Header.Set(gear.HeaderXRealIP, ip.String())
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			return nil // too many in-flight mirrored requests
+		}
+		go func() {
+			defer func() { <-sem }()
+			res, err := opts.Client.Do(req)
+			if err != nil {
+				if opts.OnError != nil {
+					opts.OnError(req, err)
+				}
+				return
+			}
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}()
+		return nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,165 @@
+package mirror
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+type mirrored struct {
+	method, uri, host, realIP, body string
+	header                          http.Header
+}
+
+func newShadow() (*gear.ServerListener, chan *mirrored) {
+	ch := make(chan *mirrored, 10)
+	app := gear.New()
+	app.Use(func(ctx *gear.Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		ch <- &mirrored{ctx.Method, ctx.Req.RequestURI, ctx.Host, ctx.Get(gear.HeaderXRealIP), string(body), ctx.Req.Header}
+		return ctx.HTML(500, "shadow")
+	})
+	return app.Start(), ch
+}
+
+func newApp(opts Options) *gear.ServerListener {
+	app := gear.New()
+	app.Use(New(opts))
+	app.Use(func(ctx *gear.Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		return ctx.HTML(200, "origin "+string(body))
+	})
+	return app.Start()
+}
+
+func TestGearMiddlewareMirror(t *testing.T) {
+	t.Run("Should mirror requests", func(t *testing.T) {
+		assert := assert.New(t)
+
+		shadow, ch := newShadow()
+		defer shadow.Close()
+		srv := newApp(Options{
+			Upstream: "http://" + shadow.Addr().String() + "/",
+			Skipper: func(ctx *gear.Context) bool {
+				return ctx.Path == "/skip"
+			},
+		})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		req, _ := http.NewRequest(http.MethodPost, host+"/users?q=1", strings.NewReader("hello"))
+		req.Header.Set("X-Custom", "custom")
+		req.Header.Set(gear.HeaderProxyAuthorization, "secret")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("origin hello", string(body))
+
+		m := <-ch
+		assert.Equal(http.MethodPost, m.method)
+		assert.Equal("/users?q=1", m.uri)
+		assert.Equal(srv.Addr().String(), m.host)
+		assert.Equal("127.0.0.1", m.realIP)
+		assert.Equal("hello", m.body)
+		assert.Equal("custom", m.header.Get("X-Custom"))
+		assert.Equal("", m.header.Get(gear.HeaderProxyAuthorization))
+
+		res, err = DefaultClient.Get(host + "/skip")
+		assert.Nil(err)
+		res.Body.Close()
+		res, err = DefaultClient.Get(host + "/next")
+		assert.Nil(err)
+		res.Body.Close()
+		assert.Equal("/next", (<-ch).uri)
+	})
+
+	t.Run("Should not mirror large body", func(t *testing.T) {
+		assert := assert.New(t)
+
+		shadow, ch := newShadow()
+		defer shadow.Close()
+		srv := newApp(Options{
+			Upstream:    "http://" + shadow.Addr().String(),
+			MaxBodySize: 5,
+		})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := DefaultClient.Post(host, gear.MIMETextPlain, strings.NewReader("large body"))
+		assert.Nil(err)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal("origin large body", string(body))
+
+		res, err = DefaultClient.Post(host+"/small", gear.MIMETextPlain, strings.NewReader("small"))
+		assert.Nil(err)
+		res.Body.Close()
+		assert.Equal("/small", (<-ch).uri)
+	})
+
+	t.Run("Should sample requests", func(t *testing.T) {
+		assert := assert.New(t)
+
+		shadow, ch := newShadow()
+		defer shadow.Close()
+		srv := newApp(Options{
+			Upstream:   "http://" + shadow.Addr().String(),
+			SampleRate: 0.000001,
+		})
+		defer srv.Close()
+
+		for i := 0; i < 5; i++ {
+			res, err := DefaultClient.Get("http://" + srv.Addr().String())
+			assert.Nil(err)
+			res.Body.Close()
+		}
+		select {
+		case <-ch:
+			assert.Fail("should not mirror")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("Should call OnError", func(t *testing.T) {
+		assert := assert.New(t)
+
+		errs := make(chan error, 1)
+		client := &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("shadow error")
+		})}
+		srv := newApp(Options{
+			Upstream: "http://shadow.example.com",
+			Client:   client,
+			OnError: func(req *http.Request, err error) {
+				errs <- err
+			},
+		})
+		defer srv.Close()
+
+		res, err := DefaultClient.Get("http://" + srv.Addr().String())
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+		assert.Contains((<-errs).Error(), "shadow error")
+
+		assert.Panics(func() {
+			New(Options{Upstream: "shadow"})
+		})
+	})
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
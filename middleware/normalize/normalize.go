@@ -0,0 +1,83 @@
+package normalize
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+// Options is URL normalization middleware options.
+type Options struct {
+	// Lowercase converts the path to lower case, default to false.
+	Lowercase bool
+	// Redirect issues a redirection to the normalized URL instead of rewriting
+	// the request path in place, default to false. It responds 301 for GET and
+	// HEAD requests and 307 for all other request methods.
+	Redirect bool
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// New creates a middleware to normalize the request URL path before routing.
+// It collapses duplicate slashes, resolves dot segments, keeps the trailing slash,
+// and converts the path to lower case optionally, to prevent cache fragmentation
+// and duplicate content.
+//
+//  app := gear.New()
+//  app.Use(normalize.New(normalize.Options{Redirect: true}))
+//  // "GET /api//user/./123" will be redirected to "/api/user/123"
+//
+func New(options ...Options) gear.Middleware {
+	opts := Options{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+		p := Path(ctx.Path)
+		if opts.Lowercase {
+			p = strings.ToLower(p)
+		}
+		if p == ctx.Path {
+			return nil
+		}
+
+		if opts.Redirect {
+			u := *ctx.Req.URL
+			u.Path = p
+			u.RawPath = ""
+			code := http.StatusMovedPermanently
+			if ctx.Method != http.MethodGet && ctx.Method != http.MethodHead {
+				code = http.StatusTemporaryRedirect
+			}
+			ctx.Status(code)
+			return ctx.Redirect(u.String())
+		}
+
+		ctx.Path = p
+		ctx.Req.URL.Path = p
+		ctx.Req.URL.RawPath = ""
+		return nil
+	}
+}
+
+// Path returns the normalized path. It collapses duplicate slashes,
+// resolves "." and ".." segments, and keeps the trailing slash.
+//
+//  normalize.Path("/a//b/./c/../d/") == "/a/b/d/"
+//
+func Path(p string) string {
+	if p == "" {
+		return "/"
+	}
+	np := path.Clean("/" + p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
@@ -0,0 +1,120 @@
+package normalize
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func rawRequest(method, url, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Opaque = path
+	return DefaultClient.Do(req)
+}
+
+func TestGearMiddlewareNormalize(t *testing.T) {
+	t.Run("Path", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("/", Path(""))
+		assert.Equal("/", Path("/"))
+		assert.Equal("/", Path("//"))
+		assert.Equal("/a/b", Path("a//b"))
+		assert.Equal("/a/b/d/", Path("/a//b/./c/../d/"))
+		assert.Equal("/a", Path("/../a"))
+		assert.Equal("/A/B", Path("/A/./B"))
+	})
+
+	t.Run("Should rewrite path in place", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New())
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, ctx.Path+" "+ctx.Req.URL.Path)
+		})
+		srv := app.Start()
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		res, err := rawRequest("GET", url, "/api//User/./123/../456")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("/api/User/456 /api/User/456", string(body))
+		res.Body.Close()
+	})
+
+	t.Run("Should redirect with lowercase path", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Lowercase: true, Redirect: true}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, ctx.Path)
+		})
+		srv := app.Start()
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		res, err := rawRequest("GET", url, "/API//User/?q=1")
+		assert.Nil(err)
+		assert.Equal(301, res.StatusCode)
+		assert.Equal("/api/user/?q=1", res.Header.Get(gear.HeaderLocation))
+		res.Body.Close()
+
+		res, err = rawRequest("POST", url, "/a/../b")
+		assert.Nil(err)
+		assert.Equal(307, res.StatusCode)
+		assert.Equal("/b", res.Header.Get(gear.HeaderLocation))
+		res.Body.Close()
+
+		res, err = rawRequest("GET", url, "/api/user")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("/api/user", string(body))
+		res.Body.Close()
+	})
+
+	t.Run("Should skip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{
+			Skipper: func(ctx *gear.Context) bool {
+				return ctx.Method == http.MethodPost
+			},
+		}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, ctx.Path)
+		})
+		srv := app.Start()
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		res, err := rawRequest("POST", url, "/a//b")
+		assert.Nil(err)
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("/a//b", string(body))
+		res.Body.Close()
+
+		res, err = rawRequest("GET", url, "/a//b")
+		assert.Nil(err)
+		body, _ = ioutil.ReadAll(res.Body)
+		assert.Equal("/a/b", string(body))
+		res.Body.Close()
+	})
+}
@@ -0,0 +1,610 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Document is a loaded OpenAPI 3 document, only the JSON format is supported. The schemas
+// are compiled with gear.JSONSchema, the "$ref" to the components are resolved.
+type Document struct {
+	Title      string
+	Version    string
+	Operations []*Operation
+	paths      []*pathItem
+}
+
+// Operation is an operation of the document.
+type Operation struct {
+	// ID is the operationId, it may be empty.
+	ID string
+	// Method is the upper case HTTP method, such as "GET".
+	Method string
+	// Path is the path template, such as "/users/{id}".
+	Path       string
+	Parameters []*Parameter
+	// Body is the request body, it is nil if the operation has no request body.
+	Body *Body
+	// Responses is the responses by status code, such as "200", "2XX" and "default".
+	Responses map[string]Content
+}
+
+// Parameter is a parameter of the operation.
+type Parameter struct {
+	Name string
+	// In is the location of the parameter, "path", "query", "header" or "cookie".
+	In       string
+	Required bool
+	// Schema is nil if the parameter has no schema.
+	Schema    *gear.JSONSchema
+	typ       string
+	itemsType string
+}
+
+// Body is the request body of the operation.
+type Body struct {
+	Required bool
+	Content
+}
+
+// Content is the schemas by media type, such as "application/json" and "image/*",
+// the schema may be nil.
+type Content map[string]*gear.JSONSchema
+
+// Lookup returns the schema of the media type, ok is false if the media type is not allowed.
+func (c Content) Lookup(mediaType string) (s *gear.JSONSchema, ok bool) {
+	if s, ok = c[mediaType]; ok {
+		return
+	}
+	if i := strings.IndexByte(mediaType, '/'); i > 0 {
+		if s, ok = c[mediaType[:i]+"/*"]; ok {
+			return
+		}
+	}
+	s, ok = c["*/*"]
+	return
+}
+
+type pathItem struct {
+	re    *regexp.Regexp
+	names []string
+	ops   map[string]*Operation
+	// static is the number of the static segments, the more static path matches first.
+	static int
+}
+
+// Load loads the OpenAPI document.
+func Load(doc []byte) (*Document, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+	l := &loader{doc: doc, root: root}
+	d := &Document{}
+	if info, ok := root["info"].(map[string]interface{}); ok {
+		d.Title, _ = info["title"].(string)
+		d.Version, _ = info["version"].(string)
+	}
+	paths, _ := root["paths"].(map[string]interface{})
+	keys := make([]string, 0, len(paths))
+	for path := range paths {
+		keys = append(keys, path)
+	}
+	sort.Strings(keys)
+	for _, path := range keys {
+		item, ptr, err := l.object(paths[path], "/paths/"+escape(path))
+		if err != nil {
+			return nil, err
+		}
+		p, err := newPathItem(path)
+		if err != nil {
+			return nil, err
+		}
+		common, err := l.parameters(item["parameters"], ptr+"/parameters")
+		if err != nil {
+			return nil, err
+		}
+		for _, method := range methods {
+			v, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			op, err := l.operation(v, ptr+"/"+method, common)
+			if err != nil {
+				return nil, err
+			}
+			op.Method, op.Path = strings.ToUpper(method), path
+			p.ops[op.Method] = op
+			d.Operations = append(d.Operations, op)
+		}
+		d.paths = append(d.paths, p)
+	}
+	sort.SliceStable(d.paths, func(i, j int) bool {
+		return d.paths[i].static > d.paths[j].static
+	})
+	return d, nil
+}
+
+// LoadFile loads the OpenAPI document from the file.
+func LoadFile(name string) (*Document, error) {
+	doc, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Load(doc)
+}
+
+// Find returns the operation matched the method and path, and the path parameters.
+// It returns nil if no operation matched.
+func (d *Document) Find(method, path string) (*Operation, map[string]string) {
+	op, params, _ := d.match(method, path)
+	return op, params
+}
+
+func (d *Document) match(method, path string) (*Operation, map[string]string, bool) {
+	for _, p := range d.paths {
+		m := p.re.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		op, ok := p.ops[method]
+		if !ok && method == http.MethodHead {
+			op, ok = p.ops[http.MethodGet]
+		}
+		if !ok {
+			return nil, nil, true
+		}
+		params := make(map[string]string, len(p.names))
+		for i, name := range p.names {
+			if val, err := url.PathUnescape(m[i+1]); err == nil {
+				params[name] = val
+			} else {
+				params[name] = m[i+1]
+			}
+		}
+		return op, params, true
+	}
+	return nil, nil, false
+}
+
+var templateReg = regexp.MustCompile(`\{([^}/]+)\}`)
+
+func newPathItem(path string) (*pathItem, error) {
+	p := &pathItem{ops: make(map[string]*Operation)}
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if !strings.Contains(seg, "{") {
+			p.static++
+		}
+	}
+	pattern := "^"
+	last := 0
+	for _, m := range templateReg.FindAllStringSubmatchIndex(path, -1) {
+		pattern += regexp.QuoteMeta(path[last:m[0]]) + "([^/]+)"
+		p.names = append(p.names, path[m[2]:m[3]])
+		last = m[1]
+	}
+	pattern += regexp.QuoteMeta(path[last:]) + "$"
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %s: %v", path, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+type loader struct {
+	doc  []byte
+	root map[string]interface{}
+}
+
+// object returns the object and its JSON pointer, the "$ref" is resolved.
+func (l *loader) object(v interface{}, ptr string) (map[string]interface{}, string, error) {
+	for i := 0; i < 32; i++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("object required at %s", ptr)
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m, ptr, nil
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil, "", fmt.Errorf("only local $ref is supported: %s", ref)
+		}
+		ptr, v = ref[1:], interface{}(l.root)
+		for _, token := range strings.Split(ptr[1:], "/") {
+			token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+			switch val := v.(type) {
+			case map[string]interface{}:
+				v, ok = val[token]
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if ok = err == nil && i >= 0 && i < len(val); ok {
+					v = val[i]
+				}
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, "", fmt.Errorf("$ref not found: %s", ref)
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("too many $ref at %s", ptr)
+}
+
+func (l *loader) schema(v interface{}, ptr string) (*gear.JSONSchema, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return gear.CompileJSONSchemaAt(l.doc, ptr)
+}
+
+func (l *loader) operation(v map[string]interface{}, ptr string, common []*Parameter) (*Operation, error) {
+	op := &Operation{Responses: make(map[string]Content)}
+	op.ID, _ = v["operationId"].(string)
+	params, err := l.parameters(v["parameters"], ptr+"/parameters")
+	if err != nil {
+		return nil, err
+	}
+	// the operation parameters override the path parameters with the same name and location
+	for _, c := range common {
+		overridden := false
+		for _, p := range params {
+			if p.Name == c.Name && p.In == c.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			op.Parameters = append(op.Parameters, c)
+		}
+	}
+	op.Parameters = append(op.Parameters, params...)
+
+	if v["requestBody"] != nil {
+		body, bodyPtr, err := l.object(v["requestBody"], ptr+"/requestBody")
+		if err != nil {
+			return nil, err
+		}
+		op.Body = &Body{}
+		op.Body.Required, _ = body["required"].(bool)
+		if op.Body.Content, err = l.content(body["content"], bodyPtr+"/content"); err != nil {
+			return nil, err
+		}
+	}
+	responses, _ := v["responses"].(map[string]interface{})
+	for code, r := range responses {
+		res, resPtr, err := l.object(r, ptr+"/responses/"+escape(code))
+		if err != nil {
+			return nil, err
+		}
+		content, err := l.content(res["content"], resPtr+"/content")
+		if err != nil {
+			return nil, err
+		}
+		op.Responses[strings.ToUpper(code)] = content
+	}
+	return op, nil
+}
+
+func (l *loader) parameters(v interface{}, ptr string) ([]*Parameter, error) {
+	list, _ := v.([]interface{})
+	params := make([]*Parameter, 0, len(list))
+	for i, item := range list {
+		m, paramPtr, err := l.object(item, ptr+"/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		p := &Parameter{}
+		p.Name, _ = m["name"].(string)
+		p.In, _ = m["in"].(string)
+		p.Required, _ = m["required"].(bool)
+		if p.Name == "" || p.In == "" {
+			return nil, fmt.Errorf("parameter name and in required at %s", paramPtr)
+		}
+		if s, schemaPtr, err := l.object(m["schema"], paramPtr+"/schema"); err == nil {
+			p.typ, _ = s["type"].(string)
+			if items, _, err := l.object(s["items"], schemaPtr+"/items"); err == nil {
+				p.itemsType, _ = items["type"].(string)
+			}
+			if p.Schema, err = l.schema(s, paramPtr+"/schema"); err != nil {
+				return nil, err
+			}
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+func (l *loader) content(v interface{}, ptr string) (Content, error) {
+	m, _ := v.(map[string]interface{})
+	content := make(Content, len(m))
+	for mediaType, item := range m {
+		media, _ := item.(map[string]interface{})
+		s, err := l.schema(media["schema"], ptr+"/"+escape(mediaType)+"/schema")
+		if err != nil {
+			return nil, err
+		}
+		content[strings.ToLower(mediaType)] = s
+	}
+	return content, nil
+}
+
+// Options is the validator middleware options.
+type Options struct {
+	// Root is the path prefix where the API is mounted, such as "/api", it is stripped
+	// from the request path before matching the operations.
+	Root string
+	// Strict responds 404 Not Found for the paths not in the document and 405 Method Not
+	// Allowed for the methods not in the document, otherwise the requests go through
+	// without validation.
+	Strict bool
+	// MaxBodySize limits the request body to validate, the larger one is responded with
+	// 413 Request Entity Too Large. It also limits the response body to validate, the larger
+	// one is not validated. Default to 1MB.
+	MaxBodySize int
+	// ValidateResponses validates the responses against the document, it should be enabled
+	// in the development and testing. The mismatches are reported with *ResponseError.
+	ValidateResponses bool
+	// OnResponseError is called with the *ResponseError when the response does not match
+	// the document, default to log it by app.Error. The response is sent anyway.
+	OnResponseError func(ctx *gear.Context, err error)
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// ResponseError is reported when the response does not match the document.
+type ResponseError struct {
+	Operation *Operation
+	Status    int
+	// Err is a *gear.SchemaError if the body does not match the schema.
+	Err error
+}
+
+// Error implemented error interface.
+func (err *ResponseError) Error() string {
+	return fmt.Sprintf("openapi: %d response of %s %s mismatched: %v",
+		err.Status, err.Operation.Method, err.Operation.Path, err.Err)
+}
+
+type ctxKey struct{}
+
+// FromCtx returns the operation matched the request, it returns nil if no operation matched.
+func FromCtx(ctx *gear.Context) *Operation {
+	if val, err := ctx.Any(ctxKey{}); err == nil {
+		return val.(*Operation)
+	}
+	return nil
+}
+
+// New creates a middleware that validates the requests against the OpenAPI document before
+// the handlers run. The parameters and the JSON request body are validated with the schemas,
+// the invalid request is responded with 400 Bad Request by *gear.SchemaError, the violations
+// are enumerated by JSON pointer with the location prefix, such as "/query/limit",
+// "/path/id", "/header/X-Request-ID", "/cookie/sid" and "/body/name".
+//
+//  doc, err := openapi.LoadFile("./openapi.json")
+//  if err != nil {
+//  	panic(err)
+//  }
+//  app.Use(openapi.New(doc, openapi.Options{
+//  	Root:              "/api",
+//  	Strict:            true,
+//  	ValidateResponses: app.Env() != "production",
+//  }))
+//  app.UseHandler(router)
+//
+func New(doc *Document, opts Options) gear.Middleware {
+	if doc == nil {
+		panic(gear.NewAppError("openapi document required"))
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	root := strings.TrimSuffix(opts.Root, "/")
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+		path := ctx.Path
+		if root != "" {
+			if path != root && !strings.HasPrefix(path, root+"/") {
+				return nil
+			}
+			if path = path[len(root):]; path == "" {
+				path = "/"
+			}
+		}
+
+		op, params, found := doc.match(ctx.Method, path)
+		if op == nil {
+			if !opts.Strict {
+				return nil
+			}
+			if found {
+				return &gear.Error{Code: http.StatusMethodNotAllowed,
+					Msg: fmt.Sprintf(`"%s" is not allowed in "%s"`, ctx.Method, ctx.Path)}
+			}
+			return &gear.Error{Code: http.StatusNotFound,
+				Msg: fmt.Sprintf(`"%s" is not documented`, ctx.Path)}
+		}
+		ctx.SetAny(ctxKey{}, op)
+
+		var violations []gear.SchemaViolation
+		for _, p := range op.Parameters {
+			violations = validateParam(ctx, p, params, violations)
+		}
+		violations, err := validateBody(ctx, op.Body, opts.MaxBodySize, violations)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			return &gear.SchemaError{Violations: violations}
+		}
+
+		if opts.ValidateResponses {
+			return ctx.Transform(opts.MaxBodySize, func(body []byte) ([]byte, error) {
+				if err := validateResponse(ctx, op, body); err != nil {
+					if opts.OnResponseError == nil {
+						return nil, err
+					}
+					opts.OnResponseError(ctx, err)
+				}
+				return body, nil
+			})
+		}
+		return nil
+	}
+}
+
+func validateParam(ctx *gear.Context, p *Parameter, params map[string]string,
+	violations []gear.SchemaViolation) []gear.SchemaViolation {
+	var vals []string
+	switch p.In {
+	case "path":
+		if val, ok := params[p.Name]; ok {
+			vals = []string{val}
+		}
+	case "query":
+		vals = ctx.Req.URL.Query()[p.Name]
+	case "header":
+		vals = ctx.Req.Header[http.CanonicalHeaderKey(p.Name)]
+	case "cookie":
+		if c, err := ctx.Req.Cookie(p.Name); err == nil {
+			vals = []string{c.Value}
+		}
+	}
+	ptr := "/" + p.In + "/" + escape(p.Name)
+	if len(vals) == 0 {
+		if p.Required {
+			violations = append(violations, gear.SchemaViolation{Pointer: ptr, Message: "is required"})
+		}
+		return violations
+	}
+	if p.Schema == nil {
+		return violations
+	}
+	var v interface{}
+	if p.typ == "array" {
+		list := make([]interface{}, 0, len(vals))
+		for _, val := range vals {
+			for _, item := range strings.Split(val, ",") {
+				list = append(list, convert(item, p.itemsType))
+			}
+		}
+		v = list
+	} else {
+		v = convert(vals[0], p.typ)
+	}
+	return appendViolations(violations, ptr, p.Schema.Validate(v))
+}
+
+// convert converts the parameter value to the JSON value of the type, it keeps the string
+// if failed, then the schema reports the type violation.
+func convert(val, typ string) interface{} {
+	switch typ {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(val, 64); err == nil {
+			return json.Number(val)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return val
+}
+
+func validateBody(ctx *gear.Context, body *Body, maxBytes int,
+	violations []gear.SchemaViolation) ([]gear.SchemaViolation, error) {
+	if body == nil {
+		return violations, nil
+	}
+	var buf []byte
+	if ctx.Req.Body != nil && ctx.Req.Body != http.NoBody {
+		var err error
+		buf, err = ioutil.ReadAll(http.MaxBytesReader(ctx.Res, ctx.Req.Body, int64(maxBytes)))
+		if err != nil {
+			return nil, &gear.Error{Code: http.StatusRequestEntityTooLarge, Msg: err.Error()}
+		}
+		ctx.Req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	}
+	if len(buf) == 0 {
+		if body.Required {
+			violations = append(violations, gear.SchemaViolation{Pointer: "/body", Message: "is required"})
+		}
+		return violations, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(ctx.Get(gear.HeaderContentType))
+	s, ok := body.Lookup(mediaType)
+	if !ok {
+		return nil, &gear.Error{Code: http.StatusUnsupportedMediaType,
+			Msg: fmt.Sprintf("unsupported media type %q", mediaType)}
+	}
+	if s == nil || !isJSON(mediaType) {
+		return violations, nil
+	}
+	return appendViolations(violations, "/body", s.ValidateJSON(buf)), nil
+}
+
+func validateResponse(ctx *gear.Context, op *Operation, body []byte) error {
+	status := ctx.Res.Status()
+	content, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		content, ok = op.Responses[strconv.Itoa(status/100)+"XX"]
+	}
+	if !ok {
+		content, ok = op.Responses["DEFAULT"]
+	}
+	if !ok {
+		return &ResponseError{Operation: op, Status: status, Err: fmt.Errorf("status code not documented")}
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(ctx.Res.Get(gear.HeaderContentType))
+	s, ok := content.Lookup(mediaType)
+	if !ok {
+		return &ResponseError{Operation: op, Status: status,
+			Err: fmt.Errorf("media type %q not documented", mediaType)}
+	}
+	if s == nil || !isJSON(mediaType) {
+		return nil
+	}
+	if err := s.ValidateJSON(body); err != nil {
+		return &ResponseError{Operation: op, Status: status, Err: err}
+	}
+	return nil
+}
+
+func appendViolations(violations []gear.SchemaViolation, prefix string, err error) []gear.SchemaViolation {
+	if e, ok := err.(*gear.SchemaError); ok {
+		for _, v := range e.Violations {
+			violations = append(violations, gear.SchemaViolation{Pointer: prefix + v.Pointer, Message: v.Message})
+		}
+	}
+	return violations
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == gear.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+func escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
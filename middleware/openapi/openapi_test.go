@@ -0,0 +1,241 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+const spec = `{
+	"openapi": "3.0.3",
+	"info": {"title": "Users", "version": "1.0.0"},
+	"paths": {
+		"/users": {
+			"get": {
+				"operationId": "listUsers",
+				"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 100}},
+					{"name": "ids", "in": "query", "schema": {"type": "array", "items": {"type": "integer"}}}
+				],
+				"responses": {
+					"200": {"content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/User"}}}}}
+				}
+			},
+			"post": {
+				"operationId": "createUser",
+				"parameters": [{"$ref": "#/components/parameters/RequestID"}],
+				"requestBody": {
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}
+				},
+				"responses": {
+					"2XX": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+					"default": {"content": {"application/json": {"schema": {"type": "object"}}}}
+				}
+			}
+		},
+		"/users/me": {
+			"get": {
+				"operationId": "getMe",
+				"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}}
+			}
+		},
+		"/users/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+			"get": {
+				"operationId": "getUser",
+				"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}}}
+			}
+		}
+	},
+	"components": {
+		"parameters": {
+			"RequestID": {"name": "X-Request-ID", "in": "header", "required": true, "schema": {"type": "string", "minLength": 4}}
+		},
+		"schemas": {
+			"User": {
+				"type": "object",
+				"properties": {"id": {"type": "integer"}, "name": {"type": "string", "minLength": 1}},
+				"required": ["name"]
+			}
+		}
+	}
+}`
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Load([]byte(`{`))
+	assert.NotNil(err)
+	_, err = Load([]byte(`{"paths": {"/a": {"get": {"parameters": [{"$ref": "#/none"}]}}}}`))
+	assert.NotNil(err)
+	_, err = LoadFile("./openapi.json")
+	assert.NotNil(err)
+
+	doc, err := Load([]byte(spec))
+	assert.Nil(err)
+	assert.Equal("Users", doc.Title)
+	assert.Equal("1.0.0", doc.Version)
+	assert.Equal(4, len(doc.Operations))
+
+	op, params := doc.Find("GET", "/users/me")
+	assert.Equal("getMe", op.ID)
+	op, params = doc.Find("GET", "/users/123")
+	assert.Equal("getUser", op.ID)
+	assert.Equal("/users/{id}", op.Path)
+	assert.Equal(map[string]string{"id": "123"}, params)
+	op, _ = doc.Find("HEAD", "/users/123")
+	assert.Equal("getUser", op.ID)
+	op, _ = doc.Find("DELETE", "/users/123")
+	assert.Nil(op)
+
+	op, _ = doc.Find("POST", "/users")
+	assert.Equal("createUser", op.ID)
+	assert.Equal("X-Request-ID", op.Parameters[0].Name)
+	assert.True(op.Body.Required)
+	_, ok := op.Body.Lookup("application/json")
+	assert.True(ok)
+	_, ok = op.Body.Lookup("text/plain")
+	assert.False(ok)
+	assert.NotNil(op.Responses["2XX"])
+	assert.NotNil(op.Responses["DEFAULT"])
+}
+
+func TestGearMiddlewareOpenAPI(t *testing.T) {
+	doc, err := Load([]byte(spec))
+	if err != nil {
+		panic(err)
+	}
+	assert.Panics(t, func() {
+		New(nil, Options{})
+	})
+
+	var mismatches []error
+	app := gear.New()
+	app.Use(New(doc, Options{
+		Root:              "/api",
+		Strict:            true,
+		ValidateResponses: true,
+		OnResponseError: func(ctx *gear.Context, err error) {
+			mismatches = append(mismatches, err)
+		},
+	}))
+	router := gear.NewRouter(gear.RouterOptions{Root: "/api"})
+	router.Get("/users", func(ctx *gear.Context) error {
+		if ctx.Query("bad") != "" {
+			return ctx.JSON(200, []map[string]interface{}{{"id": 1}})
+		}
+		return ctx.JSON(200, []map[string]interface{}{{"id": 1, "name": "gear"}})
+	})
+	router.Post("/users", func(ctx *gear.Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		return ctx.JSONBlob(201, body)
+	})
+	router.Get("/users/:id", func(ctx *gear.Context) error {
+		assert.Equal(t, "getUser", FromCtx(ctx).ID)
+		return ctx.HTML(200, "user")
+	})
+	router.Delete("/users/:id", func(ctx *gear.Context) error {
+		return ctx.End(204)
+	})
+	app.UseHandler(router)
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	request := func(method, path, body string, header map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, host+path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		buf, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res, string(buf)
+	}
+	jsonHeader := map[string]string{gear.HeaderContentType: gear.MIMEApplicationJSON, "X-Request-ID": "abcd"}
+
+	t.Run("should validate parameters", func(t *testing.T) {
+		assert := assert.New(t)
+
+		mismatches = nil
+		res, _ := request("GET", "/api/users?limit=10&ids=1,2&ids=3", "", nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Nil(mismatches)
+
+		res, body := request("GET", "/api/users?limit=0&ids=1,x", "", nil)
+		assert.Equal(400, res.StatusCode)
+		assert.Contains(body, "/query/limit: must be >= 1")
+		assert.Contains(body, "/query/ids/1: must be integer")
+
+		res, body = request("GET", "/api/users/abc", "", nil)
+		assert.Equal(400, res.StatusCode)
+		assert.Contains(body, "/path/id: must be integer")
+	})
+
+	t.Run("should validate request body", func(t *testing.T) {
+		assert := assert.New(t)
+
+		mismatches = nil
+		res, body := request("POST", "/api/users", `{"name":"gear"}`, jsonHeader)
+		assert.Equal(201, res.StatusCode)
+		assert.Equal(`{"name":"gear"}`, body)
+		assert.Nil(mismatches)
+
+		res, body = request("POST", "/api/users", `{"name":""}`, map[string]string{
+			gear.HeaderContentType: gear.MIMEApplicationJSON,
+		})
+		assert.Equal(400, res.StatusCode)
+		assert.Contains(body, "/header/X-Request-ID: is required")
+		assert.Contains(body, "/body/name: must be at least 1 characters")
+
+		res, body = request("POST", "/api/users", "", jsonHeader)
+		assert.Equal(400, res.StatusCode)
+		assert.Contains(body, "/body: is required")
+
+		res, _ = request("POST", "/api/users", "name=gear", map[string]string{
+			gear.HeaderContentType: gear.MIMEApplicationForm,
+			"X-Request-ID":         "abcd",
+		})
+		assert.Equal(415, res.StatusCode)
+	})
+
+	t.Run("should report response mismatches", func(t *testing.T) {
+		assert := assert.New(t)
+
+		mismatches = nil
+		res, _ := request("GET", "/api/users?bad=1", "", nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(1, len(mismatches))
+		err := mismatches[0].(*ResponseError)
+		assert.Equal(200, err.Status)
+		assert.Equal("listUsers", err.Operation.ID)
+		assert.Equal("/0/name", err.Err.(*gear.SchemaError).Violations[0].Pointer)
+
+		mismatches = nil
+		res, _ = request("GET", "/api/users/1", "", nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(1, len(mismatches))
+		assert.Contains(mismatches[0].Error(), `media type "text/html" not documented`)
+	})
+
+	t.Run("should respond 404 and 405 in strict mode", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, _ := request("GET", "/api/posts", "", nil)
+		assert.Equal(404, res.StatusCode)
+		res, _ = request("DELETE", "/api/users/1", "", nil)
+		assert.Equal(405, res.StatusCode)
+		res, _ = request("GET", "/other", "", nil)
+		assert.NotEqual(404, res.StatusCode)
+	})
+}
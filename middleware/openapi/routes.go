@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/teambition/gear"
+)
+
+// Handlers is the handlers of the operations by operationId.
+type Handlers map[string]gear.Middleware
+
+// HandlersOf returns the Handlers of the methods of v with the gear.Middleware signature,
+// the operationId is the method name with the first letter in lower case, such as
+// "createUser" for the method CreateUser:
+//
+//  type userAPI struct{}
+//
+//  func (a *userAPI) CreateUser(ctx *gear.Context) error { ... }
+//  func (a *userAPI) GetUser(ctx *gear.Context) error { ... }
+//
+//  err := doc.Register(router, openapi.HandlersOf(&userAPI{}))
+//
+func HandlersOf(v interface{}) Handlers {
+	handlers := make(Handlers)
+	rv := reflect.ValueOf(v)
+	for i := 0; i < rv.NumMethod(); i++ {
+		if fn, ok := rv.Method(i).Interface().(func(*gear.Context) error); ok {
+			name := rv.Type().Method(i).Name
+			r, n := utf8.DecodeRuneInString(name)
+			handlers[string(unicode.ToLower(r))+name[n:]] = fn
+		}
+	}
+	return handlers
+}
+
+// Pattern returns the router pattern of the operation path, such as "/users/:id" of
+// "/users/{id}". It returns an error if a path parameter is not a whole segment.
+func (op *Operation) Pattern() (string, error) {
+	segs := strings.Split(op.Path, "/")
+	for i, seg := range segs {
+		if !strings.ContainsAny(seg, "{}") {
+			continue
+		}
+		if m := templateReg.FindStringSubmatch(seg); m == nil || m[0] != seg {
+			return "", fmt.Errorf("unsupported path template %s", op.Path)
+		}
+		segs[i] = ":" + seg[1:len(seg)-1]
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// Register registers the operations of the document to the router with the handlers
+// looked up by operationId, so the paths and methods are defined in one source of truth,
+// the document. The middlewares are called before the handler of every operation, and
+// FromCtx returns the operation in them. It returns an error without registering any
+// route if an operation has no operationId or no handler, or a handler is not in the
+// document.
+//
+//  doc, err := openapi.LoadFile("./openapi.json")
+//  if err != nil {
+//  	panic(err)
+//  }
+//  router := gear.NewRouter(gear.RouterOptions{Root: "/api"})
+//  err = doc.Register(router, openapi.Handlers{
+//  	"listUsers":  userAPI.List,
+//  	"createUser": userAPI.Create,
+//  	"getUser":    userAPI.Get,
+//  }, auth.Middleware)
+//  if err != nil {
+//  	panic(err)
+//  }
+//  app.UseHandler(router)
+//
+func (d *Document) Register(router *gear.Router, handlers Handlers, mds ...gear.Middleware) error {
+	patterns := make([]string, len(d.Operations))
+	used := make(map[string]bool, len(handlers))
+	for i, op := range d.Operations {
+		if op.ID == "" {
+			return fmt.Errorf("operationId required for %s %s", op.Method, op.Path)
+		}
+		if handlers[op.ID] == nil {
+			return fmt.Errorf("handler not found for operation %s", op.ID)
+		}
+		pattern, err := op.Pattern()
+		if err != nil {
+			return err
+		}
+		patterns[i] = pattern
+		used[op.ID] = true
+	}
+	var unused []string
+	for id := range handlers {
+		if !used[id] {
+			unused = append(unused, id)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return fmt.Errorf("operations not found for handlers %s", strings.Join(unused, ", "))
+	}
+
+	for i, op := range d.Operations {
+		op := op
+		chain := make([]gear.Middleware, 0, len(mds)+2)
+		chain = append(chain, func(ctx *gear.Context) error {
+			ctx.SetAny(ctxKey{}, op)
+			return nil
+		})
+		chain = append(chain, mds...)
+		chain = append(chain, handlers[op.ID])
+		router.Handle(op.Method, patterns[i], chain...)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+type userAPI struct{}
+
+func (a *userAPI) ListUsers(ctx *gear.Context) error {
+	return ctx.JSON(200, []map[string]interface{}{{"id": 1, "name": "gear"}})
+}
+
+func (a *userAPI) CreateUser(ctx *gear.Context) error {
+	return ctx.JSON(201, map[string]interface{}{"id": 2, "name": "gear"})
+}
+
+func (a *userAPI) GetMe(ctx *gear.Context) error {
+	return ctx.HTML(200, FromCtx(ctx).ID)
+}
+
+func (a *userAPI) GetUser(ctx *gear.Context) error {
+	return ctx.HTML(200, FromCtx(ctx).ID+" "+ctx.Param("id"))
+}
+
+func (a *userAPI) Name() string {
+	return "users"
+}
+
+func TestOperationPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	pattern, err := (&Operation{Path: "/users/{id}/posts/{postId}"}).Pattern()
+	assert.Nil(err)
+	assert.Equal("/users/:id/posts/:postId", pattern)
+	pattern, err = (&Operation{Path: "/users"}).Pattern()
+	assert.Nil(err)
+	assert.Equal("/users", pattern)
+	_, err = (&Operation{Path: "/files/{name}.json"}).Pattern()
+	assert.NotNil(err)
+}
+
+func TestDocumentRegister(t *testing.T) {
+	doc, err := Load([]byte(spec))
+	if err != nil {
+		panic(err)
+	}
+
+	t.Run("HandlersOf", func(t *testing.T) {
+		assert := assert.New(t)
+
+		handlers := HandlersOf(&userAPI{})
+		assert.Equal(4, len(handlers))
+		assert.NotNil(handlers["listUsers"])
+		assert.NotNil(handlers["createUser"])
+		assert.NotNil(handlers["getMe"])
+		assert.NotNil(handlers["getUser"])
+	})
+
+	t.Run("should return error if not in sync", func(t *testing.T) {
+		assert := assert.New(t)
+
+		handlers := HandlersOf(&userAPI{})
+		delete(handlers, "getUser")
+		err := doc.Register(gear.NewRouter(), handlers)
+		assert.Equal("handler not found for operation getUser", err.Error())
+
+		handlers = HandlersOf(&userAPI{})
+		handlers["deleteUser"] = handlers["getUser"]
+		err = doc.Register(gear.NewRouter(), handlers)
+		assert.Equal("operations not found for handlers deleteUser", err.Error())
+
+		noID, _ := Load([]byte(`{"paths": {"/a": {"get": {}}}}`))
+		err = noID.Register(gear.NewRouter(), Handlers{})
+		assert.Equal("operationId required for GET /a", err.Error())
+	})
+
+	t.Run("should register routes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		count := 0
+		router := gear.NewRouter(gear.RouterOptions{Root: "/api"})
+		err := doc.Register(router, HandlersOf(&userAPI{}), func(ctx *gear.Context) error {
+			count++
+			return nil
+		})
+		assert.Nil(err)
+
+		app := gear.New()
+		app.UseHandler(router)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := DefaultClient.Get(host + "/api/users")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+
+		req, _ := http.NewRequest("POST", host+"/api/users", nil)
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(201, res.StatusCode)
+		res.Body.Close()
+
+		res, err = DefaultClient.Get(host + "/api/users/123")
+		assert.Nil(err)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal("getUser 123", string(body))
+
+		res, err = DefaultClient.Get(host + "/api/users/me")
+		assert.Nil(err)
+		body, _ = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal("getMe", string(body))
+
+		req, _ = http.NewRequest("DELETE", host+"/api/users/123", nil)
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		res.Body.Close()
+		assert.Equal(4, count)
+	})
+}
@@ -0,0 +1,158 @@
+package precondition
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// State is the current state of the resource to check the preconditions against.
+type State struct {
+	// ETag is the current entity tag of the resource, such as `"v3"`.
+	ETag string
+	// LastModified is the last modification time of the resource, optional.
+	LastModified time.Time
+}
+
+// Options is precondition middleware options.
+type Options struct {
+	// State returns the current state of the resource of the request, it should return nil
+	// state and nil error if the resource does not exist. Required.
+	State func(ctx *gear.Context) (*State, error)
+	// Methods defines the write methods to enforce the preconditions, default to PUT, PATCH
+	// and DELETE. The other methods go through.
+	Methods []string
+	// Optional lets the request without precondition headers go through, otherwise it is
+	// responded with 428 Precondition Required.
+	Optional bool
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+type ctxKey struct{}
+
+// FromCtx returns the state of the resource checked for the request, it returns nil if the
+// resource does not exist or the request is not checked.
+func FromCtx(ctx *gear.Context) *State {
+	if val, err := ctx.Any(ctxKey{}); err == nil {
+		return val.(*State)
+	}
+	return nil
+}
+
+// New creates a middleware that enforces the conditional requests (RFC 9110) on the write
+// endpoints to prevent the lost updates. The If-Match header is checked against the current
+// ETag with strong comparison, If-Unmodified-Since is checked against the LastModified when
+// If-Match is absent, and "If-None-Match: *" lets the client create the resource only if it
+// does not exist. The failed precondition is responded with 412 Precondition Failed, and the
+// request without any of them with 428 Precondition Required.
+//
+//  router.Put("/docs/:id", precondition.New(precondition.Options{
+//  	State: func(ctx *gear.Context) (*precondition.State, error) {
+//  		doc, err := docs.Find(ctx.Param("id"))
+//  		if err != nil || doc == nil {
+//  			return nil, err
+//  		}
+//  		return &precondition.State{ETag: doc.ETag(), LastModified: doc.UpdatedAt}, nil
+//  	},
+//  }), updateDoc)
+//
+func New(opts Options) gear.Middleware {
+	if opts.State == nil {
+		panic(gear.NewAppError("precondition state function required"))
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	methods := make(map[string]bool, len(opts.Methods))
+	for _, m := range opts.Methods {
+		methods[strings.ToUpper(m)] = true
+	}
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+		if !methods[ctx.Method] {
+			return nil
+		}
+
+		ifMatch := ctx.Get(gear.HeaderIfMatch)
+		ifNoneMatch := ctx.Get(gear.HeaderIfNoneMatch)
+		ifUnmodifiedSince := ctx.Get(gear.HeaderIfUnmodifiedSince)
+		if ifMatch == "" && ifNoneMatch == "" && ifUnmodifiedSince == "" {
+			if opts.Optional {
+				return nil
+			}
+			return &gear.Error{Code: http.StatusPreconditionRequired,
+				Msg: "If-Match or If-Unmodified-Since header required"}
+		}
+
+		state, err := opts.State(ctx)
+		if err != nil {
+			return err
+		}
+		if !check(state, ifMatch, ifNoneMatch, ifUnmodifiedSince) {
+			return &gear.Error{Code: http.StatusPreconditionFailed,
+				Msg: "the resource has been modified"}
+		}
+		if state != nil {
+			ctx.SetAny(ctxKey{}, state)
+		}
+		return nil
+	}
+}
+
+// check evaluates the preconditions in the order of RFC 9110 Section 13.2.2.
+func check(state *State, ifMatch, ifNoneMatch, ifUnmodifiedSince string) bool {
+	if ifMatch != "" {
+		if state == nil {
+			return false
+		}
+		if strings.TrimSpace(ifMatch) != "*" && !matchStrong(ifMatch, state.ETag) {
+			return false
+		}
+	} else if ifUnmodifiedSince != "" && state != nil && !state.LastModified.IsZero() {
+		// an invalid date is ignored
+		if since, err := http.ParseTime(ifUnmodifiedSince); err == nil &&
+			state.LastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+	if ifNoneMatch != "" && state != nil {
+		if strings.TrimSpace(ifNoneMatch) == "*" || matchWeak(ifNoneMatch, state.ETag) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchStrong checks the ETag against the comma-separated list with strong comparison,
+// the weak ETags never match.
+func matchStrong(list, etag string) bool {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(list, ",") {
+		if strings.TrimSpace(tag) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWeak checks the ETag against the comma-separated list with weak comparison.
+func matchWeak(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
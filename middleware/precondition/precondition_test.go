@@ -0,0 +1,148 @@
+package precondition
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func TestGearMiddlewarePrecondition(t *testing.T) {
+	assert.Panics(t, func() {
+		New(Options{})
+	})
+
+	modified := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	docs := map[string]*State{
+		"1": {ETag: `"v1"`, LastModified: modified},
+		"2": {ETag: `W/"v2"`},
+	}
+	mw := New(Options{
+		State: func(ctx *gear.Context) (*State, error) {
+			if ctx.Param("id") == "err" {
+				return nil, errors.New("database down")
+			}
+			return docs[ctx.Param("id")], nil
+		},
+	})
+
+	app := gear.New()
+	router := gear.NewRouter()
+	handler := func(ctx *gear.Context) error {
+		etag := ""
+		if s := FromCtx(ctx); s != nil {
+			etag = s.ETag
+		}
+		return ctx.HTML(200, etag)
+	}
+	router.Get("/docs/:id", mw, handler)
+	router.Put("/docs/:id", mw, handler)
+	router.Delete("/docs/:id", mw, handler)
+	app.UseHandler(router)
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	request := func(method, id string, header map[string]string) *http.Response {
+		req, _ := http.NewRequest(method, host+"/docs/"+id, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("should not check read methods", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(200, request("GET", "1", nil).StatusCode)
+	})
+
+	t.Run("should respond 428 without preconditions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(428, request("PUT", "1", nil).StatusCode)
+		assert.Equal(428, request("DELETE", "1", nil).StatusCode)
+	})
+
+	t.Run("should check If-Match", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(200, request("PUT", "1", map[string]string{gear.HeaderIfMatch: `"v0", "v1"`}).StatusCode)
+		assert.Equal(200, request("PUT", "1", map[string]string{gear.HeaderIfMatch: `*`}).StatusCode)
+
+		assert.Equal(412, request("PUT", "1", map[string]string{gear.HeaderIfMatch: `"v0"`}).StatusCode)
+
+		// weak ETags never match
+		assert.Equal(412, request("PUT", "2", map[string]string{gear.HeaderIfMatch: `W/"v2"`}).StatusCode)
+		assert.Equal(412, request("PUT", "1", map[string]string{gear.HeaderIfMatch: `W/"v1"`}).StatusCode)
+		// not exists
+		assert.Equal(412, request("PUT", "3", map[string]string{gear.HeaderIfMatch: `*`}).StatusCode)
+		assert.Equal(500, request("PUT", "err", map[string]string{gear.HeaderIfMatch: `*`}).StatusCode)
+	})
+
+	t.Run("should check If-Unmodified-Since", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(200, request("PUT", "1", map[string]string{
+			gear.HeaderIfUnmodifiedSince: modified.Format(http.TimeFormat),
+		}).StatusCode)
+		assert.Equal(412, request("PUT", "1", map[string]string{
+			gear.HeaderIfUnmodifiedSince: modified.Add(-time.Second).Format(http.TimeFormat),
+		}).StatusCode)
+		// ignored when If-Match present
+		assert.Equal(200, request("PUT", "1", map[string]string{
+			gear.HeaderIfMatch:           `"v1"`,
+			gear.HeaderIfUnmodifiedSince: modified.Add(-time.Second).Format(http.TimeFormat),
+		}).StatusCode)
+		// invalid date is ignored
+		assert.Equal(200, request("PUT", "1", map[string]string{gear.HeaderIfUnmodifiedSince: "yesterday"}).StatusCode)
+	})
+
+	t.Run("should check If-None-Match: * to create", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(200, request("PUT", "3", map[string]string{gear.HeaderIfNoneMatch: "*"}).StatusCode)
+		assert.Equal(412, request("PUT", "1", map[string]string{gear.HeaderIfNoneMatch: "*"}).StatusCode)
+	})
+
+	t.Run("Optional", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{
+			Optional: true,
+			Methods:  []string{"post"},
+			State: func(ctx *gear.Context) (*State, error) {
+				return &State{ETag: `"v1"`}, nil
+			},
+		}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.End(204)
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		req, _ := http.NewRequest("POST", "http://"+srv.Addr().String(), nil)
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(204, res.StatusCode)
+		res.Body.Close()
+
+		req, _ = http.NewRequest("POST", "http://"+srv.Addr().String(), nil)
+		req.Header.Set(gear.HeaderIfMatch, `"v2"`)
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(412, res.StatusCode)
+		res.Body.Close()
+	})
+}
@@ -0,0 +1,457 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Affinity defines how the proxy pins a client to a backend.
+type Affinity int
+
+// Affinity modes
+const (
+	// AffinityNone balances the requests by round robin.
+	AffinityNone Affinity = iota
+	// AffinityHash pins the client to a backend by consistent hashing of the HashKey,
+	// only the clients of an ejected backend are moved to the other backends.
+	AffinityHash
+	// AffinityCookie pins the client to a backend by a cookie, the client is assigned
+	// to another backend by round robin when the backend is ejected.
+	AffinityCookie
+)
+
+// HealthCheck is the active health check options.
+type HealthCheck struct {
+	// Path defines the path to check, such as "/health". The backend is healthy if it responds
+	// 2xx or 3xx status. The health check is disabled if it is empty.
+	Path string
+	// Interval defines the interval between checks, default to 10 seconds.
+	Interval time.Duration
+	// Timeout defines the timeout of a check, default to 2 seconds.
+	Timeout time.Duration
+}
+
+// Options is proxy middleware options.
+type Options struct {
+	// Targets defines the backend URLs, such as "http://10.0.0.1:8080".
+	// One of Targets or Resolver is required.
+	Targets []string
+	// Resolver resolves the backend URLs dynamically, they are refreshed every RefreshInterval.
+	// If the resolving failed or resolved nothing, the previous backends are kept.
+	Resolver Resolver
+	// RefreshInterval defines the interval to refresh the backends by Resolver, default to 30 seconds.
+	RefreshInterval time.Duration
+	// DrainTimeout defines the maximum time to wait for the in-flight requests of a removed
+	// backend to finish before closing its idle connections, default to 30 seconds.
+	DrainTimeout time.Duration
+	// Affinity defines the session affinity mode, default to AffinityNone.
+	Affinity Affinity
+	// HashKey returns the key for AffinityHash, default to the client IP, that is the peer IP of
+	// the connection, see TrustedProxies.
+	HashKey func(ctx *gear.Context) string
+	// TrustedProxies defines the IPs or CIDRs of the reverse proxies in front of the app for
+	// the default HashKey, the client IP is read from the X-Forwarded-For or X-Real-IP header
+	// only when the request comes from them, see gear.Context.ClientIP. Default to none, the
+	// forwarding headers are ignored since they can be forged by any client.
+	TrustedProxies []string
+	// Cookie defines the cookie name for AffinityCookie, default to "gear_backend".
+	Cookie string
+	// HealthCheck defines the active health check. When it is enabled, a backend is also
+	// ejected when the proxying to it failed, until it passes the next check. The failures
+	// caused by the clients, such as the canceled requests, don't eject the backend.
+	HealthCheck HealthCheck
+	// Transport defines the transport to the backends, default to http.DefaultTransport.
+	// An *http.Transport is cloned for each backend, so that the idle connections of a removed
+	// backend can be closed without affecting the other backends and the other users of it.
+	Transport http.RoundTripper
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+type backend struct {
+	id       string
+	url      *url.URL
+	proxy    *httputil.ReverseProxy
+	idle     interface{ CloseIdleConnections() } // the backend's own transport, nil if shared
+	healthy  int32
+	inflight int64
+}
+
+func (b *backend) isHealthy() bool {
+	return atomic.LoadInt32(&b.healthy) == 1
+}
+
+func (b *backend) setHealthy(ok bool) {
+	val := int32(0)
+	if ok {
+		val = 1
+	}
+	atomic.StoreInt32(&b.healthy, val)
+}
+
+// Proxy is a load balancing reverse proxy middleware with session affinity and health checks.
+//
+//  p := proxy.New(proxy.Options{
+//  	Targets:     []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+//  	Affinity:    proxy.AffinityCookie,
+//  	HealthCheck: proxy.HealthCheck{Path: "/health"},
+//  })
+//  defer p.Close()
+//
+//  app := gear.New()
+//  app.UseHandler(p)
+//
+type Proxy struct {
+	opts     Options
+	mu       sync.RWMutex
+	backends []*backend
+	ring     []ringNode
+	next     uint32
+	done     chan struct{}
+	client   *http.Client
+}
+
+type ringNode struct {
+	hash    uint32
+	backend *backend
+}
+
+// number of virtual nodes of a backend on the hash ring.
+const replicas = 100
+
+// New creates a Proxy instance with options.
+func New(opts Options) *Proxy {
+	if len(opts.Targets) == 0 && opts.Resolver == nil {
+		panic(gear.NewAppError("proxy targets or resolver required"))
+	}
+	if opts.HashKey == nil {
+		proxies := gear.NewTrustedProxies(opts.TrustedProxies...)
+		opts.HashKey = func(ctx *gear.Context) string {
+			if ip := ctx.ClientIP(proxies); ip != nil {
+				return ip.String()
+			}
+			// the peer host without the port, so that the key is not per connection
+			if host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr); err == nil {
+				return host
+			}
+			return ctx.Req.RemoteAddr
+		}
+	}
+	if opts.Cookie == "" {
+		opts.Cookie = "gear_backend"
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	if opts.HealthCheck.Interval <= 0 {
+		opts.HealthCheck.Interval = 10 * time.Second
+	}
+	if opts.HealthCheck.Timeout <= 0 {
+		opts.HealthCheck.Timeout = 2 * time.Second
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = 30 * time.Second
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = 30 * time.Second
+	}
+
+	p := &Proxy{
+		opts:   opts,
+		done:   make(chan struct{}),
+		client: &http.Client{Transport: opts.Transport, Timeout: opts.HealthCheck.Timeout},
+	}
+	if len(opts.Targets) > 0 {
+		if err := p.setTargets(opts.Targets); err != nil {
+			panic(gear.NewAppError(err.Error()))
+		}
+	}
+	if opts.Resolver != nil {
+		if err := p.Refresh(); err != nil && len(opts.Targets) == 0 {
+			panic(gear.NewAppError(err.Error()))
+		}
+		go p.refreshLoop()
+	}
+	if opts.HealthCheck.Path != "" {
+		p.check()
+		go p.checkLoop()
+	}
+	return p
+}
+
+func parseTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy target: %s", target)
+	}
+	return u, nil
+}
+
+func (p *Proxy) newBackend(u *url.URL) *backend {
+	b := &backend{
+		id:      strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(u.String()))), 36),
+		url:     u,
+		proxy:   httputil.NewSingleHostReverseProxy(u),
+		healthy: 1,
+	}
+	b.proxy.Transport = p.opts.Transport
+	if t, ok := p.opts.Transport.(*http.Transport); ok {
+		t = t.Clone()
+		b.proxy.Transport, b.idle = t, t
+	}
+	b.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// the client aborted or timed out, the backend may be healthy
+		clientErr := r.Context().Err() != nil || errors.Is(err, context.Canceled)
+		if p.opts.HealthCheck.Path != "" && !clientErr {
+			b.setHealthy(false)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return b
+}
+
+// setTargets replaces the backends and rebuilds the hash ring, the existing backends are kept
+// with their health states, the removed backends are drained.
+func (p *Proxy) setTargets(targets []string) error {
+	p.mu.RLock()
+	existing := make(map[string]*backend, len(p.backends))
+	for _, b := range p.backends {
+		existing[b.url.String()] = b
+	}
+	p.mu.RUnlock()
+
+	backends := make([]*backend, 0, len(targets))
+	for _, target := range targets {
+		u, err := parseTarget(target)
+		if err != nil {
+			return err
+		}
+		b, ok := existing[u.String()]
+		if ok {
+			delete(existing, u.String())
+		} else {
+			b = p.newBackend(u)
+		}
+		backends = append(backends, b)
+	}
+	ring := make([]ringNode, 0, len(backends)*replicas)
+	for _, b := range backends {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + b.url.String()))
+			ring = append(ring, ringNode{h, b})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	p.mu.Lock()
+	p.backends, p.ring = backends, ring
+	p.mu.Unlock()
+
+	for _, b := range existing {
+		go p.drain(b)
+	}
+	return nil
+}
+
+// Refresh resolves the backends by Resolver immediately.
+func (p *Proxy) Refresh() error {
+	if p.opts.Resolver == nil {
+		return nil
+	}
+	targets, err := p.opts.Resolver.Resolve()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("no proxy targets resolved")
+	}
+	return p.setTargets(targets)
+}
+
+func (p *Proxy) refreshLoop() {
+	ticker := time.NewTicker(p.opts.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.Refresh()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// drain waits for the in-flight requests of the removed backend to finish,
+// and then closes the idle connections of the backend's own transport.
+func (p *Proxy) drain(b *backend) {
+	deadline := time.Now().Add(p.opts.DrainTimeout)
+	for atomic.LoadInt64(&b.inflight) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if b.idle != nil {
+		b.idle.CloseIdleConnections()
+	}
+}
+
+// Healthy returns the URLs of the healthy backends.
+func (p *Proxy) Healthy() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var res []string
+	for _, b := range p.backends {
+		if b.isHealthy() {
+			res = append(res, b.url.String())
+		}
+	}
+	return res
+}
+
+// Close stops the health check and the refreshing.
+func (p *Proxy) Close() {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+}
+
+// Serve implements gear.Handler interface.
+func (p *Proxy) Serve(ctx *gear.Context) error {
+	if p.opts.Skipper != nil && p.opts.Skipper(ctx) {
+		return nil
+	}
+	b := p.pick(ctx)
+	if b == nil {
+		return &gear.Error{Code: http.StatusServiceUnavailable, Msg: "no healthy upstream"}
+	}
+	defer atomic.AddInt64(&b.inflight, -1)
+	b.proxy.ServeHTTP(ctx.Res, ctx.IntoRequest())
+	return nil
+}
+
+// pick picks a backend for the request and counts it in flight under the lock, so that a
+// removed backend is not drained before the requests picked it.
+func (p *Proxy) pick(ctx *gear.Context) *backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	b := p.pickLocked(ctx)
+	if b != nil {
+		atomic.AddInt64(&b.inflight, 1)
+	}
+	return b
+}
+
+func (p *Proxy) pickLocked(ctx *gear.Context) *backend {
+	switch p.opts.Affinity {
+	case AffinityHash:
+		return p.pickByHash(crc32.ChecksumIEEE([]byte(p.opts.HashKey(ctx))))
+	case AffinityCookie:
+		if c, err := ctx.Req.Cookie(p.opts.Cookie); err == nil {
+			for _, b := range p.backends {
+				if b.id == c.Value && b.isHealthy() {
+					return b
+				}
+			}
+		}
+		b := p.pickRoundRobin()
+		if b != nil {
+			http.SetCookie(ctx.Res, &http.Cookie{Name: p.opts.Cookie, Value: b.id, Path: "/", HttpOnly: true})
+		}
+		return b
+	default:
+		return p.pickRoundRobin()
+	}
+}
+
+// pickByHash returns the first healthy backend clockwise on the ring.
+func (p *Proxy) pickByHash(h uint32) *backend {
+	n := len(p.ring)
+	i := sort.Search(n, func(i int) bool { return p.ring[i].hash >= h })
+	for j := 0; j < n; j++ {
+		if b := p.ring[(i+j)%n].backend; b.isHealthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) pickRoundRobin() *backend {
+	n := len(p.backends)
+	start := int(atomic.AddUint32(&p.next, 1))
+	for j := 0; j < n; j++ {
+		if b := p.backends[(start+j)%n]; b.isHealthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) checkLoop() {
+	ticker := time.NewTicker(p.opts.HealthCheck.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.check()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// check checks all backends concurrently.
+func (p *Proxy) check() {
+	p.mu.RLock()
+	backends := p.backends
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, b := range backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			b.setHealthy(p.checkBackend(b) == nil)
+		}(b)
+	}
+	wg.Wait()
+}
+
+func (p *Proxy) checkBackend(b *backend) error {
+	u := *b.url
+	u.Path = singleJoiningSlash(u.Path, p.opts.HealthCheck.Path)
+	res, err := p.client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("health check failed with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case a[len(a)-1] == '/' && len(b) > 0 && b[0] == '/':
+		return a + b[1:]
+	case a[len(a)-1] != '/' && (len(b) == 0 || b[0] != '/'):
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,288 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+type testBackend struct {
+	*gear.ServerListener
+	name string
+	down int32
+}
+
+func (b *testBackend) URL() string {
+	return "http://" + b.Addr().String()
+}
+
+func newBackend(name string) *testBackend {
+	b := &testBackend{name: name}
+	app := gear.New()
+	app.Use(func(ctx *gear.Context) error {
+		if ctx.Path == "/health" && atomic.LoadInt32(&b.down) == 1 {
+			return ctx.End(503)
+		}
+		return ctx.HTML(200, name)
+	})
+	b.ServerListener = app.Start()
+	return b
+}
+
+func newApp(p *Proxy) *gear.ServerListener {
+	app := gear.New()
+	app.UseHandler(p)
+	return app.Start()
+}
+
+func request(url string, header map[string]string, cookies ...*http.Cookie) (string, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res
+}
+
+func waitFor(fn func() bool) {
+	for i := 0; i < 100 && !fn(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGearMiddlewareProxy(t *testing.T) {
+	a, b, c := newBackend("a"), newBackend("b"), newBackend("c")
+	defer a.Close()
+	defer b.Close()
+	defer c.Close()
+	targets := []string{a.URL(), b.URL(), c.URL()}
+
+	t.Run("Should balance by round robin", func(t *testing.T) {
+		assert := assert.New(t)
+
+		p := New(Options{Targets: targets})
+		defer p.Close()
+		srv := newApp(p)
+		defer srv.Close()
+
+		counts := map[string]int{}
+		for i := 0; i < 6; i++ {
+			body, _ := request("http://"+srv.Addr().String(), nil)
+			counts[body]++
+		}
+		assert.Equal(map[string]int{"a": 2, "b": 2, "c": 2}, counts)
+	})
+
+	t.Run("Should pin by consistent hash with failover", func(t *testing.T) {
+		assert := assert.New(t)
+
+		p := New(Options{
+			Targets:     targets,
+			Affinity:    AffinityHash,
+			HashKey:     func(ctx *gear.Context) string { return ctx.Get("X-User") },
+			HealthCheck: HealthCheck{Path: "/health", Interval: 10 * time.Millisecond},
+		})
+		defer p.Close()
+		srv := newApp(p)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		pinned := map[string]string{}
+		for i := 0; i < 30; i++ {
+			user := strconv.Itoa(i)
+			body, _ := request(url, map[string]string{"X-User": user})
+			again, _ := request(url, map[string]string{"X-User": user})
+			assert.Equal(body, again)
+			pinned[user] = body
+		}
+
+		atomic.StoreInt32(&b.down, 1)
+		waitFor(func() bool { return len(p.Healthy()) == 2 })
+		assert.Equal([]string{a.URL(), c.URL()}, p.Healthy())
+		for user, name := range pinned {
+			body, _ := request(url, map[string]string{"X-User": user})
+			if name == "b" {
+				assert.NotEqual("b", body)
+			} else {
+				assert.Equal(name, body) // not moved
+			}
+		}
+
+		atomic.StoreInt32(&b.down, 0)
+		waitFor(func() bool { return len(p.Healthy()) == 3 })
+		for user, name := range pinned {
+			body, _ := request(url, map[string]string{"X-User": user})
+			assert.Equal(name, body)
+		}
+	})
+
+	t.Run("Should pin by cookie with failover", func(t *testing.T) {
+		assert := assert.New(t)
+
+		p := New(Options{
+			Targets:     targets,
+			Affinity:    AffinityCookie,
+			HealthCheck: HealthCheck{Path: "/health", Interval: 10 * time.Millisecond},
+		})
+		defer p.Close()
+		srv := newApp(p)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		body, res := request(url, nil)
+		cookies := res.Cookies()
+		assert.Equal(1, len(cookies))
+		assert.Equal("gear_backend", cookies[0].Name)
+		for i := 0; i < 5; i++ {
+			again, res := request(url, nil, cookies[0])
+			assert.Equal(body, again)
+			assert.Equal(0, len(res.Cookies()))
+		}
+
+		backend := map[string]*testBackend{"a": a, "b": b, "c": c}[body]
+		atomic.StoreInt32(&backend.down, 1)
+		defer atomic.StoreInt32(&backend.down, 0)
+		waitFor(func() bool { return len(p.Healthy()) == 2 })
+		moved, res := request(url, nil, cookies[0])
+		assert.NotEqual(body, moved)
+		assert.Equal(1, len(res.Cookies()))
+	})
+
+	t.Run("Should eject failed backend", func(t *testing.T) {
+		assert := assert.New(t)
+
+		d := newBackend("d")
+		p := New(Options{
+			Targets:     []string{d.URL()},
+			HealthCheck: HealthCheck{Path: "/health", Interval: time.Hour},
+			// the closed listener keeps the alive connections
+			Transport: &http.Transport{DisableKeepAlives: true},
+		})
+		defer p.Close()
+		srv := newApp(p)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		body, _ := request(url, nil)
+		assert.Equal("d", body)
+		d.Close()
+		_, res := request(url, nil)
+		assert.Equal(http.StatusBadGateway, res.StatusCode)
+		_, res = request(url, nil)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(0, len(p.Healthy()))
+
+		assert.Panics(func() {
+			New(Options{})
+		})
+		assert.Panics(func() {
+			New(Options{Targets: []string{"backend"}})
+		})
+	})
+
+	t.Run("Should hash the peer IP by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		p := New(Options{Targets: targets, Affinity: AffinityHash})
+		defer p.Close()
+		srv := newApp(p)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		pinned, _ := request(url, nil)
+		for i := 0; i < 10; i++ {
+			// the forged headers and the new connections don't move the client
+			body, _ := request(url, map[string]string{gear.HeaderXForwardedFor: strconv.Itoa(i) + ".1.1.1", "Connection": "close"})
+			assert.Equal(pinned, body)
+		}
+	})
+
+	t.Run("Should not eject the backend for the canceled requests", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(func(ctx *gear.Context) error {
+			if ctx.Path != "/health" {
+				time.Sleep(200 * time.Millisecond)
+			}
+			return ctx.HTML(200, "slow")
+		})
+		slow := app.Start()
+		defer slow.Close()
+
+		p := New(Options{
+			Targets:     []string{"http://" + slow.Addr().String()},
+			HealthCheck: HealthCheck{Path: "/health", Interval: time.Hour},
+		})
+		defer p.Close()
+		srv := newApp(p)
+		defer srv.Close()
+
+		cli := &http.Client{Timeout: 50 * time.Millisecond}
+		_, err := cli.Get("http://" + srv.Addr().String())
+		assert.NotNil(err)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(1, len(p.Healthy()))
+	})
+
+	t.Run("Should count the picked backend in flight", func(t *testing.T) {
+		assert := assert.New(t)
+
+		p := New(Options{Targets: []string{a.URL()}})
+		defer p.Close()
+		bk := p.pick(gear.NewContext(gear.New(), nil, httptest.NewRequest("GET", "http://example.com", nil)))
+		assert.Equal(int64(1), atomic.LoadInt64(&bk.inflight))
+
+		idle := bk.idle
+		assert.Nil(p.setTargets([]string{a.URL(), b.URL()}))
+		assert.True(p.backends[0] == bk)
+		assert.True(p.backends[0].idle == idle)
+	})
+
+	t.Run("Should close the idle connections of the drained backend only", func(t *testing.T) {
+		assert := assert.New(t)
+
+		shared := &countingTransport{RoundTripper: http.DefaultTransport}
+		p := New(Options{Targets: []string{a.URL(), b.URL()}, Transport: shared, DrainTimeout: time.Millisecond})
+		defer p.Close()
+		assert.Nil(p.setTargets([]string{a.URL()}))
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(int32(0), atomic.LoadInt32(&shared.closed))
+
+		transport := &http.Transport{}
+		p = New(Options{Targets: []string{a.URL(), b.URL()}, Transport: transport})
+		defer p.Close()
+		for _, bk := range p.backends {
+			assert.NotNil(bk.idle)
+			assert.False(bk.idle == transport)
+			assert.True(bk.proxy.Transport.(*http.Transport) == bk.idle)
+		}
+		assert.False(p.backends[0].idle == p.backends[1].idle)
+	})
+}
+
+type countingTransport struct {
+	http.RoundTripper
+	closed int32
+}
+
+func (t *countingTransport) CloseIdleConnections() {
+	atomic.AddInt32(&t.closed, 1)
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolver resolves the backend URLs dynamically for Proxy.
+type Resolver interface {
+	Resolve() ([]string, error)
+}
+
+// ResolverFunc is an adapter to use a function as Resolver.
+type ResolverFunc func() ([]string, error)
+
+// Resolve implemented Resolver interface.
+func (fn ResolverFunc) Resolve() ([]string, error) {
+	return fn()
+}
+
+// FileResolver returns a Resolver that reads the backend URLs from a file, one URL per line.
+// The empty lines and the lines starting with "#" are ignored.
+func FileResolver(file string) Resolver {
+	return ResolverFunc(func() ([]string, error) {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var targets []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && line[0] != '#' {
+				targets = append(targets, line)
+			}
+		}
+		return targets, scanner.Err()
+	})
+}
+
+// lookupSRV is used by SRVResolver, it can be replaced in testing.
+var lookupSRV = net.LookupSRV
+
+// SRVResolver returns a Resolver that resolves the backend URLs by DNS SRV records,
+// the URLs are built with the scheme, the targets and the ports of the records.
+//
+//  // _http._tcp.api.service.consul
+//  proxy.SRVResolver("http", "tcp", "api.service.consul", "http")
+//
+func SRVResolver(service, proto, name, scheme string) Resolver {
+	return ResolverFunc(func() ([]string, error) {
+		_, addrs, err := lookupSRV(service, proto, name)
+		if err != nil {
+			return nil, err
+		}
+		targets := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			host := strings.TrimSuffix(addr.Target, ".")
+			targets = append(targets, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(addr.Port))))
+		}
+		return targets, nil
+	})
+}
+
+// ConsulResolver returns a Resolver that resolves the backend URLs of the passing instances
+// of the service by the Consul HTTP API, such as "http://127.0.0.1:8500".
+// The URLs are built with the scheme, the service addresses (or the node addresses if empty)
+// and the service ports.
+func ConsulResolver(consulAddr, service, scheme string) Resolver {
+	client := &http.Client{Timeout: 5 * time.Second}
+	api := strings.TrimSuffix(consulAddr, "/") + "/v1/health/service/" + url.PathEscape(service) + "?passing=1"
+	return ResolverFunc(func() ([]string, error) {
+		res, err := client.Get(api)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("consul responded status %d", res.StatusCode)
+		}
+
+		var entries []struct {
+			Node struct {
+				Address string
+			}
+			Service struct {
+				Address string
+				Port    int
+			}
+		}
+		if err = json.NewDecoder(res.Body).Decode(&entries); err != nil {
+			return nil, err
+		}
+		targets := make([]string, 0, len(entries))
+		for _, e := range entries {
+			host := e.Service.Address
+			if host == "" {
+				host = e.Node.Address
+			}
+			targets = append(targets, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+		}
+		return targets, nil
+	})
+}
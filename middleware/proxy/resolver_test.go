@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+func TestGearMiddlewareProxyResolver(t *testing.T) {
+	t.Run("FileResolver", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "gear-proxy")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "targets")
+		ioutil.WriteFile(file, []byte("# backends\nhttp://10.0.0.1:80\n\n  http://10.0.0.2:80  \n"), 0644)
+
+		targets, err := FileResolver(file).Resolve()
+		assert.Nil(err)
+		assert.Equal([]string{"http://10.0.0.1:80", "http://10.0.0.2:80"}, targets)
+
+		_, err = FileResolver(filepath.Join(dir, "none")).Resolve()
+		assert.NotNil(err)
+	})
+
+	t.Run("SRVResolver", func(t *testing.T) {
+		assert := assert.New(t)
+
+		defer func() { lookupSRV = net.LookupSRV }()
+		lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+			assert.Equal("http", service)
+			assert.Equal("tcp", proto)
+			assert.Equal("api.service.consul", name)
+			return "", []*net.SRV{{Target: "node1.consul.", Port: 8080}, {Target: "10.0.0.2", Port: 80}}, nil
+		}
+		targets, err := SRVResolver("http", "tcp", "api.service.consul", "http").Resolve()
+		assert.Nil(err)
+		assert.Equal([]string{"http://node1.consul:8080", "http://10.0.0.2:80"}, targets)
+
+		lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+			return "", nil, errors.New("lookup error")
+		}
+		_, err = SRVResolver("http", "tcp", "api.service.consul", "http").Resolve()
+		assert.NotNil(err)
+	})
+
+	t.Run("ConsulResolver", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(func(ctx *gear.Context) error {
+			if ctx.Path != "/v1/health/service/api" || ctx.Query("passing") != "1" {
+				return ctx.End(404)
+			}
+			return ctx.JSON(200, []interface{}{
+				map[string]interface{}{
+					"Node":    map[string]interface{}{"Address": "10.0.0.1"},
+					"Service": map[string]interface{}{"Address": "", "Port": 8080},
+				},
+				map[string]interface{}{
+					"Node":    map[string]interface{}{"Address": "10.0.0.2"},
+					"Service": map[string]interface{}{"Address": "172.16.0.2", "Port": 8081},
+				},
+			})
+		})
+		srv := app.Start()
+		defer srv.Close()
+		consul := "http://" + srv.Addr().String()
+
+		targets, err := ConsulResolver(consul, "api", "http").Resolve()
+		assert.Nil(err)
+		assert.Equal([]string{"http://10.0.0.1:8080", "http://172.16.0.2:8081"}, targets)
+
+		_, err = ConsulResolver(consul, "none", "http").Resolve()
+		assert.Equal("consul responded status 404", err.Error())
+		_, err = ConsulResolver("http://127.0.0.1:1", "api", "http").Resolve()
+		assert.NotNil(err)
+	})
+
+	t.Run("Should refresh backends and drain removed ones", func(t *testing.T) {
+		assert := assert.New(t)
+
+		release := make(chan struct{})
+		a := newBackend("a")
+		defer a.Close()
+		slowApp := gear.New()
+		slowApp.Use(func(ctx *gear.Context) error {
+			<-release
+			return ctx.HTML(200, "slow")
+		})
+		slow := slowApp.Start()
+		defer slow.Close()
+		slowURL := "http://" + slow.Addr().String()
+
+		var mu sync.Mutex
+		targets := []string{slowURL}
+		var resolveErr error
+		p := New(Options{
+			Resolver: ResolverFunc(func() ([]string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return targets, resolveErr
+			}),
+			RefreshInterval: 10 * time.Millisecond,
+		})
+		defer p.Close()
+		srv := newApp(p)
+		defer srv.Close()
+		url := "http://" + srv.Addr().String()
+
+		done := make(chan string)
+		go func() {
+			body, _ := request(url, nil)
+			done <- body
+		}()
+		waitFor(func() bool {
+			p.mu.RLock()
+			defer p.mu.RUnlock()
+			return atomic.LoadInt64(&p.backends[0].inflight) == 1
+		})
+
+		mu.Lock()
+		targets = []string{a.URL()}
+		mu.Unlock()
+		waitFor(func() bool { return p.Healthy()[0] == a.URL() })
+		body, _ := request(url, nil)
+		assert.Equal("a", body)
+
+		// the in-flight request to the removed backend is not broken
+		close(release)
+		assert.Equal("slow", <-done)
+
+		mu.Lock()
+		targets, resolveErr = nil, errors.New("resolve error")
+		mu.Unlock()
+		assert.NotNil(p.Refresh())
+		mu.Lock()
+		resolveErr = nil
+		mu.Unlock()
+		assert.Equal("no proxy targets resolved", p.Refresh().Error())
+		assert.Equal([]string{a.URL()}, p.Healthy())
+
+		mu.Lock()
+		targets = []string{"backend"}
+		mu.Unlock()
+		assert.NotNil(p.Refresh())
+		assert.Equal([]string{a.URL()}, p.Healthy())
+
+		assert.Panics(func() {
+			New(Options{Resolver: ResolverFunc(func() ([]string, error) {
+				return nil, errors.New("resolve error")
+			})})
+		})
+	})
+}
@@ -0,0 +1,217 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// NewTokenBucket creates a token bucket Algorithm, the bucket of a key holds up to burst tokens
+// and is refilled by rate tokens per period, a request takes a token. It allows bursts of up to
+// burst requests and then rate requests per period on average. The burst default to rate.
+//
+//  ratelimit.NewTokenBucket(10, time.Second, 50) // 10 requests per second, bursts of 50
+//
+func NewTokenBucket(rate int, per time.Duration, burst int) Algorithm {
+	interval := checkRate(rate, per)
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{keyed: newKeyed(per), interval: interval, burst: burst}
+}
+
+// NewSlidingWindow creates a sliding window Algorithm, it allows up to limit requests of a key
+// in any window of the duration. It is exact without the boundary bursts of the fixed window,
+// but it keeps the timestamps of the requests in the window, so it fits the small limits,
+// such as 10 requests per minute.
+//
+//  ratelimit.NewSlidingWindow(10, time.Minute)
+//
+func NewSlidingWindow(limit int, window time.Duration) Algorithm {
+	checkRate(limit, window)
+	return &slidingWindow{keyed: newKeyed(window), limit: limit, window: window}
+}
+
+// NewGCRA creates a GCRA (generic cell rate algorithm) Algorithm, it spaces the requests of
+// a key evenly at rate per period, and tolerates bursts of up to burst requests. It behaves
+// like the token bucket with only a timestamp stored per key. The burst default to 1, means
+// no burst.
+//
+//  ratelimit.NewGCRA(100, time.Minute, 10) // 100 requests per minute, bursts of 10
+//
+func NewGCRA(rate int, per time.Duration, burst int) Algorithm {
+	interval := checkRate(rate, per)
+	if burst <= 0 {
+		burst = 1
+	}
+	return &gcra{keyed: newKeyed(per), interval: interval, burst: burst}
+}
+
+func checkRate(rate int, per time.Duration) time.Duration {
+	if rate <= 0 || per <= 0 || per/time.Duration(rate) <= 0 {
+		panic(gear.NewAppError("ratelimit rate and period must be positive"))
+	}
+	return per / time.Duration(rate)
+}
+
+// state is the rate limiting state of a key.
+type state interface {
+	// restoredAt returns the time the quota is fully restored, the state can be dropped after it.
+	restoredAt() time.Time
+}
+
+// keyed holds the states by key, the restored states are swept periodically.
+type keyed struct {
+	mu      sync.Mutex
+	states  map[string]state
+	every   time.Duration
+	sweepAt time.Time
+}
+
+func newKeyed(every time.Duration) keyed {
+	return keyed{states: make(map[string]state), every: every}
+}
+
+// sweep should be called with the lock held.
+func (k *keyed) sweep(now time.Time) {
+	if now.Before(k.sweepAt) {
+		return
+	}
+	k.sweepAt = now.Add(k.every)
+	for key, s := range k.states {
+		if !now.Before(s.restoredAt()) {
+			delete(k.states, key)
+		}
+	}
+}
+
+type tokenBucket struct {
+	keyed
+	interval time.Duration // the time to refill a token
+	burst    int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+func (b *bucket) restoredAt() time.Time {
+	return b.full
+}
+
+func (tb *tokenBucket) Allow(key string, now time.Time) (bool, gear.RateLimit) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.sweep(now)
+
+	b, _ := tb.states[key].(*bucket)
+	if b == nil {
+		b = &bucket{tokens: float64(tb.burst), last: now}
+		tb.states[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(tb.burst), b.tokens+float64(elapsed)/float64(tb.interval))
+		b.last = now
+	}
+
+	rl := gear.RateLimit{Limit: tb.burst}
+	if b.tokens < 1 {
+		rl.Reset = time.Duration(math.Ceil((1 - b.tokens) * float64(tb.interval)))
+		return false, rl
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration(math.Ceil((float64(tb.burst) - b.tokens) * float64(tb.interval))))
+	rl.Remaining = int(b.tokens)
+	rl.Reset = b.full.Sub(now)
+	return true, rl
+}
+
+type slidingWindow struct {
+	keyed
+	limit  int
+	window time.Duration
+}
+
+type window struct {
+	times []time.Time // the times of the requests in the window, in order
+	ends  time.Time   // the last request leaves the window
+}
+
+func (w *window) restoredAt() time.Time {
+	return w.ends
+}
+
+func (sw *slidingWindow) Allow(key string, now time.Time) (bool, gear.RateLimit) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.sweep(now)
+
+	w, _ := sw.states[key].(*window)
+	if w == nil {
+		w = &window{}
+	}
+	start := now.Add(-sw.window)
+	i := 0
+	for i < len(w.times) && !w.times[i].After(start) {
+		i++
+	}
+	w.times = w.times[i:]
+
+	rl := gear.RateLimit{Limit: sw.limit}
+	if len(w.times) >= sw.limit {
+		rl.Reset = w.times[0].Sub(start)
+		return false, rl
+	}
+	w.times = append(w.times, now)
+	w.ends = now.Add(sw.window)
+	sw.states[key] = w
+	rl.Remaining = sw.limit - len(w.times)
+	rl.Reset = sw.window
+	return true, rl
+}
+
+type gcra struct {
+	keyed
+	interval time.Duration // the emission interval
+	burst    int
+}
+
+type arrival struct {
+	tat time.Time // the theoretical arrival time
+}
+
+func (a *arrival) restoredAt() time.Time {
+	return a.tat
+}
+
+func (g *gcra) Allow(key string, now time.Time) (bool, gear.RateLimit) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sweep(now)
+
+	a, _ := g.states[key].(*arrival)
+	if a == nil {
+		a = &arrival{tat: now}
+		g.states[key] = a
+	}
+	tat := a.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(g.interval)
+	allowAt := next.Add(-time.Duration(g.burst) * g.interval)
+
+	rl := gear.RateLimit{Limit: g.burst}
+	if now.Before(allowAt) {
+		rl.Reset = allowAt.Sub(now)
+		return false, rl
+	}
+	a.tat = next
+	rl.Remaining = int(now.Sub(allowAt) / g.interval)
+	rl.Reset = next.Sub(now)
+	return true, rl
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+func TestAlgorithms(t *testing.T) {
+	t0 := time.Unix(1600000000, 0)
+
+	t.Run("Should panic with invalid rate", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() { NewTokenBucket(0, time.Second, 1) })
+		assert.Panics(func() { NewSlidingWindow(1, 0) })
+		assert.Panics(func() { NewGCRA(10, time.Nanosecond, 1) })
+	})
+
+	t.Run("TokenBucket", func(t *testing.T) {
+		assert := assert.New(t)
+
+		alg := NewTokenBucket(10, time.Second, 3)
+		for i := 2; i >= 0; i-- {
+			ok, rl := alg.Allow("a", t0)
+			assert.True(ok)
+			assert.Equal(gear.RateLimit{Limit: 3, Remaining: i, Reset: time.Duration(3-i) * 100 * time.Millisecond}, rl)
+		}
+		ok, rl := alg.Allow("a", t0.Add(40*time.Millisecond))
+		assert.False(ok)
+		assert.Equal(gear.RateLimit{Limit: 3, Remaining: 0, Reset: 60 * time.Millisecond}, rl)
+
+		ok, _ = alg.Allow("b", t0.Add(40*time.Millisecond))
+		assert.True(ok)
+
+		ok, rl = alg.Allow("a", t0.Add(100*time.Millisecond))
+		assert.True(ok)
+		assert.Equal(0, rl.Remaining)
+		ok, _ = alg.Allow("a", t0.Add(150*time.Millisecond))
+		assert.False(ok)
+
+		// refilled up to burst
+		ok, rl = alg.Allow("a", t0.Add(time.Hour))
+		assert.True(ok)
+		assert.Equal(2, rl.Remaining)
+
+		// the restored states are swept
+		tb := alg.(*tokenBucket)
+		assert.Equal(1, len(tb.states))
+	})
+
+	t.Run("SlidingWindow", func(t *testing.T) {
+		assert := assert.New(t)
+
+		alg := NewSlidingWindow(3, time.Minute)
+		for i := 0; i < 3; i++ {
+			ok, rl := alg.Allow("a", t0.Add(time.Duration(i)*10*time.Second))
+			assert.True(ok)
+			assert.Equal(gear.RateLimit{Limit: 3, Remaining: 2 - i, Reset: time.Minute}, rl)
+		}
+		ok, rl := alg.Allow("a", t0.Add(55*time.Second))
+		assert.False(ok)
+		assert.Equal(gear.RateLimit{Limit: 3, Remaining: 0, Reset: 5 * time.Second}, rl)
+
+		// no boundary bursts: the window slides request by request
+		ok, rl = alg.Allow("a", t0.Add(60*time.Second))
+		assert.True(ok)
+		assert.Equal(0, rl.Remaining)
+		ok, rl = alg.Allow("a", t0.Add(65*time.Second))
+		assert.False(ok)
+		assert.Equal(5*time.Second, rl.Reset)
+
+		ok, rl = alg.Allow("a", t0.Add(5*time.Minute))
+		assert.True(ok)
+		assert.Equal(2, rl.Remaining)
+		sw := alg.(*slidingWindow)
+		assert.Equal(1, len(sw.states))
+	})
+
+	t.Run("GCRA", func(t *testing.T) {
+		assert := assert.New(t)
+
+		alg := NewGCRA(10, time.Second, 2)
+		ok, rl := alg.Allow("a", t0)
+		assert.True(ok)
+		assert.Equal(gear.RateLimit{Limit: 2, Remaining: 1, Reset: 100 * time.Millisecond}, rl)
+		ok, rl = alg.Allow("a", t0)
+		assert.True(ok)
+		assert.Equal(gear.RateLimit{Limit: 2, Remaining: 0, Reset: 200 * time.Millisecond}, rl)
+		ok, rl = alg.Allow("a", t0.Add(30*time.Millisecond))
+		assert.False(ok)
+		assert.Equal(gear.RateLimit{Limit: 2, Remaining: 0, Reset: 70 * time.Millisecond}, rl)
+
+		// spaced evenly after the burst
+		ok, _ = alg.Allow("a", t0.Add(100*time.Millisecond))
+		assert.True(ok)
+		ok, _ = alg.Allow("a", t0.Add(150*time.Millisecond))
+		assert.False(ok)
+		ok, _ = alg.Allow("a", t0.Add(200*time.Millisecond))
+		assert.True(ok)
+
+		ok, rl = NewGCRA(1, time.Second, 0).Allow("a", t0)
+		assert.True(ok)
+		assert.Equal(gear.RateLimit{Limit: 1, Remaining: 0, Reset: time.Second}, rl)
+
+		ok, _ = alg.Allow("b", t0.Add(time.Hour))
+		assert.True(ok)
+		g := alg.(*gcra)
+		assert.Equal(1, len(g.states))
+	})
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Algorithm is a rate limiting algorithm that keeps the state per key. Allow takes one request
+// of the key at the time now, it returns whether the request is allowed and the state after it.
+// The Reset of the state is the time until the quota is fully restored if allowed, or the time
+// until the next request can be allowed if not. It should be safe for concurrent use.
+type Algorithm interface {
+	Allow(key string, now time.Time) (bool, gear.RateLimit)
+}
+
+// ErrUnknownClient is responded when the client IP for the default Key can't be parsed.
+var ErrUnknownClient = &gear.Error{Code: http.StatusBadRequest, Msg: "unknown client IP"}
+
+// Options is ratelimit middleware options.
+type Options struct {
+	// Algorithm defines the rate limiting algorithm, such as NewTokenBucket, NewSlidingWindow
+	// or NewGCRA, required. The middlewares should not share an Algorithm unless they share
+	// the quota.
+	Algorithm Algorithm
+	// Key returns the key to limit the request, such as the user ID or the API token.
+	// Default to the client IP, that is the peer IP of the connection, see TrustedProxies.
+	// The requests with an unparseable client IP are responded with ErrUnknownClient.
+	Key func(ctx *gear.Context) string
+	// TrustedProxies defines the IPs or CIDRs of the reverse proxies in front of the app for
+	// the default Key, the client IP is read from the X-Forwarded-For or X-Real-IP header only
+	// when the request comes from them, see gear.Context.ClientIP. Default to none, the
+	// forwarding headers are ignored since they can be forged by any client.
+	TrustedProxies []string
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// New creates a middleware that limits the requests by the Algorithm per key. The allowed
+// requests get the RateLimit headers, the others are responded with 429 Too Many Requests
+// and the Retry-After header. It can be used per route with different algorithms and quotas:
+//
+//  router := gear.NewRouter()
+//  router.Use(ratelimit.New(ratelimit.Options{
+//  	Algorithm: ratelimit.NewTokenBucket(100, time.Minute, 20),
+//  }))
+//  router.Post("/login", ratelimit.New(ratelimit.Options{
+//  	Algorithm: ratelimit.NewGCRA(5, time.Minute, 1),
+//  }), login)
+//
+func New(opts Options) gear.Middleware {
+	if opts.Algorithm == nil {
+		panic(gear.NewAppError("ratelimit algorithm required"))
+	}
+	proxies := gear.NewTrustedProxies(opts.TrustedProxies...)
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+		var key string
+		if opts.Key != nil {
+			key = opts.Key(ctx)
+		} else if ip := ctx.ClientIP(proxies); ip != nil {
+			key = ip.String()
+		} else {
+			return ErrUnknownClient
+		}
+		ok, rl := opts.Algorithm.Allow(key, time.Now())
+		if !ok {
+			return gear.NewRateLimitError(rl)
+		}
+		ctx.SetRateLimit(rl)
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func request(url string, header map[string]string) (string, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res
+}
+
+func TestGearMiddlewareRateLimit(t *testing.T) {
+	t.Run("Should panic without algorithm", func(t *testing.T) {
+		assert.Panics(t, func() {
+			New(Options{})
+		})
+	})
+
+	t.Run("Should limit the requests per key", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{
+			Algorithm: NewGCRA(1, time.Minute, 2),
+			Key: func(ctx *gear.Context) string {
+				return ctx.Get("X-Token")
+			},
+			Skipper: func(ctx *gear.Context) bool {
+				return ctx.Path == "/health"
+			},
+		}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, "OK")
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, res := request(host, map[string]string{"X-Token": "a"})
+		assert.Equal("OK", body)
+		assert.Equal("2", res.Header.Get(gear.HeaderRateLimitLimit))
+		assert.Equal("1", res.Header.Get(gear.HeaderRateLimitRemaining))
+		assert.Equal("60", res.Header.Get(gear.HeaderRateLimitReset))
+
+		_, res = request(host, map[string]string{"X-Token": "a"})
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("0", res.Header.Get(gear.HeaderRateLimitRemaining))
+		assert.Equal("120", res.Header.Get(gear.HeaderRateLimitReset))
+
+		_, res = request(host, map[string]string{"X-Token": "a"})
+		assert.Equal(429, res.StatusCode)
+		assert.Equal("0", res.Header.Get(gear.HeaderRateLimitRemaining))
+		assert.Equal("60", res.Header.Get(gear.HeaderRetryAfter))
+
+		_, res = request(host, map[string]string{"X-Token": "b"})
+		assert.Equal(200, res.StatusCode)
+
+		_, res = request(host+"/health", map[string]string{"X-Token": "a"})
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("", res.Header.Get(gear.HeaderRateLimitLimit))
+	})
+
+	t.Run("Should work per route", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		router := gear.NewRouter()
+		router.Use(New(Options{Algorithm: NewTokenBucket(100, time.Minute, 0)}))
+		router.Get("/login", New(Options{Algorithm: NewSlidingWindow(1, time.Minute)}), func(ctx *gear.Context) error {
+			return ctx.HTML(200, "login")
+		})
+		router.Get("/", func(ctx *gear.Context) error {
+			return ctx.HTML(200, "home")
+		})
+		app.UseHandler(router)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, res := request(host+"/login", nil)
+		assert.Equal("login", body)
+		assert.Equal("1", res.Header.Get(gear.HeaderRateLimitLimit))
+		_, res = request(host+"/login", nil)
+		assert.Equal(429, res.StatusCode)
+
+		body, res = request(host+"/", nil)
+		assert.Equal("home", body)
+		assert.Equal("100", res.Header.Get(gear.HeaderRateLimitLimit))
+		assert.Equal("97", res.Header.Get(gear.HeaderRateLimitRemaining))
+	})
+
+	t.Run("Should limit by the peer IP by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Algorithm: NewSlidingWindow(1, time.Minute)}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, "OK")
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		_, res := request(host, map[string]string{gear.HeaderXForwardedFor: "1.1.1.1"})
+		assert.Equal(200, res.StatusCode)
+		_, res = request(host, map[string]string{gear.HeaderXForwardedFor: "2.2.2.2"})
+		assert.Equal(429, res.StatusCode)
+		_, res = request(host, map[string]string{gear.HeaderXForwardedFor: "3.3.3.3, 4.4.4.4"})
+		assert.Equal(429, res.StatusCode)
+
+		mw := New(Options{Algorithm: NewSlidingWindow(1, time.Minute)})
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "@"
+		ctx := gear.NewContext(app, nil, req)
+		assert.Equal(ErrUnknownClient, mw(ctx))
+	})
+
+	t.Run("Should read the forwarding headers from trusted proxies", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{
+			Algorithm:      NewSlidingWindow(1, time.Minute),
+			TrustedProxies: []string{"127.0.0.1", "::1"},
+		}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, "OK")
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		_, res := request(host, map[string]string{gear.HeaderXForwardedFor: "1.1.1.1"})
+		assert.Equal(200, res.StatusCode)
+		_, res = request(host, map[string]string{gear.HeaderXForwardedFor: "9.9.9.9, 1.1.1.1"})
+		assert.Equal(429, res.StatusCode)
+		_, res = request(host, map[string]string{gear.HeaderXForwardedFor: "2.2.2.2"})
+		assert.Equal(200, res.StatusCode)
+	})
+}
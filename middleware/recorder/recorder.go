@@ -0,0 +1,253 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Redacted replaces the values of the redacted headers.
+const Redacted = "[REDACTED]"
+
+// Record is a recorded request and response.
+type Record struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Proto         string      `json:"proto"`
+	Host          string      `json:"host"`
+	RemoteAddr    string      `json:"remoteAddr"`
+	Header        http.Header `json:"header"`
+	Body          []byte      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+
+	Status                int         `json:"status"`
+	ResponseHeader        http.Header `json:"responseHeader"`
+	ResponseBody          []byte      `json:"responseBody,omitempty"`
+	ResponseBodyTruncated bool        `json:"responseBodyTruncated,omitempty"`
+}
+
+// Sink saves the records, it should be safe for concurrent use.
+type Sink interface {
+	Save(record *Record) error
+}
+
+// SinkFunc is an adapter to use a function as Sink.
+type SinkFunc func(record *Record) error
+
+// Save implemented Sink interface.
+func (fn SinkFunc) Save(record *Record) error {
+	return fn(record)
+}
+
+// writerSink writes records as JSON lines.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a Sink that writes the records to w as JSON lines,
+// the records can be read back by ReadRecords.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Save(record *Record) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(buf, '\n'))
+	return err
+}
+
+// ReadRecords reads the JSON lines records written by the Sink created by NewWriterSink.
+func ReadRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			record := &Record{}
+			if e := json.Unmarshal(line, record); e != nil {
+				return records, e
+			}
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+	}
+}
+
+// Options is recorder middleware options.
+type Options struct {
+	// Sink saves the records, it is required.
+	Sink Sink
+	// MaxBodySize defines the maximum bytes of the request and response body to record,
+	// the larger body is recorded as truncated. Default to 64KB.
+	MaxBodySize int
+	// RedactHeaders defines the headers whose values are replaced with "[REDACTED]" in records.
+	// Default to "Authorization", "Proxy-Authorization", "Cookie" and "Set-Cookie".
+	RedactHeaders []string
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+var defaultRedactHeaders = []string{
+	gear.HeaderAuthorization,
+	gear.HeaderProxyAuthorization,
+	gear.HeaderCookie,
+	gear.HeaderSetCookie,
+}
+
+// New creates a middleware that records the full requests and responses to the Sink,
+// the records can be replayed by Replay to reproduce the bugs. The request body is read
+// up to MaxBodySize before the next middlewares, and the response body is buffered up to
+// MaxBodySize by ctx.Transform, the larger response body is sent in stream and recorded
+// as truncated without body. The records are saved by ctx.Defer after the response sent,
+// the errors of Sink are written to the app logger.
+//
+//  var buf bytes.Buffer
+//  app := gear.New()
+//  app.Use(recorder.New(recorder.Options{Sink: recorder.NewWriterSink(&buf)}))
+//
+//  // reproduce later
+//  records, _ := recorder.ReadRecords(&buf)
+//  res := recorder.Replay(app, records[0])
+//
+func New(opts Options) gear.Middleware {
+	if opts.Sink == nil {
+		panic(gear.NewAppError("recorder sink required"))
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 64 << 10
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = defaultRedactHeaders
+	}
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+
+		record := &Record{
+			Time:       time.Now(),
+			Method:     ctx.Method,
+			URL:        ctx.Req.RequestURI,
+			Proto:      ctx.Req.Proto,
+			Host:       ctx.Host,
+			RemoteAddr: ctx.Req.RemoteAddr,
+			Header:     redact(ctx.Req.Header, opts.RedactHeaders),
+		}
+		if record.URL == "" {
+			record.URL = ctx.Req.URL.RequestURI()
+		}
+
+		if ctx.Req.Body != nil && ctx.Req.Body != http.NoBody {
+			body, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Body, int64(opts.MaxBodySize)+1))
+			if err != nil {
+				return err
+			}
+			if len(body) > opts.MaxBodySize {
+				record.BodyTruncated = true
+				record.Body = body[:opts.MaxBodySize]
+			} else {
+				record.Body = body
+			}
+			ctx.Req.Body = readCloser{io.MultiReader(bytes.NewReader(body), ctx.Req.Body), ctx.Req.Body}
+		}
+
+		captured := false
+		if err := ctx.Transform(opts.MaxBodySize, func(body []byte) ([]byte, error) {
+			captured = true
+			record.ResponseBody = append([]byte(nil), body...)
+			return body, nil
+		}); err != nil {
+			return err
+		}
+		ctx.OnEnd(func() {
+			record.Status = ctx.Res.Status()
+			record.ResponseHeader = redact(ctx.Res.Header(), opts.RedactHeaders)
+		})
+		logger, _ := ctx.Setting(gear.SetLogger).(*log.Logger)
+		ctx.Defer(func() {
+			record.Duration = time.Since(record.Time)
+			if !captured && ctx.Res.BytesWritten() > 0 {
+				record.ResponseBodyTruncated = true
+			}
+			if err := opts.Sink.Save(record); err != nil && logger != nil {
+				logger.Println(gear.ErrorWithStack(err).String())
+			}
+		})
+		return nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func redact(header http.Header, keys []string) http.Header {
+	h := make(http.Header, len(header))
+	for key, vals := range header {
+		h[key] = append([]string(nil), vals...)
+	}
+	for _, key := range keys {
+		key = http.CanonicalHeaderKey(key)
+		if vals, ok := h[key]; ok {
+			for i := range vals {
+				vals[i] = Redacted
+			}
+		}
+	}
+	return h
+}
+
+// Replay feeds the recorded request back through the handler (usually the *gear.App),
+// and returns the response. The redacted headers are not replayed, they can be added
+// by the optional fn that modifies the request before serving.
+//
+//  res := recorder.Replay(app, record, func(req *http.Request) {
+//  	req.Header.Set(gear.HeaderAuthorization, "Bearer "+testToken)
+//  })
+//
+func Replay(handler http.Handler, record *Record, fn ...func(req *http.Request)) *http.Response {
+	req := httptest.NewRequest(record.Method, record.URL, bytes.NewReader(record.Body))
+	req.Host = record.Host
+	if record.RemoteAddr != "" {
+		req.RemoteAddr = record.RemoteAddr
+	}
+	for key, vals := range record.Header {
+		for _, val := range vals {
+			if val != Redacted {
+				req.Header.Add(key, val)
+			}
+		}
+	}
+	for _, f := range fn {
+		f(req)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Result()
+}
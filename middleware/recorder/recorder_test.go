@@ -0,0 +1,183 @@
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newApp(opts Options) *gear.App {
+	app := gear.New()
+	app.Use(New(opts))
+	app.Use(func(ctx *gear.Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		http.SetCookie(ctx.Res, &http.Cookie{Name: "session", Value: "secret"})
+		if ctx.Path == "/large" {
+			return ctx.End(200, bytes.Repeat([]byte("x"), 100))
+		}
+		return ctx.HTML(200, ctx.Method+" "+ctx.Path+" "+ctx.Get(gear.HeaderAuthorization)+" "+string(body))
+	})
+	return app
+}
+
+func TestGearMiddlewareRecorder(t *testing.T) {
+	records := make(chan *Record, 10)
+	sink := SinkFunc(func(record *Record) error {
+		records <- record
+		return nil
+	})
+	app := newApp(Options{
+		Sink:        sink,
+		MaxBodySize: 30,
+		Skipper: func(ctx *gear.Context) bool {
+			return ctx.Path == "/skip"
+		},
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	request := func(path, body string) string {
+		req, _ := http.NewRequest(http.MethodPost, host+path, strings.NewReader(body))
+		req.Header.Set(gear.HeaderAuthorization, "Bearer token")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(t, err)
+		buf, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return string(buf)
+	}
+
+	t.Run("Should record request and response", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("POST /a Bearer token hello", request("/a?q=1", "hello"))
+		record := <-records
+		assert.Equal("POST", record.Method)
+		assert.Equal("/a?q=1", record.URL)
+		assert.Equal("HTTP/1.1", record.Proto)
+		assert.Equal(srv.Addr().String(), record.Host)
+		assert.Equal(Redacted, record.Header.Get(gear.HeaderAuthorization))
+		assert.Equal("hello", string(record.Body))
+		assert.False(record.BodyTruncated)
+		assert.Equal(200, record.Status)
+		assert.Equal(Redacted, record.ResponseHeader.Get(gear.HeaderSetCookie))
+		assert.Equal("POST /a Bearer token hello", string(record.ResponseBody))
+		assert.False(record.ResponseBodyTruncated)
+		assert.True(record.Duration > 0)
+	})
+
+	t.Run("Should truncate large body", func(t *testing.T) {
+		assert := assert.New(t)
+
+		body := strings.Repeat("a", 40)
+		assert.Equal(strings.Repeat("x", 100), request("/large", body))
+		record := <-records
+		assert.Equal(strings.Repeat("a", 30), string(record.Body))
+		assert.True(record.BodyTruncated)
+		assert.Equal(0, len(record.ResponseBody))
+		assert.True(record.ResponseBodyTruncated)
+
+		// the next middlewares read the full body
+		assert.Equal("POST /b Bearer token "+body, request("/b", body))
+		<-records
+	})
+
+	t.Run("Should skip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("POST /skip Bearer token ", request("/skip", ""))
+		assert.Equal("POST /c Bearer token ", request("/c", ""))
+		record := <-records
+		assert.Equal("/c", record.URL)
+	})
+}
+
+func TestGearMiddlewareRecorderReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf syncBuffer
+	app := newApp(Options{Sink: NewWriterSink(&buf)})
+	srv := app.Start()
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, "http://"+srv.Addr().String()+"/users/1", strings.NewReader("data"))
+	req.Header.Set(gear.HeaderAuthorization, "Bearer token")
+	res, err := DefaultClient.Do(req)
+	assert.Nil(err)
+	res.Body.Close()
+
+	var records []*Record
+	for i := 0; i < 100 && len(records) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		records, err = ReadRecords(strings.NewReader(buf.String()))
+		assert.Nil(err)
+	}
+	assert.Equal(1, len(records))
+
+	res = Replay(app, records[0])
+	body, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(200, res.StatusCode)
+	assert.Equal("PUT /users/1  data", string(body))
+
+	res = Replay(app, records[0], func(req *http.Request) {
+		req.Header.Set(gear.HeaderAuthorization, "Bearer test")
+	})
+	body, _ = ioutil.ReadAll(res.Body)
+	assert.Equal("PUT /users/1 Bearer test data", string(body))
+	assert.Equal(string(records[0].ResponseBody), "PUT /users/1 Bearer token data")
+
+	_, err = ReadRecords(strings.NewReader("{}\ninvalid\n"))
+	assert.NotNil(err)
+
+	assert.Panics(func() {
+		New(Options{})
+	})
+}
+
+func TestGearMiddlewareRecorderSinkError(t *testing.T) {
+	assert := assert.New(t)
+
+	var logs syncBuffer
+	app := newApp(Options{Sink: SinkFunc(func(record *Record) error {
+		return errors.New("sink error")
+	})})
+	app.Set(gear.SetLogger, log.New(&logs, "", 0))
+	srv := app.Start()
+	defer srv.Close()
+
+	res, err := DefaultClient.Get("http://" + srv.Addr().String())
+	assert.Nil(err)
+	res.Body.Close()
+	for i := 0; i < 100 && logs.String() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(strings.Contains(logs.String(), "sink error"))
+}
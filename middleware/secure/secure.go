@@ -14,6 +14,18 @@ import (
 	"github.com/teambition/gear"
 )
 
+// WithSkipper composes the security middlewares to one middleware that is skipped for the
+// requests that skipper returns true, such as the API responses that don't need the
+// headers for the browsers:
+//
+//  app.Use(secure.WithSkipper(func(ctx *gear.Context) bool {
+//  	return strings.HasPrefix(ctx.Path, "/api/")
+//  }, secure.NoCache(), secure.FrameGuard(secure.FrameGuardActionDeny)))
+//
+func WithSkipper(skipper func(ctx *gear.Context) bool, mds ...gear.Middleware) gear.Middleware {
+	return gear.Unless(skipper, mds...)
+}
+
 // FrameGuardAction represents a possible option of the "X-Frame-Options"
 // header.
 type FrameGuardAction string
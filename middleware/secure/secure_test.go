@@ -374,6 +374,25 @@ func TestGearMiddlewareSecure(t *testing.T) {
 	})
 }
 
+func TestGearMiddlewareSecureWithSkipper(t *testing.T) {
+	assert := assert.New(t)
+
+	app := getAppWithMiddleware(WithSkipper(func(ctx *gear.Context) bool {
+		return ctx.Path == "/api"
+	}, NoSniff(), IENoOpen()))
+	srv := app.Start()
+	defer srv.Close()
+
+	res, err := DefaultClient.Get("http://" + srv.Addr().String())
+	assert.Nil(err)
+	assert.Equal("nosniff", res.Header.Get(gear.HeaderXContentTypeOptions))
+	assert.Equal("noopen", res.Header.Get(gear.HeaderXDownloadOptions))
+
+	res, err = DefaultClient.Get("http://" + srv.Addr().String() + "/api")
+	assert.Nil(err)
+	assert.Equal("", res.Header.Get(gear.HeaderXDownloadOptions))
+}
+
 func getAppWithMiddleware(middleware gear.Middleware) *gear.App {
 	app := gear.New()
 	app.Use(middleware)
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// MemoryOptions is the options of NewMemoryStore.
+type MemoryOptions struct {
+	// Shards defines the number of the shards to reduce the lock contention, default to 32.
+	Shards int
+	// MaxEntries defines the maximum number of the sessions, 0 means no limit. The sessions
+	// are spread over the shards, the one expiring soonest in a full shard is evicted.
+	MaxEntries int
+	// GCInterval defines the interval to remove the expired sessions, default to 1 minute.
+	GCInterval time.Duration
+}
+
+// MemoryStore is a Store that keeps the sessions in memory, the sessions are lost when the
+// process restarts and not shared between processes. It is safe for concurrent use.
+type MemoryStore struct {
+	shards   []*memoryShard
+	maxShard int
+	done     chan struct{}
+	once     sync.Once
+}
+
+type memoryShard struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryStore creates a MemoryStore and starts the GC in background.
+func NewMemoryStore(opts MemoryOptions) *MemoryStore {
+	if opts.Shards <= 0 {
+		opts.Shards = 32
+	}
+	if opts.GCInterval <= 0 {
+		opts.GCInterval = time.Minute
+	}
+	s := &MemoryStore{shards: make([]*memoryShard, opts.Shards), done: make(chan struct{})}
+	for i := range s.shards {
+		s.shards[i] = &memoryShard{entries: make(map[string]memoryEntry)}
+	}
+	if opts.MaxEntries > 0 {
+		if s.maxShard = opts.MaxEntries / opts.Shards; s.maxShard < 1 {
+			s.maxShard = 1
+		}
+	}
+	go s.loop(opts.GCInterval)
+	return s
+}
+
+// Load implemented Store interface.
+func (s *MemoryStore) Load(id string) ([]byte, error) {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	e, ok := sh.entries[id]
+	if !ok || !time.Now().Before(e.expires) {
+		return nil, nil
+	}
+	return e.data, nil
+}
+
+// Save implemented Store interface.
+func (s *MemoryStore) Save(id string, data []byte, ttl time.Duration) error {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.entries[id]; !ok && s.maxShard > 0 && len(sh.entries) >= s.maxShard {
+		sh.evict()
+	}
+	sh.entries[id] = memoryEntry{data: data, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// Touch implemented Toucher interface.
+func (s *MemoryStore) Touch(id string, ttl time.Duration) error {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if e, ok := sh.entries[id]; ok {
+		e.expires = time.Now().Add(ttl)
+		sh.entries[id] = e
+	}
+	return nil
+}
+
+// Delete implemented Store interface.
+func (s *MemoryStore) Delete(id string) error {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	delete(sh.entries, id)
+	sh.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of the sessions in the store, including the expired ones not yet removed.
+func (s *MemoryStore) Len() (n int) {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += len(sh.entries)
+		sh.mu.Unlock()
+	}
+	return
+}
+
+// GC removes the expired sessions immediately.
+func (s *MemoryStore) GC() {
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for id, e := range sh.entries {
+			if !now.Before(e.expires) {
+				delete(sh.entries, id)
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// Close stops the GC in background.
+func (s *MemoryStore) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *MemoryStore) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.GC()
+		}
+	}
+}
+
+func (s *MemoryStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// evict removes the entry expiring soonest, it should be called with the lock held.
+func (sh *memoryShard) evict() {
+	var victim string
+	var expires time.Time
+	for id, e := range sh.entries {
+		if victim == "" || e.expires.Before(expires) {
+			victim, expires = id, e.expires
+		}
+	}
+	delete(sh.entries, victim)
+}
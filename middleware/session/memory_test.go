@@ -0,0 +1,85 @@
+package session
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Run("Should load, save, touch and delete", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewMemoryStore(MemoryOptions{})
+		defer store.Close()
+
+		data, err := store.Load("a")
+		assert.Nil(err)
+		assert.Nil(data)
+
+		assert.Nil(store.Save("a", []byte("1"), 50*time.Millisecond))
+		data, _ = store.Load("a")
+		assert.Equal([]byte("1"), data)
+
+		assert.Nil(store.Touch("a", time.Second))
+		time.Sleep(100 * time.Millisecond)
+		data, _ = store.Load("a")
+		assert.Equal([]byte("1"), data)
+
+		assert.Nil(store.Delete("a"))
+		data, _ = store.Load("a")
+		assert.Nil(data)
+		assert.Nil(store.Touch("a", time.Second))
+		assert.Equal(0, store.Len())
+	})
+
+	t.Run("Should remove the expired sessions by GC", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewMemoryStore(MemoryOptions{GCInterval: 50 * time.Millisecond})
+		defer store.Close()
+
+		store.Save("a", []byte("1"), 20*time.Millisecond)
+		store.Save("b", []byte("2"), time.Minute)
+		assert.Equal(2, store.Len())
+		time.Sleep(30 * time.Millisecond)
+		data, _ := store.Load("a")
+		assert.Nil(data)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(1, store.Len())
+		data, _ = store.Load("b")
+		assert.Equal([]byte("2"), data)
+	})
+
+	t.Run("Should evict the session expiring soonest when full", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewMemoryStore(MemoryOptions{Shards: 1, MaxEntries: 3})
+		defer store.Close()
+
+		for i := 0; i < 3; i++ {
+			store.Save(strconv.Itoa(i), []byte("v"), time.Duration(10-i)*time.Minute)
+		}
+		store.Save("0", []byte("v2"), time.Minute) // update does not evict
+		assert.Equal(3, store.Len())
+
+		store.Save("3", []byte("v"), time.Hour)
+		assert.Equal(3, store.Len())
+		data, _ := store.Load("0")
+		assert.Nil(data)
+		for _, id := range []string{"1", "2", "3"} {
+			data, _ = store.Load(id)
+			assert.NotNil(data)
+		}
+
+		store = NewMemoryStore(MemoryOptions{Shards: 4, MaxEntries: 100})
+		defer store.Close()
+		for i := 0; i < 1000; i++ {
+			store.Save(strconv.Itoa(i), []byte("v"), time.Minute)
+		}
+		assert.True(store.Len() <= 100)
+	})
+}
@@ -0,0 +1,72 @@
+package session
+
+import "time"
+
+// RedisClient is the minimal Redis commands used by RedisStore, it can be implemented by
+// a thin adapter of any Redis client, or any Redis-compatible backend. Get should return
+// nil value and nil error if the key does not exist (such as redis.Nil of go-redis).
+//
+//  type goRedis struct{ c *redis.Client }
+//
+//  func (r goRedis) Get(key string) ([]byte, error) {
+//  	val, err := r.c.Get(context.Background(), key).Bytes()
+//  	if err == redis.Nil {
+//  		return nil, nil
+//  	}
+//  	return val, err
+//  }
+//  func (r goRedis) SetEX(key string, val []byte, ttl time.Duration) error {
+//  	return r.c.Set(context.Background(), key, val, ttl).Err()
+//  }
+//  func (r goRedis) Expire(key string, ttl time.Duration) error {
+//  	return r.c.Expire(context.Background(), key, ttl).Err()
+//  }
+//  func (r goRedis) Del(key string) error {
+//  	return r.c.Del(context.Background(), key).Err()
+//  }
+//
+type RedisClient interface {
+	Get(key string) ([]byte, error)
+	SetEX(key string, val []byte, ttl time.Duration) error
+	Expire(key string, ttl time.Duration) error
+	Del(key string) error
+}
+
+// RedisStore is a Store that keeps the sessions in Redis with the key prefix, the sessions
+// expire by the Redis TTL, and the sliding expiration renews the TTL by EXPIRE.
+type RedisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore with the client, the prefix default to "sess:".
+//
+//  store := session.NewRedisStore(goRedis{redis.NewClient(&redis.Options{Addr: "localhost:6379"})}, "")
+//  app.Use(session.New(session.Options{Store: store}))
+//
+func NewRedisStore(client RedisClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "sess:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Load implemented Store interface.
+func (s *RedisStore) Load(id string) ([]byte, error) {
+	return s.client.Get(s.prefix + id)
+}
+
+// Save implemented Store interface.
+func (s *RedisStore) Save(id string, data []byte, ttl time.Duration) error {
+	return s.client.SetEX(s.prefix+id, data, ttl)
+}
+
+// Touch implemented Toucher interface.
+func (s *RedisStore) Touch(id string, ttl time.Duration) error {
+	return s.client.Expire(s.prefix+id, ttl)
+}
+
+// Delete implemented Store interface.
+func (s *RedisStore) Delete(id string) error {
+	return s.client.Del(s.prefix + id)
+}
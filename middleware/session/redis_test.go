@@ -0,0 +1,97 @@
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+}
+
+func (r *fakeRedis) Get(key string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.data[key], nil
+}
+
+func (r *fakeRedis) SetEX(key string, val []byte, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key] = val
+	r.ttls[key] = ttl
+	return nil
+}
+
+func (r *fakeRedis) Expire(key string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data[key]; ok {
+		r.ttls[key] = ttl
+	}
+	return nil
+}
+
+func (r *fakeRedis) Del(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.data, key)
+	delete(r.ttls, key)
+	return nil
+}
+
+func TestRedisStore(t *testing.T) {
+	client := &fakeRedis{data: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+
+	t.Run("Should load, save, touch and delete with the key prefix", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewRedisStore(client, "")
+		assert.Nil(store.Save("a", []byte("1"), time.Minute))
+		assert.Equal([]byte("1"), client.data["sess:a"])
+		assert.Equal(time.Minute, client.ttls["sess:a"])
+
+		data, err := store.Load("a")
+		assert.Nil(err)
+		assert.Equal([]byte("1"), data)
+
+		assert.Nil(store.Touch("a", time.Hour))
+		assert.Equal(time.Hour, client.ttls["sess:a"])
+
+		assert.Nil(store.Delete("a"))
+		data, err = store.Load("a")
+		assert.Nil(err)
+		assert.Nil(data)
+
+		store = NewRedisStore(client, "app:")
+		store.Save("b", []byte("2"), time.Minute)
+		assert.Equal([]byte("2"), client.data["app:b"])
+	})
+
+	t.Run("Should work with the session middleware", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewRedisStore(client, "app:")
+		srv := newApp(Options{Store: store, Sliding: true, MaxAge: time.Hour})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		_, res := request(host + "/login?uid=u1")
+		c := sessionCookie(res)
+		assert.NotNil(c)
+		client.mu.Lock()
+		client.ttls["app:"+c.Value] = time.Second
+		client.mu.Unlock()
+
+		body, _ := request(host+"/", c)
+		assert.Equal("u1", body)
+		client.mu.Lock()
+		assert.True(client.ttls["app:"+c.Value] > 59*time.Minute)
+		client.mu.Unlock()
+	})
+}
@@ -0,0 +1,305 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/teambition/gear"
+)
+
+// Store is the storage of the sessions. The data is the encoded session, Load should return
+// nil data and nil error if the session does not exist or has expired.
+type Store interface {
+	Load(id string) (data []byte, err error)
+	Save(id string, data []byte, ttl time.Duration) error
+	Delete(id string) error
+}
+
+// Toucher is an optional interface of Store to renew the TTL of an unmodified session without
+// rewriting it, it is used by the sliding expiration. Save is used if the Store does not implement it.
+type Toucher interface {
+	Touch(id string, ttl time.Duration) error
+}
+
+// Options is session middleware options.
+type Options struct {
+	// Store defines the storage of the sessions, required.
+	Store Store
+	// Cookie defines the cookie name to carry the session ID, default to "sid".
+	Cookie string
+	// MaxAge defines the lifetime of the session, default to 24 hours.
+	MaxAge time.Duration
+	// Sliding renews the lifetime of the session on every request, so the session expires
+	// only after MaxAge of inactivity. Otherwise the session expires MaxAge after created.
+	Sliding bool
+	// Signed signs the session cookie with the app setting SetKeys.
+	Signed bool
+	// Secure, Domain, Path and SameSite define the attributes of the session cookie,
+	// the cookie is always HttpOnly. Path default to "/", SameSite default to http.SameSiteLaxMode.
+	Secure   bool
+	Domain   string
+	Path     string
+	SameSite http.SameSite
+	// OnError is called when failed to save or delete the session after the handlers,
+	// default to log the error with the app logger.
+	OnError func(ctx *gear.Context, err error)
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// Session is the session of a request, it is not safe for concurrent use. The values are
+// encoded as JSON in the Store, so they should be JSON encodable, and the numbers are
+// decoded as float64.
+type Session struct {
+	id        string
+	oldID     string // the ID to delete from the store when regenerated
+	values    map[string]interface{}
+	expires   time.Time
+	isNew     bool
+	modified  bool
+	destroyed bool
+}
+
+type record struct {
+	Expires int64                  `json:"e"`
+	Values  map[string]interface{} `json:"v"`
+}
+
+type ctxKey struct{}
+
+// FromCtx returns the session of the request, it returns nil if the middleware is not used
+// or skipped.
+//
+//  sess := session.FromCtx(ctx)
+//  if uid, ok := sess.Get("uid").(string); ok {
+//  	// ...
+//  }
+//
+func FromCtx(ctx *gear.Context) *Session {
+	if val, err := ctx.Any(ctxKey{}); err == nil {
+		return val.(*Session)
+	}
+	return nil
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew returns true if the session is created by the request.
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Expires returns the time the session expires.
+func (s *Session) Expires() time.Time {
+	return s.expires
+}
+
+// Get returns the value of the key, or nil if not exists.
+func (s *Session) Get(key string) interface{} {
+	return s.values[key]
+}
+
+// Set sets the value of the key.
+func (s *Session) Set(key string, val interface{}) {
+	s.values[key] = val
+	s.modified = true
+}
+
+// Delete deletes the key.
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// Keys returns the keys of the session.
+func (s *Session) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Regenerate moves the session to a new ID with the values kept, the old ID is deleted from
+// the store. It should be called on privilege change, such as login or logout, to prevent
+// the session fixation.
+//
+//  sess := session.FromCtx(ctx)
+//  sess.Regenerate()
+//  sess.Set("uid", user.ID)
+//
+func (s *Session) Regenerate() {
+	if !s.isNew && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = newID()
+	s.modified = true
+	s.destroyed = false
+}
+
+// Destroy deletes the session from the store and clears the session cookie.
+func (s *Session) Destroy() {
+	s.values = make(map[string]interface{})
+	s.destroyed = true
+}
+
+// New creates a middleware that loads the session by the ID in the cookie from the Store,
+// and saves it back after the handlers if it is modified. A new session is created if the
+// cookie is absent or the session has expired, it is saved only if it has values.
+//
+//  store := session.NewMemoryStore(session.MemoryOptions{MaxEntries: 100000})
+//  defer store.Close()
+//  app.Use(session.New(session.Options{Store: store, Sliding: true, Secure: true}))
+//
+func New(opts Options) gear.Middleware {
+	if opts.Store == nil {
+		panic(gear.NewAppError("session store required"))
+	}
+	if opts.Cookie == "" {
+		opts.Cookie = "sid"
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 24 * time.Hour
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.OnError == nil {
+		opts.OnError = logError
+	}
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+
+		s, err := load(ctx, &opts)
+		if err != nil {
+			return err
+		}
+		ctx.SetAny(ctxKey{}, s)
+		ctx.After(func() {
+			if err := save(ctx, &opts, s); err != nil {
+				opts.OnError(ctx, err)
+			}
+		})
+		return nil
+	}
+}
+
+func load(ctx *gear.Context, opts *Options) (*Session, error) {
+	if id, _ := ctx.Cookies.Get(opts.Cookie, opts.Signed); id != "" {
+		data, err := opts.Store.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		var r record
+		if data != nil && json.Unmarshal(data, &r) == nil {
+			// the record expiry is not renewed by Touch, the store TTL rules the sliding sessions
+			expires := time.Unix(r.Expires, 0)
+			if opts.Sliding {
+				expires = time.Now().Add(opts.MaxAge)
+			}
+			if time.Now().Before(expires) {
+				if r.Values == nil {
+					r.Values = make(map[string]interface{})
+				}
+				return &Session{id: id, values: r.Values, expires: expires}, nil
+			}
+		}
+	}
+	return &Session{
+		id:      newID(),
+		values:  make(map[string]interface{}),
+		expires: time.Now().Add(opts.MaxAge),
+		isNew:   true,
+	}, nil
+}
+
+func save(ctx *gear.Context, opts *Options, s *Session) (err error) {
+	if s.oldID != "" {
+		if err = opts.Store.Delete(s.oldID); err != nil {
+			return
+		}
+	}
+	if s.destroyed {
+		if !s.isNew {
+			err = opts.Store.Delete(s.id)
+		}
+		if !s.isNew || s.oldID != "" {
+			setCookie(ctx, opts, "", -1)
+		}
+		return
+	}
+	if s.isNew && len(s.values) == 0 {
+		return // nothing to save
+	}
+
+	touched := opts.Sliding
+	ttl := time.Until(s.expires)
+	if ttl <= 0 {
+		return
+	}
+	switch {
+	case s.modified || s.isNew:
+		data, e := json.Marshal(record{Expires: s.expires.Unix(), Values: s.values})
+		if e != nil {
+			return e
+		}
+		err = opts.Store.Save(s.id, data, ttl)
+	case touched:
+		if t, ok := opts.Store.(Toucher); ok {
+			err = t.Touch(s.id, ttl)
+		} else {
+			data, _ := json.Marshal(record{Expires: s.expires.Unix(), Values: s.values})
+			err = opts.Store.Save(s.id, data, ttl)
+		}
+	default:
+		return
+	}
+	if err == nil && (s.isNew || s.oldID != "" || touched) {
+		setCookie(ctx, opts, s.id, int(ttl/time.Second))
+	}
+	return
+}
+
+func setCookie(ctx *gear.Context, opts *Options, id string, maxAge int) {
+	ctx.Cookies.Set(opts.Cookie, id, &cookie.Options{
+		MaxAge:   maxAge,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		Secure:   opts.Secure,
+		HTTPOnly: true,
+		SameSite: opts.SameSite,
+		Signed:   opts.Signed,
+	})
+}
+
+func newID() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func logError(ctx *gear.Context, err error) {
+	if logger, ok := ctx.Setting(gear.SetLogger).(*log.Logger); ok {
+		logger.Printf("session: %v", err)
+	} else {
+		log.Printf("session: %v", err)
+	}
+}
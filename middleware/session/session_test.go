@@ -0,0 +1,226 @@
+package session
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+type countStore struct {
+	*MemoryStore
+	mu      sync.Mutex
+	saves   int
+	touches int
+	err     error
+}
+
+func (s *countStore) Save(id string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	s.saves++
+	err := s.err
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.MemoryStore.Save(id, data, ttl)
+}
+
+func (s *countStore) Touch(id string, ttl time.Duration) error {
+	s.mu.Lock()
+	s.touches++
+	s.mu.Unlock()
+	return s.MemoryStore.Touch(id, ttl)
+}
+
+func (s *countStore) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves, s.touches
+}
+
+func newApp(opts Options) *gear.ServerListener {
+	app := gear.New()
+	app.Use(New(opts))
+	app.Use(func(ctx *gear.Context) error {
+		sess := FromCtx(ctx)
+		switch ctx.Path {
+		case "/login":
+			sess.Regenerate()
+			sess.Set("uid", ctx.Query("uid"))
+		case "/logout":
+			sess.Destroy()
+		case "/visit":
+			n, _ := sess.Get("visits").(float64)
+			sess.Set("visits", n+1)
+		}
+		uid, _ := sess.Get("uid").(string)
+		return ctx.HTML(200, uid)
+	})
+	return app.Start()
+}
+
+func request(url string, cookies ...*http.Cookie) (string, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res
+}
+
+func sessionCookie(res *http.Response) *http.Cookie {
+	for _, c := range res.Cookies() {
+		if c.Name == "sid" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestGearMiddlewareSession(t *testing.T) {
+	t.Run("Should panic without store", func(t *testing.T) {
+		assert.Panics(t, func() {
+			New(Options{})
+		})
+	})
+
+	t.Run("Should create, load and regenerate the session", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := &countStore{MemoryStore: NewMemoryStore(MemoryOptions{})}
+		defer store.Close()
+		srv := newApp(Options{Store: store})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		// empty session is not saved
+		_, res := request(host + "/")
+		assert.Nil(sessionCookie(res))
+		assert.Equal(0, store.Len())
+
+		_, res = request(host + "/login?uid=u1")
+		c := sessionCookie(res)
+		assert.NotNil(c)
+		assert.True(c.HttpOnly)
+		assert.Equal(http.SameSiteLaxMode, c.SameSite)
+		assert.Equal("/", c.Path)
+		assert.True(c.MaxAge > 86390)
+		assert.Equal(1, store.Len())
+
+		body, res := request(host+"/", c)
+		assert.Equal("u1", body)
+		assert.Nil(sessionCookie(res))
+		saves, _ := store.counts()
+		assert.Equal(1, saves)
+
+		// privilege change moves the session to a new ID
+		body, res = request(host+"/login?uid=u2", c)
+		assert.Equal("u2", body)
+		c2 := sessionCookie(res)
+		assert.NotNil(c2)
+		assert.NotEqual(c.Value, c2.Value)
+		assert.Equal(1, store.Len())
+		data, _ := store.Load(c.Value)
+		assert.Nil(data)
+
+		body, _ = request(host+"/", c)
+		assert.Equal("", body)
+		body, _ = request(host+"/", c2)
+		assert.Equal("u2", body)
+
+		_, res = request(host+"/logout", c2)
+		c3 := sessionCookie(res)
+		assert.NotNil(c3)
+		assert.Equal("", c3.Value)
+		assert.True(c3.MaxAge < 0)
+		assert.Equal(0, store.Len())
+		body, _ = request(host+"/", c2)
+		assert.Equal("", body)
+	})
+
+	t.Run("Should renew the session with sliding expiration", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := &countStore{MemoryStore: NewMemoryStore(MemoryOptions{})}
+		defer store.Close()
+		srv := newApp(Options{Store: store, Sliding: true, MaxAge: time.Second})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		_, res := request(host + "/login?uid=u1")
+		c := sessionCookie(res)
+		assert.NotNil(c)
+		for i := 0; i < 3; i++ {
+			time.Sleep(500 * time.Millisecond)
+			body, res := request(host+"/", c)
+			assert.Equal("u1", body)
+			assert.NotNil(sessionCookie(res))
+		}
+		saves, touches := store.counts()
+		assert.Equal(1, saves)
+		assert.Equal(3, touches)
+
+		body, _ := request(host+"/visit", c)
+		assert.Equal("u1", body)
+		saves, _ = store.counts()
+		assert.Equal(2, saves)
+
+		time.Sleep(1100 * time.Millisecond)
+		body, _ = request(host+"/", c)
+		assert.Equal("", body)
+	})
+
+	t.Run("Should expire the session after MaxAge without sliding", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := NewMemoryStore(MemoryOptions{})
+		defer store.Close()
+		srv := newApp(Options{Store: store, MaxAge: 2 * time.Second})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		_, res := request(host + "/login?uid=u1")
+		c := sessionCookie(res)
+		time.Sleep(1100 * time.Millisecond)
+		body, res := request(host+"/visit", c)
+		assert.Equal("u1", body)
+		assert.Nil(sessionCookie(res))
+		time.Sleep(1100 * time.Millisecond)
+		body, _ = request(host+"/", c)
+		assert.Equal("", body)
+	})
+
+	t.Run("Should call OnError when failed to save", func(t *testing.T) {
+		assert := assert.New(t)
+
+		store := &countStore{MemoryStore: NewMemoryStore(MemoryOptions{}), err: errors.New("store down")}
+		defer store.Close()
+		var mu sync.Mutex
+		var errs []error
+		srv := newApp(Options{Store: store, OnError: func(ctx *gear.Context, err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}})
+		defer srv.Close()
+
+		_, res := request("http://" + srv.Addr().String() + "/login?uid=u1")
+		assert.Nil(sessionCookie(res))
+		mu.Lock()
+		assert.Equal([]error{errors.New("store down")}, errs)
+		mu.Unlock()
+	})
+}
@@ -0,0 +1,185 @@
+package sizeguard
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// ErrQuotaExceeded is responded when the egress quota of the client has been used up.
+var ErrQuotaExceeded = &gear.Error{Code: http.StatusTooManyRequests, Msg: "egress quota exceeded"}
+
+// ErrUnknownClient is responded when the client IP for the default Key can't be parsed.
+var ErrUnknownClient = &gear.Error{Code: http.StatusBadRequest, Msg: "unknown client IP"}
+
+// Store counts the egress bytes of the clients, it should be safe for concurrent use.
+// Implement it with Redis or the other shared storages to count the egress across the
+// app instances.
+type Store interface {
+	// Used returns the bytes sent to the key in the current window.
+	Used(key string) (int64, error)
+	// Add adds the bytes sent to the key.
+	Add(key string, n int64) error
+}
+
+// Options is sizeguard middleware options.
+type Options struct {
+	// MaxBytes caps the body bytes a response may write, 0 means no cap.
+	MaxBytes int64
+	// Store counts the egress bytes per client, such as NewMemoryStore(time.Hour). Optional,
+	// the Quota is required with it.
+	Store Store
+	// Quota is the total egress bytes of a client in the window of the Store. The requests of the
+	// clients used up the quota are responded with ErrQuotaExceeded, and a response is capped to
+	// the remaining bytes of the client. The bytes are counted after the responses sent, so the
+	// concurrent requests of a client are capped to the same remaining bytes, and the quota can
+	// be overshot by up to the number of them times the remaining bytes. Set MaxBytes to bound it.
+	Quota int64
+	// Key returns the key to count the egress, such as the user ID or the API token.
+	// Default to the client IP, that is the peer IP of the connection, see TrustedProxies.
+	// The requests with an unparseable client IP are responded with ErrUnknownClient.
+	Key func(ctx *gear.Context) string
+	// TrustedProxies defines the IPs or CIDRs of the reverse proxies in front of the app for
+	// the default Key, the client IP is read from the X-Forwarded-For or X-Real-IP header only
+	// when the request comes from them, see gear.Context.ClientIP. Default to none, the
+	// forwarding headers are ignored since they can be forged by any client.
+	TrustedProxies []string
+	// OnExceed is called when a response exceeds the cap (with gear.ErrResponseTooLarge), or
+	// a request is rejected for the quota (with ErrQuotaExceeded). It is useful for logging
+	// and alerting. Optional.
+	OnExceed func(ctx *gear.Context, err error)
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+// New creates a middleware that caps the body bytes the handlers may write per response, and
+// optionally the total egress per client with a Store, to protect against the accidental
+// unbounded responses, such as a list API without pagination. When a response exceeds the
+// cap, the 500 error is responded if the header has not been written, otherwise the connection
+// is aborted. See gear.Response.SetLimit for more information.
+//
+//  app.Use(sizeguard.New(sizeguard.Options{
+//  	MaxBytes: 10 << 20, // 10MB per response
+//  	Store:    sizeguard.NewMemoryStore(time.Hour),
+//  	Quota:    1 << 30, // 1GB per client per hour
+//  	OnExceed: func(ctx *gear.Context, err error) {
+//  		logging.FromCtx(ctx)["SizeGuard"] = err.Error()
+//  	},
+//  }))
+//
+func New(opts Options) gear.Middleware {
+	if opts.MaxBytes <= 0 && opts.Store == nil {
+		panic(gear.NewAppError("sizeguard MaxBytes or Store required"))
+	}
+	if opts.Store != nil && opts.Quota <= 0 {
+		panic(gear.NewAppError("sizeguard Quota must be positive with Store"))
+	}
+	proxies := gear.NewTrustedProxies(opts.TrustedProxies...)
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+
+		limit := opts.MaxBytes
+		if opts.Store != nil {
+			var key string
+			if opts.Key != nil {
+				key = opts.Key(ctx)
+			} else if ip := ctx.ClientIP(proxies); ip != nil {
+				key = ip.String()
+			} else {
+				return ErrUnknownClient
+			}
+			used, err := opts.Store.Used(key)
+			if err != nil {
+				return err
+			}
+			remaining := opts.Quota - used
+			if remaining <= 0 {
+				if opts.OnExceed != nil {
+					opts.OnExceed(ctx, ErrQuotaExceeded)
+				}
+				return ErrQuotaExceeded
+			}
+			if limit <= 0 || remaining < limit {
+				limit = remaining
+			}
+
+			res := ctx.Res
+			ctx.Defer(func() {
+				if n := res.BytesWritten(); n > 0 {
+					opts.Store.Add(key, n)
+				}
+			})
+		}
+
+		var onExceed func(int64)
+		if opts.OnExceed != nil {
+			onExceed = func(int64) {
+				opts.OnExceed(ctx, gear.ErrResponseTooLarge)
+			}
+		}
+		ctx.Res.SetLimit(limit, onExceed)
+		return nil
+	}
+}
+
+// NewMemoryStore creates an in-memory Store that counts the bytes per key in fixed windows
+// of the duration. The counts are not shared across the app instances.
+func NewMemoryStore(window time.Duration) Store {
+	if window <= 0 {
+		panic(gear.NewAppError("sizeguard window must be positive"))
+	}
+	return &memoryStore{window: window, usages: make(map[string]*usage)}
+}
+
+type usage struct {
+	bytes   int64
+	resetAt time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	window  time.Duration
+	usages  map[string]*usage
+	sweepAt time.Time
+}
+
+func (s *memoryStore) Used(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u := s.usages[key]; u != nil && time.Now().Before(u.resetAt) {
+		return u.bytes, nil
+	}
+	return 0, nil
+}
+
+func (s *memoryStore) Add(key string, n int64) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	u := s.usages[key]
+	if u == nil || !now.Before(u.resetAt) {
+		u = &usage{resetAt: now.Add(s.window)}
+		s.usages[key] = u
+	}
+	u.bytes += n
+	return nil
+}
+
+// sweep drops the expired usages once per window, it should be called with the lock held.
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Before(s.sweepAt) {
+		return
+	}
+	s.sweepAt = now.Add(s.window)
+	for key, u := range s.usages {
+		if !now.Before(u.resetAt) {
+			delete(s.usages, key)
+		}
+	}
+}
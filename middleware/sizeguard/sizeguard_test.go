@@ -0,0 +1,196 @@
+package sizeguard
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func request(url string) (string, *http.Response, error) {
+	res, err := DefaultClient.Get(url)
+	if err != nil {
+		panic(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res, err
+}
+
+type errorLog struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (l *errorLog) add(ctx *gear.Context, err error) {
+	l.mu.Lock()
+	l.errs = append(l.errs, err)
+	l.mu.Unlock()
+}
+
+func (l *errorLog) get() []error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]error(nil), l.errs...)
+}
+
+func newApp(opts Options) *gear.ServerListener {
+	app := gear.New()
+	app.Use(New(opts))
+	app.Use(func(ctx *gear.Context) error {
+		if ctx.Path == "/stream" {
+			ctx.Res.WriteHeader(200)
+			for i := 0; i < 4; i++ {
+				if _, err := ctx.Res.Write([]byte(strings.Repeat("a", 32))); err != nil {
+					return err
+				}
+				ctx.Res.Flush()
+			}
+			return nil
+		}
+		return ctx.HTML(200, strings.Repeat("a", len(ctx.Path)))
+	})
+	return app.Start()
+}
+
+func TestGearMiddlewareSizeGuard(t *testing.T) {
+	t.Run("Should panic with invalid options", func(t *testing.T) {
+		assert.Panics(t, func() {
+			New(Options{})
+		})
+		assert.Panics(t, func() {
+			New(Options{Store: NewMemoryStore(time.Minute)})
+		})
+		assert.Panics(t, func() {
+			NewMemoryStore(0)
+		})
+	})
+
+	t.Run("Should cap the response size", func(t *testing.T) {
+		assert := assert.New(t)
+
+		log := &errorLog{}
+		srv := newApp(Options{
+			MaxBytes: 64,
+			OnExceed: log.add,
+			Skipper: func(ctx *gear.Context) bool {
+				return ctx.Query("skip") != ""
+			},
+		})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, res, err := request(host + "/abc")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("aaaa", body)
+
+		body, res, err = request(host + "/" + strings.Repeat("x", 99))
+		assert.Nil(err)
+		assert.Equal(500, res.StatusCode)
+		assert.Equal(gear.ErrResponseTooLarge.Error(), body)
+
+		body, res, err = request(host + "/stream")
+		assert.NotNil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(64, len(body))
+		assert.Equal([]error{gear.ErrResponseTooLarge, gear.ErrResponseTooLarge}, log.get())
+
+		body, res, err = request(host + "/stream?skip=1")
+		assert.Nil(err)
+		assert.Equal(128, len(body))
+	})
+
+	t.Run("Should limit the egress per client", func(t *testing.T) {
+		assert := assert.New(t)
+
+		log := &errorLog{}
+		srv := newApp(Options{
+			Store:    NewMemoryStore(time.Minute),
+			Quota:    100,
+			OnExceed: log.add,
+			Key: func(ctx *gear.Context) string {
+				return ctx.Query("user")
+			},
+		})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, res, err := request(host + "/stream?user=a")
+		assert.NotNil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(96, len(body))
+
+		time.Sleep(10 * time.Millisecond) // wait for the deferred counting
+		body, res, err = request(host + "/abc?user=a")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("aaaa", body)
+
+		time.Sleep(10 * time.Millisecond)
+		body, res, err = request(host + "/abc?user=a")
+		assert.Nil(err)
+		assert.Equal(429, res.StatusCode)
+		assert.Equal(ErrQuotaExceeded.Error(), body)
+
+		body, res, err = request(host + "/abc?user=b")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal([]error{gear.ErrResponseTooLarge, ErrQuotaExceeded}, log.get())
+	})
+
+	t.Run("Should count the egress by the peer IP by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(Options{
+			Store: NewMemoryStore(time.Minute),
+			Quota: 8,
+		})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		req, _ := http.NewRequest("GET", host+"/abcdefg", nil)
+		req.Header.Set(gear.HeaderXForwardedFor, "1.1.1.1")
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+
+		time.Sleep(10 * time.Millisecond)
+		req, _ = http.NewRequest("GET", host+"/abc", nil)
+		req.Header.Set(gear.HeaderXForwardedFor, "2.2.2.2, 3.3.3.3")
+		res, err = DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(429, res.StatusCode)
+		res.Body.Close()
+
+		mw := New(Options{Store: NewMemoryStore(time.Minute), Quota: 8})
+		req, _ = http.NewRequest("GET", "http://example.com", nil)
+		req.RemoteAddr = "@"
+		assert.Equal(ErrUnknownClient, mw(gear.NewContext(gear.New(), nil, req)))
+	})
+
+	t.Run("Should reset the memory store by window", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s := NewMemoryStore(20 * time.Millisecond)
+		assert.Nil(s.Add("a", 10))
+		assert.Nil(s.Add("a", 5))
+		used, err := s.Used("a")
+		assert.Nil(err)
+		assert.Equal(int64(15), used)
+
+		time.Sleep(30 * time.Millisecond)
+		used, _ = s.Used("a")
+		assert.Equal(int64(0), used)
+		assert.Nil(s.Add("b", 1))
+		assert.Equal(1, len(s.(*memoryStore).usages))
+	})
+}
@@ -0,0 +1,158 @@
+package static
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Listing is the data to render the directory listing template.
+type Listing struct {
+	Path  string // the URL path of the directory, ends with "/"
+	Sort  string // the sort key: "name", "size" or "time"
+	Order string // the sort order: "asc" or "desc"
+	Files []ListingFile
+}
+
+// ListingFile is a file or subdirectory in the Listing.
+type ListingFile struct {
+	Name    string
+	URL     string // the escaped URL relative to the directory
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// SortURL returns the query URL to sort the listing by the key, the order is toggled if the
+// listing is sorted by the key already.
+func (l *Listing) SortURL(key string) string {
+	order := "asc"
+	if l.Sort == key && l.Order == "asc" {
+		order = "desc"
+	}
+	return "?sort=" + key + "&order=" + order
+}
+
+// DefaultBrowseTemplate is the default template of the directory listing.
+var DefaultBrowseTemplate = template.Must(template.New("browse").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+<style>body{font-family:sans-serif}td,th{padding:2px 16px 2px 0;text-align:left}</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th><a href="{{.SortURL "name"}}">Name</a></th><th><a href="{{.SortURL "size"}}">Size</a></th><th><a href="{{.SortURL "time"}}">Modified</a></th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Files}}<tr><td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if .IsDir}}-{{else}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// browsable checks whether the directory of the URL path can be listed.
+func (opts *Options) browsable(urlPath string) bool {
+	if !opts.Browse {
+		return false
+	}
+	for _, dir := range opts.NoBrowse {
+		dir = strings.TrimSuffix(dir, "/") + "/"
+		if strings.HasPrefix(urlPath, dir) {
+			return false
+		}
+	}
+	return true
+}
+
+// browse renders the listing of the directory, the hidden files (starting with ".") are omitted.
+func browse(ctx *gear.Context, tpl *template.Template, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	listing := &Listing{
+		Path:  ctx.Path,
+		Sort:  ctx.Query("sort"),
+		Order: ctx.Query("order"),
+		Files: make([]ListingFile, 0, len(entries)),
+	}
+	if listing.Sort != "size" && listing.Sort != "time" {
+		listing.Sort = "name"
+	}
+	if listing.Order != "desc" {
+		listing.Order = "asc"
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		file := ListingFile{
+			Name:    name,
+			URL:     (&url.URL{Path: "./" + name}).String(),
+			IsDir:   info.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if file.IsDir {
+			file.URL += "/"
+		}
+		listing.Files = append(listing.Files, file)
+	}
+	sortListing(listing)
+
+	if tpl == nil {
+		tpl = DefaultBrowseTemplate
+	}
+	buf := new(bytes.Buffer)
+	if err = tpl.Execute(buf, listing); err != nil {
+		return err
+	}
+	return ctx.HTML(200, buf.String())
+}
+
+// sortListing sorts the files by the listing's sort key and order, the directories first.
+func sortListing(l *Listing) {
+	sort.SliceStable(l.Files, func(i, j int) bool {
+		a, b := l.Files[i], l.Files[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if l.Order == "desc" {
+			a, b = b, a
+		}
+		switch l.Sort {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "time":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+func isDir(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+func hasIndex(dir string) bool {
+	return isFile(filepath.Join(dir, "index.html"))
+}
@@ -3,6 +3,7 @@ package static
 import (
 	"bytes"
 	"fmt"
+	"html/template"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,9 +19,25 @@ type Options struct {
 	Prefix      string            // The url prefix you wish to serve as static request, default to `'/'`.
 	StripPrefix bool              // Strip the prefix from URL path, default to `false`.
 	Files       map[string][]byte // Optional, a map of File objects to serve.
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+	// Browse enables the listing of the directories without index.html, optional.
+	// The directories are responded with 404 if it is disabled.
+	Browse bool
+	// BrowseTemplate is the template to render the directory listing with *Listing,
+	// default to DefaultBrowseTemplate.
+	BrowseTemplate *template.Template
+	// NoBrowse disables the listing of the directories (and their subdirectories)
+	// by URL paths (such as "/private") when Browse enabled, optional.
+	NoBrowse []string
+	// Reload serves the files in the Root directory prior to the Files map with
+	// "Cache-Control: no-cache" header, so that the edits are visible immediately.
+	// It is useful for development, default to false.
+	Reload bool
 }
 
 // New creates a static middleware to serves static content from the provided root directory.
+// The directories without index.html are listed only if Browse enabled.
 //
 //  package main
 //
@@ -68,7 +85,7 @@ func New(opts Options) gear.Middleware {
 
 	return func(ctx *gear.Context) (err error) {
 		path := ctx.Path
-		if !strings.HasPrefix(path, opts.Prefix) {
+		if !strings.HasPrefix(path, opts.Prefix) || (opts.Skipper != nil && opts.Skipper(ctx)) {
 			return nil
 		}
 
@@ -84,14 +101,29 @@ func New(opts Options) gear.Middleware {
 		if opts.StripPrefix {
 			path = strings.TrimPrefix(path, opts.Prefix)
 		}
-		if opts.Files != nil {
+		filePath := filepath.Join(root, filepath.FromSlash(path))
+		if opts.Reload {
+			ctx.Set(gear.HeaderCacheControl, "no-cache")
+		}
+		if opts.Files != nil && !(opts.Reload && isFile(filePath)) {
 			if file, ok := opts.Files[path]; ok {
 				http.ServeContent(ctx.Res, ctx.Req, path, modTime, bytes.NewReader(file))
 				return nil
 			}
 		}
-		path = filepath.Join(root, filepath.FromSlash(path))
-		http.ServeFile(ctx.Res, ctx.Req, path)
+		if strings.HasSuffix(ctx.Path, "/") && isDir(filePath) && !hasIndex(filePath) {
+			if !opts.browsable(ctx.Path) {
+				http.NotFound(ctx.Res, ctx.Req)
+				return nil
+			}
+			return browse(ctx, opts.BrowseTemplate, filePath)
+		}
+		http.ServeFile(ctx.Res, ctx.Req, filePath)
 		return nil
 	}
 }
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -1,8 +1,12 @@
 package static
 
 import (
+	"html/template"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -186,3 +190,157 @@ func TestGearMiddlewareStaticWithFileMap(t *testing.T) {
 		res.Body.Close()
 	})
 }
+
+func TestGearMiddlewareStaticReload(t *testing.T) {
+	files := map[string][]byte{"/hello.html": []byte("cached")}
+
+	t.Run("Should serve from system when Reload enabled", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Root: "../../testdata", Files: files, Reload: true}))
+		srv := app.Start()
+		defer srv.Close()
+
+		res, err := RequestBy("GET", "http://"+srv.Addr().String()+"/hello.html")
+		assert.Nil(err)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("no-cache", res.Header.Get(gear.HeaderCacheControl))
+		assert.Contains(string(body), "Hello, Gear!")
+	})
+
+	t.Run("Should serve from FileMap by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Set(gear.SetEnv, "development")
+		app.Use(New(Options{Root: "../../testdata", Files: files}))
+		srv := app.Start()
+		defer srv.Close()
+
+		res, err := RequestBy("GET", "http://"+srv.Addr().String()+"/hello.html")
+		assert.Nil(err)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("", res.Header.Get(gear.HeaderCacheControl))
+		assert.Equal("cached", string(body))
+	})
+}
+
+func TestGearMiddlewareStaticSkipper(t *testing.T) {
+	assert := assert.New(t)
+
+	app := gear.New()
+	app.Use(New(Options{
+		Root: "../../testdata",
+		Skipper: func(ctx *gear.Context) bool {
+			return ctx.Path == "/README.md"
+		},
+	}))
+	app.Use(func(ctx *gear.Context) error {
+		return ctx.HTML(200, "skipped")
+	})
+	srv := app.Start()
+	defer srv.Close()
+
+	res, err := RequestBy("GET", "http://"+srv.Addr().String()+"/README.md")
+	assert.Nil(err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal("skipped", string(body))
+}
+
+func TestGearMiddlewareStaticBrowse(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs", "sub"), 0755)
+	os.MkdirAll(filepath.Join(root, "private", "sub"), 0755)
+	os.MkdirAll(filepath.Join(root, "site"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "docs", "a b.txt"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "docs", "c.txt"), []byte("hi"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "docs", ".secret"), []byte("secret"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "site", "index.html"), []byte("index"), 0644)
+
+	get := func(srv *gear.ServerListener, path string) (int, string) {
+		res, err := RequestBy("GET", "http://"+srv.Addr().String()+path)
+		if err != nil {
+			panic(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res.StatusCode, string(body)
+	}
+
+	t.Run("should not list directories by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Root: root}))
+		srv := app.Start()
+		defer srv.Close()
+
+		code, _ := get(srv, "/docs/")
+		assert.Equal(404, code)
+		code, body := get(srv, "/site/")
+		assert.Equal(200, code)
+		assert.Equal("index", body)
+	})
+
+	t.Run("should list directories", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Root: root, Browse: true, NoBrowse: []string{"/private"}}))
+		srv := app.Start()
+		defer srv.Close()
+
+		code, body := get(srv, "/docs")
+		assert.Equal(200, code)
+		assert.Contains(body, "<title>Index of /docs/</title>")
+		assert.Contains(body, `<a href="./a%20b.txt">a b.txt</a></td><td>5</td>`)
+		assert.Contains(body, `<a href="./sub/">sub/</a></td><td>-</td>`)
+		assert.Contains(body, `<a href="../">../</a>`)
+		assert.Contains(body, `<a href="?sort=name&amp;order=desc">Name</a>`)
+		assert.NotContains(body, ".secret")
+		assert.True(strings.Index(body, "sub/") < strings.Index(body, "a b.txt"))
+		assert.True(strings.Index(body, "a b.txt") < strings.Index(body, "c.txt"))
+
+		code, body = get(srv, "/docs/?sort=size&order=desc")
+		assert.Equal(200, code)
+		assert.True(strings.Index(body, "a b.txt") < strings.Index(body, "c.txt"))
+		assert.Contains(body, `<a href="?sort=size&amp;order=asc">Size</a>`)
+
+		code, body = get(srv, "/")
+		assert.Equal(200, code)
+		assert.NotContains(body, `<a href="../">`)
+
+		code, _ = get(srv, "/private/")
+		assert.Equal(404, code)
+		code, _ = get(srv, "/private/sub/")
+		assert.Equal(404, code)
+		code, body = get(srv, "/docs/c.txt")
+		assert.Equal(200, code)
+		assert.Equal("hi", body)
+	})
+
+	t.Run("should list directories with the template", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{
+			Root:           root,
+			Prefix:         "/files",
+			StripPrefix:    true,
+			Browse:         true,
+			BrowseTemplate: template.Must(template.New("").Parse(`{{.Path}}:{{range .Files}}{{.Name}},{{end}}`)),
+		}))
+		srv := app.Start()
+		defer srv.Close()
+
+		code, body := get(srv, "/files/docs/?sort=time")
+		assert.Equal(200, code)
+		assert.Equal("/files/docs/:sub,a b.txt,c.txt,", body)
+	})
+}
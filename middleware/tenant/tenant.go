@@ -0,0 +1,168 @@
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/teambition/gear"
+	"github.com/teambition/gear/logging"
+)
+
+// Tenant is the tenant resolved for the request.
+type Tenant struct {
+	ID   string
+	Name string
+	// Meta holds the application defined data of the tenant, such as the plan or the database.
+	Meta map[string]interface{}
+}
+
+// Lookup finds the tenant by the key resolved from the request, it should return nil tenant
+// and nil error if the tenant does not exist.
+type Lookup interface {
+	Lookup(ctx context.Context, key string) (*Tenant, error)
+}
+
+// LookupFunc is an adapter to use a function as Lookup.
+type LookupFunc func(ctx context.Context, key string) (*Tenant, error)
+
+// Lookup implemented Lookup interface.
+func (fn LookupFunc) Lookup(ctx context.Context, key string) (*Tenant, error) {
+	return fn(ctx, key)
+}
+
+// Options is tenant middleware options. The key is resolved from Subdomain, Header and
+// PathPrefix in order, the first one found is used. At least one of them is required.
+type Options struct {
+	// Lookup finds the tenant by the key, required.
+	Lookup Lookup
+	// Subdomain defines the base domain to resolve the key from the subdomain, such as
+	// "example.com", then the key of "acme.example.com" is "acme".
+	Subdomain string
+	// Header defines the request header to resolve the key from, such as "X-Tenant-ID".
+	Header string
+	// PathPrefix resolves the key from the first path segment, such as "acme" of "/acme/users",
+	// the segment is stripped from the path when the tenant found, so the router sees "/users".
+	PathPrefix bool
+	// Optional lets the request without key go through without tenant, otherwise it is
+	// responded with 400 Bad Request. The request with unknown key is always responded with
+	// 404 Not Found.
+	Optional bool
+	// Logger adds the "Tenant" field with the tenant ID to the request log of the logger. Optional.
+	Logger *logging.Logger
+	// OnResolve is called when the tenant resolved, it can be used to tag the metrics or traces
+	// with the tenant ID. Optional.
+	OnResolve func(ctx *gear.Context, t *Tenant)
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+type ctxKey struct{}
+
+// FromCtx returns the tenant of the request, it returns nil if no tenant resolved.
+func FromCtx(ctx *gear.Context) *Tenant {
+	if val, err := ctx.Any(ctxKey{}); err == nil {
+		return val.(*Tenant)
+	}
+	return nil
+}
+
+// New creates a middleware that resolves the tenant of the request and attaches it to ctx.
+//
+//  app.UseHandler(logger)
+//  app.Use(tenant.New(tenant.Options{
+//  	Subdomain: "example.com",
+//  	Header:    "X-Tenant-ID",
+//  	Lookup:    tenant.LookupFunc(tenants.FindBySlug),
+//  	Logger:    logger,
+//  }))
+//  app.Use(func(ctx *gear.Context) error {
+//  	t := tenant.FromCtx(ctx)
+//  	return ctx.HTML(200, "Hello, "+t.Name)
+//  })
+//
+func New(opts Options) gear.Middleware {
+	if opts.Lookup == nil {
+		panic(gear.NewAppError("tenant lookup required"))
+	}
+	if opts.Subdomain == "" && opts.Header == "" && !opts.PathPrefix {
+		panic(gear.NewAppError("tenant source required"))
+	}
+	suffix := "." + strings.ToLower(strings.Trim(opts.Subdomain, "."))
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+
+		key, fromPath := "", false
+		if opts.Subdomain != "" {
+			key = subdomain(ctx.Host, suffix)
+		}
+		if key == "" && opts.Header != "" {
+			key = ctx.Get(opts.Header)
+		}
+		if key == "" && opts.PathPrefix {
+			key, fromPath = firstSegment(ctx.Path), true
+		}
+		if key == "" {
+			if opts.Optional {
+				return nil
+			}
+			return &gear.Error{Code: http.StatusBadRequest, Msg: "tenant required"}
+		}
+
+		t, err := opts.Lookup.Lookup(ctx, key)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return &gear.Error{Code: http.StatusNotFound, Msg: "tenant not found"}
+		}
+		if fromPath {
+			stripPrefix(ctx, len(key)+1)
+		}
+		ctx.SetAny(ctxKey{}, t)
+		if opts.Logger != nil {
+			opts.Logger.FromCtx(ctx)["Tenant"] = t.ID
+		}
+		if opts.OnResolve != nil {
+			opts.OnResolve(ctx, t)
+		}
+		return nil
+	}
+}
+
+func subdomain(host, suffix string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	sub := host[:len(host)-len(suffix)]
+	if strings.Contains(sub, ".") {
+		return "" // only one level
+	}
+	return sub
+}
+
+func firstSegment(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func stripPrefix(ctx *gear.Context, n int) {
+	path := ctx.Path[n:]
+	if path == "" {
+		path = "/"
+	}
+	ctx.Path = path
+	ctx.Req.URL.Path = path
+	ctx.Req.URL.RawPath = ""
+}
@@ -0,0 +1,142 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+	"github.com/teambition/gear/logging"
+)
+
+var DefaultClient = &http.Client{}
+
+var tenants = LookupFunc(func(ctx context.Context, key string) (*Tenant, error) {
+	switch key {
+	case "acme":
+		return &Tenant{ID: "t1", Name: "Acme"}, nil
+	case "globex":
+		return &Tenant{ID: "t2", Name: "Globex"}, nil
+	case "broken":
+		return nil, errors.New("database down")
+	}
+	return nil, nil
+})
+
+func newApp(opts Options) *gear.ServerListener {
+	app := gear.New()
+	app.Use(New(opts))
+	router := gear.NewRouter()
+	router.Get("/users", func(ctx *gear.Context) error {
+		name := "none"
+		if t := FromCtx(ctx); t != nil {
+			name = t.Name
+		}
+		return ctx.HTML(200, name+" "+ctx.Path)
+	})
+	app.UseHandler(router)
+	return app.Start()
+}
+
+func request(url, host string, header map[string]string) (string, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if host != "" {
+		req.Host = host
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res
+}
+
+func TestGearMiddlewareTenant(t *testing.T) {
+	t.Run("Should panic with invalid options", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() { New(Options{Header: "X-Tenant-ID"}) })
+		assert.Panics(func() { New(Options{Lookup: tenants}) })
+	})
+
+	t.Run("Should resolve from subdomain, header and path prefix in order", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(Options{Lookup: tenants, Subdomain: "example.com", Header: "X-Tenant-ID", PathPrefix: true})
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		body, _ := request(host+"/users", "Acme.Example.com:8080", map[string]string{"X-Tenant-ID": "globex"})
+		assert.Equal("Acme /users", body)
+		body, _ = request(host+"/users", "a.b.example.com", map[string]string{"X-Tenant-ID": "globex"})
+		assert.Equal("Globex /users", body)
+		body, _ = request(host+"/globex/users", "example.com", nil)
+		assert.Equal("Globex /users", body)
+
+		_, res := request(host+"/users", "", nil)
+		assert.Equal(404, res.StatusCode) // "users" as the key
+		_, res = request(host+"/users", "unknown.example.com", nil)
+		assert.Equal(404, res.StatusCode)
+		_, res = request(host+"/users", "broken.example.com", nil)
+		assert.Equal(500, res.StatusCode)
+	})
+
+	t.Run("Should respond 400 without key unless optional", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := newApp(Options{Lookup: tenants, Header: "X-Tenant-ID"})
+		defer srv.Close()
+		_, res := request("http://"+srv.Addr().String()+"/users", "", nil)
+		assert.Equal(400, res.StatusCode)
+
+		srv2 := newApp(Options{Lookup: tenants, Header: "X-Tenant-ID", Optional: true})
+		defer srv2.Close()
+		body, res := request("http://"+srv2.Addr().String()+"/users", "", nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("none /users", body)
+	})
+
+	t.Run("Should tag the log and call OnResolve", func(t *testing.T) {
+		assert := assert.New(t)
+
+		logged := make(chan interface{}, 1)
+		logger := logging.New(ioutil.Discard)
+		logger.SetLogConsume(func(log logging.Log, _ *gear.Context) {
+			logged <- log["Tenant"]
+		})
+		var resolved string
+		app := gear.New()
+		app.UseHandler(logger)
+		app.Use(New(Options{
+			Lookup: tenants,
+			Header: "X-Tenant-ID",
+			Logger: logger,
+			OnResolve: func(ctx *gear.Context, t *Tenant) {
+				resolved = t.ID
+			},
+		}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, "OK")
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		_, res := request("http://"+srv.Addr().String(), "", map[string]string{"X-Tenant-ID": "acme"})
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("t1", resolved)
+		select {
+		case tenant := <-logged:
+			assert.Equal("t1", tenant)
+		case <-time.After(time.Second):
+			assert.Fail("log not consumed")
+		}
+	})
+}
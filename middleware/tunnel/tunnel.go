@@ -0,0 +1,175 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Options is tunnel middleware options.
+type Options struct {
+	// Allow defines the allowed target hosts, it is required. The host can be "example.com:443"
+	// to allow the port, "example.com" to allow any port, "*.example.com:443" to allow the
+	// subdomains, or "*" to allow any target (do not use it on a public server).
+	Allow []string
+	// Authorize is called before the tunnel established, such as checking the
+	// "Proxy-Authorization" header. The tunnel is rejected if it returns an error, optional.
+	Authorize func(ctx *gear.Context, target string) error
+	// DialTimeout defines the timeout to connect the target, default to 10 seconds.
+	DialTimeout time.Duration
+	// IdleTimeout defines the maximum time that no data transferred in both directions,
+	// the tunnel will be closed after it. Default to 5 minutes.
+	IdleTimeout time.Duration
+	// Dial defines a function to connect the target, default to net.Dialer with DialTimeout.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// New creates a middleware that handles the CONNECT requests by establishing a bidirectional
+// TCP tunnel to the target host, so that the app can act as a forward proxy (such as the HTTPS
+// proxy of the clients). The connection is hijacked, and closed when the either side closed or
+// the tunnel is idle. The other requests will go through. The HTTP/2 CONNECT is not supported.
+//
+//  app.Use(tunnel.New(tunnel.Options{
+//  	Allow:       []string{"*.example.com:443", "api.github.com:443"},
+//  	IdleTimeout: time.Minute,
+//  }))
+//
+func New(opts Options) gear.Middleware {
+	if len(opts.Allow) == 0 {
+		panic(gear.NewAppError("tunnel allowed hosts required"))
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 10 * time.Second
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 5 * time.Minute
+	}
+	if opts.Dial == nil {
+		opts.Dial = (&net.Dialer{Timeout: opts.DialTimeout}).DialContext
+	}
+	allow := make([]string, len(opts.Allow))
+	for i, host := range opts.Allow {
+		allow[i] = strings.ToLower(host)
+	}
+
+	return func(ctx *gear.Context) error {
+		if ctx.Method != http.MethodConnect {
+			return nil
+		}
+		target := ctx.Req.Host
+		host, port, err := net.SplitHostPort(target)
+		if err != nil || host == "" || port == "" {
+			return &gear.Error{Code: http.StatusBadRequest, Msg: "invalid tunnel target: " + target}
+		}
+		if !allowed(allow, strings.ToLower(host), port) {
+			return &gear.Error{Code: http.StatusForbidden, Msg: "tunnel target not allowed: " + target}
+		}
+		if opts.Authorize != nil {
+			if err = opts.Authorize(ctx, target); err != nil {
+				return err
+			}
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, opts.DialTimeout)
+		conn, err := opts.Dial(dialCtx, "tcp", target)
+		cancel()
+		if err != nil {
+			return &gear.Error{Code: http.StatusBadGateway, Msg: "tunnel dial failed: " + err.Error()}
+		}
+
+		client, rw, err := ctx.Res.Hijack()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		if _, err = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+			client.Close()
+			conn.Close()
+			return nil
+		}
+		// the client may have sent data after the request, it is buffered in rw.Reader.
+		pipe(client, rw.Reader, conn, opts.IdleTimeout)
+		return nil
+	}
+}
+
+// allowed checks the host and port by the allowed hosts.
+func allowed(allow []string, host, port string) bool {
+	for _, pattern := range allow {
+		if pattern == "*" {
+			return true
+		}
+		h, p, err := net.SplitHostPort(pattern)
+		if err != nil {
+			h, p = pattern, ""
+		}
+		if p != "" && p != port {
+			continue
+		}
+		if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// pipe copies the data in both directions until both directions finished or the tunnel is idle.
+// The deadlines of both connections are extended on every read, so an active direction keeps
+// the other one alive.
+func pipe(client net.Conn, clientReader io.Reader, target net.Conn, idle time.Duration) {
+	touch := func() {
+		deadline := time.Now().Add(idle)
+		client.SetDeadline(deadline)
+		target.SetDeadline(deadline)
+	}
+	var closeOnce sync.Once
+	closeAll := func() {
+		closeOnce.Do(func() {
+			client.Close()
+			target.Close()
+		})
+	}
+	defer closeAll()
+
+	var wg sync.WaitGroup
+	transfer := func(dst net.Conn, src io.Reader) {
+		defer wg.Done()
+		buf := make([]byte, 32*1024)
+		for {
+			touch()
+			n, err := src.Read(buf)
+			if n > 0 {
+				if _, werr := dst.Write(buf[:n]); werr != nil {
+					closeAll()
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					// idle timeout or connection error, stop both directions
+					closeAll()
+					return
+				}
+				// half close, the other direction may still transfer data
+				if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+					cw.CloseWrite()
+				} else {
+					closeAll()
+				}
+				return
+			}
+		}
+	}
+
+	touch()
+	wg.Add(2)
+	go transfer(target, clientReader)
+	go transfer(client, target)
+	wg.Wait()
+}
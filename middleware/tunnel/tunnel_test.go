@@ -0,0 +1,175 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+func newEchoServer() net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+func connect(addr, target string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	conn.Write([]byte("CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		panic(err)
+	}
+	return conn, br, res
+}
+
+func TestGearMiddlewareTunnel(t *testing.T) {
+	echo := newEchoServer()
+	defer echo.Close()
+	target := echo.Addr().String()
+
+	t.Run("Should panic without allowed hosts", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() {
+			New(Options{})
+		})
+	})
+
+	t.Run("Should establish the tunnel", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Allow: []string{"127.0.0.1"}}))
+		app.Use(func(ctx *gear.Context) error {
+			return ctx.HTML(200, "OK")
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		conn, br, res := connect(srv.Addr().String(), target)
+		defer conn.Close()
+		assert.Equal(200, res.StatusCode)
+
+		for _, msg := range []string{"hello", "gear"} {
+			conn.Write([]byte(msg))
+			buf := make([]byte, len(msg))
+			_, err := io.ReadFull(br, buf)
+			assert.Nil(err)
+			assert.Equal(msg, string(buf))
+		}
+		conn.(*net.TCPConn).CloseWrite()
+		rest, err := ioutil.ReadAll(br)
+		assert.Nil(err)
+		assert.Equal("", string(rest))
+
+		res, err = http.Get("http://" + srv.Addr().String())
+		assert.Nil(err)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal("OK", string(body))
+	})
+
+	t.Run("Should reject the bad or disallowed targets", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{
+			Allow: []string{"127.0.0.1:1", "*.example.com:443", "localhost"},
+			Authorize: func(ctx *gear.Context, target string) error {
+				if ctx.Req.Header.Get(gear.HeaderProxyAuthorization) != "Basic dGVzdDp0ZXN0" {
+					return &gear.Error{Code: http.StatusProxyAuthRequired, Msg: "proxy auth required"}
+				}
+				return nil
+			},
+			Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return nil, errors.New("unreachable")
+			},
+		}))
+		srv := app.Start()
+		defer srv.Close()
+		addr := srv.Addr().String()
+
+		conn, _, res := connect(addr, "127.0.0.1")
+		conn.Close()
+		assert.Equal(400, res.StatusCode)
+
+		conn, _, res = connect(addr, target)
+		conn.Close()
+		assert.Equal(403, res.StatusCode)
+
+		conn, _, res = connect(addr, "example.com:443")
+		conn.Close()
+		assert.Equal(403, res.StatusCode)
+
+		conn, _, res = connect(addr, "api.example.com:443")
+		conn.Close()
+		assert.Equal(407, res.StatusCode)
+
+		conn, err := net.Dial("tcp", addr)
+		assert.Nil(err)
+		conn.Write([]byte("CONNECT localhost:8080 HTTP/1.1\r\nHost: localhost:8080\r\nProxy-Authorization: Basic dGVzdDp0ZXN0\r\n\r\n"))
+		res, err = http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+		assert.Nil(err)
+		assert.Equal(502, res.StatusCode)
+		conn.Close()
+	})
+
+	t.Run("Should close the idle tunnel", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Allow: []string{"*"}, IdleTimeout: 50 * time.Millisecond}))
+		srv := app.Start()
+		defer srv.Close()
+
+		conn, br, res := connect(srv.Addr().String(), target)
+		defer conn.Close()
+		assert.Equal(200, res.StatusCode)
+
+		start := time.Now()
+		_, err := br.ReadByte()
+		assert.Equal(io.EOF, err)
+		assert.True(time.Since(start) < time.Second)
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		allow := []string{"example.com", "*.test.com:443", "[::1]:8080"}
+		assert.True(allowed(allow, "example.com", "80"))
+		assert.False(allowed(allow, "www.example.com", "80"))
+		assert.True(allowed(allow, "a.test.com", "443"))
+		assert.True(allowed(allow, "a.b.test.com", "443"))
+		assert.False(allowed(allow, "test.com", "443"))
+		assert.False(allowed(allow, "a.test.com", "80"))
+		assert.True(allowed(allow, "::1", "8080"))
+		assert.False(allowed(allow, "evil.com", "443"))
+	})
+}
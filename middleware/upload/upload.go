@@ -0,0 +1,391 @@
+package upload
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// ErrOffsetMismatch is returned by Store.Append when the offset is not the current offset of
+// the upload, such as another chunk of the same upload has been appended concurrently.
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+// Upload is the state of a partial upload.
+type Upload struct {
+	ID string
+	// Offset is the count of the bytes received.
+	Offset int64
+	// Size is the total size of the upload, -1 if unknown.
+	Size int64
+}
+
+// Complete returns true if all the bytes of the upload are received.
+func (u *Upload) Complete() bool {
+	return u.Size >= 0 && u.Offset == u.Size
+}
+
+// Store is the storage of the upload sessions.
+type Store interface {
+	// Get returns the upload, it should return nil upload and nil error if not exists.
+	Get(id string) (*Upload, error)
+	// Append appends the chunk to the upload at the offset, the upload is created if not
+	// exists. size is the total size of the upload, -1 if unknown. It should return
+	// ErrOffsetMismatch if the offset is not the current offset of the upload.
+	Append(id string, offset, size int64, chunk io.Reader) (*Upload, error)
+	// Open opens the content of the upload to read.
+	Open(id string) (io.ReadCloser, error)
+	// Delete deletes the upload.
+	Delete(id string) error
+}
+
+// Options is upload middleware options.
+type Options struct {
+	// Store defines the storage of the upload sessions, required.
+	Store Store
+	// ID returns the ID of the upload session of the request, such as the authenticated user ID
+	// with the request path, so that the chunks of the different users uploading to the same
+	// path will not interleave. Required.
+	ID func(ctx *gear.Context) string
+	// MaxSize limits the total size of the upload, the larger one is responded with 413
+	// Request Entity Too Large. Default to 1GB.
+	MaxSize int64
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+type ctxKey struct{}
+
+// FromCtx returns the completed upload of the request, it returns nil if the request is not a
+// partial upload.
+func FromCtx(ctx *gear.Context) *Upload {
+	if val, err := ctx.Any(ctxKey{}); err == nil {
+		return val.(*Upload)
+	}
+	return nil
+}
+
+// New creates a middleware that assembles the PUT and PATCH uploads sent in chunks with the
+// Content-Range header, such as "bytes 0-1048575/5242880" ("*" for the unknown total size).
+// The chunks should be sent in order, the chunk overlapped with the received bytes is trimmed,
+// so the client can retry a chunk safely. The incomplete upload is responded with 308 and the
+// Range header of the received bytes, such as "bytes=0-1048575", and "Content-Range: bytes
+// */5242880" with empty body queries the state. When the last chunk is received, the
+// request body is replaced with the whole content and the handlers run as with a normal
+// upload, the upload is deleted from the Store if they respond a non-error status.
+// The requests without Content-Range go through.
+//
+//  router.Put("/files/:name", upload.New(upload.Options{
+//  	Store: upload.NewDirStore("/var/tmp/uploads", 24*time.Hour),
+//  	ID: func(ctx *gear.Context) string {
+//  		return userID(ctx) + ":" + ctx.Path
+//  	},
+//  }), saveFile)
+//
+func New(opts Options) gear.Middleware {
+	if opts.Store == nil {
+		panic(gear.NewAppError("upload store required"))
+	}
+	if opts.ID == nil {
+		panic(gear.NewAppError("upload ID required"))
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 1 << 30
+	}
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+		if ctx.Method != http.MethodPut && ctx.Method != http.MethodPatch {
+			return nil
+		}
+		header := ctx.Get(gear.HeaderContentRange)
+		if header == "" {
+			return nil
+		}
+		first, last, size, ok := parseContentRange(header)
+		if !ok {
+			return &gear.Error{Code: http.StatusBadRequest, Msg: "invalid Content-Range: " + header}
+		}
+		if size > opts.MaxSize || last >= opts.MaxSize {
+			return &gear.Error{Code: http.StatusRequestEntityTooLarge, Msg: "upload too large"}
+		}
+
+		id := opts.ID(ctx)
+		u, err := opts.Store.Get(id)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			u = &Upload{ID: id, Size: -1}
+		}
+		if u.Size >= 0 && size >= 0 && size != u.Size {
+			return &gear.Error{Code: http.StatusRequestedRangeNotSatisfiable, Msg: "upload size changed"}
+		}
+
+		if first >= 0 {
+			if first > u.Offset {
+				return &gear.Error{Code: http.StatusRequestedRangeNotSatisfiable,
+					Msg: "chunk not contiguous, expected offset " + strconv.FormatInt(u.Offset, 10)}
+			}
+			if ctx.Req.ContentLength >= 0 && ctx.Req.ContentLength != last-first+1 {
+				return &gear.Error{Code: http.StatusBadRequest, Msg: "Content-Length mismatched Content-Range"}
+			}
+			if last >= u.Offset {
+				// trim the received bytes of the retried chunk
+				if _, err = io.CopyN(ioutil.Discard, ctx.Req.Body, u.Offset-first); err != nil {
+					return &gear.Error{Code: http.StatusBadRequest, Msg: err.Error()}
+				}
+				chunk := io.LimitReader(ctx.Req.Body, last-u.Offset+1)
+				if u, err = opts.Store.Append(id, u.Offset, size, chunk); err != nil {
+					if err == ErrOffsetMismatch {
+						return &gear.Error{Code: http.StatusConflict, Msg: err.Error()}
+					}
+					return err
+				}
+				if u.Offset != last+1 {
+					return &gear.Error{Code: http.StatusBadRequest, Msg: "incomplete chunk"}
+				}
+			}
+		}
+
+		if !u.Complete() {
+			if u.Offset > 0 {
+				ctx.Set(gear.HeaderRange, "bytes=0-"+strconv.FormatInt(u.Offset-1, 10))
+			}
+			return ctx.End(http.StatusPermanentRedirect)
+		}
+		body, err := opts.Store.Open(id)
+		if err != nil {
+			return err
+		}
+		ctx.Req.Body = body
+		ctx.Req.ContentLength = u.Size
+		ctx.Req.Header.Set(gear.HeaderContentLength, strconv.FormatInt(u.Size, 10))
+		ctx.Req.Header.Del(gear.HeaderContentRange)
+		ctx.SetAny(ctxKey{}, u)
+		ctx.OnEnd(func() {
+			body.Close()
+			if ctx.Res.Status() < 400 {
+				opts.Store.Delete(id)
+			}
+		})
+		return nil
+	}
+}
+
+// parseContentRange parses "bytes first-last/size" or "bytes */size", first and last are -1
+// for the latter, size is -1 if it is "*".
+func parseContentRange(s string) (first, last, size int64, ok bool) {
+	if !strings.HasPrefix(s, "bytes ") {
+		return
+	}
+	s = strings.TrimSpace(s[6:])
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return
+	}
+	rng, total := s[:i], s[i+1:]
+	size = -1
+	if total != "*" {
+		var err error
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil || size < 0 {
+			return
+		}
+	}
+	if rng == "*" {
+		return -1, -1, size, size >= 0
+	}
+	j := strings.IndexByte(rng, '-')
+	if j < 0 {
+		return
+	}
+	var err error
+	if first, err = strconv.ParseInt(rng[:j], 10, 64); err != nil || first < 0 {
+		return
+	}
+	if last, err = strconv.ParseInt(rng[j+1:], 10, 64); err != nil || last < first {
+		return
+	}
+	if size >= 0 && last >= size {
+		return
+	}
+	return first, last, size, true
+}
+
+// DirStore is a Store that keeps the uploads as files in a directory.
+type DirStore struct {
+	dir     string
+	ttl     time.Duration
+	mu      sync.Mutex
+	locks   map[string]*sync.Mutex
+	sweepAt time.Time
+}
+
+// NewDirStore creates a DirStore instance with the directory, the directory is created if
+// not exists. The uploads not appended in the ttl are expired, and removed from the directory
+// once per ttl, so the abandoned uploads don't fill the disk. The ttl defaults to 24 hours.
+func NewDirStore(dir string, ttl time.Duration) *DirStore {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		panic(gear.NewAppError(err.Error()))
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &DirStore{dir: dir, ttl: ttl, locks: make(map[string]*sync.Mutex)}
+}
+
+type dirMeta struct {
+	ID   string `json:"id"`
+	Size int64  `json:"size"`
+}
+
+func (s *DirStore) path(id string) string {
+	sum := sha1.Sum([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *DirStore) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[id] = l
+	}
+	s.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+func (s *DirStore) get(id string) (*Upload, error) {
+	p := s.path(id)
+	buf, err := ioutil.ReadFile(p + ".json")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta := &dirMeta{}
+	if err = json.Unmarshal(buf, meta); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p + ".part")
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(fi.ModTime()) > s.ttl {
+		return nil, s.remove(id)
+	}
+	return &Upload{ID: id, Offset: fi.Size(), Size: meta.Size}, nil
+}
+
+// remove removes the files of the upload, it should be called with the lock of the id held.
+func (s *DirStore) remove(id string) error {
+	p := s.path(id)
+	err := os.Remove(p + ".part")
+	if e := os.Remove(p + ".json"); err == nil {
+		err = e
+	}
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// sweep removes the expired uploads once per ttl.
+func (s *DirStore) sweep() {
+	now := time.Now()
+	s.mu.Lock()
+	if now.Before(s.sweepAt) {
+		s.mu.Unlock()
+		return
+	}
+	s.sweepAt = now.Add(s.ttl)
+	s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, fi := range files {
+		if !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		meta := &dirMeta{}
+		buf, err := ioutil.ReadFile(filepath.Join(s.dir, fi.Name()))
+		if err != nil || json.Unmarshal(buf, meta) != nil {
+			continue
+		}
+		unlock := s.lock(meta.ID)
+		s.get(meta.ID) // removes the expired one
+		unlock()
+	}
+}
+
+// Get implemented Store interface.
+func (s *DirStore) Get(id string) (*Upload, error) {
+	defer s.lock(id)()
+	return s.get(id)
+}
+
+// Append implemented Store interface.
+func (s *DirStore) Append(id string, offset, size int64, chunk io.Reader) (*Upload, error) {
+	s.sweep()
+	defer s.lock(id)()
+	u, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	created := u == nil
+	if created {
+		u = &Upload{ID: id, Size: -1}
+	}
+	if u.Offset != offset {
+		return nil, ErrOffsetMismatch
+	}
+	p := s.path(id)
+	if created || (size >= 0 && size != u.Size) {
+		u.Size = size
+		buf, _ := json.Marshal(dirMeta{ID: id, Size: size})
+		if err = ioutil.WriteFile(p+".json", buf, 0600); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(p+".part", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, chunk)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	u.Offset += n
+	return u, err
+}
+
+// Open implemented Store interface.
+func (s *DirStore) Open(id string) (io.ReadCloser, error) {
+	return os.Open(s.path(id) + ".part")
+}
+
+// Delete implemented Store interface.
+func (s *DirStore) Delete(id string) error {
+	defer s.lock(id)()
+	return s.remove(id)
+}
@@ -0,0 +1,219 @@
+package upload
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func TestParseContentRange(t *testing.T) {
+	assert := assert.New(t)
+
+	first, last, size, ok := parseContentRange("bytes 0-99/1000")
+	assert.True(ok)
+	assert.Equal([]int64{0, 99, 1000}, []int64{first, last, size})
+	first, last, size, ok = parseContentRange("bytes 100-199/*")
+	assert.True(ok)
+	assert.Equal([]int64{100, 199, -1}, []int64{first, last, size})
+	first, last, size, ok = parseContentRange("bytes */1000")
+	assert.True(ok)
+	assert.Equal([]int64{-1, -1, 1000}, []int64{first, last, size})
+
+	for _, s := range []string{"", "0-99/1000", "bytes 0-99", "bytes 99-0/1000", "bytes 0-1000/1000",
+		"bytes */*", "bytes x-1/2", "bytes 0-x/2", "bytes 0-1/x", "bytes 01/2"} {
+		_, _, _, ok = parseContentRange(s)
+		assert.False(ok, s)
+	}
+}
+
+func TestGearMiddlewareUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gear-upload")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewDirStore(dir, time.Hour)
+	id := func(ctx *gear.Context) string {
+		return ctx.Path
+	}
+
+	assert.Panics(t, func() {
+		New(Options{})
+	})
+	assert.Panics(t, func() {
+		New(Options{Store: store})
+	})
+
+	var received []string
+	app := gear.New()
+	router := gear.NewRouter()
+	router.Put("/files/:name", New(Options{Store: store, ID: id, MaxSize: 100}), func(ctx *gear.Context) error {
+		body, err := ioutil.ReadAll(ctx.Req.Body)
+		if err != nil {
+			return err
+		}
+		if ctx.Param("name") == "fail" {
+			return errors.New("disk full")
+		}
+		received = append(received, string(body))
+		if u := FromCtx(ctx); u != nil {
+			assert.Equal(t, int64(len(body)), u.Size)
+		}
+		return ctx.End(201)
+	})
+	app.UseHandler(router)
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	put := func(path, contentRange, body string) *http.Response {
+		req, _ := http.NewRequest("PUT", host+path, strings.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set(gear.HeaderContentRange, contentRange)
+		}
+		res, err := DefaultClient.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("should assemble chunks", func(t *testing.T) {
+		assert := assert.New(t)
+
+		received = nil
+		res := put("/files/a", "bytes 0-4/15", "hello")
+		assert.Equal(308, res.StatusCode)
+		assert.Equal("bytes=0-4", res.Header.Get(gear.HeaderRange))
+
+		res = put("/files/a", "bytes */15", "")
+		assert.Equal(308, res.StatusCode)
+		assert.Equal("bytes=0-4", res.Header.Get(gear.HeaderRange))
+
+		// not contiguous
+		res = put("/files/a", "bytes 10-14/15", "gear!")
+		assert.Equal(416, res.StatusCode)
+		// size changed
+		res = put("/files/a", "bytes 5-9/20", "gear!")
+		assert.Equal(416, res.StatusCode)
+
+		// retried chunk overlapped
+		res = put("/files/a", "bytes 3-9/15", "lo, ge")
+		assert.Equal(400, res.StatusCode)
+		res = put("/files/a", "bytes 3-9/15", "lo, gea")
+		assert.Equal(308, res.StatusCode)
+		assert.Equal("bytes=0-9", res.Header.Get(gear.HeaderRange))
+
+		res = put("/files/a", "bytes 10-14/15", "r!!!!")
+		assert.Equal(201, res.StatusCode)
+		assert.Equal([]string{"hello, gear!!!!"}, received)
+
+		// deleted after completed
+		u, err := store.Get("/files/a")
+		assert.Nil(err)
+		assert.Nil(u)
+	})
+
+	t.Run("should support unknown size", func(t *testing.T) {
+		assert := assert.New(t)
+
+		received = nil
+		res := put("/files/b", "bytes 0-4/*", "hello")
+		assert.Equal(308, res.StatusCode)
+		res = put("/files/b", "bytes 5-9/10", "world")
+		assert.Equal(201, res.StatusCode)
+		assert.Equal([]string{"helloworld"}, received)
+	})
+
+	t.Run("should keep the upload if the handler failed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := put("/files/fail", "bytes 0-4/5", "hello")
+		assert.Equal(500, res.StatusCode)
+		u, err := store.Get("/files/fail")
+		assert.Nil(err)
+		assert.True(u.Complete())
+		assert.Nil(store.Delete("/files/fail"))
+		assert.Nil(store.Delete("/files/fail"))
+	})
+
+	t.Run("should go through without Content-Range", func(t *testing.T) {
+		assert := assert.New(t)
+
+		received = nil
+		res := put("/files/c", "", "whole")
+		assert.Equal(201, res.StatusCode)
+		assert.Equal([]string{"whole"}, received)
+	})
+
+	t.Run("should respond 400 or 413", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(400, put("/files/d", "bytes 0-4", "hello").StatusCode)
+		assert.Equal(413, put("/files/d", "bytes 0-4/101", "hello").StatusCode)
+		assert.Equal(413, put("/files/d", "bytes 100-104/*", "hello").StatusCode)
+	})
+
+	t.Run("DirStore", func(t *testing.T) {
+		assert := assert.New(t)
+
+		u, err := store.Append("x", 0, -1, strings.NewReader("abc"))
+		assert.Nil(err)
+		assert.Equal(&Upload{ID: "x", Offset: 3, Size: -1}, u)
+		_, err = store.Append("x", 1, -1, strings.NewReader("abc"))
+		assert.Equal(ErrOffsetMismatch, err)
+		u, err = store.Append("x", 3, 6, strings.NewReader("def"))
+		assert.Nil(err)
+		assert.True(u.Complete())
+
+		r, err := store.Open("x")
+		assert.Nil(err)
+		buf, _ := ioutil.ReadAll(r)
+		r.Close()
+		assert.Equal("abcdef", string(buf))
+		assert.Nil(store.Delete("x"))
+	})
+
+	t.Run("DirStore should expire the uploads", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "gear-upload")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		store := NewDirStore(dir, 50*time.Millisecond)
+		assert.Equal(24*time.Hour, NewDirStore(dir, 0).ttl)
+
+		_, err = store.Append("x", 0, -1, strings.NewReader("abc"))
+		assert.Nil(err)
+		_, err = store.Append("y", 0, -1, strings.NewReader("abc"))
+		assert.Nil(err)
+		time.Sleep(60 * time.Millisecond)
+
+		// expired, a new upload is started
+		u, err := store.Get("x")
+		assert.Nil(err)
+		assert.Nil(u)
+		u, err = store.Append("x", 0, -1, strings.NewReader("def"))
+		assert.Nil(err)
+		assert.Equal(int64(3), u.Offset)
+
+		// the abandoned one is swept
+		files, _ := ioutil.ReadDir(dir)
+		assert.Equal(2, len(files))
+		r, err := store.Open("x")
+		assert.Nil(err)
+		buf, _ := ioutil.ReadAll(r)
+		r.Close()
+		assert.Equal("def", string(buf))
+	})
+}
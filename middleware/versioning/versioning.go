@@ -0,0 +1,182 @@
+package versioning
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// Version is a version of the API with its handler set.
+type Version struct {
+	// Name is the version name, such as "v1", it is matched case-insensitively.
+	Name string
+	// Handler serves the requests of the version, such as a *gear.Router, required.
+	Handler gear.Handler
+	// Deprecated is the time the version was (or will be) deprecated, the responses carry the
+	// Deprecation header (RFC 9745) if it is not zero.
+	Deprecated time.Time
+	// Sunset is the time the version will be retired, the responses carry the Sunset header
+	// (RFC 8594) if it is not zero.
+	Sunset time.Time
+	// Link is the URL of the deprecation and migration documentation, it is added to the
+	// Link header with rel="deprecation" for the deprecated version, and with rel="sunset"
+	// for the version with sunset.
+	Link string
+}
+
+// Options is versioning middleware options. The version is resolved from PathPrefix,
+// Header and the Accept parameter in order, the first known one is used.
+type Options struct {
+	// Versions defines the versions of the API, required.
+	Versions []*Version
+	// Default defines the version name used when the request does not specify one, otherwise
+	// the request without version is responded with 400 Bad Request.
+	Default string
+	// PathPrefix resolves the version from the first path segment, such as "v1" of "/v1/users",
+	// the segment is stripped from the path when it is a known version, so the handler sees
+	// "/users".
+	PathPrefix bool
+	// Header defines the request header to resolve the version from, default to "X-API-Version".
+	Header string
+	// AcceptParam defines the media type parameter of the Accept header to resolve the version
+	// from, such as "application/json; version=v2". Default to "version".
+	AcceptParam string
+	// RejectSunset responds 410 Gone for the version after its Sunset time.
+	RejectSunset bool
+	// Skipper defines a function to skip the middleware for the request.
+	Skipper func(ctx *gear.Context) bool
+}
+
+type ctxKey struct{}
+
+// FromCtx returns the version resolved for the request, it returns nil if no version resolved.
+func FromCtx(ctx *gear.Context) *Version {
+	if val, err := ctx.Any(ctxKey{}); err == nil {
+		return val.(*Version)
+	}
+	return nil
+}
+
+// New creates a middleware that routes the requests to the handler of the resolved version,
+// and emits the Deprecation, Sunset and Link headers for the retiring versions. The unknown
+// version from Header or Accept is responded with 400 Bad Request.
+//
+//  app.Use(versioning.New(versioning.Options{
+//  	PathPrefix: true,
+//  	Default:    "v2",
+//  	Versions: []*versioning.Version{
+//  		{
+//  			Name:       "v1",
+//  			Handler:    routerV1,
+//  			Deprecated: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+//  			Sunset:     time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+//  			Link:       "https://example.com/docs/migrate-to-v2",
+//  		},
+//  		{Name: "v2", Handler: routerV2},
+//  	},
+//  }))
+//
+func New(opts Options) gear.Middleware {
+	if len(opts.Versions) == 0 {
+		panic(gear.NewAppError("versions required"))
+	}
+	versions := make(map[string]*Version, len(opts.Versions))
+	for _, v := range opts.Versions {
+		if v.Name == "" || v.Handler == nil {
+			panic(gear.NewAppError("version name and handler required"))
+		}
+		versions[strings.ToLower(v.Name)] = v
+	}
+	if opts.Default != "" && versions[strings.ToLower(opts.Default)] == nil {
+		panic(gear.NewAppError("default version not found: " + opts.Default))
+	}
+	if opts.Header == "" {
+		opts.Header = "X-API-Version"
+	}
+	if opts.AcceptParam == "" {
+		opts.AcceptParam = "version"
+	}
+
+	return func(ctx *gear.Context) error {
+		if opts.Skipper != nil && opts.Skipper(ctx) {
+			return nil
+		}
+
+		var v *Version
+		if opts.PathPrefix {
+			seg := firstSegment(ctx.Path)
+			if v = versions[strings.ToLower(seg)]; v != nil {
+				stripPrefix(ctx, len(seg)+1)
+			}
+		}
+		if v == nil {
+			name := ctx.Get(opts.Header)
+			if name == "" {
+				name = acceptVersion(ctx.Get(gear.HeaderAccept), opts.AcceptParam)
+			}
+			ctx.Vary(opts.Header, gear.HeaderAccept)
+			if name == "" {
+				name = opts.Default
+			}
+			if name == "" {
+				return &gear.Error{Code: http.StatusBadRequest, Msg: "API version required"}
+			}
+			if v = versions[strings.ToLower(name)]; v == nil {
+				return &gear.Error{Code: http.StatusBadRequest, Msg: "unsupported API version: " + name}
+			}
+		}
+
+		ctx.SetAny(ctxKey{}, v)
+		header := ctx.Res.Header()
+		if !v.Deprecated.IsZero() {
+			header.Set("Deprecation", "@"+strconv.FormatInt(v.Deprecated.Unix(), 10))
+			if v.Link != "" {
+				header.Add(gear.HeaderLink, "<"+v.Link+`>; rel="deprecation"`)
+			}
+		}
+		if !v.Sunset.IsZero() {
+			header.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+			if v.Link != "" {
+				header.Add(gear.HeaderLink, "<"+v.Link+`>; rel="sunset"`)
+			}
+			if opts.RejectSunset && !time.Now().Before(v.Sunset) {
+				return &gear.Error{Code: http.StatusGone, Msg: "API version " + v.Name + " has been retired"}
+			}
+		}
+		return v.Handler.Serve(ctx)
+	}
+}
+
+// acceptVersion returns the version parameter of the first media type in the Accept header.
+func acceptVersion(accept, param string) string {
+	for _, spec := range strings.Split(accept, ",") {
+		if _, params, err := mime.ParseMediaType(strings.TrimSpace(spec)); err == nil {
+			if v := params[param]; v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func firstSegment(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func stripPrefix(ctx *gear.Context, n int) {
+	path := ctx.Path[n:]
+	if path == "" {
+		path = "/"
+	}
+	ctx.Path = path
+	ctx.Req.URL.Path = path
+	ctx.Req.URL.RawPath = ""
+}
@@ -0,0 +1,119 @@
+package versioning
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+var DefaultClient = &http.Client{}
+
+func newRouter(name string) *gear.Router {
+	router := gear.NewRouter()
+	router.Get("/users", func(ctx *gear.Context) error {
+		return ctx.HTML(200, name+" "+FromCtx(ctx).Name+" "+ctx.Path)
+	})
+	return router
+}
+
+func request(url string, header map[string]string) (string, *http.Response) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body), res
+}
+
+func TestGearMiddlewareVersioning(t *testing.T) {
+	assert.Panics(t, func() {
+		New(Options{})
+	})
+	assert.Panics(t, func() {
+		New(Options{Versions: []*Version{{Name: "v1"}}})
+	})
+	assert.Panics(t, func() {
+		New(Options{Versions: []*Version{{Name: "v1", Handler: newRouter("one")}}, Default: "v2"})
+	})
+
+	deprecated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	versions := []*Version{
+		{Name: "v0", Handler: newRouter("zero"), Sunset: time.Now().Add(-time.Hour)},
+		{
+			Name:       "v1",
+			Handler:    newRouter("one"),
+			Deprecated: deprecated,
+			Sunset:     time.Date(2099, 12, 31, 0, 0, 0, 0, time.UTC),
+			Link:       "https://example.com/migrate",
+		},
+		{Name: "v2", Handler: newRouter("two")},
+	}
+	app := gear.New()
+	app.Use(New(Options{Versions: versions, PathPrefix: true, Default: "v2", RejectSunset: true}))
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	t.Run("should resolve version from path, header and Accept", func(t *testing.T) {
+		assert := assert.New(t)
+
+		body, res := request(host+"/v2/users", nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("two v2 /users", body)
+		assert.Equal("", res.Header.Get("Deprecation"))
+
+		body, _ = request(host+"/users", map[string]string{"X-API-Version": "V1"})
+		assert.Equal("one v1 /users", body)
+
+		body, res = request(host+"/users", map[string]string{gear.HeaderAccept: "application/json; version=v1"})
+		assert.Equal("one v1 /users", body)
+		assert.Equal([]string{"X-Api-Version", "Accept"}, res.Header[gear.HeaderVary])
+
+		body, _ = request(host+"/users", nil)
+		assert.Equal("two v2 /users", body)
+
+		_, res = request(host+"/users", map[string]string{"X-API-Version": "v9"})
+		assert.Equal(400, res.StatusCode)
+	})
+
+	t.Run("should emit Deprecation, Sunset and Link headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, res := request(host+"/v1/users", nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("@1767225600", res.Header.Get("Deprecation"))
+		assert.Equal("Thu, 31 Dec 2099 00:00:00 GMT", res.Header.Get("Sunset"))
+		assert.Equal([]string{
+			`<https://example.com/migrate>; rel="deprecation"`,
+			`<https://example.com/migrate>; rel="sunset"`,
+		}, res.Header[gear.HeaderLink])
+	})
+
+	t.Run("should respond 410 after sunset", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, res := request(host+"/v0/users", nil)
+		assert.Equal(410, res.StatusCode)
+	})
+
+	t.Run("should respond 400 without version", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := gear.New()
+		app.Use(New(Options{Versions: versions}))
+		srv := app.Start()
+		defer srv.Close()
+
+		_, res := request("http://"+srv.Addr().String()+"/users", nil)
+		assert.Equal(400, res.StatusCode)
+	})
+}
@@ -0,0 +1,364 @@
+package gear
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OCSPOptions is the options of NewOCSPStapler.
+type OCSPOptions struct {
+	// Client defines the http.Client to fetch the OCSP responses, default to a client with
+	// 10 seconds timeout.
+	Client *http.Client
+	// CheckInterval defines the interval to check the OCSP responses to refresh, default to 1 minute.
+	// The responses are refreshed at the half of their validity period.
+	CheckInterval time.Duration
+	// RetryInterval defines the interval to retry the failed fetching, default to 5 minutes.
+	// The previous response is stapled until it expires.
+	RetryInterval time.Duration
+	// OnError is called when failed to fetch the OCSP response of the certificate, optional.
+	OnError func(leaf *x509.Certificate, err error)
+}
+
+// OCSPStats is the metrics of OCSPStapler.
+type OCSPStats struct {
+	Certificates int    // the number of the certificates served
+	Stapled      int    // the number of the certificates with valid OCSP response
+	Fetches      uint64 // the total number of the fetches
+	Failures     uint64 // the total number of the failed fetches
+}
+
+// OCSPStapler is a CertificateProvider that staples the OCSP responses into the certificates
+// provided by another CertificateProvider. The OCSP responses are fetched from the OCSP servers
+// of the certificates asynchronously when the certificates first served, cached, and refreshed
+// in background before they expire. The certificate should contain the issuer certificate in
+// the chain. The response is checked for the serial number, the good status and the validity
+// period, the signature is verified by the clients.
+//
+//  store := gear.NewCertificateStore()
+//  store.AddFile("example.com", "fullchain.pem", "key.pem")
+//  stapler := gear.NewOCSPStapler(store, gear.OCSPOptions{})
+//  defer stapler.Close()
+//  app.Set(gear.SetCertificates, stapler)
+//  app.Error(app.ListenTLS(":443", "", ""))
+//
+type OCSPStapler struct {
+	provider CertificateProvider
+	opts     OCSPOptions
+	mu       sync.Mutex
+	entries  map[string]*ocspEntry
+	fetches  uint64
+	failures uint64
+	done     chan struct{}
+	once     sync.Once
+}
+
+type ocspEntry struct {
+	cert       *tls.Certificate
+	leaf       *x509.Certificate
+	issuer     *x509.Certificate
+	stapled    *tls.Certificate // copy of cert with OCSPStaple
+	nextUpdate time.Time
+	refreshAt  time.Time
+	fetching   bool
+}
+
+// NewOCSPStapler creates a OCSPStapler with the CertificateProvider.
+func NewOCSPStapler(provider CertificateProvider, opts OCSPOptions) *OCSPStapler {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = time.Minute
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 5 * time.Minute
+	}
+	s := &OCSPStapler{
+		provider: provider,
+		opts:     opts,
+		entries:  make(map[string]*ocspEntry),
+		done:     make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// GetCertificate implemented CertificateProvider interface.
+func (s *OCSPStapler) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := s.provider.GetCertificate(hello)
+	if err != nil || cert == nil || len(cert.Certificate) == 0 {
+		return cert, err
+	}
+
+	key := string(cert.Certificate[0])
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &ocspEntry{cert: cert}
+		s.entries[key] = e
+		if e.leaf, e.issuer, err = parseChain(cert); err == nil && len(e.leaf.OCSPServer) > 0 {
+			e.fetching = true
+			go s.fetch(e)
+		} else {
+			e.refreshAt = time.Now().Add(100 * 365 * 24 * time.Hour) // never
+		}
+	}
+	stapled := e.stapled
+	if stapled != nil && time.Now().After(e.nextUpdate) {
+		stapled = nil // expired
+	}
+	s.mu.Unlock()
+
+	if stapled != nil {
+		return stapled, nil
+	}
+	return cert, nil
+}
+
+// Refresh fetches the OCSP responses of all the certificates served immediately,
+// it returns the last error.
+func (s *OCSPStapler) Refresh() (err error) {
+	s.mu.Lock()
+	var entries []*ocspEntry
+	for _, e := range s.entries {
+		if e.issuer != nil && len(e.leaf.OCSPServer) > 0 && !e.fetching {
+			e.fetching = true
+			entries = append(entries, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		if e := s.fetch(e); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+// Stats returns the metrics of the OCSPStapler.
+func (s *OCSPStapler) Stats() OCSPStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := OCSPStats{Certificates: len(s.entries), Fetches: s.fetches, Failures: s.failures}
+	now := time.Now()
+	for _, e := range s.entries {
+		if e.stapled != nil && now.Before(e.nextUpdate) {
+			stats.Stapled++
+		}
+	}
+	return stats
+}
+
+// Close stops refreshing the OCSP responses in background.
+func (s *OCSPStapler) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *OCSPStapler) loop() {
+	ticker := time.NewTicker(s.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for _, e := range s.entries {
+				if !e.fetching && now.After(e.refreshAt) {
+					e.fetching = true
+					go s.fetch(e)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// fetch fetches the OCSP response for the entry marked fetching.
+func (s *OCSPStapler) fetch(e *ocspEntry) error {
+	staple, res, err := fetchOCSP(s.opts.Client, e.leaf, e.issuer)
+
+	s.mu.Lock()
+	e.fetching = false
+	s.fetches++
+	if err != nil {
+		s.failures++
+		e.refreshAt = time.Now().Add(s.opts.RetryInterval)
+		s.mu.Unlock()
+		if s.opts.OnError != nil {
+			s.opts.OnError(e.leaf, err)
+		}
+		return err
+	}
+
+	stapled := *e.cert
+	stapled.OCSPStaple = staple
+	e.stapled = &stapled
+	e.nextUpdate = res.NextUpdate
+	e.refreshAt = res.ThisUpdate.Add(res.NextUpdate.Sub(res.ThisUpdate) / 2)
+	s.mu.Unlock()
+	return nil
+}
+
+func parseChain(cert *tls.Certificate) (leaf, issuer *x509.Certificate, err error) {
+	if len(cert.Certificate) < 2 {
+		return nil, nil, errors.New("issuer certificate not found")
+	}
+	if leaf = cert.Leaf; leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return
+		}
+	}
+	issuer, err = x509.ParseCertificate(cert.Certificate[1])
+	return
+}
+
+// ----- a minimal OCSP client (RFC 6960) ----- //
+
+var (
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest struct {
+		Version     int `asn1:"explicit,tag:0,default:0,optional"`
+		RequestList []struct {
+			Cert ocspCertID
+		}
+	}
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData struct {
+		Version        int `asn1:"optional,default:0,explicit,tag:0"`
+		RawResponderID asn1.RawValue
+		ProducedAt     time.Time `asn1:"generalized"`
+		Responses      []ocspSingleResponse
+	}
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+func fetchOCSP(client *http.Client, leaf, issuer *x509.Certificate) ([]byte, *ocspSingleResponse, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+
+	var req ocspRequest
+	req.TBSRequest.RequestList = append(req.TBSRequest.RequestList, struct{ Cert ocspCertID }{ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+		NameHash:      nameHash[:],
+		IssuerKeyHash: keyHash[:],
+		SerialNumber:  leaf.SerialNumber,
+	}})
+	body, err := asn1.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP server responded status %d", res.StatusCode)
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	single, err := parseOCSPResponse(raw, leaf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, single, nil
+}
+
+func parseOCSPResponse(raw []byte, leaf *x509.Certificate) (*ocspSingleResponse, error) {
+	var res ocspResponse
+	if _, err := asn1.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+	if res.Status != 0 {
+		return nil, fmt.Errorf("OCSP response status %d", res.Status)
+	}
+	if !res.Response.ResponseType.Equal(oidOCSPBasicResponse) {
+		return nil, errors.New("unsupported OCSP response type")
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(res.Response.Response, &basic); err != nil {
+		return nil, err
+	}
+
+	for i := range basic.TBSResponseData.Responses {
+		single := &basic.TBSResponseData.Responses[i]
+		if single.CertID.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+			continue
+		}
+		now := time.Now()
+		switch {
+		case !bool(single.Good):
+			return nil, errors.New("certificate is not in good status")
+		case single.NextUpdate.IsZero():
+			// no newer information, keep it for an hour
+			single.NextUpdate = now.Add(time.Hour)
+		case now.After(single.NextUpdate):
+			return nil, errors.New("OCSP response expired")
+		}
+		return single, nil
+	}
+	return nil, errors.New("no OCSP response for the certificate")
+}
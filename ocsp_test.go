@@ -0,0 +1,229 @@
+package gear
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestChain(host, ocspServer string) *tls.Certificate {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	ca, _ = x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{ocspServer},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	return &tls.Certificate{Certificate: [][]byte{der, caDER}, PrivateKey: key}
+}
+
+func newTestOCSPResponse(serial int64, good bool, thisUpdate, nextUpdate time.Time) []byte {
+	var basic ocspBasicResponse
+	basic.TBSResponseData.RawResponderID = asn1.RawValue{Class: 2, Tag: 2, IsCompound: true, Bytes: []byte{4, 0}}
+	basic.TBSResponseData.ProducedAt = thisUpdate.UTC().Truncate(time.Second)
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+			NameHash:      []byte{1},
+			IssuerKeyHash: []byte{2},
+			SerialNumber:  big.NewInt(serial),
+		},
+		Good:       asn1.Flag(good),
+		ThisUpdate: thisUpdate.UTC().Truncate(time.Second),
+		NextUpdate: nextUpdate.UTC().Truncate(time.Second),
+	}
+	if !good {
+		single.Revoked.RevocationTime = thisUpdate.UTC().Truncate(time.Second)
+	}
+	basic.TBSResponseData.Responses = []ocspSingleResponse{single}
+	basic.SignatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}
+	basic.Signature = asn1.BitString{Bytes: []byte{0}, BitLength: 8}
+	buf, err := asn1.Marshal(basic)
+	if err != nil {
+		panic(err)
+	}
+
+	var res ocspResponse
+	res.Response.ResponseType = oidOCSPBasicResponse
+	res.Response.Response = buf
+	if buf, err = asn1.Marshal(res); err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+func TestGearOCSPStapler(t *testing.T) {
+	var mu sync.Mutex
+	status := 200
+	good := true
+	nextUpdate := time.Now().Add(time.Hour)
+	requests := 0
+
+	responder := New()
+	responder.Use(func(ctx *Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		var req ocspRequest
+		if _, err := asn1.Unmarshal(body, &req); err != nil || ctx.Get(HeaderContentType) != "application/ocsp-request" {
+			return ctx.End(400)
+		}
+		if status != 200 {
+			return ctx.End(status)
+		}
+		serial := req.TBSRequest.RequestList[0].Cert.SerialNumber.Int64()
+		ctx.Type("application/ocsp-response")
+		return ctx.End(200, newTestOCSPResponse(serial, good, time.Now().Add(-time.Minute), nextUpdate))
+	})
+	srv := responder.Start()
+	defer srv.Close()
+
+	cert := newTestChain("example.com", "http://"+srv.Addr().String())
+	noChain := newTestCert("nochain.com")
+	store := NewCertificateStore()
+	store.Add("example.com", cert)
+	store.Add("nochain.com", noChain)
+
+	errs := make(chan error, 10)
+	stapler := NewOCSPStapler(store, OCSPOptions{
+		CheckInterval: 10 * time.Millisecond,
+		RetryInterval: time.Hour,
+		OnError: func(leaf *x509.Certificate, err error) {
+			errs <- err
+		},
+	})
+	defer stapler.Close()
+	get := func(name string) *tls.Certificate {
+		c, err := stapler.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		if err != nil {
+			panic(err)
+		}
+		return c
+	}
+	waitFor := func(fn func() bool) {
+		for i := 0; i < 200 && !fn(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("Should fetch and staple the OCSP response", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Nil(get("example.com").OCSPStaple) // fetching asynchronously
+		waitFor(func() bool { return stapler.Stats().Stapled == 1 })
+		staple := get("example.com").OCSPStaple
+		assert.NotNil(staple)
+		assert.Nil(cert.OCSPStaple) // the original certificate is not changed
+
+		assert.Equal(noChain, get("nochain.com"))
+		_, err := stapler.GetCertificate(&tls.ClientHelloInfo{ServerName: "none.com"})
+		assert.NotNil(err)
+		assert.Equal(OCSPStats{Certificates: 2, Stapled: 1, Fetches: 1, Failures: 0}, stapler.Stats())
+
+		// handshake with stapled OCSP response
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: stapler.GetCertificate})
+		assert.Nil(err)
+		defer l.Close()
+		go func() {
+			conn, err := l.Accept()
+			if err == nil {
+				conn.Write([]byte("OK"))
+				conn.Close()
+			}
+		}()
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+		assert.Nil(err)
+		assert.Equal(staple, conn.ConnectionState().OCSPResponse)
+		conn.Close()
+	})
+
+	t.Run("Should refresh and keep the valid response on failure", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// refresh at the half of validity period
+		mu.Lock()
+		nextUpdate = time.Now().Add(30 * time.Second)
+		mu.Unlock()
+		assert.Nil(stapler.Refresh())
+		fetches := stapler.Stats().Fetches
+		waitFor(func() bool { return stapler.Stats().Fetches > fetches+1 })
+		assert.True(stapler.Stats().Fetches > fetches+1)
+
+		mu.Lock()
+		nextUpdate = time.Now().Add(time.Hour)
+		mu.Unlock()
+		fetches = stapler.Stats().Fetches
+		waitFor(func() bool { return stapler.Stats().Fetches > fetches })
+		time.Sleep(50 * time.Millisecond) // the refreshing stops
+		assert.Equal(uint64(0), stapler.Stats().Failures)
+
+		mu.Lock()
+		status = 500
+		mu.Unlock()
+		err := stapler.Refresh()
+		assert.Equal("OCSP server responded status 500", err.Error())
+		assert.Equal(err, <-errs)
+		assert.NotNil(get("example.com").OCSPStaple)
+		assert.Equal(1, stapler.Stats().Stapled)
+
+		mu.Lock()
+		status, good = 200, false
+		mu.Unlock()
+		assert.Equal("certificate is not in good status", stapler.Refresh().Error())
+		<-errs
+		stats := stapler.Stats()
+		assert.Equal(uint64(2), stats.Failures)
+	})
+
+	t.Run("parseOCSPResponse", func(t *testing.T) {
+		assert := assert.New(t)
+
+		leaf, _, err := parseChain(cert)
+		assert.Nil(err)
+		_, _, err = parseChain(noChain)
+		assert.Equal(errors.New("issuer certificate not found"), err)
+
+		now := time.Now()
+		_, err = parseOCSPResponse([]byte("invalid"), leaf)
+		assert.NotNil(err)
+		_, err = parseOCSPResponse(newTestOCSPResponse(1, true, now, now.Add(time.Hour)), leaf)
+		assert.Equal("no OCSP response for the certificate", err.Error())
+		_, err = parseOCSPResponse(newTestOCSPResponse(42, true, now.Add(-2*time.Hour), now.Add(-time.Hour)), leaf)
+		assert.Equal("OCSP response expired", err.Error())
+		res, err := parseOCSPResponse(newTestOCSPResponse(42, true, now, time.Time{}), leaf)
+		assert.Nil(err)
+		assert.True(res.NextUpdate.After(now))
+		buf, _ := asn1.Marshal(ocspResponse{Status: 6})
+		_, err = parseOCSPResponse(buf, leaf)
+		assert.Equal("OCSP response status 6", err.Error())
+	})
+}
@@ -0,0 +1,201 @@
+package gear
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReadPacing is the options of app setting SetReadPacing.
+type ReadPacing struct {
+	// MinRate defines the minimum average bytes per second to receive the request headers
+	// and the request body, it is required.
+	MinRate int
+	// Grace defines the duration before the MinRate is enforced, so that the small
+	// requests are not affected by the network latency. Default to 5 seconds.
+	Grace time.Duration
+}
+
+// slowReadError is returned when the client sends the request slower than ReadPacing.MinRate.
+type slowReadError struct{}
+
+func (slowReadError) Error() string   { return "request read too slow" }
+func (slowReadError) Status() int     { return http.StatusRequestTimeout }
+func (slowReadError) Timeout() bool   { return true }
+func (slowReadError) Temporary() bool { return false }
+
+type pacedConnKey struct{}
+
+// listen wraps the listener with app settings SetConnLimiter and SetReadPacing, and hooks
+// the app.Server to track the request phases of the connections.
+func (app *App) listen(l net.Listener) net.Listener {
+	if app.connLimiter != nil {
+		l = app.connLimiter.Listener(l)
+	}
+	if app.pacing == nil {
+		return l
+	}
+	pacing := *app.pacing
+	connState := app.Server.ConnState
+	app.Server.ConnState = func(c net.Conn, state http.ConnState) {
+		if pc := unwrapPacedConn(c); pc != nil {
+			switch state {
+			case http.StateActive: // the request headers have been read
+				pc.disarm()
+			case http.StateIdle: // wait for the next request
+				pc.arm(false)
+			}
+		}
+		if connState != nil {
+			connState(c, state)
+		}
+	}
+	connContext := app.Server.ConnContext
+	app.Server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		if pc := unwrapPacedConn(c); pc != nil {
+			ctx = context.WithValue(ctx, pacedConnKey{}, pc)
+		}
+		return ctx
+	}
+	return &pacedListener{l, pacing}
+}
+
+// pacedBody paces the request body of HTTP/1.x request with the connection.
+func pacedBody(r *http.Request) func() {
+	pc, ok := r.Context().Value(pacedConnKey{}).(*pacedConn)
+	if !ok || r.ProtoMajor != 1 || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	r.Body = &pacedReadCloser{ReadCloser: r.Body, conn: pc}
+	return pc.disarm
+}
+
+func unwrapPacedConn(c net.Conn) *pacedConn {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	pc, _ := c.(*pacedConn)
+	return pc
+}
+
+type pacedListener struct {
+	net.Listener
+	pacing ReadPacing
+}
+
+func (l *pacedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	pc := &pacedConn{Conn: c, rate: float64(l.pacing.MinRate), grace: l.pacing.Grace}
+	pc.arm(true)
+	return pc, nil
+}
+
+type pacedConn struct {
+	net.Conn
+	rate     float64
+	grace    time.Duration
+	mu       sync.Mutex
+	armed    bool
+	start    time.Time // zero until the first byte received if not started
+	n        int64
+	deadline time.Time // the read deadline set by http.Server
+	tooSlow  bool      // the connection should not be read anymore
+}
+
+// arm starts to pace the reading, now or from the first byte received.
+func (c *pacedConn) arm(now bool) {
+	c.mu.Lock()
+	c.armed = true
+	c.n = 0
+	c.start = time.Time{}
+	if now {
+		c.start = time.Now()
+	}
+	c.mu.Unlock()
+}
+
+// disarm stops pacing the reading, and restores the read deadline for the pending read.
+func (c *pacedConn) disarm() {
+	c.mu.Lock()
+	if c.armed {
+		c.armed = false
+		c.Conn.SetReadDeadline(c.deadline)
+	}
+	c.mu.Unlock()
+}
+
+func (c *pacedConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *pacedConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *pacedConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.tooSlow {
+		c.mu.Unlock()
+		return 0, slowReadError{}
+	}
+	deadline, paced := c.deadline, false
+	if c.armed && !c.start.IsZero() {
+		// the average rate drops below MinRate after it
+		d := c.start.Add(c.grace + time.Duration(float64(c.n)/c.rate*float64(time.Second)))
+		if deadline.IsZero() || d.Before(deadline) {
+			deadline, paced = d, true
+		}
+	}
+	c.Conn.SetReadDeadline(deadline)
+	c.mu.Unlock()
+
+	n, err := c.Conn.Read(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.armed {
+		if c.start.IsZero() && n > 0 {
+			c.start = time.Now()
+		}
+		c.n += int64(n)
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() && paced {
+		// the remaining request body should not be drained by http.Server
+		c.tooSlow = true
+		err = slowReadError{}
+	}
+	return n, err
+}
+
+type pacedReadCloser struct {
+	io.ReadCloser
+	conn    *pacedConn
+	started bool
+}
+
+func (r *pacedReadCloser) Read(b []byte) (n int, err error) {
+	if !r.started {
+		r.started = true
+		r.conn.arm(true)
+	}
+	if n, err = r.ReadCloser.Read(b); err != nil {
+		r.conn.disarm()
+	}
+	return
+}
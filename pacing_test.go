@@ -0,0 +1,99 @@
+package gear
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearReadPacing(t *testing.T) {
+	app := New()
+	assert.Panics(t, func() {
+		app.Set(SetReadPacing, ReadPacing{})
+	})
+	app.Set(SetReadPacing, ReadPacing{MinRate: 100, Grace: 100 * time.Millisecond})
+	app.Use(func(ctx *Context) error {
+		if ctx.Method == http.MethodPost {
+			body, err := ioutil.ReadAll(ctx.Req.Body)
+			if err != nil {
+				return err
+			}
+			return ctx.HTML(200, string(body))
+		}
+		return ctx.HTML(200, "OK")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	addr := srv.Addr().String()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			panic(err)
+		}
+		return conn
+	}
+	trickle := func(conn net.Conn, data string) error {
+		for i := 0; i < len(data); i++ {
+			if _, err := conn.Write([]byte{data[i]}); err != nil {
+				return err
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	}
+
+	t.Run("Should serve the normal requests", func(t *testing.T) {
+		assert := assert.New(t)
+
+		conn := dial()
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello"))
+			res, err := http.ReadResponse(r, nil)
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			body, _ := ioutil.ReadAll(res.Body)
+			assert.Equal("hello", string(body))
+			// the idle time between the requests is not paced
+			time.Sleep(300 * time.Millisecond)
+		}
+	})
+
+	t.Run("Should abort the connection with slow headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		conn := dial()
+		defer conn.Close()
+		start := time.Now()
+		err := trickle(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nX-Slow: "+strings.Repeat("a", 100)+"\r\n\r\n")
+		if err == nil {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		}
+		assert.NotNil(err)
+		assert.True(time.Since(start) < 3*time.Second)
+	})
+
+	t.Run("Should respond 408 for slow body", func(t *testing.T) {
+		assert := assert.New(t)
+
+		conn := dial()
+		defer conn.Close()
+		conn.Write([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 100\r\n\r\n"))
+		go trickle(conn, strings.Repeat("a", 100))
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		assert.Nil(err)
+		assert.Equal(http.StatusRequestTimeout, res.StatusCode)
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("request read too slow", string(body))
+	})
+}
@@ -0,0 +1,170 @@
+package gear
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Page is the pagination of the request parsed by ctx.Paginate from the "page", "limit"
+// and "cursor" query params.
+type Page struct {
+	// Page is the 1-based page number, default to 1.
+	Page int
+	// Limit is the page size, in [1, max limit].
+	Limit int
+	// Offset is the count of the items before the page, (Page - 1) * Limit.
+	Offset int
+	// Cursor is the opaque cursor of the request, decode it with ctx.DecodeCursor.
+	Cursor string
+}
+
+// Paginate parses the "page", "limit" and "cursor" query params, limit defaults to defLimit
+// and can not be greater than maxLimit. It returns 400 error if the page or limit is invalid.
+//
+//  p, err := ctx.Paginate(20, 100) // ?page=2&limit=50
+//  if err != nil {
+//  	return err
+//  }
+//  users, total := db.ListUsers(p.Offset, p.Limit)
+//  ctx.SetPageLinks(p, total)
+//  return ctx.JSON(200, users)
+//
+func (ctx *Context) Paginate(defLimit, maxLimit int) (*Page, error) {
+	if defLimit < 1 || maxLimit < defLimit {
+		panic(NewAppError("invalid pagination limits"))
+	}
+	page, err := ctx.QueryInt("page", 1)
+	if err != nil || page < 1 {
+		return nil, invalidValueError("query", "page", ctx.Query("page"))
+	}
+	limit, err := ctx.QueryInt("limit", defLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return nil, invalidValueError("query", "limit", ctx.Query("limit"))
+	}
+	if page-1 > (int(^uint(0)>>1))/limit {
+		return nil, invalidValueError("query", "page", ctx.Query("page"))
+	}
+	return &Page{Page: page, Limit: limit, Offset: (page - 1) * limit, Cursor: ctx.Query("cursor")}, nil
+}
+
+// SetPageLinks sets the Link response header (RFC 8288) with the "first", "prev", "next" and
+// "last" relations of the page-based pagination, total is the count of all the items. The
+// links are relative to the request URL, with the "page" and "limit" query params replaced.
+func (ctx *Context) SetPageLinks(p *Page, total int) {
+	last := 1
+	if total > 0 {
+		last = (total + p.Limit - 1) / p.Limit
+	}
+	link := func(rel string, page int) string {
+		return ctx.pageLink(rel, map[string]string{
+			"page": strconv.Itoa(page), "limit": strconv.Itoa(p.Limit), "cursor": "",
+		})
+	}
+	links := []string{link("first", 1)}
+	if p.Page > 1 {
+		prev := p.Page - 1
+		if prev > last {
+			prev = last
+		}
+		links = append(links, link("prev", prev))
+	}
+	if p.Page < last {
+		links = append(links, link("next", p.Page+1))
+	}
+	links = append(links, link("last", last))
+	ctx.Res.Header().Add(HeaderLink, strings.Join(links, ", "))
+}
+
+// SetCursorLinks sets the Link response header (RFC 8288) with the "first", "prev" and "next"
+// relations of the cursor-based pagination, the empty cursor omits the relation. The links are
+// relative to the request URL, with the "cursor" query param replaced.
+//
+//  next, err := ctx.EncodeCursor(lastID)
+//  if err != nil {
+//  	return err
+//  }
+//  ctx.SetCursorLinks(next, "")
+//
+func (ctx *Context) SetCursorLinks(next, prev string) {
+	links := []string{ctx.pageLink("first", map[string]string{"cursor": "", "page": ""})}
+	if prev != "" {
+		links = append(links, ctx.pageLink("prev", map[string]string{"cursor": prev, "page": ""}))
+	}
+	if next != "" {
+		links = append(links, ctx.pageLink("next", map[string]string{"cursor": next, "page": ""}))
+	}
+	ctx.Res.Header().Add(HeaderLink, strings.Join(links, ", "))
+}
+
+// pageLink returns the link of the request URL with the query params replaced, the empty
+// value removes the param.
+func (ctx *Context) pageLink(rel string, params map[string]string) string {
+	query := ctx.Req.URL.Query()
+	for key, val := range params {
+		if val == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, val)
+		}
+	}
+	u := ctx.Req.URL.EscapedPath()
+	if q := query.Encode(); q != "" {
+		u += "?" + q
+	}
+	return "<" + u + `>; rel="` + rel + `"`
+}
+
+// EncodeCursor encodes the value as an opaque cursor, the value is marshaled to JSON and
+// signed with the first key of the app's SetKeys, so the clients can not forge it.
+// The cursor is not encrypted, do not put secrets in it.
+func (ctx *Context) EncodeCursor(val interface{}) (string, error) {
+	if len(ctx.app.keys) == 0 {
+		return "", NewAppError("SetKeys required to sign the cursor")
+	}
+	payload, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	buf := append(payload, signCursor(ctx.app.keys[0], payload)...)
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// DecodeCursor verifies the cursor encoded by ctx.EncodeCursor with any key of the app's
+// SetKeys, and unmarshals it into the value pointed to by val. It returns 400 error if the
+// cursor is invalid.
+//
+//  var lastID string
+//  if p.Cursor != "" {
+//  	if err := ctx.DecodeCursor(p.Cursor, &lastID); err != nil {
+//  		return err
+//  	}
+//  }
+//
+func (ctx *Context) DecodeCursor(cursor string, val interface{}) error {
+	invalid := invalidValueError("query", "cursor", cursor)
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) <= sha256.Size {
+		return invalid
+	}
+	payload, sig := buf[:len(buf)-sha256.Size], buf[len(buf)-sha256.Size:]
+	for _, key := range ctx.app.keys {
+		if hmac.Equal(sig, signCursor(key, payload)) {
+			if err = json.Unmarshal(payload, val); err != nil {
+				return invalid
+			}
+			return nil
+		}
+	}
+	return invalid
+}
+
+func signCursor(key string, payload []byte) []byte {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte("gear.cursor:"))
+	h.Write(payload)
+	return h.Sum(nil)
+}
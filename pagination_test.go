@@ -0,0 +1,97 @@
+package gear
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextPaginate(t *testing.T) {
+	app := New()
+
+	t.Run("should parse page and limit", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := CtxTest(app, "GET", "http://example.com/users?page=3&limit=50&cursor=abc", nil)
+		assert.Panics(func() {
+			ctx.Paginate(20, 10)
+		})
+		p, err := ctx.Paginate(20, 100)
+		assert.Nil(err)
+		assert.Equal(&Page{Page: 3, Limit: 50, Offset: 100, Cursor: "abc"}, p)
+
+		ctx = CtxTest(app, "GET", "http://example.com/users", nil)
+		p, err = ctx.Paginate(20, 100)
+		assert.Nil(err)
+		assert.Equal(&Page{Page: 1, Limit: 20}, p)
+
+		for _, query := range []string{"page=0", "page=x", "limit=0", "limit=101", "page=9223372036854775807"} {
+			ctx = CtxTest(app, "GET", "http://example.com/users?"+query, nil)
+			_, err = ctx.Paginate(20, 100)
+			assert.Equal(400, err.(*Error).Code, query)
+		}
+	})
+
+	t.Run("should set page links", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := CtxTest(app, "GET", "http://example.com/users?q=go&page=2&limit=10", nil)
+		p, _ := ctx.Paginate(20, 100)
+		ctx.SetPageLinks(p, 35)
+		assert.Equal(`</users?limit=10&page=1&q=go>; rel="first", `+
+			`</users?limit=10&page=1&q=go>; rel="prev", `+
+			`</users?limit=10&page=3&q=go>; rel="next", `+
+			`</users?limit=10&page=4&q=go>; rel="last"`, ctx.Res.Get(HeaderLink))
+
+		ctx = CtxTest(app, "GET", "http://example.com/users", nil)
+		p, _ = ctx.Paginate(20, 100)
+		ctx.SetPageLinks(p, 0)
+		assert.Equal(`</users?limit=20&page=1>; rel="first", </users?limit=20&page=1>; rel="last"`,
+			ctx.Res.Get(HeaderLink))
+	})
+
+	t.Run("should set cursor links", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := CtxTest(app, "GET", "http://example.com/users?q=go&cursor=c1", nil)
+		ctx.SetCursorLinks("c2", "c0")
+		assert.Equal(`</users?q=go>; rel="first", </users?cursor=c0&q=go>; rel="prev", `+
+			`</users?cursor=c2&q=go>; rel="next"`, ctx.Res.Get(HeaderLink))
+
+		ctx = CtxTest(app, "GET", "http://example.com/users?cursor=c1", nil)
+		ctx.SetCursorLinks("", "")
+		assert.Equal(`</users>; rel="first"`, ctx.Res.Get(HeaderLink))
+	})
+
+	t.Run("should encode and decode signed cursor", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := CtxTest(app, "GET", "http://example.com/users", nil)
+		_, err := ctx.EncodeCursor("id")
+		assert.NotNil(err)
+
+		app := New()
+		app.Set(SetKeys, []string{"key1"})
+		ctx = CtxTest(app, "GET", "http://example.com/users", nil)
+		cursor, err := ctx.EncodeCursor(map[string]interface{}{"id": "u100", "ts": 1})
+		assert.Nil(err)
+		assert.NotContains(cursor, "=")
+
+		var val struct {
+			ID string `json:"id"`
+			TS int    `json:"ts"`
+		}
+		assert.Nil(ctx.DecodeCursor(cursor, &val))
+		assert.Equal("u100", val.ID)
+		assert.Equal(1, val.TS)
+
+		// verified by the rotated keys
+		app.Set(SetKeys, []string{"key2", "key1"})
+		assert.Nil(ctx.DecodeCursor(cursor, &val))
+
+		app.Set(SetKeys, []string{"key2"})
+		assert.Equal(400, ctx.DecodeCursor(cursor, &val).(*Error).Code)
+		assert.Equal(400, ctx.DecodeCursor("abc", &val).(*Error).Code)
+		assert.Equal(400, ctx.DecodeCursor("!!!", &val).(*Error).Code)
+	})
+}
@@ -0,0 +1,234 @@
+package gear
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteRange is a byte range of the content, from Start with Length bytes.
+type ByteRange struct {
+	Start, Length int64
+}
+
+func (r ByteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+var errNoOverlap = errors.New("invalid range: failed to overlap")
+
+// ParseRange parses the Range header (such as "bytes=0-499, -500") against the content size,
+// the unsatisfiable ranges are ignored. It returns nil if the header is empty, and an error if
+// the header is invalid or none of the ranges is satisfiable.
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	if header == "" {
+		return nil, nil
+	}
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errors.New("invalid range")
+	}
+	var ranges []ByteRange
+	noOverlap := false
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.IndexByte(spec, '-')
+		if i < 0 {
+			return nil, errors.New("invalid range")
+		}
+		start, end := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		var r ByteRange
+		if start == "" {
+			// suffix range, the last n bytes
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if n == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = ByteRange{Start: size - n, Length: n}
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.Start = i
+			if end == "" {
+				r.Length = size - i
+			} else {
+				j, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || i > j {
+					return nil, errors.New("invalid range")
+				}
+				if j >= size {
+					j = size - 1
+				}
+				r.Length = j - i + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, errNoOverlap
+		}
+		return nil, errors.New("invalid range")
+	}
+	return ranges, nil
+}
+
+// Content sends the content with Range requests support. A single range is responded with
+// 206 Partial Content, and multiple ranges with a multipart/byteranges body. The Range header
+// is ignored if the If-Range header does not match the response ETag or the modtime, and the
+// unsatisfiable one is responded with 416 Range Not Satisfiable. The modtime is set as the
+// Last-Modified header if not zero, and the ETag header should be set before calling it.
+// Unlike ctx.Attachment (http.ServeContent), the content needs not to be seekable, and the
+// conditional GET should be checked with ctx.Fresh if needed. The *os.File content is sent
+// with sendfile(2) if possible, see Response.ReadFrom.
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+//
+//  f, _ := os.Open(path)
+//  defer f.Close()
+//  fi, _ := f.Stat()
+//  return ctx.Content(gear.MIMEOctetStream, fi.ModTime(), f, fi.Size())
+//
+func (ctx *Context) Content(contentType string, modtime time.Time, content io.ReaderAt, size int64) (err error) {
+	if !ctx.ended.swapTrue() {
+		return
+	}
+	ctx.Set(HeaderAcceptRanges, "bytes")
+	if !modtime.IsZero() {
+		ctx.Set(HeaderLastModified, modtime.UTC().Format(http.TimeFormat))
+	}
+
+	var ranges []ByteRange
+	if ctx.Method == http.MethodGet && ctx.checkIfRange(modtime) {
+		ranges, err = ParseRange(ctx.Get(HeaderRange), size)
+		if err != nil {
+			if err == errNoOverlap {
+				ctx.Set(HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			}
+			ctx.Type(MIMETextPlainCharsetUTF8)
+			return ctx.Res.respond(http.StatusRequestedRangeNotSatisfiable, []byte(err.Error()))
+		}
+		if sumRanges(ranges) > size {
+			// the client is wasteful or malicious, send the whole content
+			ranges = nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		ctx.Type(contentType)
+		ctx.Set(HeaderContentLength, strconv.FormatInt(size, 10))
+		ctx.Res.WriteHeader(http.StatusOK)
+		if ctx.Method != http.MethodHead {
+			_, err = io.Copy(ctx.Res, sectionReader(content, 0, size))
+		}
+	case 1:
+		r := ranges[0]
+		ctx.Type(contentType)
+		ctx.Set(HeaderContentRange, r.contentRange(size))
+		ctx.Set(HeaderContentLength, strconv.FormatInt(r.Length, 10))
+		ctx.Res.WriteHeader(http.StatusPartialContent)
+		_, err = io.Copy(ctx.Res, sectionReader(content, r.Start, r.Length))
+	default:
+		mw := multipart.NewWriter(ctx.Res)
+		length := rangesLength(mw.Boundary(), ranges, contentType, size)
+		ctx.Type("multipart/byteranges; boundary=" + mw.Boundary())
+		ctx.Set(HeaderContentLength, strconv.FormatInt(length, 10))
+		ctx.Res.WriteHeader(http.StatusPartialContent)
+		for _, r := range ranges {
+			var part io.Writer
+			if part, err = mw.CreatePart(rangeHeader(r, contentType, size)); err != nil {
+				return
+			}
+			if _, err = io.Copy(part, io.NewSectionReader(content, r.Start, r.Length)); err != nil {
+				return
+			}
+		}
+		err = mw.Close()
+	}
+	return
+}
+
+// checkIfRange returns true if the Range header should be applied.
+func (ctx *Context) checkIfRange(modtime time.Time) bool {
+	ifRange := ctx.Get(HeaderIfRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		// strong comparison
+		return ifRange == ctx.Res.Get(HeaderETag)
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && !modtime.IsZero() && modtime.Truncate(time.Second).Equal(t)
+}
+
+// sectionReader returns a reader of the section of the content. The *os.File is returned as
+// an *io.LimitedReader of it, so that the response can send it with sendfile(2).
+func sectionReader(content io.ReaderAt, off, n int64) io.Reader {
+	if f, ok := content.(*os.File); ok {
+		if _, err := f.Seek(off, io.SeekStart); err == nil {
+			return &io.LimitedReader{R: f, N: n}
+		}
+	}
+	return io.NewSectionReader(content, off, n)
+}
+
+func sumRanges(ranges []ByteRange) (n int64) {
+	for _, r := range ranges {
+		n += r.Length
+	}
+	return
+}
+
+func rangeHeader(r ByteRange, contentType string, size int64) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{HeaderContentRange: {r.contentRange(size)}}
+	if contentType != "" {
+		header.Set(HeaderContentType, contentType)
+	}
+	return header
+}
+
+// rangesLength returns the length of the multipart/byteranges body.
+func rangesLength(boundary string, ranges []ByteRange, contentType string, size int64) int64 {
+	var n countingWriter
+	mw := multipart.NewWriter(&n)
+	mw.SetBoundary(boundary)
+	for _, r := range ranges {
+		mw.CreatePart(rangeHeader(r, contentType, size))
+		n += countingWriter(r.Length)
+	}
+	mw.Close()
+	return int64(n)
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
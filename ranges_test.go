@@ -0,0 +1,144 @@
+package gear
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearParseRange(t *testing.T) {
+	assert := assert.New(t)
+
+	ranges, err := ParseRange("", 10)
+	assert.Nil(err)
+	assert.Nil(ranges)
+
+	ranges, err = ParseRange("bytes=0-1, 5-, -3, 8-100, 20-30", 10)
+	assert.Nil(err)
+	assert.Equal([]ByteRange{{0, 2}, {5, 5}, {7, 3}, {8, 2}}, ranges)
+
+	ranges, err = ParseRange("bytes=-100", 10)
+	assert.Nil(err)
+	assert.Equal([]ByteRange{{0, 10}}, ranges)
+
+	_, err = ParseRange("bytes=10-", 10)
+	assert.Equal(errNoOverlap, err)
+	_, err = ParseRange("bytes=-0", 10)
+	assert.Equal(errNoOverlap, err)
+
+	for _, s := range []string{"items=0-1", "bytes=", "bytes=1", "bytes=2-1", "bytes=a-1", "bytes=1-a", "bytes=--1"} {
+		_, err = ParseRange(s, 10)
+		assert.NotNil(err, s)
+		assert.NotEqual(errNoOverlap, err, s)
+	}
+}
+
+func TestGearContextContent(t *testing.T) {
+	app := New()
+	content := strings.NewReader("0123456789abcdefghij")
+	modtime := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	request := func(method string, header map[string]string) *http.Response {
+		ctx := CtxTest(app, method, "http://example.com/file", nil)
+		for k, v := range header {
+			ctx.Req.Header.Set(k, v)
+		}
+		ctx.Set(HeaderETag, `"v1"`)
+		assert.Nil(t, ctx.Content(MIMETextPlainCharsetUTF8, modtime, content, content.Size()))
+		return CtxResult(ctx)
+	}
+
+	t.Run("should send the whole content", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("GET", nil)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("bytes", res.Header.Get(HeaderAcceptRanges))
+		assert.Equal("20", res.Header.Get(HeaderContentLength))
+		assert.Equal(modtime.Format(http.TimeFormat), res.Header.Get(HeaderLastModified))
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("0123456789abcdefghij", string(body))
+
+		res = request("HEAD", map[string]string{HeaderRange: "bytes=0-1"})
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("20", res.Header.Get(HeaderContentLength))
+		body, _ = ioutil.ReadAll(res.Body)
+		assert.Equal("", string(body))
+
+		// too many overlapped ranges
+		res = request("GET", map[string]string{HeaderRange: "bytes=0-, 0-, 0-"})
+		assert.Equal(200, res.StatusCode)
+	})
+
+	t.Run("should send a single range", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("GET", map[string]string{HeaderRange: "bytes=-5"})
+		assert.Equal(206, res.StatusCode)
+		assert.Equal("bytes 15-19/20", res.Header.Get(HeaderContentRange))
+		assert.Equal("5", res.Header.Get(HeaderContentLength))
+		assert.Equal(MIMETextPlainCharsetUTF8, res.Header.Get(HeaderContentType))
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("fghij", string(body))
+	})
+
+	t.Run("should send multipart/byteranges", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("GET", map[string]string{HeaderRange: "bytes=0-2, 10-12"})
+		assert.Equal(206, res.StatusCode)
+		assert.Equal("", res.Header.Get(HeaderContentRange))
+		mediaType, params, err := mime.ParseMediaType(res.Header.Get(HeaderContentType))
+		assert.Nil(err)
+		assert.Equal("multipart/byteranges", mediaType)
+
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(strconv.Itoa(len(body)), res.Header.Get(HeaderContentLength))
+
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		var parts []string
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			assert.Equal(MIMETextPlainCharsetUTF8, part.Header.Get(HeaderContentType))
+			buf, _ := ioutil.ReadAll(part)
+			parts = append(parts, part.Header.Get(HeaderContentRange)+" "+string(buf))
+		}
+		assert.Equal([]string{"bytes 0-2/20 012", "bytes 10-12/20 abc"}, parts)
+	})
+
+	t.Run("should check If-Range", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("GET", map[string]string{HeaderRange: "bytes=0-1", HeaderIfRange: `"v1"`})
+		assert.Equal(206, res.StatusCode)
+		res = request("GET", map[string]string{HeaderRange: "bytes=0-1", HeaderIfRange: `"v0"`})
+		assert.Equal(200, res.StatusCode)
+		res = request("GET", map[string]string{HeaderRange: "bytes=0-1", HeaderIfRange: modtime.Format(http.TimeFormat)})
+		assert.Equal(206, res.StatusCode)
+		res = request("GET", map[string]string{HeaderRange: "bytes=0-1", HeaderIfRange: modtime.Add(-time.Hour).Format(http.TimeFormat)})
+		assert.Equal(200, res.StatusCode)
+	})
+
+	t.Run("should respond 416", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request("GET", map[string]string{HeaderRange: "bytes=20-"})
+		assert.Equal(416, res.StatusCode)
+		assert.Equal("bytes */20", res.Header.Get(HeaderContentRange))
+
+		res = request("GET", map[string]string{HeaderRange: "bytes=x"})
+		assert.Equal(416, res.StatusCode)
+		assert.Equal("", res.Header.Get(HeaderContentRange))
+	})
+}
@@ -0,0 +1,76 @@
+package gear
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit represents the state of a rate limiter for the request, it is used to populate the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset response headers
+// (draft-ietf-httpapi-ratelimit-headers).
+type RateLimit struct {
+	// Limit is the request quota of the time window.
+	Limit int
+	// Remaining is the remaining quota of the time window.
+	Remaining int
+	// Reset is the time until the quota resets.
+	Reset time.Duration
+}
+
+// RateLimitError represents a 429 Too Many Requests error with the rate limiter state.
+// When it is returned from a middleware (or passed to ctx.Error), the RateLimit headers
+// and the Retry-After header are set on the response.
+//
+//  if !limiter.Allow(key) {
+//  	return gear.NewRateLimitError(gear.RateLimit{Limit: 100, Remaining: 0, Reset: limiter.Reset(key)})
+//  }
+//
+type RateLimitError struct {
+	RateLimit
+	Msg string
+}
+
+// NewRateLimitError creates a RateLimitError with the rate limiter state.
+func NewRateLimitError(rl RateLimit) *RateLimitError {
+	return &RateLimitError{RateLimit: rl, Msg: http.StatusText(http.StatusTooManyRequests)}
+}
+
+// Status implemented HTTPError interface.
+func (err *RateLimitError) Status() int {
+	return http.StatusTooManyRequests
+}
+
+// Error implemented HTTPError interface.
+func (err *RateLimitError) Error() string {
+	return err.Msg
+}
+
+// retryAfter returns the delay seconds of Retry-After header, rounded up and at least 1.
+func (err *RateLimitError) retryAfter() string {
+	return strconv.Itoa(resetSeconds(err.Reset, 1))
+}
+
+// SetRateLimit sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset response headers
+// from the rate limiter state, it can be used on the allowed requests to let the clients know
+// their quota. The headers are kept when the ctx responds an error.
+//
+//  ctx.SetRateLimit(gear.RateLimit{Limit: 100, Remaining: 99, Reset: time.Minute})
+//
+func (ctx *Context) SetRateLimit(rl RateLimit) {
+	remaining := rl.Remaining
+	if remaining < 0 {
+		remaining = 0
+	}
+	ctx.Set(HeaderRateLimitLimit, strconv.Itoa(rl.Limit))
+	ctx.Set(HeaderRateLimitRemaining, strconv.Itoa(remaining))
+	ctx.Set(HeaderRateLimitReset, strconv.Itoa(resetSeconds(rl.Reset, 0)))
+}
+
+func resetSeconds(d time.Duration, min int) int {
+	s := int((d + time.Second - 1) / time.Second)
+	if s < min {
+		s = min
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package gear
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearRateLimit(t *testing.T) {
+	app := New()
+	app.Use(func(ctx *Context) error {
+		switch ctx.Path {
+		case "/allowed":
+			ctx.SetRateLimit(RateLimit{Limit: 10, Remaining: 9, Reset: 1500 * time.Millisecond})
+			return ctx.HTML(200, "OK")
+		case "/limited":
+			ctx.Set(HeaderXPoweredBy, "gear")
+			return NewRateLimitError(RateLimit{Limit: 10, Remaining: -1, Reset: 30*time.Second + time.Millisecond})
+		case "/error":
+			ctx.SetRateLimit(RateLimit{Limit: 10, Remaining: 0, Reset: 0})
+			return errors.New("some error")
+		}
+		return ctx.Error(&RateLimitError{RateLimit: RateLimit{Limit: 1}, Msg: "slow down"})
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	t.Run("SetRateLimit", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := RequestBy("GET", host+"/allowed")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("10", res.Header.Get(HeaderRateLimitLimit))
+		assert.Equal("9", res.Header.Get(HeaderRateLimitRemaining))
+		assert.Equal("2", res.Header.Get(HeaderRateLimitReset))
+		assert.Equal("", res.Header.Get(HeaderRetryAfter))
+		res.Body.Close()
+
+		res, err = RequestBy("GET", host+"/error")
+		assert.Nil(err)
+		assert.Equal(500, res.StatusCode)
+		assert.Equal("10", res.Header.Get(HeaderRateLimitLimit))
+		assert.Equal("0", res.Header.Get(HeaderRateLimitRemaining))
+		assert.Equal("0", res.Header.Get(HeaderRateLimitReset))
+		res.Body.Close()
+	})
+
+	t.Run("RateLimitError", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := RequestBy("GET", host+"/limited")
+		assert.Nil(err)
+		assert.Equal(http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal("10", res.Header.Get(HeaderRateLimitLimit))
+		assert.Equal("0", res.Header.Get(HeaderRateLimitRemaining))
+		assert.Equal("31", res.Header.Get(HeaderRateLimitReset))
+		assert.Equal("31", res.Header.Get(HeaderRetryAfter))
+		assert.Equal("", res.Header.Get(HeaderXPoweredBy))
+		assert.Equal("Too Many Requests", PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		res, err = RequestBy("GET", host+"/")
+		assert.Nil(err)
+		assert.Equal(http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal("1", res.Header.Get(HeaderRateLimitLimit))
+		assert.Equal("0", res.Header.Get(HeaderRateLimitReset))
+		assert.Equal("1", res.Header.Get(HeaderRetryAfter))
+		assert.Equal("slow down", PickRes(res.Text()).(string))
+		res.Body.Close()
+	})
+}
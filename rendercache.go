@@ -0,0 +1,190 @@
+package gear
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RenderCacheOptions is the options of NewRenderCache.
+type RenderCacheOptions struct {
+	// TTL defines how long the rendered output is cached, default to 1 minute.
+	TTL time.Duration
+	// MaxEntries defines the maximum number of the cached outputs, 0 means no limit.
+	// The expired ones are removed first, then the one expiring soonest when full.
+	MaxEntries int
+}
+
+// RenderCache caches the rendered output of the templates by key, it is used by ctx.RenderCached
+// with the app setting SetRenderCache, so that the mostly-static HTML pages are served without
+// running the render pipeline. The outputs are invalidated after the TTL, or explicitly by
+// Invalidate and InvalidatePrefix when the data changed. It is safe for concurrent use.
+//
+// The cached output is served to every request with the same key, so only cache the pages that
+// are the same for every user. Never cache the pages rendered with the user's session, cookies
+// or permissions, such as a dashboard or a page showing the user name, unless the key contains
+// the user ID.
+//
+//  cache := gear.NewRenderCache(gear.RenderCacheOptions{TTL: 10 * time.Minute})
+//  app.Set(gear.SetRenderCache, cache)
+//
+//  router.Get("/posts/:id", func(ctx *gear.Context) error {
+//  	return ctx.RenderCached(200, "", "post.html", func() (interface{}, error) {
+//  		return db.GetPost(ctx.Param("id"))
+//  	})
+//  })
+//
+//  // after the post updated
+//  cache.InvalidatePrefix("/posts/" + id + "?")
+//
+type RenderCache struct {
+	ttl     time.Duration
+	max     int
+	mu      sync.Mutex
+	entries map[string]renderEntry
+}
+
+type renderEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// NewRenderCache creates a RenderCache with the options.
+func NewRenderCache(opts RenderCacheOptions) *RenderCache {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	return &RenderCache{ttl: opts.TTL, max: opts.MaxEntries, entries: make(map[string]renderEntry)}
+}
+
+// Get returns the cached output by key if it is not expired.
+func (c *RenderCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.body, true
+}
+
+// Set caches the output by key with the TTL, the body should not be modified after.
+func (c *RenderCache) Set(key string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && c.max > 0 && len(c.entries) >= c.max {
+		c.evict()
+	}
+	c.entries[key] = renderEntry{body: body, expires: time.Now().Add(c.ttl)}
+}
+
+// Invalidate removes the cached outputs by the keys.
+func (c *RenderCache) Invalidate(keys ...string) {
+	c.mu.Lock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+}
+
+// InvalidatePrefix removes the cached outputs that the key has the prefix, such as the pages of
+// a path with any query with the default keys ("/posts/123?").
+func (c *RenderCache) InvalidatePrefix(prefix string) {
+	c.mu.Lock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Purge removes all the cached outputs.
+func (c *RenderCache) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[string]renderEntry)
+	c.mu.Unlock()
+}
+
+// Len returns the number of the cached outputs, including the expired ones not yet removed.
+func (c *RenderCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// evict removes the expired entries, or the one expiring soonest if none expired.
+// It should be called with the lock held.
+func (c *RenderCache) evict() {
+	now := time.Now()
+	var victim string
+	var expires time.Time
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+			victim = ""
+			expires = now
+			continue
+		}
+		if expires.IsZero() || e.expires.Before(expires) {
+			victim, expires = key, e.expires
+		}
+	}
+	if len(c.entries) >= c.max {
+		delete(c.entries, victim)
+	}
+}
+
+// RenderKey returns the default key of ctx.RenderCached, it consists of the path, the sorted
+// query, the language and the host of the request, such as "/posts/123?page=2#en@example.com".
+// It starts with the path, so that InvalidatePrefix("/posts/123?") invalidates the page of all
+// the hosts. It contains nothing about the user, see RenderCache.
+func (ctx *Context) RenderKey() string {
+	return ctx.Path + "?" + ctx.Req.URL.Query().Encode() + "#" + ctx.Lang() + "@" + ctx.Host
+}
+
+// RenderCached renders a template like ctx.Render, but the output is cached by the key (or
+// ctx.RenderKey() if the key is empty) with the app setting SetRenderCache. The data func is
+// called to get the template data only when the cache missed. The output is not cached if no
+// SetRenderCache. It must only be used for the output that is the same for every user, the
+// cached output of one user is served to the others.
+// It will end the ctx. The middlewares after current middleware will not run.
+// "after hooks" (if no error) and "end hooks" will run normally.
+// Note that this will not stop the current handler.
+func (ctx *Context) RenderCached(code int, key, name string, data func() (interface{}, error)) error {
+	if ctx.app.renderer == nil {
+		return ErrRendererNotRegistered
+	}
+	cache := ctx.app.renderCache
+	if cache == nil {
+		val, err := data()
+		if err != nil {
+			return err
+		}
+		return ctx.Render(code, name, val)
+	}
+
+	if key == "" {
+		key = ctx.RenderKey()
+	}
+	body, ok := cache.Get(key)
+	if !ok {
+		val, err := data()
+		if err != nil {
+			return err
+		}
+		buf := new(bytes.Buffer)
+		if err = ctx.app.renderer.Render(ctx, buf, name, val); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		cache.Set(key, body)
+	}
+	ctx.Type(MIMETextHTMLCharsetUTF8)
+	return ctx.End(code, body)
+}
@@ -0,0 +1,149 @@
+package gear
+
+import (
+	"errors"
+	"html/template"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearRenderCache(t *testing.T) {
+	t.Run("should cache and invalidate", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cache := NewRenderCache(RenderCacheOptions{TTL: 50 * time.Millisecond})
+		cache.Set("/a?#en", []byte("a"))
+		cache.Set("/a?x=1#en", []byte("a1"))
+		cache.Set("/b?#en", []byte("b"))
+		body, ok := cache.Get("/a?#en")
+		assert.True(ok)
+		assert.Equal("a", string(body))
+		_, ok = cache.Get("/c?#en")
+		assert.False(ok)
+
+		cache.InvalidatePrefix("/a?")
+		assert.Equal(1, cache.Len())
+		cache.Invalidate("/b?#en", "/c?#en")
+		assert.Equal(0, cache.Len())
+
+		cache.Set("/a?#en", []byte("a"))
+		time.Sleep(60 * time.Millisecond)
+		_, ok = cache.Get("/a?#en")
+		assert.False(ok)
+		assert.Equal(0, cache.Len())
+
+		cache.Set("/a?#en", []byte("a"))
+		cache.Purge()
+		assert.Equal(0, cache.Len())
+	})
+
+	t.Run("should evict the one expiring soonest", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cache := NewRenderCache(RenderCacheOptions{MaxEntries: 2})
+		assert.Equal(time.Minute, cache.ttl)
+		cache.Set("a", []byte("a"))
+		cache.Set("b", []byte("b"))
+		cache.Set("a", []byte("a"))
+		cache.Set("c", []byte("c"))
+		assert.Equal(2, cache.Len())
+		_, ok := cache.Get("b")
+		assert.False(ok)
+		_, ok = cache.Get("a")
+		assert.True(ok)
+		_, ok = cache.Get("c")
+		assert.True(ok)
+	})
+
+	t.Run("should render with cache", func(t *testing.T) {
+		assert := assert.New(t)
+
+		count := 0
+		app := New()
+		assert.Panics(func() {
+			app.Set(SetRenderCache, "cache")
+		})
+		cache := NewRenderCache(RenderCacheOptions{})
+		app.Set(SetRenderCache, cache)
+		app.Set(SetRenderer, &RenderTest{
+			tpl: template.Must(template.New("hello").Parse(`<h1>Hello, {{.}}!</h1>`)),
+		})
+		app.Use(func(ctx *Context) error {
+			return ctx.RenderCached(200, "", "hello", func() (interface{}, error) {
+				count++
+				if ctx.Query("name") == "err" {
+					return nil, errors.New("some error")
+				}
+				return ctx.Query("name"), nil
+			})
+		})
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		for i := 0; i < 2; i++ {
+			res, err := RequestBy("GET", host+"/?name=gear&a=1")
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			assert.Equal(MIMETextHTMLCharsetUTF8, res.Header.Get(HeaderContentType))
+			assert.Equal("<h1>Hello, gear!</h1>", PickRes(res.Text()).(string))
+			res.Body.Close()
+		}
+		assert.Equal(1, count)
+
+		res, err := RequestBy("GET", host+"/?a=1&name=gear")
+		assert.Nil(err)
+		assert.Equal("<h1>Hello, gear!</h1>", PickRes(res.Text()).(string))
+		assert.Equal(1, count)
+
+		cache.InvalidatePrefix("/?")
+		res, err = RequestBy("GET", host+"/?name=gear&a=1")
+		assert.Nil(err)
+		assert.Equal("<h1>Hello, gear!</h1>", PickRes(res.Text()).(string))
+		assert.Equal(2, count)
+
+		res, err = RequestBy("GET", host+"/?name=err")
+		assert.Nil(err)
+		assert.Equal(500, res.StatusCode)
+		assert.Equal(1, cache.Len())
+	})
+
+	t.Run("should not cache without SetRenderCache", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx := CtxTest(New(), "GET", "http://example.com/?name=gear", nil)
+		assert.Equal(ErrRendererNotRegistered, ctx.RenderCached(200, "", "hello", nil))
+
+		count := 0
+		app := New()
+		app.Set(SetRenderer, &RenderTest{
+			tpl: template.Must(template.New("hello").Parse(`Hello, {{.}}!`)),
+		})
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			ctx := NewContext(app, rec, httptest.NewRequest("GET", "http://example.com/?name=gear", nil))
+			err := ctx.RenderCached(200, "page", "hello", func() (interface{}, error) {
+				count++
+				return "gear", nil
+			})
+			assert.Nil(err)
+			assert.Equal("Hello, gear!", rec.Body.String())
+		}
+		assert.Equal(2, count)
+
+		app = New()
+		app.Set(SetRenderer, &RenderTest{tpl: template.New("hello")})
+		app.Set(SetRenderCache, NewRenderCache(RenderCacheOptions{}))
+		ctx = NewContext(app, httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com", nil))
+		assert.Equal("?#@example.com", ctx.RenderKey())
+
+		req := httptest.NewRequest("GET", "http://example.com/posts/1?b=2&a=1", nil)
+		req.Host = "acme.example.com"
+		ctx = NewContext(app, httptest.NewRecorder(), req)
+		assert.Equal("/posts/1?a=1&b=2#@acme.example.com", ctx.RenderKey())
+		assert.NotNil(ctx.RenderCached(200, "", "none", func() (interface{}, error) { return nil, nil }))
+	})
+}
@@ -2,18 +2,29 @@ package gear
 
 import (
 	"bufio"
+	"io"
 	"net"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var defaultHeaderFilterReg = regexp.MustCompile(
-	`(?i)^(accept|allow|retry-after|warning|vary|access-control-allow-)`)
+	`(?i)^(accept|allow|retry-after|ratelimit-|warning|vary|access-control-allow-)`)
 
 // ErrPusherNotImplemented is return from Response.Push.
 var ErrPusherNotImplemented = NewAppError("http.Pusher not implemented")
 
+// ErrHijackerNotImplemented is return from Response.Hijack.
+var ErrHijackerNotImplemented = NewAppError("http.Hijacker not implemented")
+
+// ErrResponseTooLarge is returned from Response.Write when the body exceeds the limit set by
+// Response.SetLimit.
+var ErrResponseTooLarge = NewAppError("response body too large")
+
 // Response wraps an http.ResponseWriter and implements its interface to be used
 // by an HTTP handler to construct an HTTP response.
 type Response struct {
@@ -22,8 +33,17 @@ type Response struct {
 	rw          http.ResponseWriter // maybe a http.ResponseWriter wrapper
 	wroteHeader atomicBool
 	responded   atomicBool
-	bodyLength  int // number of bytes to write, ignore stream body.
-	status      int // response Status Code
+	bodyLength  int       // number of bytes to write, ignore stream body.
+	status      int       // response Status Code
+	written     int64     // number of body bytes written, should be accessed atomically.
+	wroteAt     time.Time // the time when the header was written.
+	transforms  []*transformWriter
+	compress    *compressWriter
+	noBuffering bool // flush after every write
+	limit       int64 // max number of body bytes to write, 0 means no limit.
+	onLimit     func(written int64)
+	exceeded    bool // the body exceeded the limit
+	truncated   bool // the body exceeded the limit after the header wrote, the connection should be aborted
 }
 
 func newResponse(ctx *Context, w http.ResponseWriter) *Response {
@@ -45,20 +65,34 @@ func (r *Response) Del(key string) {
 	r.Header().Del(key)
 }
 
-// Vary manipulate the HTTP Vary header.
+// Vary manipulate the HTTP Vary header, the fields that already exist will be ignored.
 // https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Vary
-func (r *Response) Vary(field string) {
-	if field != "" && r.Get(HeaderVary) != "*" {
+func (r *Response) Vary(fields ...string) {
+	for _, field := range fields {
+		if field == "" || r.Get(HeaderVary) == "*" {
+			continue
+		}
 		if field == "*" {
 			r.Header().Set(HeaderVary, field)
-		} else {
-			r.Header().Add(HeaderVary, field)
+		} else if !r.hasVary(field) {
+			r.Header().Add(HeaderVary, http.CanonicalHeaderKey(field))
 		}
 	}
 }
 
+func (r *Response) hasVary(field string) bool {
+	for _, val := range r.Header()[HeaderVary] {
+		for _, f := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ResetHeader reset headers. If keepSubset is true,
-// header matching `(?i)^(accept|allow|retry-after|warning|access-control-allow-)` will be keep
+// header matching `(?i)^(accept|allow|retry-after|ratelimit-|warning|vary|access-control-allow-)` will be keep
 func (r *Response) ResetHeader(filterReg ...*regexp.Regexp) {
 	reg := defaultHeaderFilterReg
 	if len(filterReg) > 0 {
@@ -72,6 +106,32 @@ func (r *Response) ResetHeader(filterReg ...*regexp.Regexp) {
 	}
 }
 
+// presetHeaderValues are the preallocated values of the common headers, such as the
+// Content-Type variants, so that setting them allocates nothing. They are shared between
+// responses, the values can be replaced or appended but should not be modified in place.
+var presetHeaderValues = map[string][]string{
+	MIMEApplicationJSONCharsetUTF8:       {MIMEApplicationJSONCharsetUTF8},
+	MIMEApplicationJavaScriptCharsetUTF8: {MIMEApplicationJavaScriptCharsetUTF8},
+	MIMEApplicationXMLCharsetUTF8:        {MIMEApplicationXMLCharsetUTF8},
+	MIMEApplicationYAMLCharsetUTF8:       {MIMEApplicationYAMLCharsetUTF8},
+	MIMETextHTMLCharsetUTF8:              {MIMETextHTMLCharsetUTF8},
+	MIMETextPlainCharsetUTF8:             {MIMETextPlainCharsetUTF8},
+	MIMEOctetStream:                      {MIMEOctetStream},
+	"nosniff":                            {"nosniff"},
+	"close":                              {"close"},
+	"no":                                 {"no"},
+}
+
+// setHeader sets the header with a canonical key (such as the Header* constants) without
+// the canonicalization, and with the preset value if exists.
+func (r *Response) setHeader(key, value string) {
+	if v, ok := presetHeaderValues[value]; ok {
+		r.Header()[key] = v
+	} else {
+		r.Header()[key] = []string{value}
+	}
+}
+
 // Header returns the header map that will be sent by WriteHeader.
 func (r *Response) Header() http.Header {
 	return r.rw.Header()
@@ -79,6 +139,9 @@ func (r *Response) Header() http.Header {
 
 // Write writes the data to the connection as part of an HTTP reply.
 func (r *Response) Write(buf []byte) (int, error) {
+	if r.limit > 0 && !r.allow(len(buf)) {
+		return 0, ErrResponseTooLarge
+	}
 	// Some http Handler will call Write directly.
 	if !r.wroteHeader.isTrue() {
 		if r.status == 0 {
@@ -86,7 +149,41 @@ func (r *Response) Write(buf []byte) (int, error) {
 		}
 		r.WriteHeader(0)
 	}
-	return r.rw.Write(buf)
+	n, err := r.rw.Write(buf)
+	atomic.AddInt64(&r.written, int64(n))
+	if err == nil && r.noBuffering {
+		r.Flush()
+	}
+	return n, err
+}
+
+// ReadFrom implements the io.ReaderFrom interface, so that io.Copy (and http.ServeContent,
+// http.ServeFile) sends the file with sendfile(2) instead of copying through userspace buffers,
+// when the src is an *os.File (or an *io.LimitedReader of it). The ReadFrom is passed through
+// the compression and body transformation wrappers, they send the src through userspace
+// buffers only when the body is compressed or buffered.
+func (r *Response) ReadFrom(src io.Reader) (n int64, err error) {
+	if r.noBuffering || r.limit > 0 {
+		return io.Copy(writerOnly{r}, src)
+	}
+	if !r.wroteHeader.isTrue() {
+		if r.status == 0 {
+			r.status = 200
+		}
+		r.WriteHeader(0)
+	}
+	if rf, ok := r.rw.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{r.rw}, src)
+	}
+	atomic.AddInt64(&r.written, n)
+	return
+}
+
+// writerOnly hides the io.ReaderFrom of the writer to avoid the recursion of io.Copy.
+type writerOnly struct {
+	io.Writer
 }
 
 // WriteHeader sends an HTTP response header with status code.
@@ -123,10 +220,20 @@ func (r *Response) WriteHeader(code int) {
 		r.bodyLength = 0
 	}
 
-	// check and set Content-Length
-	if r.bodyLength > 0 && r.Get(HeaderContentLength) == "" {
-		r.Set(HeaderContentLength, strconv.Itoa(r.bodyLength))
+	if r.ctx.app.cookiePolicy != nil {
+		r.ctx.app.cookiePolicy.apply(r.ctx)
+	}
+	if serverTiming := r.ctx.serverTimingHeader(); serverTiming != "" {
+		r.Header().Add(HeaderServerTiming, serverTiming)
+	}
+
+	// check and set Content-Length, the response with trailers should be chunked.
+	if r.hasTrailer() {
+		r.Del(HeaderContentLength)
+	} else if r.bodyLength > 0 && r.Get(HeaderContentLength) == "" {
+		r.setHeader(HeaderContentLength, strconv.Itoa(r.bodyLength))
 	}
+	r.wroteAt = time.Now()
 	r.rw.WriteHeader(r.status)
 	// execute "end hooks" in LIFO order after Response.WriteHeader
 	for i := len(r.ctx.endHooks) - 1; i >= 0; i-- {
@@ -135,17 +242,43 @@ func (r *Response) WriteHeader(code int) {
 }
 
 // Flush implements the http.Flusher interface to allow an HTTP handler to flush
-// buffered data to the client.
+// buffered data to the client. The header will be written (and "after hooks" will run)
+// if it has not been written. The buffered data of body transformation will be sent
+// without transformation, and the compressed data will be flushed too.
 // See [http.Flusher](https://golang.org/pkg/net/http/#Flusher)
 func (r *Response) Flush() {
-	r.w.(http.Flusher).Flush()
+	if !r.wroteHeader.isTrue() {
+		if r.status == 0 {
+			r.status = 200
+		}
+		r.WriteHeader(0)
+	}
+	// stop buffering for body transformation in LIFO order
+	for i := len(r.transforms) - 1; i >= 0; i-- {
+		r.transforms[i].stream()
+	}
+	if r.compress != nil {
+		r.compress.Flush()
+	}
+	if flusher, ok := r.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
 // Hijack implements the http.Hijacker interface to allow an HTTP handler to
-// take over the connection.
+// take over the connection. The ctx will be ended after the connection hijacked,
+// gear will not respond anymore, the handler should write the response to the connection.
 // See [http.Hijacker](https://golang.org/pkg/net/http/#Hijacker)
 func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	return r.w.(http.Hijacker).Hijack()
+	if hijacker, ok := r.w.(http.Hijacker); ok {
+		conn, rw, err := hijacker.Hijack()
+		if err == nil {
+			r.wroteHeader.setTrue()
+			r.ctx.ended.setTrue()
+		}
+		return conn, rw, err
+	}
+	return nil, nil, ErrHijackerNotImplemented
 }
 
 // CloseNotify implements the http.CloseNotifier interface to allow detecting
@@ -166,12 +299,104 @@ func (r *Response) Push(target string, opts *http.PushOptions) error {
 	return ErrPusherNotImplemented
 }
 
+// Unwrap returns the origin http.ResponseWriter, so that http.ResponseController can access
+// the methods that Response does not implement, such as SetWriteDeadline and EnableFullDuplex.
+func (r *Response) Unwrap() http.ResponseWriter {
+	return r.w
+}
+
 // HeaderWrote indecates that whether the reply header has been (logically) written.
 func (r *Response) HeaderWrote() bool {
 	return r.wroteHeader.isTrue()
 }
 
+// Status returns the response status code. It is the final status code
+// that sent to the client after the header wrote, and it can be read in "end hooks".
+func (r *Response) Status() int {
+	return r.status
+}
+
+// BytesWritten returns the number of body bytes written to the response so far,
+// it is uncompressed size if the app compresses the response.
+// Note that "end hooks" run before the body written, so it is the final size only
+// after the app served the request.
+func (r *Response) BytesWritten() int64 {
+	return atomic.LoadInt64(&r.written)
+}
+
+// HeaderWroteAt returns the time when the response header was written,
+// a zero time will be returned if the header has not been written.
+// It can be used to calculate the time to first byte in "end hooks":
+//
+//  start := time.Now()
+//  ctx.OnEnd(func() {
+//  	ttfb := ctx.Res.HeaderWroteAt().Sub(start)
+//  	logging.FromCtx(ctx)["TTFB"] = ttfb
+//  })
+//
+func (r *Response) HeaderWroteAt() time.Time {
+	return r.wroteAt
+}
+
+// SetLimit caps the number of body bytes the handler may write to n, the write beyond it
+// fails with ErrResponseTooLarge, and the onExceed hook (can be nil) is called once with
+// the number of bytes written. If the header has not been written, such as ctx.JSON with
+// a too large body, the error response is sent instead (the error responses are not limited).
+// Otherwise the connection will be aborted after the request served, so that the client will
+// not take the truncated body as a complete one. n <= 0 removes the limit.
+//
+//  ctx.Res.SetLimit(10<<20, func(written int64) {
+//  	logging.FromCtx(ctx)["Truncated"] = written
+//  })
+//
+func (r *Response) SetLimit(n int64, onExceed func(written int64)) {
+	if n < 0 {
+		n = 0
+	}
+	r.limit = n
+	r.onLimit = onExceed
+}
+
+// allow checks the limit before writing n bytes of body.
+func (r *Response) allow(n int) bool {
+	written := atomic.LoadInt64(&r.written)
+	if !r.exceeded && written+int64(n) <= r.limit {
+		return true
+	}
+	if !r.exceeded {
+		r.exceeded = true
+		r.truncated = r.wroteHeader.isTrue()
+		if r.onLimit != nil {
+			r.onLimit(written)
+		}
+	}
+	return false
+}
+
+// abortTruncated aborts the connection if the body is truncated by the limit.
+func (r *Response) abortTruncated() {
+	if r.truncated {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (r *Response) hasTrailer() bool {
+	return len(r.Header()[HeaderTrailer]) > 0
+}
+
+// closeTransforms sends the transformed body in LIFO order.
+func (r *Response) closeTransforms() {
+	for i := len(r.transforms) - 1; i >= 0; i-- {
+		if err := r.transforms[i].Close(); err != nil {
+			r.ctx.app.Error(err)
+		}
+	}
+}
+
 func (r *Response) respond(status int, body []byte) (err error) {
+	if r.limit > 0 && !r.wroteHeader.isTrue() && !r.allow(len(body)) {
+		return ErrResponseTooLarge
+	}
 	if r.responded.swapTrue() && !r.wroteHeader.isTrue() {
 		r.bodyLength = len(body)
 		r.WriteHeader(status)
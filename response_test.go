@@ -1,8 +1,14 @@
 package gear
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -34,6 +40,12 @@ func TestGearResponse(t *testing.T) {
 		res.Vary("Accept-Language")
 		assert.Equal("Accept-Encoding, Accept-Language", strings.Join(res.Header()["Vary"], ", "))
 
+		res.Vary("accept-encoding", "Origin", "", "ORIGIN")
+		assert.Equal("Accept-Encoding, Accept-Language, Origin", strings.Join(res.Header()["Vary"], ", "))
+		res.Header().Set("Vary", "Accept, Cookie")
+		res.Vary("cookie", "Accept-Language")
+		assert.Equal("Accept, Cookie, Accept-Language", strings.Join(res.Header()["Vary"], ", "))
+
 		res.Vary("*")
 		assert.Equal("*", res.Get("Vary"))
 		res.Vary("Accept-Language")
@@ -199,6 +211,64 @@ func TestGearResponse(t *testing.T) {
 	})
 }
 
+func TestGearResponseObservation(t *testing.T) {
+	t.Run("status, bytes written and header wrote time", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		ctx := CtxTest(app, "GET", "http://example.com/foo", nil)
+		res := ctx.Res
+		assert.Equal(0, res.Status())
+		assert.Equal(int64(0), res.BytesWritten())
+		assert.True(res.HeaderWroteAt().IsZero())
+
+		start := time.Now()
+		ctx.After(func() {
+			ctx.Status(http.StatusCreated)
+		})
+		ctx.OnEnd(func() {
+			assert.Equal(http.StatusCreated, res.Status())
+			assert.Equal(int64(0), res.BytesWritten())
+			assert.False(res.HeaderWroteAt().Before(start))
+		})
+		assert.Nil(ctx.End(http.StatusOK, []byte("Hello")))
+		assert.Equal(http.StatusCreated, res.Status())
+		assert.Equal(int64(5), res.BytesWritten())
+
+		wroteAt := res.HeaderWroteAt()
+		res.Write([]byte(", Gear"))
+		assert.Equal(int64(11), res.BytesWritten())
+		assert.Equal(wroteAt, res.HeaderWroteAt())
+	})
+
+	t.Run("stream body", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var c *Context
+		app := New()
+		app.Set(SetCompress, &DefaultCompress{})
+		app.Use(func(ctx *Context) error {
+			c = ctx
+			ctx.Type(MIMETextPlainCharsetUTF8)
+			ctx.Res.WriteHeader(http.StatusAccepted)
+			for i := 0; i < 3; i++ {
+				ctx.Res.Write([]byte(strings.Repeat("chunk", 100)))
+			}
+			return nil
+		})
+
+		req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+		req.Header.Set(HeaderAcceptEncoding, "gzip")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(http.StatusAccepted, rec.Code)
+		assert.Equal("gzip", rec.Header().Get(HeaderContentEncoding))
+		assert.Equal(http.StatusAccepted, c.Res.Status())
+		assert.Equal(int64(1500), c.Res.BytesWritten())
+		assert.True(rec.Body.Len() < 1500)
+	})
+}
+
 func TestGearResponseFlusher(t *testing.T) {
 	assert := assert.New(t)
 
@@ -218,6 +288,195 @@ func TestGearResponseFlusher(t *testing.T) {
 	res.Body.Close()
 }
 
+func TestGearResponseReaderFrom(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/README.md")
+	if err != nil {
+		panic(NewAppError(err.Error()))
+	}
+
+	var c *Context
+	app := New()
+	app.Set(SetCompress, &DefaultCompress{})
+	app.Use(func(ctx *Context) error {
+		c = ctx
+		file, err := os.Open("testdata/README.md")
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if ctx.Query("stream") != "" {
+			ctx.DisableBuffering()
+		}
+		if n := ctx.Query("transform"); n != "" {
+			max, _ := strconv.Atoi(n)
+			ctx.Transform(max, func(body []byte) ([]byte, error) {
+				return bytes.ToUpper(body), nil
+			})
+		}
+		ctx.Type(MIMETextPlainCharsetUTF8)
+		_, err = io.Copy(ctx.Res, file)
+		return err
+	})
+
+	srv := app.Start()
+	defer srv.Close()
+
+	t.Run("should send file with sendfile", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := RequestBy("GET", "http://"+srv.Addr().String())
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(string(data), PickRes(res.Text()).(string))
+		assert.Equal(int64(len(data)), c.Res.BytesWritten())
+	})
+
+	t.Run("should fallback to Write", func(t *testing.T) {
+		assert := assert.New(t)
+
+		req, _ := NewRequst("GET", "http://"+srv.Addr().String())
+		req.Header.Set(HeaderAcceptEncoding, "gzip")
+		res, err := DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("gzip", res.Header.Get(HeaderContentEncoding))
+		assert.Equal(int64(len(data)), c.Res.BytesWritten())
+		res.Body.Close()
+
+		res, err = RequestBy("GET", "http://"+srv.Addr().String()+"?stream=1")
+		assert.Nil(err)
+		assert.Equal(string(data), PickRes(res.Text()).(string))
+		assert.Equal(int64(len(data)), c.Res.BytesWritten())
+
+		res, err = RequestBy("GET", "http://"+srv.Addr().String()+"?transform=4096")
+		assert.Nil(err)
+		assert.Equal(strings.ToUpper(string(data)), PickRes(res.Text()).(string))
+		assert.Equal(int64(len(data)), c.Res.BytesWritten())
+	})
+
+	t.Run("should pass through the wrappers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		req, _ := NewRequst("GET", "http://"+srv.Addr().String()+"?transform=16")
+		req.Header.Set(HeaderAcceptEncoding, "identity")
+		res, err := DefaultClientDo(req)
+		assert.Nil(err)
+		assert.Equal("", res.Header.Get(HeaderContentEncoding))
+		assert.Equal(string(data), PickRes(res.Text()).(string))
+		assert.Equal(int64(len(data)), c.Res.BytesWritten())
+	})
+}
+
+func TestGearResponseSetLimit(t *testing.T) {
+	var exceeded []int64
+	app := New()
+	app.Use(func(ctx *Context) error {
+		ctx.Res.SetLimit(16, func(written int64) {
+			exceeded = append(exceeded, written)
+		})
+		switch ctx.Path {
+		case "/json":
+			return ctx.JSON(200, []string{"abcdefgh", "abcdefgh"})
+		case "/stream":
+			ctx.Res.WriteHeader(200)
+			for i := 0; i < 3; i++ {
+				if _, err := ctx.Res.Write([]byte("abcdefgh")); err != nil {
+					return err
+				}
+				ctx.Res.Flush()
+			}
+			return nil
+		case "/file":
+			ctx.Res.SetLimit(1<<20, nil)
+			file, err := os.Open("testdata/README.md")
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(ctx.Res, file)
+			return err
+		}
+		return ctx.HTML(200, "OK")
+	})
+	srv := app.Start()
+	defer srv.Close()
+	host := "http://" + srv.Addr().String()
+
+	t.Run("should respond error before the header wrote", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := RequestBy("GET", host+"/json")
+		assert.Nil(err)
+		assert.Equal(500, res.StatusCode)
+		assert.Equal(ErrResponseTooLarge.Error(), PickRes(res.Text()).(string))
+		assert.Equal([]int64{0}, exceeded)
+
+		res, err = RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("OK", PickRes(res.Text()).(string))
+	})
+
+	t.Run("should abort the truncated response", func(t *testing.T) {
+		assert := assert.New(t)
+
+		exceeded = nil
+		res, err := RequestBy("GET", host+"/stream")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.NotNil(err)
+		assert.Equal("abcdefghabcdefgh", string(body))
+		assert.Equal([]int64{16}, exceeded)
+	})
+
+	t.Run("should copy the file through the limit", func(t *testing.T) {
+		assert := assert.New(t)
+
+		data, _ := ioutil.ReadFile("testdata/README.md")
+		res, err := RequestBy("GET", host+"/file")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal(string(data), PickRes(res.Text()).(string))
+	})
+}
+
+func TestGearResponseUnwrap(t *testing.T) {
+	assert := assert.New(t)
+
+	app := New()
+	ctx := CtxTest(app, "GET", "http://example.com/foo", nil)
+	assert.Equal(ctx.Res.w, ctx.Res.Unwrap())
+
+	conn, rw, err := ctx.Res.Hijack()
+	assert.Nil(conn)
+	assert.Nil(rw)
+	assert.Equal(ErrHijackerNotImplemented, err)
+
+	rc := http.NewResponseController(ctx.Res)
+	assert.NotNil(rc.SetWriteDeadline(time.Now()))
+	assert.Nil(rc.Flush())
+}
+
+func TestGearResponseSetHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	app := New()
+	ctx := CtxTest(app, "GET", "http://example.com/foo", nil)
+	ctx.Type(MIMEApplicationJSONCharsetUTF8)
+	ctx.Res.setHeader(HeaderContentLength, "12")
+	assert.Equal(MIMEApplicationJSONCharsetUTF8, ctx.Res.Get(HeaderContentType))
+	assert.Equal("12", ctx.Res.Get(HeaderContentLength))
+
+	ctx.Res.Header().Add(HeaderContentType, "text/plain")
+	assert.Equal([]string{MIMEApplicationJSONCharsetUTF8, "text/plain"}, ctx.Res.Header()[HeaderContentType])
+	assert.Equal([]string{MIMEApplicationJSONCharsetUTF8}, presetHeaderValues[MIMEApplicationJSONCharsetUTF8])
+
+	ctx.Type("text/csv")
+	assert.Equal("text/csv", ctx.Type())
+}
+
 func TestGearResponseHijacker(t *testing.T) {
 	assert := assert.New(t)
 
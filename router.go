@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/teambition/trie-mux"
 )
@@ -112,10 +114,86 @@ import (
 //
 type Router struct {
 	root       string
-	trie       *trie.Trie
-	otherwise  Middleware
-	middleware Middleware
-	mds        []Middleware
+	host       *hostPattern
+	autoHead   bool
+	ignoreCase bool
+	trieOpts   trie.Options
+	onerror    func(*Context, HTTPError)
+
+	mu        sync.Mutex // guards the fields below, the mutations of routes are serialized
+	defs      []*routeDef
+	otherwise []Middleware
+	mds       []Middleware
+	staged    *routeTable  // the table being mutated, it is published on the next request
+	table     atomic.Value // *routeTable, the published table that Serve matches with
+}
+
+// route is the handler of a route, the router middlewares and the route handlers are
+// composed once at registration to one flat chain, so no closure is composed per request.
+type route struct {
+	handlers []Middleware
+	handle   Middleware
+}
+
+// routeDef is a registered route, the route tables are built from them.
+type routeDef struct {
+	pattern  string
+	methods  []string
+	handlers []Middleware
+}
+
+// routeTable is the matching state of the router. A published table is never mutated: the
+// mutations after it build a new table (copy-on-write), so the routes can be added, removed
+// or swapped while serving, and the requests in flight keep matching the old one without locks.
+type routeTable struct {
+	trie      *trie.Trie
+	statics   map[string]*trie.Node // the routes without parameters, matched by a map lookup
+	anys      map[*trie.Node]*route // the routes of the nonstandard methods registered by Any
+	otherwise *route
+	onerror   func(*Context, HTTPError)
+}
+
+func (r *Router) newRoute(handlers []Middleware) *route {
+	mds := make([]Middleware, 0, len(r.mds)+len(handlers))
+	mds = append(mds, r.mds...)
+	return &route{handlers: handlers, handle: Compose(append(mds, handlers...)...)}
+}
+
+// build builds a new route table from the route definitions.
+func (r *Router) build() *routeTable {
+	t := &routeTable{trie: trie.New(r.trieOpts), statics: make(map[string]*trie.Node),
+		anys: make(map[*trie.Node]*route), onerror: r.onerror}
+	for _, def := range r.defs {
+		r.define(t, def)
+	}
+	if len(r.otherwise) > 0 {
+		t.otherwise = r.newRoute(r.otherwise)
+	}
+	return t
+}
+
+// stage returns the table to mutate, it is copied from the route definitions if the
+// current one has been published. It should be called with the lock held.
+func (r *Router) stage() *routeTable {
+	if r.staged == nil {
+		r.staged = r.build()
+		r.table.Store((*routeTable)(nil))
+	}
+	return r.staged
+}
+
+// load returns the published table, it publishes the staged one if the routes are mutated.
+func (r *Router) load() *routeTable {
+	if t := r.table.Load().(*routeTable); t != nil {
+		return t
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.staged != nil {
+		r.table.Store(r.staged)
+		r.staged = nil
+	}
+	return r.table.Load().(*routeTable)
 }
 
 // RouterOptions is options for Router
@@ -124,6 +202,18 @@ type RouterOptions struct {
 	// Root string should start with "/", default to "/"
 	Root string
 
+	// Router's host pattern, the router only serves the requests that the host matched, the
+	// others go through. The port of the host is ignored. The label of the pattern can be a
+	// named parameter that matches one label, or a named wildcard parameter that matches one
+	// or more labels, they can be retrieved by `ctx.Param` as the path parameters:
+	//
+	//  ":tenant.example.com"     "acme.example.com" matched: tenant="acme"
+	//  ":sub*.example.com"       "a.b.example.com" matched: sub="a.b"
+	//  "api.:region.example.com" "api.us.example.com" matched: region="us"
+	//
+	// Default to "", match any host.
+	Host string
+
 	// Ignore case when matching URL path.
 	IgnoreCase bool
 
@@ -140,6 +230,13 @@ type RouterOptions struct {
 	// client is redirected to "/foo"" with http status code 301 for GET requests
 	// and 307 for all other request methods.
 	TrailingSlashRedirect bool
+
+	// Disables automatic HEAD handling for GET routes, it is enabled by default.
+	// For example if "HEAD /foo" is requested but only a GET handler exists for "/foo",
+	// the GET handler will be called. The response headers (including Content-Length)
+	// are kept but the body will be discarded by the server. The HEAD method is also
+	// added to the `Allow` header of the OPTIONS and 405 responses for the GET routes.
+	DisableAutoHead bool
 }
 
 var defaultRouterOptions = RouterOptions{
@@ -184,21 +281,35 @@ func NewRouter(routerOptions ...RouterOptions) *Router {
 		opts.Root = "/"
 	}
 
-	return &Router{
-		root: opts.Root,
-		mds:  make([]Middleware, 0),
-		trie: trie.New(trie.Options{
+	var host *hostPattern
+	if opts.Host != "" {
+		host = parseHostPattern(opts.Host)
+	}
+
+	r := &Router{
+		root:       opts.Root,
+		host:       host,
+		autoHead:   !opts.DisableAutoHead,
+		ignoreCase: opts.IgnoreCase,
+		mds:        make([]Middleware, 0),
+		trieOpts: trie.Options{
 			IgnoreCase:            opts.IgnoreCase,
 			FixedPathRedirect:     opts.FixedPathRedirect,
 			TrailingSlashRedirect: opts.TrailingSlashRedirect,
-		}),
+		},
 	}
+	r.stage()
+	return r
 }
 
 // Use registers a new Middleware in the router, that will be called when router mathed.
+// The routes registered before are recompiled with it.
 func (r *Router) Use(handle Middleware) {
-	r.mds = append(r.mds, handle)
-	r.middleware = Compose(r.mds...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mds = append(r.mds[:len(r.mds):len(r.mds)], handle)
+	r.staged = nil
+	r.stage()
 }
 
 // Handle registers a new Middleware handler with method and path in the router.
@@ -207,15 +318,126 @@ func (r *Router) Use(handle Middleware) {
 //
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
-// communication with a proxy).
+// communication with a proxy, or WebDAV methods). Method "*" matches all the
+// non-standardized methods that are not registered on the path.
+//
+//  router.Handle("PROPFIND", "/files/:filepath*", handler)
+//
 func (r *Router) Handle(method, pattern string, handlers ...Middleware) {
-	if method == "" {
+	if !isMethodToken(method) {
 		panic(NewAppError("invalid method"))
 	}
 	if len(handlers) == 0 {
 		panic(NewAppError("invalid middleware"))
 	}
-	r.trie.Define(pattern).Handle(strings.ToUpper(method), Compose(handlers...))
+	r.add(&routeDef{pattern: pattern, methods: []string{strings.ToUpper(method)}, handlers: handlers})
+}
+
+// Any registers a new route for a path with matching handler in the router for all methods,
+// the standard ones (GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, CONNECT and TRACE) and the
+// non-standardized or custom ones (e.g. WebDAV methods). A standard method of the route can be
+// removed by Remove, and the others by Remove with method "*".
+func (r *Router) Any(pattern string, handlers ...Middleware) {
+	if len(handlers) == 0 {
+		panic(NewAppError("invalid middleware"))
+	}
+	methods := make([]string, 0, len(anyMethods)+1)
+	methods = append(append(methods, anyMethods...), anyMethod)
+	r.add(&routeDef{pattern: pattern, methods: methods, handlers: handlers})
+}
+
+func (r *Router) add(def *routeDef) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.define(r.stage(), def)
+	r.defs = append(r.defs, def)
+}
+
+// define defines the route in the table's trie, and indexes it in statics if it has no parameters.
+func (r *Router) define(t *routeTable, def *routeDef) {
+	node := t.trie.Define(def.pattern)
+	if !strings.Contains(def.pattern, ":") {
+		t.statics[r.staticKey(def.pattern)] = node
+	}
+	rt := r.newRoute(def.handlers)
+	for _, method := range def.methods {
+		if method == anyMethod {
+			if t.anys[node] != nil {
+				panic(NewAppError(fmt.Sprintf(`"%s" already defined`, anyMethod)))
+			}
+			t.anys[node] = rt
+			continue
+		}
+		node.Handle(method, rt)
+	}
+}
+
+// Remove removes the route registered with the method and the pattern from the router, it
+// returns false if no such route. The pattern should be the same as the registered one. It
+// can be called while serving, the requests that have matched the route are not affected.
+//
+//  router.Get("/beta/:feature", handler)
+//  // later, when the beta ended
+//  router.Remove("GET", "/beta/:feature")
+//
+func (r *Router) Remove(method, pattern string) bool {
+	method = strings.ToUpper(method)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, def := range r.defs {
+		if def.pattern != pattern {
+			continue
+		}
+		for j, m := range def.methods {
+			if m != method {
+				continue
+			}
+			defs := make([]*routeDef, 0, len(r.defs))
+			defs = append(defs, r.defs[:i]...)
+			if len(def.methods) > 1 {
+				methods := make([]string, 0, len(def.methods)-1)
+				methods = append(append(methods, def.methods[:j]...), def.methods[j+1:]...)
+				defs = append(defs, &routeDef{pattern: def.pattern, methods: methods, handlers: def.handlers})
+			}
+			r.defs = append(defs, r.defs[i+1:]...)
+			r.staged = nil
+			r.stage()
+			return true
+		}
+	}
+	return false
+}
+
+// Swap replaces the routes, the router middlewares and the otherwise handlers of the router
+// with next's in one step, the options of the router (root, host and so on) are kept. It can be
+// called while serving, a request matches either all the old routes or all the new ones.
+// So the routes can be reloaded from a configuration without restarting the app:
+//
+//  next := gear.NewRouter()
+//  for _, rule := range config.Rules {
+//  	next.Get(rule.Path, proxy(rule.Upstream))
+//  }
+//  router.Swap(next)
+//
+func (r *Router) Swap(next *Router) {
+	next.mu.Lock()
+	defs, mds, otherwise := next.defs, next.mds, next.otherwise
+	next.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defs = append([]*routeDef(nil), defs...)
+	r.mds = append([]Middleware(nil), mds...)
+	r.otherwise = otherwise
+	r.staged = nil
+	r.table.Store(r.build())
+}
+
+func (r *Router) staticKey(path string) string {
+	if r.ignoreCase {
+		return strings.ToLower(path)
+	}
+	return path
 }
 
 // Get registers a new GET route for a path with matching handler in the router.
@@ -253,25 +475,113 @@ func (r *Router) Options(pattern string, handlers ...Middleware) {
 	r.Handle(http.MethodOptions, pattern, handlers...)
 }
 
+// anyMethod is the wildcard method slot of the routes registered by Any, it matches the
+// nonstandard methods.
+const anyMethod = "*"
+
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodConnect,
+	http.MethodTrace,
+}
+
+func isStandardMethod(method string) bool {
+	for _, m := range anyMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// isMethodToken checks the method is a valid token, https://tools.ietf.org/html/rfc7230#section-3.1.1
+func isMethodToken(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, c := range method {
+		if c > 127 || !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
 // Otherwise registers a new Middleware handler in the router
 // that will run if there is no other handler matching.
 func (r *Router) Otherwise(handlers ...Middleware) {
 	if len(handlers) == 0 {
 		panic(NewAppError("invalid middleware"))
 	}
-	r.otherwise = Compose(handlers...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.otherwise = handlers
+	r.stage().otherwise = r.newRoute(handlers)
+}
+
+// OnError sets an error handler for the router, it overrides the app's OnError hook for the
+// requests matched the router's root, including the 404, 405 and 501 errors of the router.
+// So the routers as groups can render the errors differently:
+//
+//  apiRouter := gear.NewRouter(gear.RouterOptions{Root: "/api"})
+//  apiRouter.OnError(func(ctx *gear.Context, err gear.HTTPError) {
+//  	ctx.JSON(err.Status(), err)
+//  })
+//
+//  viewRouter := gear.NewRouter()
+//  viewRouter.OnError(func(ctx *gear.Context, err gear.HTTPError) {
+//  	ctx.Render(err.Status(), "error.html", err)
+//  })
+//
+func (r *Router) OnError(handle func(ctx *Context, err HTTPError)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onerror = handle
+	r.stage().onerror = handle
+}
+
+// WithErrorHandler returns a middleware that sets the error handler for the rest of the request,
+// it overrides the router's and the app's error handler for a route:
+//
+//  router.Get("/download", gear.WithErrorHandler(func(ctx *gear.Context, err gear.HTTPError) {
+//  	ctx.HTML(err.Status(), "<h1>Download failed</h1>")
+//  }), handler)
+//
+func WithErrorHandler(handle func(ctx *Context, err HTTPError)) Middleware {
+	return func(ctx *Context) error {
+		ctx.SetErrorHandler(handle)
+		return nil
+	}
 }
 
 // Serve implemented gear.Handler interface
 func (r *Router) Serve(ctx *Context) error {
 	path := ctx.Path
 	method := ctx.Method
-	var handler Middleware
+	var rt *route
 
 	if !strings.HasPrefix(path, r.root) {
 		return nil
 	}
+	var hostParams map[string]string
+	if r.host != nil {
+		ok := false
+		if hostParams, ok = r.host.match(ctx.Host); !ok {
+			return nil
+		}
+	}
 
+	t := r.load()
+	if t.onerror != nil {
+		ctx.SetErrorHandler(t.onerror)
+	}
 	if len(r.root) > 1 {
 		path = strings.TrimPrefix(path, r.root)
 		if path == "" {
@@ -279,53 +589,81 @@ func (r *Router) Serve(ctx *Context) error {
 		}
 	}
 
-	matched := r.trie.Match(path)
-	if matched.Node == nil {
-		// FixedPathRedirect or TrailingSlashRedirect
-		if matched.TSR != "" || matched.FPR != "" {
-			ctx.Req.URL.Path = matched.TSR
-			if matched.FPR != "" {
-				ctx.Req.URL.Path = matched.FPR
-			}
-			if len(r.root) > 1 {
-				ctx.Req.URL.Path = r.root + ctx.Req.URL.Path
+	// fast path for the routes without parameters
+	node := t.statics[r.staticKey(path)]
+	var params map[string]string
+	if node == nil {
+		matched := t.trie.Match(path)
+		if matched.Node == nil {
+			// FixedPathRedirect or TrailingSlashRedirect
+			if matched.TSR != "" || matched.FPR != "" {
+				ctx.Req.URL.Path = matched.TSR
+				if matched.FPR != "" {
+					ctx.Req.URL.Path = matched.FPR
+				}
+				if len(r.root) > 1 {
+					ctx.Req.URL.Path = r.root + ctx.Req.URL.Path
+				}
+
+				code := http.StatusMovedPermanently
+				if method != "GET" {
+					code = http.StatusTemporaryRedirect
+				}
+				ctx.Status(code)
+				return ctx.Redirect(ctx.Req.URL.String())
 			}
 
-			code := http.StatusMovedPermanently
-			if method != "GET" {
-				code = http.StatusTemporaryRedirect
+			if t.otherwise == nil {
+				return ctx.Error(&Error{Code: http.StatusNotImplemented,
+					Msg: fmt.Sprintf(`"%s" is not implemented`, ctx.Path)})
 			}
-			ctx.Status(code)
-			return ctx.Redirect(ctx.Req.URL.String())
+			rt = t.otherwise
 		}
+		node, params = matched.Node, matched.Params
+	}
 
-		if r.otherwise == nil {
-			return ctx.Error(&Error{Code: http.StatusNotImplemented,
-				Msg: fmt.Sprintf(`"%s" is not implemented`, ctx.Path)})
-		}
-		handler = r.otherwise
-	} else {
+	if node != nil {
 		ok := false
-		if handler, ok = matched.Node.GetHandler(method).(Middleware); !ok {
+		rt, ok = node.GetHandler(method).(*route)
+		if !ok && method == http.MethodHead && r.autoHead {
+			// automatic HEAD handling with GET handler
+			rt, ok = node.GetHandler(http.MethodGet).(*route)
+		}
+		if !ok && !isStandardMethod(method) {
+			rt, ok = t.anys[node]
+		}
+		if !ok {
 			// OPTIONS support
 			if method == http.MethodOptions {
-				ctx.Set(HeaderAllow, matched.Node.GetAllow())
+				ctx.Set(HeaderAllow, r.allow(node))
 				return ctx.End(http.StatusNoContent)
 			}
 
-			if r.otherwise == nil {
+			if t.otherwise == nil {
 				// If no route handler is returned, it's a 405 error
-				ctx.Set(HeaderAllow, matched.Node.GetAllow())
+				ctx.Set(HeaderAllow, r.allow(node))
 				return ctx.Error(&Error{Code: http.StatusMethodNotAllowed,
 					Msg: fmt.Sprintf(`"%s" is not allowed in "%s"`, method, ctx.Path)})
 			}
-			handler = r.otherwise
+			rt = t.otherwise
+		}
+	}
+
+	if hostParams != nil {
+		for key, val := range params {
+			hostParams[key] = val
 		}
+		params = hostParams
 	}
+	ctx.SetAny(paramsKey, params)
+	return rt.handle(ctx)
+}
 
-	ctx.SetAny(paramsKey, matched.Params)
-	if len(r.mds) > 0 {
-		handler = Compose(r.middleware, handler)
+// allow returns the `Allow` header value of the node, with HEAD if it is handled automatically.
+func (r *Router) allow(node *trie.Node) string {
+	allow := node.GetAllow()
+	if r.autoHead && node.GetHandler(http.MethodHead) == nil && node.GetHandler(http.MethodGet) != nil {
+		allow += ", " + http.MethodHead
 	}
-	return handler(ctx)
+	return allow
 }
@@ -2,7 +2,10 @@ package gear
 
 import (
 	"errors"
+	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -187,6 +190,145 @@ func TestGearRouter(t *testing.T) {
 		res.Body.Close()
 	})
 
+	t.Run("router.Any and custom method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := NewRouter()
+		assert.Panics(func() {
+			r.Any("/")
+		})
+		assert.Panics(func() {
+			r.Handle("GET POST", "/", func(ctx *Context) error { return nil })
+		})
+		assert.Panics(func() {
+			r.Handle("", "/", func(ctx *Context) error { return nil })
+		})
+
+		r.Any("/any", func(ctx *Context) error {
+			return ctx.HTML(200, ctx.Method)
+		})
+		r.Handle("propfind", "/files/:filepath*", func(ctx *Context) error {
+			return ctx.HTML(207, ctx.Method+" "+ctx.Param("filepath"))
+		})
+
+		srv := newApp(r)
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"} {
+			res, err := RequestBy(method, host+"/any")
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			assert.Equal(method, PickRes(res.Text()).(string))
+			res.Body.Close()
+		}
+
+		res, err := RequestBy("HEAD", host+"/any")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+
+		res, err = RequestBy("PROPFIND", host+"/files/a/b.txt")
+		assert.Nil(err)
+		assert.Equal(207, res.StatusCode)
+		assert.Equal("PROPFIND a/b.txt", PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		for _, method := range []string{"MKCOL", "PROPFIND", "X-CUSTOM"} {
+			res, err = RequestBy(method, host+"/any")
+			assert.Nil(err)
+			assert.Equal(200, res.StatusCode)
+			assert.Equal(method, PickRes(res.Text()).(string))
+			res.Body.Close()
+		}
+
+		res, err = RequestBy("MKCOL", host+"/files/a")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		res.Body.Close()
+
+		assert.True(r.Remove("*", "/any"))
+		res, err = RequestBy("MKCOL", host+"/any")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.False(strings.Contains(res.Header.Get(HeaderAllow), "*"))
+		res.Body.Close()
+		res, err = RequestBy("PUT", host+"/any")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+	})
+
+	t.Run("automatic handle `HEAD` method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := NewRouter()
+		r.Get("/", func(ctx *Context) error {
+			ctx.Set("X-Method", ctx.Method)
+			return ctx.HTML(200, "Hello")
+		})
+		r.Put("/abc", func(ctx *Context) error {
+			return ctx.End(204)
+		})
+
+		srv := newApp(r)
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("HEAD", host)
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("HEAD", res.Header.Get("X-Method"))
+		assert.Equal("5", res.Header.Get(HeaderContentLength))
+		assert.Equal("", PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		res, err = RequestBy("HEAD", host+"/abc")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.Equal("PUT", res.Header.Get(HeaderAllow))
+		res.Body.Close()
+
+		res, err = RequestBy("OPTIONS", host)
+		assert.Nil(err)
+		assert.Equal(204, res.StatusCode)
+		assert.Equal("GET, HEAD", res.Header.Get(HeaderAllow))
+		res.Body.Close()
+
+		res, err = RequestBy("POST", host)
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.Equal("GET, HEAD", res.Header.Get(HeaderAllow))
+		res.Body.Close()
+
+		r1 := NewRouter(RouterOptions{Root: "/api"})
+		r1.Get("/", func(ctx *Context) error {
+			return ctx.HTML(200, "Hello")
+		})
+
+		srv1 := newApp(r1)
+		defer srv1.Close()
+
+		res, err = RequestBy("HEAD", "http://"+srv1.Addr().String()+"/api")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		res.Body.Close()
+
+		r2 := NewRouter(RouterOptions{DisableAutoHead: true})
+		r2.Get("/", func(ctx *Context) error {
+			return ctx.HTML(200, "Hello")
+		})
+
+		srv2 := newApp(r2)
+		defer srv2.Close()
+
+		res, err = RequestBy("HEAD", "http://"+srv2.Addr().String())
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.Equal("GET", res.Header.Get(HeaderAllow))
+		res.Body.Close()
+	})
+
 	t.Run("router.Get with one more middleware", func(t *testing.T) {
 		assert := assert.New(t)
 
@@ -259,7 +401,7 @@ func TestGearRouter(t *testing.T) {
 		res, err := RequestBy("PUT", host+"/abc")
 		assert.Nil(err)
 		assert.Equal(405, res.StatusCode)
-		assert.Equal("GET", res.Header.Get(HeaderAllow))
+		assert.Equal("GET, HEAD", res.Header.Get(HeaderAllow))
 		assert.Equal("nosniff", res.Header.Get(HeaderXContentTypeOptions))
 		assert.Equal("text/plain; charset=utf-8", res.Header.Get(HeaderContentType))
 		assert.Equal(`"PUT" is not allowed in "/abc"`, PickRes(res.Text()).(string))
@@ -839,4 +981,303 @@ func TestGearRouter(t *testing.T) {
 		assert.Equal("some error", PickRes(res.Text()).(string))
 		res.Body.Close()
 	})
+
+	t.Run("router middleware used after routes registered", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := NewRouter()
+		r.Get("/abc", func(ctx *Context) error {
+			return ctx.HTML(200, ctx.Res.Get("X-Router"))
+		})
+		r.Otherwise(func(ctx *Context) error {
+			return ctx.HTML(404, ctx.Res.Get("X-Router"))
+		})
+		r.Use(func(ctx *Context) error {
+			ctx.Set("X-Router", "1")
+			return nil
+		})
+		r.Use(func(ctx *Context) error {
+			ctx.Set("X-Router", ctx.Res.Get("X-Router")+"2")
+			return nil
+		})
+		r.Otherwise(func(ctx *Context) error {
+			return ctx.HTML(404, "otherwise "+ctx.Res.Get("X-Router"))
+		})
+
+		srv := newApp(r)
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("GET", host+"/abc")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("12", PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		res, err = RequestBy("GET", host+"/xyz")
+		assert.Nil(err)
+		assert.Equal(404, res.StatusCode)
+		assert.Equal("otherwise 12", PickRes(res.Text()).(string))
+		res.Body.Close()
+		assert.Equal(1, len(r.defs))
+	})
+
+	t.Run("static routes matched without the trie", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := NewRouter()
+		r.Get("/Healthz", func(ctx *Context) error {
+			return ctx.HTML(200, "ok"+ctx.Param("name"))
+		})
+		r.Get("/:name", func(ctx *Context) error {
+			return ctx.HTML(200, ctx.Param("name"))
+		})
+		r.Get("/api/::", func(ctx *Context) error {
+			return ctx.HTML(200, "colon")
+		})
+		assert.Equal(1, len(r.load().statics))
+		assert.NotNil(r.load().statics["/healthz"])
+
+		srv := newApp(r)
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("GET", host+"/HEALTHZ")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("ok", PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		res, err = RequestBy("GET", host+"/metrics")
+		assert.Nil(err)
+		assert.Equal("metrics", PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		res, err = RequestBy("PUT", host+"/healthz")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.Equal("GET, HEAD", res.Header.Get(HeaderAllow))
+		res.Body.Close()
+
+		res, err = RequestBy("GET", host+"/healthz/")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("ok", PickRes(res.Text()).(string))
+		res.Body.Close()
+
+		r = NewRouter(RouterOptions{})
+		r.Get("/Healthz", func(ctx *Context) error {
+			return ctx.HTML(200, "ok")
+		})
+		assert.NotNil(r.load().statics["/Healthz"])
+		ctx := CtxTest(New(), "GET", "/healthz", nil)
+		assert.Nil(r.Serve(ctx))
+		assert.Equal(501, ctx.Res.status)
+	})
+
+	t.Run("router.OnError while serving", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := NewRouter()
+		r.Get("/", func(ctx *Context) error {
+			return &Error{Code: 400, Msg: "bad"}
+		})
+		app := New()
+		app.UseHandler(r)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			r.OnError(func(ctx *Context, err HTTPError) {
+				ctx.HTML(err.Status(), "router: "+err.Error())
+			})
+		}
+		<-done
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/", nil))
+		assert.Equal(400, rec.Code)
+		assert.Equal("router: bad", rec.Body.String())
+	})
+
+	t.Run("router and route error handlers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetOnError, func(ctx *Context, err HTTPError) {
+			ctx.HTML(err.Status(), "app: "+err.Error())
+		})
+
+		api := NewRouter(RouterOptions{Root: "/api"})
+		api.OnError(func(ctx *Context, err HTTPError) {
+			ctx.JSON(err.Status(), err)
+		})
+		api.Get("/user", func(ctx *Context) error {
+			return &Error{Code: 404, Msg: "user not found"}
+		})
+		api.Get("/file", WithErrorHandler(func(ctx *Context, err HTTPError) {
+			ctx.HTML(err.Status(), "route: "+err.Error())
+		}), func(ctx *Context) error {
+			return ctx.Error(&Error{Code: 400, Msg: "bad file"})
+		})
+
+		views := NewRouter()
+		views.Get("/", func(ctx *Context) error {
+			return &Error{Code: 403, Msg: "forbidden"}
+		})
+		app.UseHandler(api)
+		app.UseHandler(views)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("GET", host+"/api/user")
+		assert.Nil(err)
+		assert.Equal(404, res.StatusCode)
+		assert.Equal(MIMEApplicationJSONCharsetUTF8, res.Header.Get(HeaderContentType))
+		assert.Equal(`{"code":404,"error":"user not found"}`, PickRes(res.Text()).(string))
+
+		res, err = RequestBy("POST", host+"/api/user")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.Equal(MIMEApplicationJSONCharsetUTF8, res.Header.Get(HeaderContentType))
+		res.Body.Close()
+
+		res, err = RequestBy("GET", host+"/api/file")
+		assert.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		assert.Equal("route: bad file", PickRes(res.Text()).(string))
+
+		res, err = RequestBy("GET", host+"/")
+		assert.Nil(err)
+		assert.Equal(403, res.StatusCode)
+		assert.Equal("app: forbidden", PickRes(res.Text()).(string))
+	})
+
+	t.Run("routes removed and swapped while serving", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := NewRouter()
+		r.Any("/user", func(ctx *Context) error {
+			return ctx.HTML(200, "user")
+		})
+		r.Get("/beta/:feature", func(ctx *Context) error {
+			return ctx.HTML(200, ctx.Param("feature"))
+		})
+		srv := newApp(r)
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("GET", host+"/beta/x")
+		assert.Nil(err)
+		assert.Equal("x", PickRes(res.Text()).(string))
+
+		assert.False(r.Remove("POST", "/beta/:feature"))
+		assert.False(r.Remove("GET", "/beta/:name"))
+		assert.True(r.Remove("get", "/beta/:feature"))
+		assert.True(r.Remove("DELETE", "/user"))
+		assert.False(r.Remove("DELETE", "/user"))
+
+		res, err = RequestBy("GET", host+"/beta/x")
+		assert.Nil(err)
+		assert.Equal(501, res.StatusCode)
+		res.Body.Close()
+
+		res, err = RequestBy("DELETE", host+"/user")
+		assert.Nil(err)
+		assert.Equal(405, res.StatusCode)
+		assert.False(strings.Contains(res.Header.Get(HeaderAllow), "DELETE"))
+		res.Body.Close()
+
+		res, err = RequestBy("PUT", host+"/user")
+		assert.Nil(err)
+		assert.Equal("user", PickRes(res.Text()).(string))
+		res, err = RequestBy("MKCOL", host+"/user")
+		assert.Nil(err)
+		assert.Equal("user", PickRes(res.Text()).(string))
+
+		r.Get("/beta/:feature", func(ctx *Context) error {
+			return ctx.HTML(200, "again "+ctx.Param("feature"))
+		})
+		res, err = RequestBy("GET", host+"/beta/x")
+		assert.Nil(err)
+		assert.Equal("again x", PickRes(res.Text()).(string))
+
+		next := NewRouter(RouterOptions{Root: "/other"})
+		next.Use(func(ctx *Context) error {
+			ctx.Set("X-Router", "next")
+			return nil
+		})
+		next.Get("/v2", func(ctx *Context) error {
+			return ctx.HTML(200, "v2")
+		})
+		next.Otherwise(func(ctx *Context) error {
+			return ctx.HTML(404, "next")
+		})
+		r.Swap(next)
+
+		res, err = RequestBy("GET", host+"/v2")
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("next", res.Header.Get("X-Router"))
+		assert.Equal("v2", PickRes(res.Text()).(string))
+
+		res, err = RequestBy("GET", host+"/user")
+		assert.Nil(err)
+		assert.Equal(404, res.StatusCode)
+		assert.Equal("next", PickRes(res.Text()).(string))
+
+		next.Get("/v3", func(ctx *Context) error {
+			return ctx.HTML(200, "v3")
+		})
+		res, err = RequestBy("GET", host+"/v3")
+		assert.Nil(err)
+		assert.Equal(404, res.StatusCode)
+		res.Body.Close()
+	})
+
+	t.Run("routes mutated concurrently", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := NewRouter()
+		r.Get("/:id", func(ctx *Context) error {
+			return ctx.End(200)
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					ctx := CtxTest(New(), "GET", "/"+strconv.Itoa(j), nil)
+					assert.Nil(r.Serve(ctx))
+					assert.Equal(200, ctx.Res.status)
+				}
+			}()
+		}
+		for j := 0; j < 50; j++ {
+			pattern := "/static/" + strconv.Itoa(j)
+			r.Get(pattern, func(ctx *Context) error {
+				return ctx.End(204)
+			})
+			if j%2 == 0 {
+				r.Remove("GET", pattern)
+			}
+		}
+		wg.Wait()
+
+		ctx := CtxTest(New(), "GET", "/static/1", nil)
+		assert.Nil(r.Serve(ctx))
+		assert.Equal(204, ctx.Res.status)
+		ctx = CtxTest(New(), "GET", "/static/2", nil)
+		assert.Nil(r.Serve(ctx))
+		assert.Equal(501, ctx.Res.status)
+		assert.Equal(26, len(r.defs))
+	})
 }
@@ -0,0 +1,138 @@
+package gear
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setting returns the app setting value by key, nil if not set.
+func (app *App) Setting(key interface{}) interface{} {
+	app.settingsMu.RLock()
+	defer app.settingsMu.RUnlock()
+	return app.settings[key]
+}
+
+func (app *App) storeSetting(key, val interface{}) {
+	app.settingsMu.Lock()
+	app.settings[key] = val
+	app.settingsMu.Unlock()
+}
+
+func (app *App) deleteSetting(key interface{}) {
+	app.settingsMu.Lock()
+	delete(app.settings, key)
+	app.settingsMu.Unlock()
+}
+
+// SetDefault sets the app setting value if the key has not been set.
+//
+//  app.LoadEnv("MYAPP_")
+//  app.SetDefault("TIMEOUT", 10*time.Second)
+//  app.Require("DATABASE_URL")
+//
+//  timeout := app.GetDuration("TIMEOUT") // "MYAPP_TIMEOUT=5s" or 10s
+//
+func (app *App) SetDefault(key, val interface{}) {
+	if app.Setting(key) == nil {
+		app.Set(key, val)
+	}
+}
+
+// LoadEnv loads the environment variables with the prefix as app settings,
+// the key is the variable name without the prefix, the value is string.
+// For example, "MYAPP_PORT=3000" is loaded as setting "PORT" with prefix "MYAPP_".
+func (app *App) LoadEnv(prefix string) {
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, prefix) {
+			continue
+		}
+		if i := strings.IndexByte(kv, '='); i > len(prefix) {
+			app.Set(kv[len(prefix):i], kv[i+1:])
+		}
+	}
+}
+
+// Require declares the app settings that must be set, they are validated by app.Start
+// (panics), app.Listen, app.ListenTLS and app.ServeFCGI (return error).
+// A string value should not be empty.
+func (app *App) Require(keys ...interface{}) {
+	app.required = append(app.required, keys...)
+}
+
+// checkRequired returns an error with the missing required settings.
+func (app *App) checkRequired() error {
+	var missing []string
+	for _, key := range app.required {
+		if val := app.Setting(key); val == nil || val == "" {
+			missing = append(missing, fmt.Sprint(key))
+		}
+	}
+	if len(missing) > 0 {
+		return NewAppError("required settings missing: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// GetString returns the app setting value as string, an empty string if not set.
+// The value of other types is formatted by fmt.Sprint.
+func (app *App) GetString(key interface{}) string {
+	switch v := app.Setting(key).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// GetInt returns the app setting value as int, the string value is parsed by strconv.Atoi.
+// It returns 0 if not set or invalid.
+func (app *App) GetInt(key interface{}) int {
+	switch v := app.Setting(key).(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(strings.TrimSpace(v))
+		return i
+	default:
+		return 0
+	}
+}
+
+// GetBool returns the app setting value as bool, the string value is parsed by strconv.ParseBool.
+// It returns false if not set or invalid.
+func (app *App) GetBool(key interface{}) bool {
+	switch v := app.Setting(key).(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(strings.TrimSpace(v))
+		return b
+	default:
+		return false
+	}
+}
+
+// GetDuration returns the app setting value as time.Duration, the string value is parsed
+// by time.ParseDuration, such as "1.5s", "300ms". It returns 0 if not set or invalid.
+func (app *App) GetDuration(key interface{}) time.Duration {
+	switch v := app.Setting(key).(type) {
+	case time.Duration:
+		return v
+	case string:
+		d, _ := time.ParseDuration(strings.TrimSpace(v))
+		return d
+	default:
+		return 0
+	}
+}
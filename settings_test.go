@@ -0,0 +1,81 @@
+package gear
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearAppSettings(t *testing.T) {
+	t.Run("typed getters", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set("name", "gear")
+		app.Set("port", "3000")
+		app.Set("workers", 8)
+		app.Set("debug", "true")
+		app.Set("timeout", "1.5s")
+		app.Set("interval", time.Minute)
+
+		assert.Equal("gear", app.Setting("name"))
+		assert.Nil(app.Setting("none"))
+		assert.Equal("gear", app.GetString("name"))
+		assert.Equal("8", app.GetString("workers"))
+		assert.Equal("", app.GetString("none"))
+		assert.Equal(3000, app.GetInt("port"))
+		assert.Equal(8, app.GetInt("workers"))
+		assert.Equal(0, app.GetInt("name"))
+		assert.Equal(0, app.GetInt("debug"))
+		assert.True(app.GetBool("debug"))
+		assert.False(app.GetBool("name"))
+		assert.False(app.GetBool("none"))
+		assert.Equal(1500*time.Millisecond, app.GetDuration("timeout"))
+		assert.Equal(time.Minute, app.GetDuration("interval"))
+		assert.Equal(time.Duration(0), app.GetDuration("name"))
+		assert.Equal(time.Duration(0), app.GetDuration("workers"))
+		assert.Equal(time.Duration(0), app.GetDuration(SetTimeout))
+	})
+
+	t.Run("LoadEnv and SetDefault", func(t *testing.T) {
+		assert := assert.New(t)
+
+		os.Setenv("GEAR_TEST_PORT", "8080")
+		os.Setenv("GEAR_TEST_TIMEOUT", "5s")
+		defer os.Unsetenv("GEAR_TEST_PORT")
+		defer os.Unsetenv("GEAR_TEST_TIMEOUT")
+
+		app := New()
+		app.LoadEnv("GEAR_TEST_")
+		app.SetDefault("PORT", 3000)
+		app.SetDefault("HOST", "127.0.0.1")
+		app.SetDefault(SetTimeout, time.Second)
+		assert.Equal(8080, app.GetInt("PORT"))
+		assert.Equal(5*time.Second, app.GetDuration("TIMEOUT"))
+		assert.Equal("127.0.0.1", app.GetString("HOST"))
+		assert.Equal(time.Second, app.GetDuration(SetTimeout))
+		assert.Panics(func() {
+			app.SetDefault(SetCompress, "invalid")
+		})
+	})
+
+	t.Run("Require", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Require("DATABASE_URL", "SECRET")
+		app.Set("SECRET", "")
+		assert.Panics(func() {
+			app.Start()
+		})
+		err := app.Listen(":0")
+		assert.Equal("Gear: required settings missing: DATABASE_URL, SECRET", err.Error())
+
+		app.Set("DATABASE_URL", "mysql://localhost")
+		app.Set("SECRET", "xxx")
+		srv := app.Start()
+		srv.Close()
+	})
+}
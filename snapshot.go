@@ -0,0 +1,119 @@
+package gear
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Snapshot is an immutable copy of a Context's request data and values, created by ctx.Clone.
+// It is detached from the request lifecycle: it will not be canceled when the request finished
+// or timeout, but the values of the Context (see ctx.WithContext) are still reachable,
+// so it is safe to use in background goroutines and as the context.Context of background jobs.
+type Snapshot struct {
+	Host       string
+	Method     string
+	Path       string
+	RemoteAddr string
+	URL        *url.URL
+	Header     http.Header
+
+	params map[string]string
+	kv     map[interface{}]interface{}
+	parent context.Context
+}
+
+// Clone returns an immutable Snapshot of the ctx, the request URL, header, path parameters
+// and the values set by ctx.SetAny are copied (values are shallow copied), so the background
+// jobs started from a handler don't race with the ctx.
+//
+//  snap := ctx.Clone()
+//  go func() {
+//  	// use snap after the request finished
+//  	auditLog(snap, snap.Method, snap.Path, snap.Param("id"))
+//  }()
+//
+func (ctx *Context) Clone() *Snapshot {
+	u := *ctx.Req.URL
+	if u.User != nil {
+		user := *u.User
+		u.User = &user
+	}
+	s := &Snapshot{
+		Host:       ctx.Host,
+		Method:     ctx.Method,
+		Path:       ctx.Path,
+		RemoteAddr: ctx.Req.RemoteAddr,
+		URL:        &u,
+		Header:     cloneHeader(ctx.Req.Header),
+		params:     make(map[string]string),
+		parent:     ctx._ctx,
+	}
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	s.kv = make(map[interface{}]interface{}, len(ctx.kv))
+	for k, v := range ctx.kv {
+		if k == paramsKey {
+			for pk, pv := range v.(map[string]string) {
+				s.params[pk] = pv
+			}
+			continue
+		}
+		s.kv[k] = v
+	}
+	return s
+}
+
+// Param returns path parameter by name.
+func (s *Snapshot) Param(key string) string {
+	return s.params[key]
+}
+
+// Get returns the request header value by key.
+func (s *Snapshot) Get(key string) string {
+	return s.Header.Get(key)
+}
+
+// Any returns the value set by ctx.SetAny (or evaluated by ctx.Any) before cloned.
+func (s *Snapshot) Any(key interface{}) (interface{}, error) {
+	if val, ok := s.kv[key]; ok {
+		return val, nil
+	}
+	return nil, ErrAnyKeyNonExistent
+}
+
+// ----- implement context.Context interface ----- //
+
+// Deadline returns no deadline, the snapshot is never canceled.
+func (s *Snapshot) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done returns nil, the snapshot is never canceled.
+func (s *Snapshot) Done() <-chan struct{} {
+	return nil
+}
+
+// Err always returns nil.
+func (s *Snapshot) Err() error {
+	return nil
+}
+
+// Value returns the value associated with the ctx for key, like ctx.Value.
+func (s *Snapshot) Value(key interface{}) (val interface{}) {
+	if val = s.parent.Value(key); val == nil {
+		val = s.kv[key]
+	}
+	return
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, vv := range h {
+		vv2 := make([]string, len(vv))
+		copy(vv2, vv)
+		h2[k] = vv2
+	}
+	return h2
+}
@@ -0,0 +1,67 @@
+package gear
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextClone(t *testing.T) {
+	assert := assert.New(t)
+
+	type ctxKey string
+
+	app := New()
+	app.Set(SetTimeout, 10*time.Millisecond)
+	snaps := make(chan *Snapshot, 1)
+	router := NewRouter()
+	router.Put("/users/:id", func(ctx *Context) error {
+		ctx.SetAny("user", "admin")
+		ctx.WithContext(ctx.WithValue(ctxKey("trace"), "abc"))
+		snaps <- ctx.Clone()
+		ctx.SetAny("user", "other")
+		ctx.Req.Header.Set("X-Request-ID", "changed")
+		ctx.Path = "/changed"
+		return ctx.End(http.StatusNoContent)
+	})
+	app.UseHandler(router)
+	srv := app.Start()
+	defer srv.Close()
+
+	req, _ := NewRequst("PUT", "http://"+srv.Addr().String()+"/users/123?q=1")
+	req.Header.Set("X-Request-ID", "req1")
+	res, err := DefaultClientDo(req)
+	assert.Nil(err)
+	assert.Equal(204, res.StatusCode)
+
+	snap := <-snaps
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(snap.Err())
+	assert.Nil(snap.Done())
+	_, ok := snap.Deadline()
+	assert.False(ok)
+
+	assert.Equal("PUT", snap.Method)
+	assert.Equal("/users/123", snap.Path)
+	assert.Equal("q=1", snap.URL.RawQuery)
+	assert.Equal("req1", snap.Get("X-Request-ID"))
+	assert.Equal("123", snap.Param("id"))
+	assert.Equal("", snap.Param("name"))
+	assert.NotEqual("", snap.Host)
+	assert.NotEqual("", snap.RemoteAddr)
+
+	val, err := snap.Any("user")
+	assert.Nil(err)
+	assert.Equal("admin", val)
+	_, err = snap.Any("other")
+	assert.Equal(ErrAnyKeyNonExistent, err)
+	assert.Equal("abc", snap.Value(ctxKey("trace")))
+
+	ctx, cancel := context.WithTimeout(snap, time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.Equal(context.DeadlineExceeded, ctx.Err())
+}
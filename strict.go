@@ -0,0 +1,73 @@
+package gear
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// StrictOptions is the options of app setting SetStrictRequest.
+type StrictOptions struct {
+	// MaxHeaderFieldSize defines the maximum bytes of a header field (name and value),
+	// default to 8KB.
+	MaxHeaderFieldSize int
+}
+
+// check validates the request against the malformed headers. The requests may also come from
+// the other front ends than the HTTP/1.x server, such as FastCGI or Lambda adapters. The request
+// smuggling vectors of HTTP/1.x are handled by net/http before the app runs: the Content-Length
+// header is dropped if the Transfer-Encoding is chunked, and the obs-fold lines are unfolded.
+func (o *StrictOptions) check(r *http.Request) *Error {
+	if cl := r.Header[HeaderContentLength]; len(cl) > 1 {
+		for _, v := range cl[1:] {
+			if v != cl[0] {
+				return badRequest("conflicting Content-Length headers")
+			}
+		}
+	}
+
+	for key, vals := range r.Header {
+		if !isToken(key) {
+			return badRequest(fmt.Sprintf("invalid header name %q", key))
+		}
+		for _, val := range vals {
+			if len(key)+len(val) > o.MaxHeaderFieldSize {
+				return badRequest(fmt.Sprintf("header field %s too large", key))
+			}
+			for i := 0; i < len(val); i++ {
+				if c := val[i]; (c < ' ' && c != '\t') || c == 0x7f {
+					return badRequest(fmt.Sprintf("invalid character in header field %s", key))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func badRequest(msg string) *Error {
+	return &Error{Code: http.StatusBadRequest, Msg: msg}
+}
+
+// isToken reports whether s is a valid token of RFC 7230.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c < 0x7f && c > ' ' && !isSeparator(c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isSeparator(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '@', ',', ';', ':', '\\', '"', '/', '[', ']', '?', '=', '{', '}':
+		return true
+	}
+	return false
+}
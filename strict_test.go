@@ -0,0 +1,127 @@
+package gear
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearStrictRequest(t *testing.T) {
+	app := New()
+	assert.Panics(t, func() {
+		app.Set(SetStrictRequest, true)
+	})
+	app.Set(SetStrictRequest, StrictOptions{MaxHeaderFieldSize: 64})
+	app.Use(func(ctx *Context) error {
+		return ctx.HTML(200, "OK")
+	})
+
+	request := func(header map[string][]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("hello"))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res := httptest.NewRecorder()
+		app.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Run("Should accept valid request", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res := request(map[string][]string{
+			"Content-Length": {"5", "5"},
+			"X-Value":        {"a\tb c"},
+		})
+		assert.Equal(200, res.Code)
+		assert.Equal("OK", res.Body.String())
+	})
+
+	t.Run("Should reject malformed request", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cases := map[string]map[string][]string{
+			"conflicting Content-Length headers":        {"Content-Length": {"5", "6"}},
+			`invalid header name "X Value"`:             {"X Value": {"a"}},
+			"invalid character in header field X-Value": {"X-Value": {"a\r\n b"}},
+			"invalid character in header field X":       {"X": {"a\x00b"}},
+			"header field X-Long too large":             {"X-Long": {strings.Repeat("a", 60)}},
+		}
+		for msg, header := range cases {
+			res := request(header)
+			assert.Equal(400, res.Code)
+			assert.Equal(msg, res.Body.String())
+			assert.Equal("close", res.Header().Get("Connection"))
+		}
+	})
+
+	t.Run("Should default MaxHeaderFieldSize to 8KB", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetStrictRequest, StrictOptions{})
+		assert.Equal(8<<10, app.strict.MaxHeaderFieldSize)
+
+		srv := app.Start()
+		defer srv.Close()
+		req, _ := http.NewRequest("GET", "http://"+srv.Addr().String(), nil)
+		req.Header.Set("X-Long", strings.Repeat("a", 8<<10))
+		res, err := DefaultClient.Do(req)
+		assert.Nil(err)
+		assert.Equal(400, res.StatusCode)
+		res.Body.Close()
+	})
+	t.Run("Should serve the requests normalized by net/http", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetStrictRequest, StrictOptions{MaxHeaderFieldSize: 64})
+		app.Use(func(ctx *Context) error {
+			body, err := ioutil.ReadAll(ctx.Req.Body)
+			if err != nil {
+				return err
+			}
+			return ctx.HTML(200, ctx.Get("X-Value")+"|"+string(body))
+		})
+		srv := app.Start()
+		defer srv.Close()
+
+		send := func(raw string) *http.Response {
+			conn, err := net.Dial("tcp", srv.Addr().String())
+			assert.Nil(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte(raw))
+			assert.Nil(err)
+			res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			assert.Nil(err)
+			return res
+		}
+		read := func(res *http.Response) string {
+			body, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			return string(body)
+		}
+
+		// the Content-Length is dropped, the body is read as chunked
+		res := send("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n" +
+			"Transfer-Encoding: chunked\r\nConnection: close\r\n\r\n3\r\nabc\r\n0\r\n\r\n")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("|abc", read(res))
+
+		// the obs-fold line is unfolded
+		res = send("GET / HTTP/1.1\r\nHost: example.com\r\nX-Value: a\r\n b\r\nConnection: close\r\n\r\n")
+		assert.Equal(200, res.StatusCode)
+		assert.Equal("a b|", read(res))
+
+		res = send("GET / HTTP/1.1\r\nHost: example.com\r\nX-Value: " + strings.Repeat("a", 60) +
+			"\r\nConnection: close\r\n\r\n")
+		assert.Equal(400, res.StatusCode)
+		assert.Equal("header field X-Value too large", read(res))
+	})
+}
@@ -0,0 +1,113 @@
+package gear
+
+import (
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TemplateRenderer is a html/template based Renderer, it loads the templates from a directory.
+// The templates are precompiled when loading, and used without any file system access by default.
+// If AutoReload is enabled (for development), the directory is checked on every rendering, and the
+// templates are reloaded if any file was added, removed or modified, so that the edits are visible
+// without restarting the server.
+//
+//  renderer, err := gear.LoadTemplates("./views", ".html", template.FuncMap{"upper": strings.ToUpper})
+//  if err != nil {
+//  	panic(err)
+//  }
+//  renderer.AutoReload = app.Env() == "development"
+//  app.Set(gear.SetRenderer, renderer)
+//
+//  // render "./views/users/index.html"
+//  ctx.Render(200, "users/index.html", data)
+//
+type TemplateRenderer struct {
+	// AutoReload enables reloading the changed templates on rendering, it should be set
+	// before serving, default to false.
+	AutoReload bool
+
+	dir   string
+	ext   string
+	funcs template.FuncMap
+	mu    sync.RWMutex
+	tpl   *template.Template
+	sig   string
+}
+
+// LoadTemplates creates a TemplateRenderer with the template files which have the extension
+// in the dir and its sub directories. The template name is the file path relative to the dir,
+// separated by "/". The funcs will be added to the templates, it can be nil.
+func LoadTemplates(dir, ext string, funcs template.FuncMap) (*TemplateRenderer, error) {
+	r := &TemplateRenderer{dir: dir, ext: ext, funcs: funcs}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Render implemented Renderer interface.
+func (r *TemplateRenderer) Render(ctx *Context, w io.Writer, name string, data interface{}) error {
+	if r.AutoReload {
+		if err := r.Reload(); err != nil {
+			return err
+		}
+	}
+	r.mu.RLock()
+	tpl := r.tpl
+	r.mu.RUnlock()
+	return tpl.ExecuteTemplate(w, name, data)
+}
+
+// Reload reloads the templates if the template files were changed.
+func (r *TemplateRenderer) Reload() error {
+	files, sig, err := r.walk()
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	changed := r.tpl == nil || sig != r.sig
+	r.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	tpl := template.New("").Funcs(r.funcs)
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(r.dir, file)
+		if _, err = tpl.New(filepath.ToSlash(name)).Parse(string(buf)); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	r.tpl, r.sig = tpl, sig
+	r.mu.Unlock()
+	return nil
+}
+
+// walk returns the template files, and a signature of their names, sizes and modification times.
+func (r *TemplateRenderer) walk() (files []string, sig string, err error) {
+	var parts []string
+	err = filepath.Walk(r.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, r.ext) {
+			return nil
+		}
+		files = append(files, path)
+		parts = append(parts, path+":"+strconv.FormatInt(info.Size(), 10)+":"+
+			strconv.FormatInt(info.ModTime().UnixNano(), 10))
+		return nil
+	})
+	return files, strings.Join(parts, "|"), err
+}
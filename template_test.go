@@ -0,0 +1,108 @@
+package gear
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTemplateRenderer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gear-templates")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, content string) {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+		// make sure the modification time changed
+		modTime := time.Now().Add(time.Duration(len(content)) * time.Second)
+		os.Chtimes(file, modTime, modTime)
+	}
+	writeFile("index.html", `Hello, {{upper .}}!`)
+	writeFile("users/list.html", `{{range .}}{{.}},{{end}}`)
+	writeFile("README.md", `{{invalid`)
+
+	newApp := func(autoReload bool) (*App, *TemplateRenderer) {
+		renderer, err := LoadTemplates(dir, ".html", template.FuncMap{"upper": strings.ToUpper})
+		if err != nil {
+			panic(err)
+		}
+		renderer.AutoReload = autoReload
+		app := New()
+		app.Set(SetEnv, "development")
+		app.Set(SetRenderer, renderer)
+		app.Use(func(ctx *Context) error {
+			if ctx.Path == "/users" {
+				return ctx.Render(200, "users/list.html", []string{"a", "b"})
+			}
+			return ctx.Render(200, "index.html", "gear")
+		})
+		return app, renderer
+	}
+
+	t.Run("Should reload when AutoReload enabled", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app, _ := newApp(true)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		res, err := RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal("Hello, GEAR!", PickRes(res.Text()).(string))
+		res, err = RequestBy("GET", host+"/users")
+		assert.Nil(err)
+		assert.Equal("a,b,", PickRes(res.Text()).(string))
+
+		writeFile("index.html", `Hi, {{.}}!`)
+		res, err = RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal("Hi, gear!", PickRes(res.Text()).(string))
+
+		writeFile("index.html", `Hi, {{.`)
+		res, err = RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal(500, res.StatusCode)
+		writeFile("index.html", `Hello, {{upper .}}!`)
+	})
+
+	t.Run("Should not reload by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app, renderer := newApp(false)
+		srv := app.Start()
+		defer srv.Close()
+		host := "http://" + srv.Addr().String()
+
+		writeFile("index.html", `Hi, {{.}}!`)
+		res, err := RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal("Hello, GEAR!", PickRes(res.Text()).(string))
+
+		assert.Nil(renderer.Reload())
+		res, err = RequestBy("GET", host)
+		assert.Nil(err)
+		assert.Equal("Hi, gear!", PickRes(res.Text()).(string))
+	})
+
+	t.Run("Should return error with invalid templates", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := LoadTemplates(dir, ".md", nil)
+		assert.NotNil(err)
+		_, err = LoadTemplates(filepath.Join(dir, "none"), ".html", nil)
+		assert.NotNil(err)
+	})
+}
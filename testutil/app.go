@@ -0,0 +1,175 @@
+package testutil
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/teambition/gear"
+)
+
+// TestApp serves a Gear app in memory, the requests don't go through TCP connections.
+//
+//  ta := testutil.NewTestApp(app)
+//  res, err := ta.Client().Post("/users").JSON(user).Do()
+//  testutil.Expect(t, res).Status(200).JSONPath("user.name", "gear")
+//
+type TestApp struct {
+	App *gear.App
+}
+
+// NewTestApp creates a TestApp with the app.
+func NewTestApp(app *gear.App) *TestApp {
+	return &TestApp{App: app}
+}
+
+// RoundTrip implemented http.RoundTripper interface, it serves the request by the app.
+func (ta *TestApp) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "192.0.2.1:1234"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	if r.Host == "" {
+		r.Host = req.URL.Host
+	}
+
+	rec := httptest.NewRecorder()
+	ta.App.ServeHTTP(rec, r)
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+// Client returns a Client that sends the requests to the app in memory,
+// the requests are relative to "http://example.com".
+func (ta *TestApp) Client() *Client {
+	c := NewClient("http://example.com")
+	c.Transport = ta
+	return c
+}
+
+// NewContext creates a gear.Context of the app for testing middlewares,
+// the response can be retrieved from the returned ResponseRecorder.
+//
+//  ctx, rec := ta.NewContext("GET", "/?name=gear", nil)
+//  err := someMiddleware(ctx)
+//  res := rec.Result()
+//
+func (ta *TestApp) NewContext(method, url string, body io.Reader) (*gear.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, url, body)
+	rec := httptest.NewRecorder()
+	return gear.NewContext(ta.App, rec, req), rec
+}
+
+// Expectation provides fluent assertions on a Response, the failures are
+// reported by t.Errorf, so that the rest assertions will run.
+type Expectation struct {
+	t   testing.TB
+	res *Response
+}
+
+// Expect creates a Expectation for the response.
+func Expect(t testing.TB, res *Response) *Expectation {
+	return &Expectation{t: t, res: res}
+}
+
+func (e *Expectation) errorf(format string, args ...interface{}) {
+	if h, ok := e.t.(interface {
+		Helper()
+	}); ok {
+		h.Helper()
+	}
+	e.t.Errorf(format, args...)
+}
+
+// Status asserts the response status code.
+func (e *Expectation) Status(code int) *Expectation {
+	if e.res.StatusCode != code {
+		e.errorf("expected status %d, got %d", code, e.res.StatusCode)
+	}
+	return e
+}
+
+// Header asserts the response header value.
+func (e *Expectation) Header(key, value string) *Expectation {
+	if val := e.res.Header.Get(key); val != value {
+		e.errorf("expected header %s: %q, got %q", key, value, val)
+	}
+	return e
+}
+
+// Cookie asserts the value of the cookie set by the response.
+func (e *Expectation) Cookie(name, value string) *Expectation {
+	if val, ok := e.res.Cookie(name); !ok {
+		e.errorf("expected cookie %s, but not set", name)
+	} else if val != value {
+		e.errorf("expected cookie %s=%q, got %q", name, value, val)
+	}
+	return e
+}
+
+// Body asserts the response body.
+func (e *Expectation) Body(body string) *Expectation {
+	if text, err := e.res.Text(); err != nil {
+		e.errorf("read body error: %v", err)
+	} else if text != body {
+		e.errorf("expected body %q, got %q", body, text)
+	}
+	return e
+}
+
+// JSONPath asserts the value on the path of the JSON response body, the path is separated by
+// ".", the array index is a number, such as "users.0.name". The value is compared after being
+// converted with encoding/json, so that 1 equals to float64(1).
+func (e *Expectation) JSONPath(path string, value interface{}) *Expectation {
+	var data interface{}
+	if err := e.res.JSON(&data); err != nil {
+		e.errorf("decode JSON body error: %v", err)
+		return e
+	}
+	val, ok := lookupPath(data, path)
+	if !ok {
+		e.errorf("expected JSON path %q, but not found", path)
+		return e
+	}
+	var expected interface{}
+	if buf, err := json.Marshal(value); err != nil {
+		e.errorf("encode JSON value error: %v", err)
+	} else if json.Unmarshal(buf, &expected); !reflect.DeepEqual(expected, val) {
+		e.errorf("expected JSON path %q: %#v, got %#v", path, expected, val)
+	}
+	return e
+}
+
+func lookupPath(data interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return data, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			val, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			data = val
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			data = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
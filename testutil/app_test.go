@@ -0,0 +1,96 @@
+package testutil
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+// mockT records the errors of Expectation.
+type mockT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *mockT) Helper() {}
+
+func (t *mockT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestTestApp(t *testing.T) {
+	ta := NewTestApp(newApp())
+	client := ta.Client()
+
+	t.Run("in-memory round trip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := client.Post("/json").JSON(map[string]interface{}{
+			"user":  map[string]interface{}{"name": "gear", "age": 5},
+			"items": []string{"a", "b"},
+		}).Do()
+		assert.Nil(err)
+		assert.Equal("/json", res.Request.URL.Path)
+
+		Expect(t, res).Status(200).
+			Header(gear.HeaderContentType, gear.MIMEApplicationJSONCharsetUTF8).
+			JSONPath("user.name", "gear").
+			JSONPath("user.age", 5).
+			JSONPath("items.1", "b").
+			JSONPath("items", []string{"a", "b"})
+
+		// cookie jar and redirects work with the in-memory client
+		res, err = client.Post("/login").Form(map[string][]string{"name": {"gear"}}).Do()
+		assert.Nil(err)
+		Expect(t, res).Status(200).JSONPath("session", "gear")
+		assert.Equal("gear", client.Cookie("session"))
+	})
+
+	t.Run("failed assertions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := ta.Client().MaxRedirects(0)
+		res, err := client.Post("/login").Form(map[string][]string{"name": {"gear"}}).Do()
+		assert.Nil(err)
+		mt := &mockT{}
+		Expect(mt, res).Status(200).Header("X-None", "x").Cookie("none", "x").JSONPath("a", 1)
+		assert.Equal([]string{
+			`expected status 200, got 303`,
+			`expected header X-None: "x", got ""`,
+			`expected cookie none, but not set`,
+			`decode JSON body error: unexpected end of JSON input`,
+		}, mt.errors)
+
+		res, _ = client.Post("/json").JSON(map[string]interface{}{"a": []int{1}}).Do()
+		mt = &mockT{}
+		Expect(mt, res).JSONPath("a.1", 1).JSONPath("a.x", 1).JSONPath("a.0.b", 1).
+			JSONPath("a.0", "1").JSONPath("a", make(chan int)).Body("{}")
+		assert.Equal([]string{
+			`expected JSON path "a.1", but not found`,
+			`expected JSON path "a.x", but not found`,
+			`expected JSON path "a.0.b", but not found`,
+			`expected JSON path "a.0": "1", got 1`,
+			`encode JSON value error: json: unsupported type: chan int`,
+			`expected body "{}", got "{\"a\":[1]}"`,
+		}, mt.errors)
+
+		res, _ = client.Post("/login").Form(map[string][]string{"name": {"gear"}}).Do()
+		mt = &mockT{}
+		Expect(mt, res).Cookie("session", "x")
+		assert.Equal([]string{`expected cookie session="x", got "gear"`}, mt.errors)
+	})
+
+	t.Run("NewContext", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ctx, rec := ta.NewContext(http.MethodPost, "/?name=gear", strings.NewReader("body"))
+		assert.Equal("gear", ctx.Query("name"))
+		assert.Nil(ctx.HTML(200, "hello"))
+		assert.Equal(200, rec.Code)
+		assert.Equal("hello", rec.Body.String())
+	})
+}
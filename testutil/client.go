@@ -0,0 +1,315 @@
+// Package testutil provides helpers to test Gear apps.
+//
+//  app := gear.New()
+//  app.Use(func(ctx *gear.Context) error {
+//  	return ctx.JSON(200, map[string]string{"name": ctx.Query("name")})
+//  })
+//  srv := app.Start()
+//  defer srv.Close()
+//
+//  client := testutil.NewClient("http://" + srv.Addr().String())
+//  res, err := client.Get("/").Query("name", "gear").Do()
+//  var user struct{ Name string }
+//  err = res.JSON(&user)
+//
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/teambition/gear"
+)
+
+// Client is a HTTP client for testing, it keeps the cookies in a cookie jar
+// and builds requests relative to the BaseURL.
+type Client struct {
+	*http.Client
+	// BaseURL is prefixed to the relative request URLs, such as "http://127.0.0.1:3000".
+	BaseURL string
+	// Header is added to every request.
+	Header http.Header
+}
+
+// NewClient creates a Client with a cookie jar, it follows at most 10 redirects.
+func NewClient(baseURL string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		Client:  &http.Client{Jar: jar},
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Header:  make(http.Header),
+	}
+}
+
+// MaxRedirects sets the maximum number of redirects to follow, 0 means not follow any redirect,
+// the redirect response will be returned.
+func (c *Client) MaxRedirects(n int) *Client {
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > n {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	return c
+}
+
+// Cookie returns the cookie value for the BaseURL from the cookie jar.
+func (c *Client) Cookie(name string) string {
+	if c.Jar == nil {
+		return ""
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	for _, cookie := range c.Jar.Cookies(u) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// SetCookie sets the cookie for the BaseURL to the cookie jar.
+func (c *Client) SetCookie(name, value string) {
+	if u, err := url.Parse(c.BaseURL); err == nil && c.Jar != nil {
+		c.Jar.SetCookies(u, []*http.Cookie{{Name: name, Value: value}})
+	}
+}
+
+// NewRequest creates a request builder with the method and the url.
+func (c *Client) NewRequest(method, urlStr string) *Request {
+	if !strings.Contains(urlStr, "://") {
+		urlStr = c.BaseURL + urlStr
+	}
+	r := &Request{client: c, method: method, header: make(http.Header), query: make(url.Values)}
+	r.url, r.err = url.Parse(urlStr)
+	for key, vals := range c.Header {
+		r.header[key] = append([]string(nil), vals...)
+	}
+	return r
+}
+
+// Get creates a GET request builder.
+func (c *Client) Get(urlStr string) *Request {
+	return c.NewRequest(http.MethodGet, urlStr)
+}
+
+// Head creates a HEAD request builder.
+func (c *Client) Head(urlStr string) *Request {
+	return c.NewRequest(http.MethodHead, urlStr)
+}
+
+// Post creates a POST request builder.
+func (c *Client) Post(urlStr string) *Request {
+	return c.NewRequest(http.MethodPost, urlStr)
+}
+
+// Put creates a PUT request builder.
+func (c *Client) Put(urlStr string) *Request {
+	return c.NewRequest(http.MethodPut, urlStr)
+}
+
+// Patch creates a PATCH request builder.
+func (c *Client) Patch(urlStr string) *Request {
+	return c.NewRequest(http.MethodPatch, urlStr)
+}
+
+// Delete creates a DELETE request builder.
+func (c *Client) Delete(urlStr string) *Request {
+	return c.NewRequest(http.MethodDelete, urlStr)
+}
+
+// Request is a request builder, the errors occurred when building are returned by Do.
+type Request struct {
+	client  *Client
+	method  string
+	url     *url.URL
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    io.Reader
+	err     error
+}
+
+// Header sets the request header.
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Query adds the query value to the request url.
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Cookie adds a cookie to the request, it is not saved to the cookie jar.
+func (r *Request) Cookie(name, value string) *Request {
+	r.cookies = append(r.cookies, &http.Cookie{Name: name, Value: value})
+	return r
+}
+
+// Body sets the request body with the content type.
+func (r *Request) Body(contentType string, body io.Reader) *Request {
+	r.header.Set(gear.HeaderContentType, contentType)
+	r.body = body
+	return r
+}
+
+// JSON sets the request body with the JSON encoding of v.
+func (r *Request) JSON(v interface{}) *Request {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+	}
+	return r.Body(gear.MIMEApplicationJSONCharsetUTF8, bytes.NewReader(buf))
+}
+
+// Form sets the request body with the url-encoded form.
+func (r *Request) Form(form url.Values) *Request {
+	return r.Body(gear.MIMEApplicationForm, strings.NewReader(form.Encode()))
+}
+
+// File is a file field of the multipart form.
+type File struct {
+	Field    string
+	Filename string
+	Content  io.Reader
+}
+
+// Multipart sets the request body with the multipart form of the fields and files.
+func (r *Request) Multipart(fields url.Values, files ...File) *Request {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for key, vals := range fields {
+		for _, val := range vals {
+			if err := w.WriteField(key, val); err != nil {
+				r.err = err
+			}
+		}
+	}
+	for _, file := range files {
+		fw, err := w.CreateFormFile(file.Field, file.Filename)
+		if err == nil {
+			_, err = io.Copy(fw, file.Content)
+		}
+		if err != nil {
+			r.err = err
+		}
+	}
+	if err := w.Close(); err != nil {
+		r.err = err
+	}
+	return r.Body(w.FormDataContentType(), &buf)
+}
+
+// Build builds the http.Request.
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	u := *r.url
+	if len(r.query) > 0 {
+		query := u.Query()
+		for key, vals := range r.query {
+			query[key] = append(query[key], vals...)
+		}
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest(r.method, u.String(), r.body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.header
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+	return req, nil
+}
+
+// Do sends the request and returns the Response.
+func (r *Request) Do() (*Response, error) {
+	req, err := r.Build()
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Response: res}, nil
+}
+
+// Response wraps the http.Response, the body is read and closed once by the helpers.
+type Response struct {
+	*http.Response
+	body []byte
+	read bool
+	err  error
+}
+
+// Bytes reads the response body and closes it.
+func (res *Response) Bytes() ([]byte, error) {
+	if !res.read {
+		res.read = true
+		res.body, res.err = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	return res.body, res.err
+}
+
+// Text returns the response body as string.
+func (res *Response) Text() (string, error) {
+	buf, err := res.Bytes()
+	return string(buf), err
+}
+
+// JSON decodes the JSON response body to v.
+func (res *Response) JSON(v interface{}) error {
+	buf, err := res.Bytes()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// XML decodes the XML response body to v.
+func (res *Response) XML(v interface{}) error {
+	buf, err := res.Bytes()
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(buf, v)
+}
+
+// Decode decodes the response body to v by the response content type, JSON and XML are supported.
+func (res *Response) Decode(v interface{}) error {
+	contentType := res.Header.Get(gear.HeaderContentType)
+	switch {
+	case strings.Contains(contentType, "json"):
+		return res.JSON(v)
+	case strings.Contains(contentType, "xml"):
+		return res.XML(v)
+	}
+	return fmt.Errorf("testutil: can't decode content type %q", contentType)
+}
+
+// Cookie returns the value of the cookie set by the response.
+func (res *Response) Cookie(name string) (string, bool) {
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == name {
+			return cookie.Value, true
+		}
+	}
+	return "", false
+}
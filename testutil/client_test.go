@@ -0,0 +1,158 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+type user struct {
+	Name string `json:"name" xml:"name"`
+	Age  int    `json:"age" xml:"age"`
+}
+
+func newApp() *gear.App {
+	router := gear.NewRouter()
+	router.Get("/echo", func(ctx *gear.Context) error {
+		cookie, _ := ctx.Req.Cookie("session")
+		val := ""
+		if cookie != nil {
+			val = cookie.Value
+		}
+		return ctx.JSON(200, map[string]interface{}{
+			"query":   ctx.Req.URL.Query(),
+			"header":  ctx.Get("X-Test"),
+			"global":  ctx.Get("X-Global"),
+			"session": val,
+		})
+	})
+	router.Post("/login", func(ctx *gear.Context) error {
+		http.SetCookie(ctx.Res, &http.Cookie{Name: "session", Value: ctx.Req.PostFormValue("name"), Path: "/"})
+		return ctx.Redirect("/echo")
+	})
+	router.Post("/json", func(ctx *gear.Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		ctx.Set("X-Content-Type", ctx.Get(gear.HeaderContentType))
+		return ctx.JSONBlob(200, body)
+	})
+	router.Post("/xml", func(ctx *gear.Context) error {
+		return ctx.XML(200, user{Name: "gear", Age: 5})
+	})
+	router.Post("/upload", func(ctx *gear.Context) error {
+		file, header, err := ctx.Req.FormFile("file")
+		if err != nil {
+			return err
+		}
+		buf, _ := ioutil.ReadAll(file)
+		return ctx.HTML(200, ctx.Req.FormValue("name")+" "+header.Filename+" "+string(buf))
+	})
+	app := gear.New()
+	app.UseHandler(router)
+	return app
+}
+
+func TestClient(t *testing.T) {
+	srv := newApp().Start()
+	defer srv.Close()
+
+	client := NewClient("http://" + srv.Addr().String() + "/")
+	client.Header.Set("X-Global", "global")
+
+	t.Run("query, header and cookie", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := client.Get("/echo?a=1").Query("a", "2").Query("b", "3").
+			Header("X-Test", "test").Cookie("session", "s1").Do()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+
+		var data struct {
+			Query   map[string][]string
+			Header  string
+			Global  string
+			Session string
+		}
+		assert.Nil(res.Decode(&data))
+		assert.Equal(map[string][]string{"a": {"1", "2"}, "b": {"3"}}, data.Query)
+		assert.Equal("test", data.Header)
+		assert.Equal("global", data.Global)
+		assert.Equal("s1", data.Session)
+		assert.Equal("", client.Cookie("session"))
+	})
+
+	t.Run("cookie jar and redirects", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client.MaxRedirects(0)
+		res, err := client.Post("/login").Form(url.Values{"name": {"gear"}}).Do()
+		assert.Nil(err)
+		assert.Equal(303, res.StatusCode)
+		assert.Equal("/echo", res.Header.Get(gear.HeaderLocation))
+		val, ok := res.Cookie("session")
+		assert.True(ok)
+		assert.Equal("gear", val)
+		_, ok = res.Cookie("none")
+		assert.False(ok)
+		assert.Equal("gear", client.Cookie("session"))
+
+		client.MaxRedirects(10)
+		client.SetCookie("session", "")
+		res, err = client.Post("/login").Form(url.Values{"name": {"gear2"}}).Do()
+		assert.Nil(err)
+		assert.Equal(200, res.StatusCode)
+		data := map[string]interface{}{}
+		assert.Nil(res.JSON(&data))
+		assert.Equal("gear2", data["session"])
+	})
+
+	t.Run("JSON and XML", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := client.Post("/json").JSON(user{Name: "gear", Age: 5}).Do()
+		assert.Nil(err)
+		assert.Equal(gear.MIMEApplicationJSONCharsetUTF8, res.Header.Get("X-Content-Type"))
+		u := &user{}
+		assert.Nil(res.Decode(u))
+		assert.Equal(user{Name: "gear", Age: 5}, *u)
+		text, err := res.Text()
+		assert.Nil(err)
+		assert.Equal(`{"name":"gear","age":5}`, text)
+
+		res, err = client.Post("/xml").Do()
+		assert.Nil(err)
+		u = &user{}
+		assert.Nil(res.Decode(u))
+		assert.Equal(user{Name: "gear", Age: 5}, *u)
+
+		_, err = client.Post("/json").JSON(make(chan int)).Do()
+		assert.NotNil(err)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		assert := assert.New(t)
+
+		res, err := client.Post("/upload").Multipart(url.Values{"name": {"gear"}},
+			File{Field: "file", Filename: "a.txt", Content: strings.NewReader("hello")}).Do()
+		assert.Nil(err)
+		text, _ := res.Text()
+		assert.Equal("gear a.txt hello", text)
+		assert.NotNil(res.Decode(&user{}))
+	})
+
+	t.Run("methods", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, r := range []*Request{client.Head("/"), client.Put("/"), client.Patch("/"), client.Delete("/")} {
+			res, err := r.Do()
+			assert.Nil(err)
+			assert.Equal(501, res.StatusCode)
+		}
+		_, err := client.Get("http://%zz").Do()
+		assert.NotNil(err)
+	})
+}
@@ -0,0 +1,144 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// TLSOptions is the options of TLSServer.
+type TLSOptions struct {
+	// ClientAuth defines the policy for TLS client authentication, default to tls.NoClientCert.
+	// The client certificates should be created by TLSServer.ClientCert.
+	ClientAuth tls.ClientAuthType
+	// DisableHTTP2 disables HTTP/2, default to false.
+	DisableHTTP2 bool
+}
+
+// TLSServer is a httptest.Server serving a Gear app on TLS with generated certificates.
+// The certificates are signed by a generated CA, the server certificate is valid for
+// "127.0.0.1", "::1", "localhost" and "example.com".
+//
+//  srv := testutil.NewTLSServer(app, testutil.TLSOptions{ClientAuth: tls.RequireAndVerifyClientCert})
+//  defer srv.Close()
+//
+//  res, err := srv.Client(srv.ClientCert("user")).Get("/").Do()
+//  // res.ProtoMajor == 2
+//  // ctx.Req.TLS.PeerCertificates[0].Subject.CommonName == "user" in the app
+//
+type TLSServer struct {
+	*httptest.Server
+	// CertPool contains the CA certificate.
+	CertPool *x509.CertPool
+	ca       *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	http2    bool
+}
+
+// NewTLSServer starts a TLSServer with the app, the server should be closed by Close.
+func NewTLSServer(app *gear.App, options ...TLSOptions) *TLSServer {
+	opts := TLSOptions{}
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	s := &TLSServer{CertPool: x509.NewCertPool(), http2: !opts.DisableHTTP2}
+	s.ca, s.caKey = mustCreateCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Gear Test CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	s.CertPool.AddCert(s.ca)
+
+	serverCert := s.createCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "Gear Test Server"},
+		DNSNames:    []string{"localhost", "example.com"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+
+	s.Server = httptest.NewUnstartedServer(app)
+	s.Server.EnableHTTP2 = s.http2
+	s.Server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   opts.ClientAuth,
+		ClientCAs:    s.CertPool,
+	}
+	s.Server.StartTLS()
+	return s
+}
+
+// ClientCert creates a client certificate signed by the CA for mTLS.
+func (s *TLSServer) ClientCert(commonName string) tls.Certificate {
+	return s.createCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// HTTPClient returns a http.Client that trusts the CA, with the client certificates.
+// HTTP/2 is used if it is not disabled.
+func (s *TLSServer) HTTPClient(certs ...tls.Certificate) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      s.CertPool,
+				Certificates: certs,
+			},
+			ForceAttemptHTTP2: s.http2,
+		},
+	}
+}
+
+// Client returns a Client that requests to the server, see HTTPClient.
+func (s *TLSServer) Client(certs ...tls.Certificate) *Client {
+	c := NewClient(s.URL)
+	c.Transport = s.HTTPClient(certs...).Transport
+	return c
+}
+
+func (s *TLSServer) createCert(template *x509.Certificate) tls.Certificate {
+	cert, key := mustCreateCert(template, s.ca, s.caKey)
+	return tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}
+}
+
+var serialNumber int64
+
+func mustCreateCert(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano() + atomic.AddInt64(&serialNumber, 1))
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return cert, key
+}
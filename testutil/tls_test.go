@@ -0,0 +1,73 @@
+package testutil
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+func newTLSApp() *gear.App {
+	app := gear.New()
+	app.Use(func(ctx *gear.Context) error {
+		http.SetCookie(ctx.Res, &http.Cookie{Name: "secure", Value: "1", Secure: true, Path: "/"})
+		user := ""
+		if ctx.Req.TLS != nil && len(ctx.Req.TLS.PeerCertificates) > 0 {
+			user = ctx.Req.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		return ctx.JSON(200, map[string]interface{}{
+			"proto": ctx.Req.Proto,
+			"user":  user,
+		})
+	})
+	return app
+}
+
+func TestTLSServer(t *testing.T) {
+	t.Run("HTTP/2", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := NewTLSServer(newTLSApp())
+		defer srv.Close()
+
+		client := srv.Client()
+		res, err := client.Get("/").Do()
+		assert.Nil(err)
+		assert.Equal(2, res.ProtoMajor)
+		Expect(t, res).Status(200).JSONPath("proto", "HTTP/2.0").JSONPath("user", "").Cookie("secure", "1")
+		assert.Equal("1", client.Cookie("secure"))
+
+		_, err = (&http.Client{}).Get(srv.URL)
+		assert.NotNil(err)
+	})
+
+	t.Run("HTTP/1.1", func(t *testing.T) {
+		srv := NewTLSServer(newTLSApp(), TLSOptions{DisableHTTP2: true})
+		defer srv.Close()
+
+		res, err := srv.Client().Get("/").Do()
+		assert.Nil(t, err)
+		Expect(t, res).Status(200).JSONPath("proto", "HTTP/1.1")
+	})
+
+	t.Run("mTLS", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := NewTLSServer(newTLSApp(), TLSOptions{ClientAuth: tls.RequireAndVerifyClientCert})
+		defer srv.Close()
+
+		res, err := srv.Client(srv.ClientCert("gear")).Get("/").Do()
+		assert.Nil(err)
+		Expect(t, res).Status(200).JSONPath("user", "gear")
+
+		_, err = srv.Client().Get("/").Do()
+		assert.NotNil(err)
+
+		other := NewTLSServer(newTLSApp())
+		defer other.Close()
+		_, err = srv.Client(other.ClientCert("gear")).Get("/").Do()
+		assert.NotNil(err)
+	})
+}
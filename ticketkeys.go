@@ -0,0 +1,130 @@
+package gear
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+// TicketKeySource provides the TLS session ticket keys, such as from a KMS or a secret store.
+// The servers sharing the same source can resume the sessions of each other.
+type TicketKeySource interface {
+	TicketKey() ([32]byte, error)
+}
+
+// TicketKeySourceFunc is an adapter to use a function as TicketKeySource.
+type TicketKeySourceFunc func() ([32]byte, error)
+
+// TicketKey implemented TicketKeySource interface.
+func (fn TicketKeySourceFunc) TicketKey() ([32]byte, error) {
+	return fn()
+}
+
+// RandomTicketKeys is a TicketKeySource that generates random keys.
+var RandomTicketKeys TicketKeySource = TicketKeySourceFunc(func() (key [32]byte, err error) {
+	_, err = rand.Read(key[:])
+	return
+})
+
+// TicketKeyOptions is the options of RotateTicketKeys.
+type TicketKeyOptions struct {
+	// Source defines the source of the new keys, default to RandomTicketKeys.
+	Source TicketKeySource
+	// Interval defines the rotation interval, default to 24 hours.
+	Interval time.Duration
+	// Overlap defines the number of the previous keys to keep, the tickets encrypted with them
+	// can still be resumed. Default to 0, only the current key.
+	Overlap int
+	// OnError is called when failed to get the new key on schedule, the current keys are kept.
+	OnError func(err error)
+}
+
+// TicketKeyRotator rotates the TLS session ticket keys of a tls.Config on schedule.
+type TicketKeyRotator struct {
+	opts    TicketKeyOptions
+	keys    *tls.Config // holds the keys to encrypt and decrypt the tickets
+	mu      sync.Mutex
+	current [][32]byte
+	done    chan struct{}
+	once    sync.Once
+}
+
+// RotateTicketKeys makes the config encrypt the session tickets with the keys from the source,
+// and rotates the keys on schedule. The newest key encrypts the new tickets, the previous keys
+// (up to Overlap) only decrypt the old tickets. It returns error if failed to get the first key.
+// The config may be cloned by http.Server, the clones use the rotated keys too.
+//
+//  app.Server.TLSConfig = &tls.Config{}
+//  rotator, err := gear.RotateTicketKeys(app.Server.TLSConfig, gear.TicketKeyOptions{
+//  	Interval: 12 * time.Hour,
+//  	Overlap:  1,
+//  })
+//  if err != nil {
+//  	panic(err)
+//  }
+//  defer rotator.Stop()
+//  app.Error(app.ListenTLS(":443", "cert.pem", "key.pem"))
+//
+func RotateTicketKeys(config *tls.Config, opts TicketKeyOptions) (*TicketKeyRotator, error) {
+	if opts.Source == nil {
+		opts.Source = RandomTicketKeys
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 24 * time.Hour
+	}
+	if opts.Overlap < 0 {
+		opts.Overlap = 0
+	}
+
+	r := &TicketKeyRotator{opts: opts, keys: &tls.Config{}, done: make(chan struct{})}
+	if err := r.Rotate(); err != nil {
+		return nil, err
+	}
+	config.WrapSession = func(cs tls.ConnectionState, ss *tls.SessionState) ([]byte, error) {
+		return r.keys.EncryptTicket(cs, ss)
+	}
+	config.UnwrapSession = func(identity []byte, cs tls.ConnectionState) (*tls.SessionState, error) {
+		return r.keys.DecryptTicket(identity, cs)
+	}
+	go r.loop()
+	return r, nil
+}
+
+// Rotate gets a new key from the source and rotates the keys immediately.
+func (r *TicketKeyRotator) Rotate() error {
+	key, err := r.opts.Source.TicketKey()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := append([][32]byte{key}, r.current...)
+	if len(keys) > r.opts.Overlap+1 {
+		keys = keys[:r.opts.Overlap+1]
+	}
+	r.current = keys
+	r.keys.SetSessionTicketKeys(keys)
+	return nil
+}
+
+// Stop stops the scheduled rotation, the current keys are still used.
+func (r *TicketKeyRotator) Stop() {
+	r.once.Do(func() { close(r.done) })
+}
+
+func (r *TicketKeyRotator) loop() {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if err := r.Rotate(); err != nil && r.opts.OnError != nil {
+				r.opts.OnError(err)
+			}
+		}
+	}
+}
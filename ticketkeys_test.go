@@ -0,0 +1,124 @@
+package gear
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearRotateTicketKeys(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("./testdata/cert.pem", "./testdata/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Should rotate the keys with overlap", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var mu sync.Mutex
+		n := byte(0)
+		config := &tls.Config{Certificates: []tls.Certificate{cert}}
+		rotator, err := RotateTicketKeys(config, TicketKeyOptions{
+			Source: TicketKeySourceFunc(func() (key [32]byte, err error) {
+				mu.Lock()
+				n++
+				key[0] = n
+				mu.Unlock()
+				return
+			}),
+			Overlap: 1,
+		})
+		assert.Nil(err)
+		defer rotator.Stop()
+
+		// http.Server clones the config
+		l, err := tls.Listen("tcp", "127.0.0.1:0", config.Clone())
+		assert.Nil(err)
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.Write([]byte("OK"))
+				conn.Close()
+			}
+		}()
+
+		clientConfig := &tls.Config{
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(8),
+		}
+		resumed := func() bool {
+			conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+			assert.Nil(err)
+			defer conn.Close()
+			body, _ := ioutil.ReadAll(conn) // receive the session ticket
+			assert.Equal("OK", string(body))
+			return conn.ConnectionState().DidResume
+		}
+
+		assert.False(resumed())
+		assert.True(resumed())
+
+		assert.Nil(rotator.Rotate())
+		assert.True(resumed()) // the previous key is kept
+
+		assert.Nil(rotator.Rotate())
+		assert.Nil(rotator.Rotate())
+		assert.False(resumed())
+		assert.True(resumed())
+		assert.Equal(2, len(rotator.current))
+		assert.Equal(byte(4), rotator.current[0][0])
+	})
+
+	t.Run("Should handle the source error", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := RotateTicketKeys(&tls.Config{}, TicketKeyOptions{
+			Source: TicketKeySourceFunc(func() ([32]byte, error) {
+				return [32]byte{}, errors.New("kms error")
+			}),
+		})
+		assert.Equal("kms error", err.Error())
+
+		var mu sync.Mutex
+		fail := false
+		errCh := make(chan error, 1)
+		rotator, err := RotateTicketKeys(&tls.Config{}, TicketKeyOptions{
+			Source: TicketKeySourceFunc(func() (key [32]byte, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if fail {
+					err = errors.New("kms error")
+				}
+				return
+			}),
+			Interval: 10 * time.Millisecond,
+			OnError: func(err error) {
+				select {
+				case errCh <- err:
+				default:
+				}
+			},
+		})
+		assert.Nil(err)
+		mu.Lock()
+		fail = true
+		mu.Unlock()
+		assert.Equal("kms error", (<-errCh).Error())
+		rotator.Stop()
+		rotator.Stop()
+
+		rotator, err = RotateTicketKeys(&tls.Config{}, TicketKeyOptions{})
+		assert.Nil(err)
+		rotator.Stop()
+		assert.Equal(24*time.Hour, rotator.opts.Interval)
+	})
+}
@@ -0,0 +1,86 @@
+package gear
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverTiming is a metric of the Server-Timing header.
+type serverTiming struct {
+	name string
+	dur  time.Duration
+	desc string
+}
+
+func (st serverTiming) String() string {
+	s := st.name
+	if st.dur >= 0 {
+		s += ";dur=" + strconv.FormatFloat(float64(st.dur.Round(time.Microsecond))/1e6, 'f', -1, 64)
+	}
+	if st.desc != "" {
+		s += ";desc=" + strconv.Quote(st.desc)
+	}
+	return s
+}
+
+// ServerTiming adds a metric to the Server-Timing header, it will be sent when the response
+// header is written, so browser devtools can show the backend breakdowns.
+// The name should be a token (such as "db", "cache.hit"), otherwise it will be ignored.
+// The dur will be omitted if it is negative, and the desc is optional.
+// It is safe for concurrent use, but the metrics added after the header written will be ignored.
+// See https://www.w3.org/TR/server-timing/ .
+//
+//  start := time.Now()
+//  user, err := db.FindUser(id)
+//  ctx.ServerTiming("db", time.Since(start), "Find user")
+//
+func (ctx *Context) ServerTiming(name string, dur time.Duration, desc string) {
+	if !isMethodToken(name) {
+		return
+	}
+	ctx.mu.Lock()
+	ctx.timings = append(ctx.timings, serverTiming{name, dur, desc})
+	ctx.mu.Unlock()
+}
+
+func (ctx *Context) serverTimingHeader() string {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if len(ctx.timings) == 0 {
+		return ""
+	}
+	metrics := make([]string, len(ctx.timings))
+	for i, st := range ctx.timings {
+		metrics[i] = st.String()
+	}
+	return strings.Join(metrics, ", ")
+}
+
+// Timed wraps a middleware to record its duration by ctx.ServerTiming with the name.
+// The duration contains the time of the middlewares composed in it. If the middleware
+// responds, the duration is recorded in an "after hook" before the header written.
+//
+//  app.Use(gear.Timed("auth", authMiddleware))
+//  router.Get("/users/:id", gear.Timed("handler", getUser))
+//
+func Timed(name string, md Middleware) Middleware {
+	return func(ctx *Context) error {
+		start := time.Now()
+		recorded := false
+		record := func() {
+			if !recorded {
+				recorded = true
+				ctx.ServerTiming(name, time.Since(start), "")
+			}
+		}
+		if !ctx.ended.isTrue() { // "after hook" can't be added after the ctx ended
+			ctx.After(record)
+		}
+		err := md(ctx)
+		if !ctx.Res.HeaderWrote() {
+			record()
+		}
+		return err
+	}
+}
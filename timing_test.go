@@ -0,0 +1,96 @@
+package gear
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearServerTiming(t *testing.T) {
+	t.Run("serverTiming.String", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("db", serverTiming{"db", -1, ""}.String())
+		assert.Equal("db;dur=0", serverTiming{"db", 0, ""}.String())
+		assert.Equal("db;dur=53.2", serverTiming{"db", 53200 * time.Microsecond, ""}.String())
+		assert.Equal("db;dur=1.235", serverTiming{"db", 1234567 * time.Nanosecond, ""}.String())
+		assert.Equal(`cache;desc="Cache \"hit\""`, serverTiming{"cache", -1, `Cache "hit"`}.String())
+		assert.Equal(`app;dur=1000;desc="Total"`, serverTiming{"app", time.Second, "Total"}.String())
+	})
+
+	t.Run("ctx.ServerTiming", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			ctx.ServerTiming("db", 10*time.Millisecond, "Database")
+			ctx.ServerTiming("bad name", time.Millisecond, "")
+			ctx.ServerTiming("", time.Millisecond, "")
+
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ctx.ServerTiming("task", time.Millisecond, "")
+				}()
+			}
+			wg.Wait()
+			ctx.After(func() {
+				ctx.ServerTiming("after", -1, "")
+			})
+			ctx.OnEnd(func() {
+				ctx.ServerTiming("ignored", time.Millisecond, "")
+			})
+			return ctx.End(http.StatusOK, []byte("OK"))
+		})
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/foo", nil))
+		assert.Equal(200, rec.Code)
+		assert.Equal(`db;dur=10;desc="Database", task;dur=1, task;dur=1, task;dur=1, after`,
+			rec.Header().Get(HeaderServerTiming))
+
+		app = New()
+		app.Use(func(ctx *Context) error {
+			return ctx.End(http.StatusOK, []byte("OK"))
+		})
+		rec = httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/foo", nil))
+		assert.Equal(200, rec.Code)
+		assert.Equal(0, len(rec.Header()[HeaderServerTiming]))
+	})
+
+	t.Run("Timed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(Timed("auth", func(ctx *Context) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		}))
+		app.Use(Timed("handler", func(ctx *Context) error {
+			return ctx.End(http.StatusOK, []byte("OK"))
+		}))
+
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/foo", nil))
+		assert.Equal(200, rec.Code)
+		ctx := CtxTest(app, "GET", "http://example.com/foo", nil)
+		assert.Equal("", ctx.serverTimingHeader())
+
+		header := rec.Header().Get(HeaderServerTiming)
+		assert.Regexp(`^auth;dur=\d+(\.\d+)?, handler;dur=\d+(\.\d+)?$`, header)
+
+		ctx = CtxTest(app, "GET", "http://example.com/foo", nil)
+		ctx.Cancel()
+		assert.NotPanics(func() {
+			assert.Nil(Timed("late", func(ctx *Context) error { return nil })(ctx))
+		})
+		assert.Regexp(`^late;dur=\d+(\.\d+)?$`, ctx.serverTimingHeader())
+	})
+}
@@ -0,0 +1,76 @@
+package gear
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+)
+
+// setupTLS applies app settings SetCertificates and SetKeyLogWriter to app.Server.TLSConfig.
+func (app *App) setupTLS() error {
+	keyLog := app.keyLog
+	if keyLog == nil && app.Env() == "development" {
+		if file := os.Getenv("SSLKEYLOGFILE"); file != "" {
+			f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return err
+			}
+			keyLog = f
+		}
+	}
+	if app.certs == nil && keyLog == nil {
+		return nil
+	}
+
+	if app.Server.TLSConfig == nil {
+		app.Server.TLSConfig = &tls.Config{}
+	}
+	if app.certs != nil {
+		app.Server.TLSConfig.GetCertificate = app.certs.GetCertificate
+	}
+	if keyLog != nil {
+		app.logger.Println("Gear: TLS key log is enabled, the TLS traffic can be decrypted")
+		app.Server.TLSConfig.KeyLogWriter = keyLog
+	}
+	return nil
+}
+
+// TLSInfo is the TLS connection state of the request, returned by ctx.TLS.
+type TLSInfo struct {
+	// Version is the TLS version name, such as "TLS 1.3".
+	Version string
+	// CipherSuite is the cipher suite name, such as "TLS_AES_128_GCM_SHA256".
+	CipherSuite string
+	// Protocol is the application protocol negotiated by ALPN, such as "h2", may be empty.
+	Protocol string
+	// ServerName is the server name (SNI) requested by the client, may be empty.
+	ServerName string
+	// PeerCertificates are the certificates sent by the client, the first one is the leaf certificate.
+	PeerCertificates []*x509.Certificate
+	// Resumed reports whether the connection resumed a previous TLS session.
+	Resumed bool
+	// State is the underlying tls.ConnectionState.
+	State *tls.ConnectionState
+}
+
+// TLS returns the TLS connection state of the request, or nil if the request is not over TLS.
+//
+//  if info := ctx.TLS(); info != nil && len(info.PeerCertificates) > 0 {
+//  	ctx.SetAny("client", info.PeerCertificates[0].Subject.CommonName)
+//  }
+//
+func (ctx *Context) TLS() *TLSInfo {
+	cs := ctx.Req.TLS
+	if cs == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:          tls.VersionName(cs.Version),
+		CipherSuite:      tls.CipherSuiteName(cs.CipherSuite),
+		Protocol:         cs.NegotiatedProtocol,
+		ServerName:       cs.ServerName,
+		PeerCertificates: cs.PeerCertificates,
+		Resumed:          cs.DidResume,
+		State:            cs,
+	}
+}
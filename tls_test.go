@@ -0,0 +1,139 @@
+package gear
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type syncWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *syncWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestGearAppKeyLogWriter(t *testing.T) {
+	t.Run("Should log the TLS secrets", func(t *testing.T) {
+		assert := assert.New(t)
+
+		w := &syncWriter{}
+		app := New()
+		assert.Panics(func() {
+			app.Set(SetKeyLogWriter, "keys.log")
+		})
+		app.Set(SetKeyLogWriter, w)
+		app.Use(func(ctx *Context) error {
+			return ctx.HTML(200, "OK")
+		})
+		go app.ListenTLS("127.0.0.1:3446", "./testdata/cert.pem", "./testdata/key.pem")
+		defer app.Close()
+
+		var conn *tls.Conn
+		var err error
+		for i := 0; i < 50; i++ {
+			if conn, err = tls.Dial("tcp", "127.0.0.1:3446", &tls.Config{InsecureSkipVerify: true}); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Nil(err)
+		conn.Close()
+		assert.True(strings.Contains(w.String(), "CLIENT_HANDSHAKE_TRAFFIC_SECRET "))
+	})
+
+	t.Run("Should use SSLKEYLOGFILE in development", func(t *testing.T) {
+		assert := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "gear-tls")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "keys.log")
+		os.Setenv("SSLKEYLOGFILE", file)
+		defer os.Unsetenv("SSLKEYLOGFILE")
+
+		app := New()
+		app.Set(SetEnv, "production")
+		assert.Nil(app.setupTLS())
+		assert.Nil(app.Server.TLSConfig)
+
+		app.Set(SetEnv, "development")
+		assert.Nil(app.setupTLS())
+		assert.NotNil(app.Server.TLSConfig.KeyLogWriter)
+		_, err = os.Stat(file)
+		assert.Nil(err)
+
+		os.Setenv("SSLKEYLOGFILE", filepath.Join(dir, "none", "keys.log"))
+		app = New()
+		app.Set(SetEnv, "development")
+		assert.NotNil(app.ListenTLS("127.0.0.1:3447", "", ""))
+	})
+}
+
+func TestGearContextTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := CtxTest(New(), "GET", "http://example.com/foo", nil)
+	assert.Nil(ctx.TLS())
+
+	clientCert := newTestCert("client")
+
+	app := New()
+	app.Server.TLSConfig = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	app.Use(func(ctx *Context) error {
+		info := ctx.TLS()
+		return ctx.JSON(200, map[string]interface{}{
+			"version":    info.Version,
+			"cipher":     info.CipherSuite,
+			"protocol":   info.Protocol,
+			"serverName": info.ServerName,
+			"peer":       info.PeerCertificates[0].Subject.CommonName,
+			"resumed":    info.Resumed,
+			"state":      info.State == ctx.Req.TLS,
+		})
+	})
+	go app.ListenTLS("127.0.0.1:3448", "./testdata/cert.pem", "./testdata/key.pem")
+	defer app.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		ForceAttemptHTTP2: true,
+		TLSClientConfig: &tls.Config{
+			ServerName:         "example.com",
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{*clientCert},
+			MaxVersion:         tls.VersionTLS12,
+			CipherSuites:       []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+	}}
+	var res *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if res, err = client.Get("https://127.0.0.1:3448"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(err)
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(`{"cipher":"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256","peer":"client","protocol":"h2","resumed":false,"serverName":"example.com","state":true,"version":"TLS 1.2"}`, string(body))
+}
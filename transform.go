@@ -0,0 +1,134 @@
+package gear
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ErrHeaderWrote is returned from ctx.Transform when the response header has been written.
+var ErrHeaderWrote = NewAppError("response header has been written")
+
+// BodyTransformer is used by ctx.Transform to rewrite the response body before it is sent.
+type BodyTransformer func(body []byte) ([]byte, error)
+
+// http.ResponseWriter wrapper, it buffers the header and body, and transforms the body
+// when the response finished. It will be a pass-through writer if the body is larger
+// than the limit or the response is flushed.
+type transformWriter struct {
+	res       *Response
+	rw        http.ResponseWriter // underlying http.ResponseWriter
+	fn        BodyTransformer
+	maxBytes  int
+	status    int
+	buf       []byte
+	streaming bool
+}
+
+func (tw *transformWriter) Header() http.Header {
+	return tw.rw.Header()
+}
+
+func (tw *transformWriter) WriteHeader(code int) {
+	if tw.streaming {
+		tw.rw.WriteHeader(code)
+		return
+	}
+	tw.status = code
+}
+
+func (tw *transformWriter) Write(b []byte) (int, error) {
+	if !tw.streaming {
+		if len(tw.buf)+len(b) <= tw.maxBytes {
+			tw.buf = append(tw.buf, b...)
+			return len(b), nil
+		}
+		if err := tw.stream(); err != nil {
+			return 0, err
+		}
+	}
+	return tw.rw.Write(b)
+}
+
+// ReadFrom passes through the io.ReaderFrom of the underlying writer if streaming.
+func (tw *transformWriter) ReadFrom(src io.Reader) (int64, error) {
+	if tw.streaming {
+		if rf, ok := tw.rw.(io.ReaderFrom); ok {
+			return rf.ReadFrom(src)
+		}
+	}
+	return io.Copy(writerOnly{tw}, src)
+}
+
+// stream gives up the transformation, it writes the buffered header and body
+// to the underlying writer, and passes through the later writes.
+func (tw *transformWriter) stream() (err error) {
+	if tw.streaming {
+		return
+	}
+	tw.streaming = true
+	if tw.status > 0 {
+		tw.rw.WriteHeader(tw.status)
+	}
+	if len(tw.buf) > 0 {
+		_, err = tw.rw.Write(tw.buf)
+		tw.buf = nil
+	}
+	return
+}
+
+// Close transforms the buffered body and writes it to the underlying writer.
+func (tw *transformWriter) Close() (err error) {
+	if tw.streaming || tw.status == 0 {
+		return
+	}
+	tw.streaming = true
+	body := tw.buf
+	tw.buf = nil
+	if tw.res.ctx.Method != http.MethodHead && !isEmptyStatus(tw.status) {
+		if b, e := tw.fn(body); e != nil {
+			tw.res.ctx.app.Error(e) // respond the origin body
+		} else {
+			body = b
+		}
+		tw.res.bodyLength = len(body)
+		if !tw.res.hasTrailer() {
+			tw.res.Set(HeaderContentLength, strconv.Itoa(len(body)))
+		}
+	}
+	tw.rw.WriteHeader(tw.status)
+	if len(body) > 0 {
+		_, err = tw.rw.Write(body)
+	}
+	return
+}
+
+// Transform registers a BodyTransformer to rewrite the response body before it is sent,
+// such as HTML minification, link rewriting or injection of debug toolbars.
+// The response header and body will be buffered until the app served the request, and then
+// the transformed body will be sent with a new Content-Length header. If the body larger than
+// maxBytes, or the response is flushed by ctx.Res.Flush, the buffered content will be sent
+// as it is, and the later writes will be passed through without transformation, so the stream
+// response is not blocked. The origin body will be sent if the transformer returns an error.
+// Multiple transformers run in LIFO order. Responses of HEAD request and 204, 205, 304 status
+// will not be transformed. It returns ErrHeaderWrote if the response header has been written.
+// Compression (app setting SetCompress) will be applied after transformation.
+//
+//  app.Use(func(ctx *gear.Context) error {
+//  	return ctx.Transform(1<<20, func(body []byte) ([]byte, error) {
+//  		if !strings.HasPrefix(ctx.Res.Get(gear.HeaderContentType), gear.MIMETextHTML) {
+//  			return body, nil
+//  		}
+//  		return bytes.Replace(body, []byte("</body>"), toolbar, 1), nil
+//  	})
+//  })
+//
+func (ctx *Context) Transform(maxBytes int, fn BodyTransformer) error {
+	if ctx.Res.wroteHeader.isTrue() {
+		return ErrHeaderWrote
+	}
+	tw := &transformWriter{res: ctx.Res, rw: ctx.Res.rw, fn: fn, maxBytes: maxBytes}
+	ctx.Res.rw = tw
+	ctx.Res.transforms = append(ctx.Res.transforms, tw)
+	return nil
+}
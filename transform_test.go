@@ -0,0 +1,187 @@
+package gear
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearContextTransform(t *testing.T) {
+	upper := func(body []byte) ([]byte, error) {
+		return bytes.ToUpper(body), nil
+	}
+	serve := func(app *App, method string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://example.com/foo", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("should transform body", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			return ctx.Transform(1024, func(body []byte) ([]byte, error) {
+				return bytes.Replace(body, []byte("</body>"), []byte("<script></script></body>"), 1), nil
+			})
+		})
+		app.Use(func(ctx *Context) error {
+			ctx.After(func() {
+				ctx.Set("X-After", "ok")
+			})
+			return ctx.HTML(http.StatusCreated, "<body>Hello</body>")
+		})
+
+		rec := serve(app, "GET")
+		assert.Equal(http.StatusCreated, rec.Code)
+		assert.Equal("ok", rec.Header().Get("X-After"))
+		assert.Equal("<body>Hello<script></script></body>", rec.Body.String())
+		assert.Equal("35", rec.Header().Get(HeaderContentLength))
+
+		rec = serve(app, "HEAD")
+		assert.Equal(http.StatusCreated, rec.Code)
+		assert.Equal("18", rec.Header().Get(HeaderContentLength))
+	})
+
+	t.Run("should run in LIFO order", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			ctx.Transform(1024, func(body []byte) ([]byte, error) {
+				return append(body, " first"...), nil
+			})
+			return ctx.Transform(1024, upper)
+		})
+		app.Use(func(ctx *Context) error {
+			return ctx.End(http.StatusOK, []byte("hello"))
+		})
+
+		rec := serve(app, "GET")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("HELLO first", rec.Body.String())
+		assert.Equal("11", rec.Header().Get(HeaderContentLength))
+	})
+
+	t.Run("should work with compress", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Set(SetCompress, &DefaultCompress{})
+		app.Use(func(ctx *Context) error {
+			return ctx.Transform(1<<20, func(body []byte) ([]byte, error) {
+				return bytes.Repeat(body, 1000), nil
+			})
+		})
+		app.Use(func(ctx *Context) error {
+			return ctx.HTML(http.StatusOK, "hello")
+		})
+
+		rec := serve(app, "GET", HeaderAcceptEncoding, "gzip")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("gzip", rec.Header().Get(HeaderContentEncoding))
+		assert.Equal("", rec.Header().Get(HeaderContentLength))
+		assert.True(rec.Body.Len() < 5000)
+	})
+
+	t.Run("should pass through when body too large", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			return ctx.Transform(10, upper)
+		})
+		app.Use(func(ctx *Context) error {
+			ctx.Type(MIMETextPlainCharsetUTF8)
+			ctx.Res.WriteHeader(http.StatusOK)
+			ctx.Res.Write([]byte("hello"))
+			ctx.Res.Write([]byte(" world"))
+			ctx.Res.Write([]byte("!"))
+			return nil
+		})
+
+		rec := serve(app, "GET")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("hello world!", rec.Body.String())
+	})
+
+	t.Run("should pass through when flushed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			ctx.Transform(1024, upper)
+			return ctx.Transform(1024, upper)
+		})
+		app.Use(func(ctx *Context) error {
+			ctx.Type(MIMETextPlainCharsetUTF8)
+			ctx.Res.WriteHeader(http.StatusOK)
+			ctx.Res.Write([]byte("hello"))
+			ctx.Res.Flush()
+			ctx.Res.Write([]byte(" world"))
+			return nil
+		})
+
+		rec := serve(app, "GET")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.True(rec.Flushed)
+		assert.Equal("hello world", rec.Body.String())
+	})
+
+	t.Run("should respond origin body when transformer error", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		app := New()
+		app.logger.SetOutput(&buf)
+		app.Use(func(ctx *Context) error {
+			return ctx.Transform(1024, func(body []byte) ([]byte, error) {
+				return nil, errors.New("some transform error")
+			})
+		})
+		app.Use(func(ctx *Context) error {
+			return ctx.End(http.StatusOK, []byte("hello"))
+		})
+
+		rec := serve(app, "GET")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("hello", rec.Body.String())
+		assert.True(strings.Contains(buf.String(), "some transform error"))
+	})
+
+	t.Run("should not transform empty status", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		app.Use(func(ctx *Context) error {
+			return ctx.Transform(1024, func(body []byte) ([]byte, error) {
+				return []byte("should not be sent"), nil
+			})
+		})
+		app.Use(func(ctx *Context) error {
+			return ctx.End(http.StatusNoContent)
+		})
+
+		rec := serve(app, "GET")
+		assert.Equal(http.StatusNoContent, rec.Code)
+		assert.Equal("", rec.Body.String())
+	})
+
+	t.Run("should return error when header wrote", func(t *testing.T) {
+		assert := assert.New(t)
+
+		app := New()
+		ctx := CtxTest(app, "GET", "http://example.com/foo", nil)
+		ctx.Res.WriteHeader(http.StatusOK)
+		assert.Equal(ErrHeaderWrote, ctx.Transform(1024, upper))
+	})
+}
@@ -0,0 +1,436 @@
+// Package webhook delivers the outbound webhooks from a gear app.
+//
+// The payloads are signed with HMAC-SHA256 by the secrets of the endpoint, all the secrets sign
+// the payload during a key rotation, so the receivers can verify it with the old or the new one.
+// Every endpoint has its own queue, the deliveries to an endpoint are sent in order and retried
+// with exponential backoff, a slow or down endpoint doesn't delay the others:
+//
+//  d := webhook.New(webhook.Options{
+//  	OnDelivery: func(dl webhook.Delivery) {
+//  		if dl.Status == webhook.StatusFailed {
+//  			logger.Err(dl.Err)
+//  		}
+//  	},
+//  })
+//  d.AddEndpoint(webhook.Endpoint{ID: "acme", URL: "https://acme.com/hooks", Secrets: []string{"new", "old"}})
+//
+//  router.Post("/orders", func(ctx *gear.Context) error {
+//  	// ... create the order
+//  	if _, err := d.Send("acme", "order.created", order); err != nil {
+//  		return err
+//  	}
+//  	return ctx.JSON(201, order)
+//  })
+//
+//  // drain the queues on shutdown
+//  ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//  defer cancel()
+//  d.Close(ctx)
+//
+// The receivers verify the "Webhook-Signature" header by Verify.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teambition/gear"
+)
+
+// The headers of the webhook requests.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// Errors returned by Dispatcher and Verify.
+var (
+	ErrClosed           = errors.New("webhook: dispatcher closed")
+	ErrQueueFull        = errors.New("webhook: queue full")
+	ErrUnknownEndpoint  = errors.New("webhook: unknown endpoint")
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+)
+
+// Status is the status of a Delivery.
+type Status int
+
+// Delivery statuses
+const (
+	// StatusDelivered means the endpoint responded 2xx.
+	StatusDelivered Status = iota + 1
+	// StatusRetrying means the attempt failed and the delivery will be retried.
+	StatusRetrying
+	// StatusFailed means the delivery failed permanently, because the endpoint responded 4xx
+	// (except 408 and 429), the attempts ran out, or the dispatcher closed.
+	StatusFailed
+)
+
+// String returns the status name.
+func (s Status) String() string {
+	switch s {
+	case StatusDelivered:
+		return "delivered"
+	case StatusRetrying:
+		return "retrying"
+	case StatusFailed:
+		return "failed"
+	}
+	return "pending"
+}
+
+// Endpoint is a webhook receiver.
+type Endpoint struct {
+	// ID identifies the endpoint, it is required.
+	ID string
+	// URL defines the URL to POST the payloads, it is required.
+	URL string
+	// Secrets defines the keys to sign the payloads, at least one is required. Add the new key
+	// to the front to rotate the keys, and remove the old one after the receiver updated.
+	Secrets []string
+}
+
+// Delivery is the state of a webhook delivery, it is reported by Options.OnDelivery after
+// every attempt.
+type Delivery struct {
+	ID         string
+	Endpoint   string
+	Event      string
+	Body       []byte
+	Attempts   int
+	Status     Status
+	StatusCode int   // the response status of the last attempt, 0 if no response
+	Err        error // the error of the last attempt
+}
+
+// Options is the options of Dispatcher.
+type Options struct {
+	// Client defines the http.Client to send the webhooks, default to a client with 10 seconds timeout.
+	Client *http.Client
+	// MaxAttempts defines the maximum attempts of a delivery, default to 5.
+	MaxAttempts int
+	// MinBackoff defines the wait before the first retry, it is doubled for every retry,
+	// default to 1 second.
+	MinBackoff time.Duration
+	// MaxBackoff defines the maximum wait between the retries, default to 5 minutes.
+	MaxBackoff time.Duration
+	// QueueSize defines the maximum pending deliveries of an endpoint, Send returns ErrQueueFull
+	// when it is full. Default to 1000.
+	QueueSize int
+	// OnDelivery is called after every attempt of the deliveries, optional.
+	OnDelivery func(d Delivery)
+}
+
+// Dispatcher delivers the webhooks to the endpoints, it is safe for concurrent use.
+type Dispatcher struct {
+	opts    Options
+	mu      sync.Mutex
+	queues  map[string]*queue
+	closed  bool
+	wg      sync.WaitGroup
+	abort   context.Context
+	aborted context.CancelFunc
+}
+
+type queue struct {
+	endpoint Endpoint
+	ch       chan *Delivery
+}
+
+// New creates a Dispatcher with the options.
+func New(opts Options) *Dispatcher {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	d := &Dispatcher{opts: opts, queues: make(map[string]*queue)}
+	d.abort, d.aborted = context.WithCancel(context.Background())
+	return d
+}
+
+// AddEndpoint adds the endpoint and starts its queue, the endpoint with the same ID is replaced,
+// the pending deliveries of the old one are still sent to the old URL.
+func (d *Dispatcher) AddEndpoint(e Endpoint) error {
+	if e.ID == "" || e.URL == "" || len(e.Secrets) == 0 {
+		return fmt.Errorf("webhook: invalid endpoint %q", e.ID)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	if q := d.queues[e.ID]; q != nil {
+		close(q.ch)
+	}
+	q := &queue{endpoint: e, ch: make(chan *Delivery, d.opts.QueueSize)}
+	d.queues[e.ID] = q
+	d.wg.Add(1)
+	go d.work(q)
+	return nil
+}
+
+// RemoveEndpoint removes the endpoint, its pending deliveries are still sent.
+func (d *Dispatcher) RemoveEndpoint(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	if q := d.queues[id]; q != nil {
+		close(q.ch)
+		delete(d.queues, id)
+	}
+}
+
+// Send queues the event with the payload to the endpoint, and returns the delivery ID.
+// The payload is encoded to JSON, it is sent as is if it is []byte or json.RawMessage.
+func (d *Dispatcher) Send(endpoint, event string, payload interface{}) (string, error) {
+	var body []byte
+	switch v := payload.(type) {
+	case []byte:
+		body = v
+	case json.RawMessage:
+		body = v
+	default:
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return "", err
+		}
+	}
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	dl := &Delivery{ID: id, Endpoint: endpoint, Event: event, Body: body}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return "", ErrClosed
+	}
+	q := d.queues[endpoint]
+	if q == nil {
+		return "", ErrUnknownEndpoint
+	}
+	select {
+	case q.ch <- dl:
+		return dl.ID, nil
+	default:
+		return "", ErrQueueFull
+	}
+}
+
+// Close stops accepting the deliveries and waits for the pending ones to be sent. If the ctx is
+// done before that, the in-flight requests and the retries are aborted, the rest deliveries are
+// reported as StatusFailed with ErrClosed, and the ctx's error is returned.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, q := range d.queues {
+			close(q.ch)
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		d.aborted()
+		return nil
+	case <-ctx.Done():
+		d.aborted()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) work(q *queue) {
+	defer d.wg.Done()
+	for dl := range q.ch {
+		d.deliver(q.endpoint, dl)
+	}
+}
+
+// deliver sends the delivery until it is delivered or failed permanently.
+func (d *Dispatcher) deliver(e Endpoint, dl *Delivery) {
+	for {
+		if d.abort.Err() != nil {
+			dl.Status, dl.Err = StatusFailed, ErrClosed
+			d.report(dl)
+			return
+		}
+		dl.Attempts++
+		retry := d.attempt(e, dl)
+		switch {
+		case dl.Status == StatusDelivered:
+		case d.abort.Err() != nil:
+			dl.Status, dl.Err = StatusFailed, ErrClosed
+		case retry && dl.Attempts < d.opts.MaxAttempts:
+			dl.Status = StatusRetrying
+		default:
+			dl.Status = StatusFailed
+		}
+		d.report(dl)
+		if dl.Status != StatusRetrying {
+			return
+		}
+
+		timer := time.NewTimer(d.backoff(dl.Attempts))
+		select {
+		case <-timer.C:
+		case <-d.abort.Done():
+			timer.Stop()
+		}
+	}
+}
+
+// attempt sends the delivery once, it returns whether the failure is retryable.
+func (d *Dispatcher) attempt(e Endpoint, dl *Delivery) bool {
+	dl.StatusCode, dl.Err = 0, nil
+	req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(dl.Body))
+	if err != nil {
+		dl.Err = err
+		return false
+	}
+	req = req.WithContext(d.abort)
+	req.Header.Set(gear.HeaderContentType, gear.MIMEApplicationJSONCharsetUTF8)
+	req.Header.Set(gear.HeaderUserAgent, "gear-webhook")
+	req.Header.Set(HeaderID, dl.ID)
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderSignature, Sign(time.Now(), dl.Body, e.Secrets...))
+
+	res, err := d.opts.Client.Do(req)
+	if err != nil {
+		dl.Err = err
+		return true
+	}
+	res.Body.Close()
+	dl.StatusCode = res.StatusCode
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		dl.Status = StatusDelivered
+		return false
+	}
+	dl.Err = fmt.Errorf("webhook: endpoint %q responded %d", e.ID, res.StatusCode)
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusRequestTimeout ||
+		res.StatusCode == http.StatusTooManyRequests
+}
+
+func (d *Dispatcher) report(dl *Delivery) {
+	if d.opts.OnDelivery != nil {
+		d.opts.OnDelivery(*dl)
+	}
+}
+
+// backoff returns the wait before the next attempt, it is doubled for every retry with
+// a random jitter up to 1/4.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.opts.MaxBackoff
+	if attempts < 32 && d.opts.MinBackoff<<uint(attempts-1) < wait {
+		wait = d.opts.MinBackoff << uint(attempts-1)
+	}
+	return wait + time.Duration(mrand.Int63n(int64(wait/4)+1))
+}
+
+// Sign returns the signature header value of the body at time t signed by the secrets:
+//
+//  t=1700000000,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd,v1=...
+//
+// Every "v1" is the hex encoded HMAC-SHA256 of "{t}.{body}" with a secret.
+func Sign(t time.Time, body []byte, secrets ...string) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	buf := make([]byte, 0, len(ts)+3+len(secrets)*68)
+	buf = append(buf, "t="...)
+	buf = append(buf, ts...)
+	for _, secret := range secrets {
+		buf = append(buf, ",v1="...)
+		buf = append(buf, hex.EncodeToString(sign(secret, ts, body))...)
+	}
+	return string(buf)
+}
+
+// Verify verifies the signature header value of the webhook request body with the secrets,
+// it returns ErrInvalidSignature if no signature matched, or the timestamp is older or newer
+// than the tolerance from now (0 means no check).
+//
+//  body, _ := ioutil.ReadAll(ctx.Req.Body)
+//  if err := webhook.Verify(ctx.Get(webhook.HeaderSignature), body, 5*time.Minute, secret); err != nil {
+//  	return &gear.Error{Code: http.StatusUnauthorized, Msg: err.Error()}
+//  }
+//
+func Verify(header string, body []byte, tolerance time.Duration, secrets ...string) error {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			ts = part[2:]
+		case strings.HasPrefix(part, "v1="):
+			if sig, err := hex.DecodeString(part[3:]); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+	for _, secret := range secrets {
+		expected := sign(secret, ts, body)
+		for _, sig := range sigs {
+			if hmac.Equal(sig, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func sign(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/teambition/gear"
+)
+
+type receiver struct {
+	*gear.ServerListener
+	mu     sync.Mutex
+	bodies []string
+	events []string
+}
+
+func (r *receiver) URL() string {
+	return "http://" + r.Addr().String()
+}
+
+func newReceiver(handle func(ctx *gear.Context, body []byte) error) *receiver {
+	r := &receiver{}
+	app := gear.New()
+	app.Use(func(ctx *gear.Context) error {
+		body, _ := ioutil.ReadAll(ctx.Req.Body)
+		if err := Verify(ctx.Get(HeaderSignature), body, time.Minute, "secret"); err != nil {
+			return ctx.ErrorStatus(401)
+		}
+		if handle != nil {
+			if err := handle(ctx, body); err != nil {
+				return err
+			}
+		}
+		r.mu.Lock()
+		r.bodies = append(r.bodies, string(body))
+		r.events = append(r.events, ctx.Get(HeaderEvent))
+		r.mu.Unlock()
+		return ctx.End(204)
+	})
+	r.ServerListener = app.Start()
+	return r
+}
+
+type recorder struct {
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+func (r *recorder) record(d Delivery) {
+	r.mu.Lock()
+	r.deliveries = append(r.deliveries, d)
+	r.mu.Unlock()
+}
+
+func (r *recorder) statuses() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]Status, len(r.deliveries))
+	for i, d := range r.deliveries {
+		res[i] = d.Status
+	}
+	return res
+}
+
+func TestWebhookSign(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	body := []byte(`{"id":1}`)
+	header := Sign(now, body, "new", "old")
+	assert.Nil(Verify(header, body, time.Minute, "old"))
+	assert.Nil(Verify(header, body, time.Minute, "new"))
+	assert.Nil(Verify(header, body, 0, "other", "new"))
+	assert.Equal(ErrInvalidSignature, Verify(header, body, time.Minute, "other"))
+	assert.Equal(ErrInvalidSignature, Verify(header, []byte(`{"id":2}`), time.Minute, "new"))
+	assert.Equal(ErrInvalidSignature, Verify(Sign(now.Add(-time.Hour), body, "new"), body, time.Minute, "new"))
+	assert.Nil(Verify(Sign(now.Add(-time.Hour), body, "new"), body, 0, "new"))
+	assert.Equal(ErrInvalidSignature, Verify(Sign(now.Add(time.Hour), body, "new"), body, time.Minute, "new"))
+	assert.Nil(Verify(Sign(now.Add(30*time.Second), body, "new"), body, time.Minute, "new"))
+	assert.Equal(ErrInvalidSignature, Verify("", body, 0, "new"))
+	assert.Equal(ErrInvalidSignature, Verify("t=abc,v1=00", body, 0, "new"))
+	assert.Equal("delivered", StatusDelivered.String())
+	assert.Equal("pending", Status(0).String())
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	t.Run("should deliver in order", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := newReceiver(nil)
+		defer r.Close()
+		rec := &recorder{}
+		d := New(Options{OnDelivery: rec.record})
+
+		_, err := d.Send("acme", "order.created", 1)
+		assert.Equal(ErrUnknownEndpoint, err)
+		assert.NotNil(d.AddEndpoint(Endpoint{ID: "acme", URL: r.URL()}))
+		assert.Nil(d.AddEndpoint(Endpoint{ID: "acme", URL: r.URL(), Secrets: []string{"secret"}}))
+
+		for i := 0; i < 5; i++ {
+			id, err := d.Send("acme", "order.created", map[string]int{"id": i})
+			assert.Nil(err)
+			assert.Equal(32, len(id))
+		}
+		_, err = d.Send("acme", "order.raw", []byte(`{"raw":true}`))
+		assert.Nil(err)
+		_, err = d.Send("acme", "order.created", func() {})
+		assert.NotNil(err)
+
+		assert.Nil(d.Close(context.Background()))
+		_, err = d.Send("acme", "order.created", 1)
+		assert.Equal(ErrClosed, err)
+		assert.Equal(ErrClosed, d.AddEndpoint(Endpoint{ID: "x", URL: r.URL(), Secrets: []string{"secret"}}))
+		d.RemoveEndpoint("acme")
+
+		assert.Equal([]string{`{"id":0}`, `{"id":1}`, `{"id":2}`, `{"id":3}`, `{"id":4}`, `{"raw":true}`}, r.bodies)
+		assert.Equal("order.raw", r.events[5])
+		assert.Equal([]Status{StatusDelivered, StatusDelivered, StatusDelivered, StatusDelivered,
+			StatusDelivered, StatusDelivered}, rec.statuses())
+		assert.Equal(204, rec.deliveries[0].StatusCode)
+		assert.Equal(1, rec.deliveries[0].Attempts)
+	})
+
+	t.Run("should retry with backoff", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var count int32
+		r := newReceiver(func(ctx *gear.Context, body []byte) error {
+			if atomic.AddInt32(&count, 1) < 3 {
+				return ctx.ErrorStatus(503)
+			}
+			return nil
+		})
+		defer r.Close()
+		rec := &recorder{}
+		d := New(Options{OnDelivery: rec.record, MinBackoff: 10 * time.Millisecond})
+		assert.Nil(d.AddEndpoint(Endpoint{ID: "acme", URL: r.URL(), Secrets: []string{"secret"}}))
+		_, err := d.Send("acme", "order.created", 1)
+		assert.Nil(err)
+		assert.Nil(d.Close(context.Background()))
+
+		assert.Equal([]Status{StatusRetrying, StatusRetrying, StatusDelivered}, rec.statuses())
+		assert.Equal(503, rec.deliveries[0].StatusCode)
+		assert.NotNil(rec.deliveries[0].Err)
+		assert.Equal(3, rec.deliveries[2].Attempts)
+		assert.Nil(rec.deliveries[2].Err)
+	})
+
+	t.Run("should fail permanently", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := newReceiver(func(ctx *gear.Context, body []byte) error {
+			if string(body) == "1" {
+				return ctx.ErrorStatus(400)
+			}
+			return ctx.ErrorStatus(500)
+		})
+		defer r.Close()
+		rec := &recorder{}
+		d := New(Options{OnDelivery: rec.record, MinBackoff: time.Millisecond, MaxAttempts: 2})
+		assert.Nil(d.AddEndpoint(Endpoint{ID: "acme", URL: r.URL(), Secrets: []string{"secret"}}))
+		assert.Nil(d.AddEndpoint(Endpoint{ID: "other", URL: r.URL(), Secrets: []string{"other"}}))
+		assert.Nil(d.AddEndpoint(Endpoint{ID: "bad", URL: "://bad", Secrets: []string{"secret"}}))
+		d.Send("acme", "order.created", 1)
+		d.Send("acme", "order.created", 2)
+		d.Send("other", "order.created", 3)
+		d.Send("bad", "order.created", 4)
+		d.Close(context.Background())
+
+		statuses := rec.statuses()
+		assert.Equal(5, len(statuses))
+		failed := 0
+		for _, dl := range rec.deliveries {
+			if dl.Status == StatusFailed {
+				failed++
+			}
+		}
+		assert.Equal(4, failed)
+	})
+
+	t.Run("should drain on close", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := newReceiver(func(ctx *gear.Context, body []byte) error {
+			time.Sleep(50 * time.Millisecond)
+			return ctx.ErrorStatus(503)
+		})
+		defer r.Close()
+		rec := &recorder{}
+		d := New(Options{OnDelivery: rec.record, MinBackoff: time.Second, QueueSize: 2})
+		assert.Nil(d.AddEndpoint(Endpoint{ID: "acme", URL: r.URL(), Secrets: []string{"secret"}}))
+		d.Send("acme", "order.created", 1)
+		time.Sleep(10 * time.Millisecond)
+		d.Send("acme", "order.created", 2)
+		d.Send("acme", "order.created", 3)
+		_, err := d.Send("acme", "order.created", 4)
+		assert.Equal(ErrQueueFull, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		assert.Equal(context.DeadlineExceeded, d.Close(ctx))
+		assert.True(time.Since(start) < time.Second)
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		last := rec.deliveries[len(rec.deliveries)-1]
+		assert.Equal(StatusFailed, last.Status)
+		assert.Equal(ErrClosed, last.Err)
+		for _, dl := range rec.deliveries[len(rec.deliveries)-3:] {
+			assert.Equal(StatusFailed, dl.Status)
+		}
+	})
+}